@@ -0,0 +1,87 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tiff
+
+import (
+	"fmt"
+	"io"
+)
+
+// atWriter adapts an io.WriterAt to an io.Writer that writes sequentially
+// from off.
+type atWriter struct {
+	w   io.WriterAt
+	off int64
+}
+
+func (aw *atWriter) Write(p []byte) (int, error) {
+	n, err := aw.w.WriteAt(p, aw.off)
+	aw.off += int64(n)
+	return n, err
+}
+
+// AppendPages appends every page (IFD in the main IFD chain) of the TIFF found
+// in src to the end of the multi-page TIFF t, which must have been parsed from
+// rw.  The new IFDs and everything they reference are written past the
+// current end of the file, after which the NextOffset of the last IFD of t is
+// patched to point to them.  That single pointer is the only existing byte of
+// the file that is changed, so nothing else needs to be rewritten no matter
+// how large the file has grown.  Wrap the file with OpenJournaled to be able
+// to undo an interrupted append.
+//
+// src must have the same byte order as t.  A BigTIFF src may only be appended
+// to a BigTIFF.  Once AppendPages returns, t no longer reflects the contents of
+// the file and should be parsed again.
+func AppendPages(rw ReadWriteAtSeeker, t TIFF, src ReadAtReadSeeker) error {
+	pt, err := Parse(src, nil, nil)
+	if err != nil {
+		return err
+	}
+	if pt.R().ByteOrder() != t.R().ByteOrder() {
+		return fmt.Errorf("tiff: append: pages are %v, but the file is %v", pt.R().ByteOrder(), t.R().ByteOrder())
+	}
+	big := t.OffsetSize() == 8
+	if pt.OffsetSize() == 8 && !big {
+		return fmt.Errorf("tiff: append: pages with 64 bit offsets cannot be added to a file with 32 bit offsets")
+	}
+	ifds := t.IFDs()
+	if len(ifds) == 0 {
+		return fmt.Errorf("tiff: append: the file has no IFDs")
+	}
+	pages, err := planTIFF(pt, nil)
+	if err != nil {
+		return err
+	}
+
+	end, err := rw.Seek(0, io.SeekEnd)
+	if err != nil {
+		return fmt.Errorf("tiff: unable to locate the end of the file: %v", err)
+	}
+	padding, err := dicomAppend(rw, end)
+	if err != nil {
+		return err
+	}
+	base := even(uint64(end))
+	tw, err := newTIFFWriter(&atWriter{rw, int64(base)}, t.R().ByteOrder(), big, base, pages)
+	if err != nil {
+		return err
+	}
+	if err = tw.writeBody(pages); err != nil {
+		return err
+	}
+	if err = padding.grow(rw, int64(tw.written)); err != nil {
+		return err
+	}
+
+	// Point the last existing IFD to the first new one.
+	last := len(ifds) - 1
+	ptrPos := ifdOffset(t, last) + tw.countSize() + uint64(ifds[last].NumEntries())*tw.entrySize()
+	ptr := make([]byte, tw.offsetSize())
+	tw.putOffset(ptr, pages[0].offset)
+	if _, err = rw.WriteAt(ptr, int64(ptrPos)); err != nil {
+		return fmt.Errorf("tiff: append: unable to update the offset to the new pages: %v", err)
+	}
+	return nil
+}
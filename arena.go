@@ -0,0 +1,75 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tiff
+
+// minArenaBlock is the number of values in the first block of an OffsetArena.
+const minArenaBlock = 1024
+
+// An OffsetArena holds the memory that arrays of offsets and byte counts are
+// decoded into, so that a program going through the pages of files with
+// millions of strips or tiles reuses the same memory for each page rather than
+// allocating it anew.  The slices it hands out stay valid until Reset is
+// called, after which they are reused.  A nil *OffsetArena allocates each
+// slice on its own.  An OffsetArena is not safe for concurrent use.
+type OffsetArena struct {
+	block []uint64 // where values are handed out from
+	used  int      // values of block handed out
+	// spare holds blocks that filled up, for Reset to reuse.
+	spare [][]uint64
+}
+
+// NewOffsetArena returns an OffsetArena holding room for n values to start
+// with.  The zero value is also ready to use.
+func NewOffsetArena(n int) *OffsetArena {
+	return &OffsetArena{block: make([]uint64, n)}
+}
+
+// Reset makes the memory of every slice handed out by a available again.  The
+// largest block of memory is kept; the others are dropped, so that an arena
+// sized by its first uses settles on a single block.
+func (a *OffsetArena) Reset() {
+	for _, b := range a.spare {
+		if len(b) > len(a.block) {
+			a.block = b
+		}
+	}
+	a.spare, a.used = nil, 0
+}
+
+// alloc returns a slice of n values from a.
+func (a *OffsetArena) alloc(n int) []uint64 {
+	if a == nil {
+		return make([]uint64, n)
+	}
+	if n > len(a.block)-a.used {
+		if a.block != nil {
+			a.spare = append(a.spare, a.block)
+		}
+		size := 2 * len(a.block)
+		if size < minArenaBlock {
+			size = minArenaBlock
+		}
+		if size < n {
+			size = n
+		}
+		a.block, a.used = make([]uint64, size), 0
+	}
+	s := a.block[a.used : a.used+n : a.used+n]
+	a.used += n
+	return s
+}
+
+// Uints returns the values of f, which must have an unsigned integer type
+// (such as SHORT, LONG, or LONG8), decoded into memory from a.  It suits the
+// fields that hold offsets and byte counts, such as StripOffsets and
+// TileByteCounts.
+func (a *OffsetArena) Uints(f Field) ([]uint64, error) {
+	if err := checkUints(f); err != nil {
+		return nil, err
+	}
+	vals := a.alloc(int(f.Count()))
+	decodeUints(f, vals)
+	return vals, nil
+}
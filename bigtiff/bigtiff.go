@@ -62,7 +62,7 @@ func ParseBigTIFF(ordr [2]byte, vers uint16, br tiff.BReader, tsp tiff.TagSpace,
 	var restOfHdr [12]byte
 
 	if _, err = io.ReadFull(br, restOfHdr[:]); err != nil {
-		return nil, fmt.Errorf("bigtiff: unable to read the rest of the header: %v", err)
+		return nil, tiff.ReadError(err, "the rest of the header", tiff.ErrorContext{Offset: 4, IFD: -1})
 	}
 
 	offsetSize := br.ByteOrder().Uint16(restOfHdr[:2])
@@ -75,15 +75,25 @@ func ParseBigTIFF(ordr [2]byte, vers uint16, br tiff.BReader, tsp tiff.TagSpace,
 	firstOffset := br.ByteOrder().Uint64(restOfHdr[4:])
 	// Check the offset to the first IFD (ensure it is past the end of the header)
 	if firstOffset < 16 {
-		return nil, fmt.Errorf("bigtiff: invalid offset to first IFD, %d < 16", firstOffset)
+		return nil, tiff.ErrOffsetOutOfBounds{ErrorContext: tiff.ErrorContext{Offset: firstOffset, IFD: -1}, What: "the first ifd", Err: fmt.Errorf("%d < 16", firstOffset)}
 	}
 
 	t := &BigTIFF{ordr: ordr, vers: vers, offsetSize: offsetSize, firstOff: firstOffset, r: br}
 
 	// Locate and decode IFDs
+	cc := tiff.NewChainChecker(8)
 	for nextOffset := firstOffset; nextOffset != 0; {
+		if err = tiff.CheckContext(br); err != nil {
+			return nil, err
+		}
+		if err = cc.Visit(nextOffset); err != nil {
+			return nil, err
+		}
 		var ifd tiff.IFD
 		if ifd, err = ParseIFD(br, nextOffset, tsp, ftsp); err != nil {
+			return nil, tiff.WithIFDIndex(err, len(t.ifds))
+		}
+		if err = cc.Add(ifd, nextOffset); err != nil {
 			return nil, err
 		}
 		t.ifds = append(t.ifds, ifd)
@@ -94,4 +104,5 @@ func ParseBigTIFF(ordr [2]byte, vers uint16, br tiff.BReader, tsp tiff.TagSpace,
 
 func init() {
 	tiff.RegisterVersion(Version, ParseBigTIFF)
+	tiff.RegisterIFDParser(Version, ParseIFD)
 }
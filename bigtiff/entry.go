@@ -5,8 +5,10 @@
 package bigtiff
 
 import (
+	"encoding/binary"
 	"encoding/json"
 	"fmt"
+	"io"
 
 	"github.com/google/tiff"
 )
@@ -77,19 +79,119 @@ func (e *entry) MarshalJSON() ([]byte, error) {
 	return json.Marshal(tmp)
 }
 
+// UnmarshalJSON reads an entry in the form written by MarshalJSON.
+func (e *entry) UnmarshalJSON(data []byte) error {
+	var tmp struct {
+		Tag         uint16  `json:"tagID"`
+		Type        uint16  `json:"typeID"`
+		Count       uint64  `json:"count"`
+		ValueOffset [8]byte `json:"valueOffset"`
+	}
+	if err := json.Unmarshal(data, &tmp); err != nil {
+		return err
+	}
+	e.tagID, e.typeID, e.count, e.valueOffset = tmp.Tag, tmp.Type, tmp.Count, tmp.ValueOffset
+	return nil
+}
+
 func ParseEntry(br tiff.BReader) (out Entry, err error) {
 	e := new(entry)
+	pos, _ := br.Seek(0, io.SeekCurrent)
 	if err = br.BRead(&e.tagID); err != nil {
-		return
+		return nil, tiff.ReadError(err, "an ifd entry", tiff.ErrorContext{Offset: uint64(pos), IFD: -1})
 	}
-	if err = br.BRead(&e.typeID); err != nil {
-		return
+	ctx := tiff.ErrorContext{Offset: uint64(pos), TagID: e.tagID, IFD: -1}
+	for _, v := range []interface{}{&e.typeID, &e.count, &e.valueOffset} {
+		if err = br.BRead(v); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, tiff.ReadError(err, "an ifd entry", ctx)
+		}
 	}
-	if err = br.BRead(&e.count); err != nil {
-		return
+	return e, nil
+}
+
+func (e *entry) Count64() uint64 {
+	return e.count
+}
+
+func (e *entry) RawValueOffset() []byte {
+	return e.valueOffset[:]
+}
+
+func (e *entry) ValueOffset64(bo binary.ByteOrder) uint64 {
+	return bo.Uint64(e.valueOffset[:])
+}
+
+func (e *entry) IsBig() bool {
+	return true
+}
+
+// NewGenericEntry returns e as a tiff.GenericEntry.
+func NewGenericEntry(e Entry) tiff.GenericEntry {
+	if ge, ok := e.(tiff.GenericEntry); ok {
+		return ge
 	}
-	if err = br.BRead(&e.valueOffset); err != nil {
-		return
+	return &entry{tagID: e.TagID(), typeID: e.TypeID(), count: e.Count(), valueOffset: e.ValueOffset()}
+}
+
+// BigEntry returns ge as an Entry of a BigTIFF.  The value offset of a classic
+// entry is widened using bo, the byte order of the file.
+func BigEntry(ge tiff.GenericEntry, bo binary.ByteOrder) Entry {
+	if e, ok := ge.(Entry); ok && ge.IsBig() {
+		return e
 	}
-	return e, nil
+	e := &entry{tagID: ge.TagID(), typeID: ge.TypeID(), count: ge.Count64()}
+	raw := ge.RawValueOffset()
+	if !ge.IsBig() && tiff.DefaultFieldTypeSpace.GetFieldType(ge.TypeID()).Size()*ge.Count64() > 4 {
+		bo.PutUint64(e.valueOffset[:], ge.ValueOffset64(bo))
+		return e
+	}
+	copy(e.valueOffset[:], raw)
+	return e
+}
+
+// EntrySize is the size in bytes of an IFD entry as stored in a BigTIFF file.
+const EntrySize = 20
+
+// An OrderedEntry is an Entry along with the byte order of its file, which is
+// needed to convert it to and from the 20 bytes it is stored as.  The value
+// offset is kept as raw bytes, so it is not affected by the byte order.
+type OrderedEntry struct {
+	Entry
+	Order binary.ByteOrder
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+func (oe OrderedEntry) MarshalBinary() ([]byte, error) {
+	if oe.Entry == nil || oe.Order == nil {
+		return nil, fmt.Errorf("bigtiff: entry or byte order missing")
+	}
+	b := make([]byte, EntrySize)
+	oe.Order.PutUint16(b[0:], oe.TagID())
+	oe.Order.PutUint16(b[2:], oe.TypeID())
+	oe.Order.PutUint64(b[4:], oe.Count())
+	vo := oe.ValueOffset()
+	copy(b[12:], vo[:])
+	return b, nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.  Order must be set
+// beforehand; Entry is replaced by the entry held by data.
+func (oe *OrderedEntry) UnmarshalBinary(data []byte) error {
+	if oe.Order == nil {
+		return fmt.Errorf("bigtiff: byte order missing")
+	}
+	if len(data) != EntrySize {
+		return fmt.Errorf("bigtiff: an entry is %d bytes, not %d", EntrySize, len(data))
+	}
+	e := &entry{
+		tagID:  oe.Order.Uint16(data[0:]),
+		typeID: oe.Order.Uint16(data[2:]),
+		count:  oe.Order.Uint64(data[4:]),
+	}
+	copy(e.valueOffset[:], data[12:])
+	oe.Entry = e
+	return nil
 }
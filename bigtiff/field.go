@@ -8,6 +8,7 @@ import (
 	"encoding/binary"
 	"encoding/json"
 	"fmt"
+	"math"
 	"reflect"
 	"sync"
 
@@ -106,6 +107,11 @@ func (f *field) Value() tiff.FieldValue {
 	return f.value
 }
 
+// GenericEntry returns the entry of f.  See tiff.EntryOf.
+func (f *field) GenericEntry() tiff.GenericEntry {
+	return NewGenericEntry(f.entry)
+}
+
 func (f *field) String() string {
 	var (
 		theTSP  = f.tsp
@@ -199,19 +205,31 @@ func ParseField(br tiff.BReader, tsp tiff.TagSpace, ftsp tiff.FieldTypeSpace) (o
 	if tsp == nil {
 		tsp = tiff.DefaultTagSpace
 	}
-	f := &field{ftsp: ftsp, tsp: tsp}
+	f := &field{ftsp: tiff.FieldTypeSpaceOf(br, ftsp), tsp: tsp}
 	if f.entry, err = ParseEntry(br); err != nil {
 		return
 	}
 	fv := &fieldValue{order: br.ByteOrder()}
+	if size := f.Type().Size(); size > 0 && f.Count() > math.MaxInt64/size {
+		return nil, fmt.Errorf("bigtiff: value of tag %d is too large (%d values of %d bytes)", f.Tag().ID(), f.Count(), size)
+	}
 	valSize := int64(f.Count()) * int64(f.Type().Size())
 	valOffBytes := f.entry.ValueOffset()
 	if valSize > 8 {
-		fv.value = make([]byte, valSize)
 		offset := int64(br.ByteOrder().Uint64(valOffBytes[:])) // Hope this does not go negative
-		if err = br.BReadSection(&fv.value, offset, valSize); err != nil {
+		if err = tiff.CheckValueSize(br, tiff.ErrorContext{Offset: uint64(offset), TagID: f.Tag().ID(), IFD: -1}, f.Count(), f.Type()); err != nil {
 			return
 		}
+		if err = tiff.ChargeValue(br, uint64(offset), uint64(valSize)); err != nil {
+			return
+		}
+		if dv, ok := tiff.DeferredValue(br, f.entry.TagID(), offset, valSize); ok {
+			f.value = dv
+			return f, nil
+		}
+		if fv.value, err = tiff.ReadValue(br, offset, valSize); err != nil {
+			return nil, tiff.ReadError(err, "the values of a field", tiff.ErrorContext{Offset: uint64(offset), TagID: f.Tag().ID(), IFD: -1})
+		}
 	} else {
 		fv.value = valOffBytes[:]
 	}
@@ -18,6 +18,21 @@ type imageFileDirectory struct {
 	fields     []tiff.Field
 	nextOffset uint64
 	fieldMap   map[uint16]tiff.Field
+	offset     uint64
+}
+
+// Offset returns the offset of ifd in the file it was parsed from.
+func (ifd *imageFileDirectory) Offset() uint64 {
+	return ifd.offset
+}
+
+// Entries returns the entries of ifd in the order they are stored.
+func (ifd *imageFileDirectory) Entries() []tiff.GenericEntry {
+	entries := make([]tiff.GenericEntry, len(ifd.fields))
+	for i, f := range ifd.fields {
+		entries[i] = tiff.EntryOf(f)
+	}
+	return entries
 }
 
 func (ifd *imageFileDirectory) NumEntries() uint64 {
@@ -32,6 +47,11 @@ func (ifd *imageFileDirectory) NextOffset() uint64 {
 	return ifd.nextOffset
 }
 
+// Kind returns the IFDKind of ifd (see tiff.KindOf).
+func (ifd *imageFileDirectory) Kind() tiff.IFDKind {
+	return tiff.KindOf(ifd)
+}
+
 func (ifd *imageFileDirectory) HasField(tagID uint16) bool {
 	_, ok := ifd.fieldMap[tagID]
 	return ok
@@ -72,10 +92,14 @@ func ParseIFD(br tiff.BReader, offset uint64, tsp tiff.TagSpace, ftsp tiff.Field
 	}
 	ifd := &imageFileDirectory{
 		fieldMap: make(map[uint16]tiff.Field, 1),
+		offset:   offset,
 	}
 	br.Seek(int64(offset), 0)
 	if err = br.BRead(&ifd.numEntries); err != nil {
-		err = fmt.Errorf("bigtiff: unable to read the number of entries for the IFD at offset %#08x: %v", offset, err)
+		err = tiff.ReadError(err, "the number of entries of an ifd", tiff.ErrorContext{Offset: offset, IFD: -1})
+		return
+	}
+	if err = tiff.ChargeIFD(br, offset, ifd.numEntries); err != nil {
 		return
 	}
 	for i := uint64(0); i < ifd.numEntries; i++ {
@@ -87,7 +111,7 @@ func ParseIFD(br tiff.BReader, offset uint64, tsp tiff.TagSpace, ftsp tiff.Field
 		ifd.fieldMap[f.Tag().ID()] = f
 	}
 	if err = br.BRead(&ifd.nextOffset); err != nil {
-		err = fmt.Errorf("bigtiff: unable to read the offset for the next ifd: %v", err)
+		err = tiff.ReadError(err, "the offset to the next ifd", tiff.ErrorContext{Offset: offset + 8 + 20*ifd.numEntries, IFD: -1})
 		return
 	}
 	return ifd, nil
@@ -0,0 +1,181 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tiff
+
+import (
+	"fmt"
+	"sort"
+)
+
+// ErrIFDCycle is returned when the chain of IFDs in a file loops back to an
+// IFD it has already visited.  Following such a chain would never end.
+type ErrIFDCycle struct {
+	// Index is the position in the chain of the IFD whose next IFD offset
+	// (or the header, if Index is -1) points back into the chain.
+	Index int
+	// Offset is the offset it points to.
+	Offset uint64
+	// First is the position in the chain of the IFD found at Offset.
+	First int
+}
+
+func (e ErrIFDCycle) Error() string {
+	from := "the header"
+	if e.Index >= 0 {
+		from = fmt.Sprintf("IFD %d", e.Index)
+	}
+	return fmt.Sprintf("tiff: ifd chain loops: %s points back to IFD %d at offset %d", from, e.First, e.Offset)
+}
+
+// A ChainChecker guards the parsing of a chain of IFDs against corrupt or
+// malicious files.  It rejects any IFD that has already been visited, so that
+// a chain checked this way always ends.  It also keeps a map of the bytes used
+// by the header and by the IFDs parsed so far (their entries and their
+// out-of-line values) and records every IFD that shares bytes with the header
+// or with another IFD (see Overlaps).  Such files are still read, as other
+// readers do; ParseWithOptions reports the overlaps as OverlappingData
+// violations, which fail a strict parse.
+//
+// Out-of-line values may share bytes with each other; use the Overlaps
+// function or ParseStrict to find those.
+//
+// A ChainChecker is used by ParseTIFF and should be used in the same way by
+// parsers registered for other versions:
+//
+//	cc := NewChainChecker(offsetSize)
+//	for off := firstOffset; off != 0; {
+//		if err := cc.Visit(off); err != nil {
+//			return nil, err
+//		}
+//		ifd, err := ParseIFD(br, off, tsp, ftsp)
+//		...
+//		if err = cc.Add(ifd, off); err != nil {
+//			return nil, err
+//		}
+//		off = ifd.NextOffset()
+//	}
+type ChainChecker struct {
+	offsetSize uint64
+	offsets    map[uint64]int // IFD offset -> position in the chain
+	structs    regionSet      // the header and IFD entries
+	values     regionSet      // out-of-line values
+	overlaps   []Overlap
+}
+
+// NewChainChecker returns a ChainChecker for a file whose offsets are
+// offsetSize bytes long (4 for a classic TIFF and 8 for a BigTIFF).
+func NewChainChecker(offsetSize uint16) *ChainChecker {
+	cc := &ChainChecker{
+		offsetSize: uint64(offsetSize),
+		offsets:    make(map[uint64]int, 1),
+	}
+	hdr := uint64(8)
+	if offsetSize == 8 {
+		hdr = 16
+	}
+	cc.structs.insert(Region{0, hdr, "header", RegionHeader})
+	return cc
+}
+
+// Visit returns an ErrIFDCycle if the IFD at off has already been added.  Call
+// it before parsing the IFD at off.
+func (cc *ChainChecker) Visit(off uint64) error {
+	if first, ok := cc.offsets[off]; ok {
+		return ErrIFDCycle{Index: len(cc.offsets) - 1, Offset: off, First: first}
+	}
+	return nil
+}
+
+// Add adds ifd, which was parsed from off, to the map.  It records an overlap
+// if the entries of ifd share bytes with the header, with the entries of
+// another IFD or with the values of another IFD, or if its values share bytes
+// with the header or with the entries of any IFD.  It only fails, as Visit
+// does, if the IFD at off has already been added.
+func (cc *ChainChecker) Add(ifd IFD, off uint64) error {
+	if err := cc.Visit(off); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("IFD %d", len(cc.offsets))
+	table := Region{off, ifdSize(cc.offsetSize, uint64(len(ifd.Fields()))), name, RegionIFD}
+	if reg, ok := cc.structs.find(table); ok {
+		cc.overlaps = append(cc.overlaps, Overlap{reg, table})
+	} else if reg, ok := cc.values.find(table); ok {
+		cc.overlaps = append(cc.overlaps, Overlap{reg, table})
+	}
+	var vals []Region
+	for _, f := range ifd.Fields() {
+		size := f.Type().Size() * f.Count()
+		if size <= cc.offsetSize {
+			continue
+		}
+		v := Region{f.Offset(), size, fmt.Sprintf("%s tag %d values", name, f.Tag().ID()), RegionValue}
+		if reg, ok := cc.structs.find(v); ok {
+			cc.overlaps = append(cc.overlaps, Overlap{reg, v})
+		} else if v.Overlaps(table) {
+			cc.overlaps = append(cc.overlaps, Overlap{table, v})
+		}
+		vals = append(vals, v)
+	}
+	cc.offsets[off] = len(cc.offsets)
+	cc.structs.insert(table)
+	for _, v := range vals {
+		cc.values.insert(v)
+	}
+	return nil
+}
+
+// Overlaps returns the overlaps found by Add so far, in the order they were
+// found.
+func (cc *ChainChecker) Overlaps() []Overlap {
+	return append([]Overlap(nil), cc.overlaps...)
+}
+
+// Regions returns the regions used by the header and by the entries of the
+// IFDs added so far, sorted by offset.
+func (cc *ChainChecker) Regions() []Region {
+	return append([]Region(nil), cc.structs...)
+}
+
+// regionSet is a set of disjoint regions sorted by offset.  Inserting a region
+// that overlaps members of the set merges them into one region that keeps the
+// description of the one that starts first.
+type regionSet []Region
+
+// search returns the index of the first region that ends after off.
+func (s regionSet) search(off uint64) int {
+	return sort.Search(len(s), func(i int) bool { return s[i].End() > off })
+}
+
+// find returns a member of s that shares bytes with r.
+func (s regionSet) find(r Region) (Region, bool) {
+	if i := s.search(r.Offset); i < len(s) && s[i].Overlaps(r) {
+		return s[i], true
+	}
+	return Region{}, false
+}
+
+func (s *regionSet) insert(r Region) {
+	if r.Size == 0 {
+		return
+	}
+	i := s.search(r.Offset)
+	j := i
+	for j < len(*s) && (*s)[j].Overlaps(r) {
+		j++
+	}
+	if j > i {
+		first, last := (*s)[i], (*s)[j-1]
+		end := r.End()
+		if last.End() > end {
+			end = last.End()
+		}
+		if first.Offset < r.Offset {
+			r = Region{first.Offset, end - first.Offset, first.Desc, first.Kind}
+		} else {
+			r = Region{r.Offset, end - r.Offset, r.Desc, r.Kind}
+		}
+	}
+	*s = append((*s)[:i], append([]Region{r}, (*s)[j:]...)...)
+}
@@ -0,0 +1,223 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tiff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+/*
+Text encodings
+
+ASCII fields are meant to hold 7-bit ASCII, but many writers (Windows scanner
+drivers in particular) stored text in the code page of the machine instead:
+Latin-1 or Windows-1252 in Europe and the Americas, Shift_JIS in Japan, and so
+on.  Nothing in the file says which.  To always give valid UTF-8 to callers,
+the values of ASCII fields are decoded as follows:
+	1. Text that is already valid UTF-8 (which includes plain ASCII) is
+	   used as it is.
+	2. Otherwise it is decoded with the charset of the file: the Charset
+	   of the ParseOptions it was parsed with, or else the text charset
+	   (see SetTextCharset), which is Windows-1252 by default.
+	3. Bytes the charset cannot decode become U+FFFD.
+The charset of a file is applied by the type of its ASCII fields (see
+TextFieldType), so FieldText and UnmarshalIFD honor it, while DecodeText, which
+only has the bytes, uses the text charset.  Charsets other than the built in
+"UTF-8", "ISO-8859-1" and "Windows-1252" can be added with RegisterCharset.
+For example, with golang.org/x/text:
+	tiff.RegisterCharset("Shift_JIS", func(b []byte) (string, error) {
+		out, err := japanese.ShiftJIS.NewDecoder().Bytes(b)
+		return string(out), err
+	})
+	t, _, err := tiff.ParseWithOptions(r, &tiff.ParseOptions{Charset: "Shift_JIS"})
+*/
+
+// A CharsetDecoder converts text in some charset to UTF-8.
+type CharsetDecoder func([]byte) (string, error)
+
+var charsets = struct {
+	mu   sync.RWMutex
+	decs map[string]CharsetDecoder // keyed by lower case name
+	text string                    // lower case name of the text charset
+}{
+	decs: make(map[string]CharsetDecoder, 4),
+	text: "windows-1252",
+}
+
+// RegisterCharset registers dec as the decoder for the charset called name.
+// Names are not case sensitive.
+func RegisterCharset(name string, dec CharsetDecoder) {
+	charsets.mu.Lock()
+	defer charsets.mu.Unlock()
+	charsets.decs[strings.ToLower(name)] = dec
+}
+
+// GetCharset returns the decoder registered for the charset called name, or
+// nil if there is none.
+func GetCharset(name string) CharsetDecoder {
+	charsets.mu.RLock()
+	defer charsets.mu.RUnlock()
+	return charsets.decs[strings.ToLower(name)]
+}
+
+// SetTextCharset sets the charset used to decode the values of ASCII fields
+// that are not valid UTF-8, in files parsed without a ParseOptions.Charset.
+// It must have been registered.  Since the setting is shared by the whole
+// program, code that reads files of different origins should use
+// ParseOptions.Charset instead.
+func SetTextCharset(name string) error {
+	charsets.mu.Lock()
+	defer charsets.mu.Unlock()
+	if _, ok := charsets.decs[strings.ToLower(name)]; !ok {
+		return fmt.Errorf("tiff: unknown charset %q", name)
+	}
+	charsets.text = strings.ToLower(name)
+	return nil
+}
+
+// GetTextCharset returns the name, in lower case, of the charset used to
+// decode the values of ASCII fields that are not valid UTF-8.
+func GetTextCharset() string {
+	charsets.mu.RLock()
+	defer charsets.mu.RUnlock()
+	return charsets.text
+}
+
+// DecodeText returns the text held by the value of an ASCII field as valid
+// UTF-8, decoding it with the text charset if it is not valid UTF-8 already.
+// Trailing NULs are removed.
+func DecodeText(b []byte) string {
+	return decodeTextWith(b, GetTextCharset())
+}
+
+// decodeTextWith is DecodeText, with the charset called name in place of the
+// text charset.
+func decodeTextWith(b []byte, name string) string {
+	b = bytes.TrimRight(b, "\x00")
+	if utf8.Valid(b) {
+		return string(b)
+	}
+	s, err := DecodeTextAs(b, name)
+	if err != nil {
+		return strings.ToValidUTF8(string(b), "\uFFFD")
+	}
+	return s
+}
+
+// FieldText returns the text held by the value of f as valid UTF-8, without
+// trailing NULs.  ASCII fields are decoded as their type directs (see
+// TextFieldType), other fields as DecodeText does.
+func FieldText(f Field) string {
+	b := f.Value().Bytes()
+	if n := f.Count() * f.Type().Size(); uint64(len(b)) > n {
+		b = b[:n]
+	}
+	if ft := f.Type(); ft.ID() == FTAscii.ID() && ft.ReflectType() == typString {
+		return ft.Valuer()(b, f.Value().Order()).String()
+	}
+	return DecodeText(b)
+}
+
+// TextFieldType returns an ASCII field type whose values, when they are not
+// valid UTF-8, are decoded with the charset called name instead of the text
+// charset.  The ASCII fields of files parsed with a ParseOptions.Charset have
+// this type.
+func TextFieldType(name string) (FieldType, error) {
+	if GetCharset(name) == nil {
+		return nil, fmt.Errorf("tiff: unknown charset %q", name)
+	}
+	repr := func(in []byte, bo binary.ByteOrder) string {
+		return decodeTextWith(in, name)
+	}
+	rval := func(in []byte, bo binary.ByteOrder) reflect.Value {
+		return reflect.ValueOf(decodeTextWith(in, name))
+	}
+	return NewFieldType(FTAscii.ID(), FTAscii.Name(), 1, false, repr, rval, typString), nil
+}
+
+// charsetFieldTypeSpace is a FieldTypeSpace with the ASCII type replaced.
+type charsetFieldTypeSpace struct {
+	FieldTypeSpace
+	ascii FieldType
+}
+
+func (s charsetFieldTypeSpace) GetFieldType(id uint16) FieldType {
+	if id == FTAscii.ID() {
+		return s.ascii
+	}
+	return s.FieldTypeSpace.GetFieldType(id)
+}
+
+// FieldTypeSpaceOf returns the FieldTypeSpace that the parsers of the fields
+// read from br use in place of ftsp: ftsp itself, or, for files parsed with a
+// ParseOptions.Charset, ftsp with the ASCII type of that charset.
+func FieldTypeSpaceOf(br BReader, ftsp FieldTypeSpace) FieldTypeSpace {
+	if fo := fieldOptionsOf(br); fo != nil && fo.ascii != nil {
+		return charsetFieldTypeSpace{ftsp, fo.ascii}
+	}
+	return ftsp
+}
+
+// DecodeTextAs is like DecodeText, but it always decodes b with the charset
+// called name, for callers that know how a file was written.
+func DecodeTextAs(b []byte, name string) (string, error) {
+	dec := GetCharset(name)
+	if dec == nil {
+		return "", fmt.Errorf("tiff: unknown charset %q", name)
+	}
+	s, err := dec(bytes.TrimRight(b, "\x00"))
+	if err != nil {
+		return "", fmt.Errorf("tiff: unable to decode %s text: %v", name, err)
+	}
+	return strings.ToValidUTF8(s, "\uFFFD"), nil
+}
+
+func decodeUTF8(b []byte) (string, error) {
+	return strings.ToValidUTF8(string(b), "\uFFFD"), nil
+}
+
+func decodeLatin1(b []byte) (string, error) {
+	rs := make([]rune, len(b))
+	for i, c := range b {
+		rs[i] = rune(c)
+	}
+	return string(rs), nil
+}
+
+// cp1252 holds the characters of Windows-1252 that differ from Latin-1, for
+// bytes 0x80 to 0x9F.  The 5 bytes left undefined by Windows-1252 are mapped
+// to the C1 control characters, as Windows does.
+var cp1252 = [32]rune{
+	0x20AC, 0x0081, 0x201A, 0x0192, 0x201E, 0x2026, 0x2020, 0x2021,
+	0x02C6, 0x2030, 0x0160, 0x2039, 0x0152, 0x008D, 0x017D, 0x008F,
+	0x0090, 0x2018, 0x2019, 0x201C, 0x201D, 0x2022, 0x2013, 0x2014,
+	0x02DC, 0x2122, 0x0161, 0x203A, 0x0153, 0x009D, 0x017E, 0x0178,
+}
+
+func decodeWindows1252(b []byte) (string, error) {
+	rs := make([]rune, len(b))
+	for i, c := range b {
+		if c >= 0x80 && c < 0xA0 {
+			rs[i] = cp1252[c-0x80]
+		} else {
+			rs[i] = rune(c)
+		}
+	}
+	return string(rs), nil
+}
+
+func init() {
+	RegisterCharset("UTF-8", decodeUTF8)
+	RegisterCharset("ISO-8859-1", decodeLatin1)
+	RegisterCharset("Latin-1", decodeLatin1)
+	RegisterCharset("Windows-1252", decodeWindows1252)
+	RegisterCharset("CP1252", decodeWindows1252)
+}
@@ -0,0 +1,309 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+/*
+Tiffinspect prints and checks the structure of TIFF and BigTIFF files.
+
+Usage:
+
+	tiffinspect info [-json] [-s] [-n max] file
+	tiffinspect validate [-json] file
+	tiffinspect map file
+	tiffinspect page -i index -o out file
+	tiffinspect xmp [-i index] [-o out] file
+	tiffinspect icc [-i index] [-o out] file
+	tiffinspect codecs [-i index] [-tile size] [-n samples] file
+
+The info command prints every IFD with its sub-IFDs (such as the Exif and GPS
+IFDs) and the GeoKeys of GeoTIFF files, in the format of libtiff's tiffinfo
+or as JSON.  The validate command prints the findings of tiff.Validate and
+exits with status 1 if any of them is an error.  The map command prints every
+byte range of the file, flagging unreferenced bytes that are not zero.  The page command writes a
+single page of the file as a new TIFF.  The xmp and icc commands write the XMP
+packet or ICC profile embedded in an IFD, to standard output by default.  The
+codecs command compresses sample strips or tiles of an image with every codec
+that can write them and prints the sizes and times, from the smallest output
+to the largest (see image.TrialCompressions).
+*/
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/google/tiff"
+	_ "github.com/google/tiff/bigtiff"
+	_ "github.com/google/tiff/exif"
+	"github.com/google/tiff/geotiff"
+	"github.com/google/tiff/image"
+)
+
+var commands = map[string]func(args []string) error{
+	"info":     info,
+	"validate": validate,
+	"map":      fileMap,
+	"page":     page,
+	"xmp":      extractXMP,
+	"icc":      extractICC,
+	"codecs":   codecs,
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: tiffinspect info|validate|map|page|xmp|icc|codecs [flags] file\n")
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		usage()
+	}
+	if err := cmd(os.Args[2:]); err != nil {
+		fmt.Fprintf(os.Stderr, "tiffinspect: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// parseArgs parses the flags of fs from args and opens the single file that
+// must follow them.
+func parseArgs(fs *flag.FlagSet, args []string) (*tiff.ReadOnlyFile, tiff.TIFF, error) {
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	f, err := tiff.OpenReadOnly(fs.Arg(0))
+	if err != nil {
+		return nil, nil, err
+	}
+	t, err := tiff.Parse(f, nil, nil)
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return f, t, nil
+}
+
+// create returns the file named name, or standard output if name is empty.
+func create(name string) (io.WriteCloser, error) {
+	if name == "" {
+		return nopCloser{os.Stdout}, nil
+	}
+	return os.Create(name)
+}
+
+type nopCloser struct{ io.Writer }
+
+func (nopCloser) Close() error { return nil }
+
+// geoKeys is the JSON output of the info command for an IFD with GeoKeys.
+type geoKeys struct {
+	IFD  int              `json:"ifd"`
+	Keys []geotiff.GeoKey `json:"keys"`
+}
+
+func info(args []string) error {
+	fs := flag.NewFlagSet("info", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "print the file as JSON")
+	strips := fs.Bool("s", false, "print the offsets and byte counts of strips and tiles")
+	max := fs.Int("n", 10, "print at most `max` values of each field; -1 prints all")
+	f, t, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var keys []geoKeys
+	for i, ifd := range t.IFDs() {
+		k, err := geotiff.GeoKeys(ifd)
+		if err != nil {
+			return err
+		}
+		if k != nil {
+			keys = append(keys, geoKeys{i, k})
+		}
+	}
+	if *asJSON {
+		doc, err := tiff.ToJSON(t)
+		if err != nil {
+			return err
+		}
+		out := struct {
+			File    json.RawMessage `json:"file"`
+			GeoKeys []geoKeys       `json:"geoKeys,omitempty"`
+		}{doc, keys}
+		b, err := json.MarshalIndent(out, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Printf("%s\n", b)
+		return err
+	}
+	if err := tiff.Dump(os.Stdout, t, &tiff.DumpOptions{MaxValues: *max, Strips: *strips, SubIFDs: true}); err != nil {
+		return err
+	}
+	for _, k := range keys {
+		fmt.Printf("=== GeoKeys of TIFF directory %d ===\n", k.IFD)
+		for _, key := range k.Keys {
+			fmt.Printf("  %v\n", key)
+		}
+	}
+	return nil
+}
+
+func validate(args []string) error {
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "print the findings as JSON")
+	f, t, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	findings := tiff.Validate(t)
+	if *asJSON {
+		b, err := json.MarshalIndent(findings, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s\n", b)
+	} else {
+		for _, fd := range findings {
+			fmt.Println(fd)
+		}
+	}
+	for _, fd := range findings {
+		if fd.Severity == tiff.SevError {
+			return fmt.Errorf("%s is not valid", fs.Arg(0))
+		}
+	}
+	return nil
+}
+
+func fileMap(args []string) error {
+	fs := flag.NewFlagSet("map", flag.ExitOnError)
+	f, _, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	m, err := tiff.MapFile(f)
+	if err != nil {
+		return err
+	}
+	if _, err := m.WriteTo(os.Stdout); err != nil {
+		return err
+	}
+	_, err = fmt.Printf("%d of %d bytes unreferenced, fragmentation %.2f\n", m.Wasted(), m.Size, m.Fragmentation())
+	return err
+}
+
+func page(args []string) error {
+	fs := flag.NewFlagSet("page", flag.ExitOnError)
+	idx := fs.Int("i", 0, "write the page of IFD `index`")
+	out := fs.String("o", "", "write the page to `file`")
+	f, _, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if *out == "" {
+		return fmt.Errorf("page: no output file given with -o")
+	}
+	// WritePage parses the file again from where it is read next.
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	w, err := create(*out)
+	if err != nil {
+		return err
+	}
+	if err := tiff.WritePage(f, w, *idx); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+func extractXMP(args []string) error {
+	return extract("xmp", args, func(ifd tiff.IFD) ([]byte, error) {
+		return tiff.XMP(ifd), nil
+	})
+}
+
+func extractICC(args []string) error {
+	return extract("icc", args, tiff.ICCProfile)
+}
+
+// extract writes the payload get returns for an IFD to a file.
+func extract(name string, args []string, get func(tiff.IFD) ([]byte, error)) error {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	idx := fs.Int("i", 0, "extract from IFD `index`")
+	out := fs.String("o", "", "write to `file` rather than standard output")
+	f, t, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	ifds := t.IFDs()
+	if *idx < 0 || *idx >= len(ifds) {
+		return fmt.Errorf("%s: IFD index %d out of range [0, %d)", name, *idx, len(ifds))
+	}
+	payload, err := get(ifds[*idx])
+	if err != nil {
+		return err
+	}
+	if payload == nil {
+		return fmt.Errorf("%s: IFD %d has no %s payload", name, *idx, name)
+	}
+	w, err := create(*out)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(payload); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+func codecs(args []string) error {
+	fs := flag.NewFlagSet("codecs", flag.ExitOnError)
+	idx := fs.Int("i", 0, "try the image of IFD `index`")
+	tile := fs.Int("tile", 0, "cut the image into tiles of `size` by size pixels rather than strips")
+	samples := fs.Int("n", 16, "compress `samples` strips or tiles with each codec")
+	f, t, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	ifds := t.IFDs()
+	if *idx < 0 || *idx >= len(ifds) {
+		return fmt.Errorf("codecs: IFD index %d out of range [0, %d)", *idx, len(ifds))
+	}
+	img, err := image.DecodeRaw(ifds[*idx], t.R(), nil)
+	if err != nil {
+		return err
+	}
+	trials, err := image.TrialCompressions(img, &image.TrialOptions{
+		Encode:  &image.EncodeOptions{TileWidth: *tile, TileHeight: *tile},
+		Samples: *samples,
+	})
+	if err != nil {
+		return err
+	}
+	for _, tr := range trials {
+		fmt.Println(tr)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tiff
+
+import (
+	"fmt"
+	"io"
+)
+
+// Compact writes a copy of the TIFF found in src to dst that holds only what
+// the file references: unreferenced regions (see MapFile), such as the old
+// IFDs and values left behind by in-place edits like SetXMP, are dropped.
+// Every IFD keeps its fields in the order src lists them, and image data
+// (strips, tiles, etc.) is copied byte for byte, once for blocks that several
+// fields share.  The copy has the same byte order and offset size as src.
+func Compact(src ReadAtReadSeeker, dst io.Writer) error {
+	t, err := Parse(src, nil, nil)
+	if err != nil {
+		return err
+	}
+	ws, err := planTIFF(t, nil)
+	if err != nil {
+		return err
+	}
+	for i, ifd := range t.IFDs() {
+		if err = keepFieldOrder(t, ifd, ws[i]); err != nil {
+			return err
+		}
+	}
+	return writeTIFF(dst, t.R().ByteOrder(), t.OffsetSize() == 8, ws)
+}
+
+// keepFieldOrder puts the fields of w, which planIFD sorted, and of its
+// sub-IFDs back in the order ifd lists them.  Files written by this package
+// list them in order already.  Sub-IFDs that are referenced twice or nested
+// more than maxFingerprintDepth deep are an error, as they are for planIFD.
+func keepFieldOrder(t TIFF, ifd IFD, w *writeIFD) error {
+	return reorderFields(t, ifd, w, make(map[uint64]bool, 1), 0)
+}
+
+// reorderFields is keepFieldOrder for an IFD depth levels below the main IFD
+// chain, with seen holding the offsets of the IFDs already reordered.
+func reorderFields(t TIFF, ifd IFD, w *writeIFD, seen map[uint64]bool, depth int) error {
+	if off := RawIFDOf(ifd).Offset(); off != 0 {
+		if seen[off] {
+			return fmt.Errorf("tiff: the IFD at offset %d is referenced more than once", off)
+		}
+		seen[off] = true
+	}
+	pos := make(map[uint16]int, len(ifd.Fields()))
+	for i, f := range ifd.Fields() {
+		if _, ok := pos[f.Tag().ID()]; !ok {
+			pos[f.Tag().ID()] = i
+		}
+	}
+	fields := make([]Field, len(w.fields))
+	copy(fields, w.fields)
+	for i := 1; i < len(fields); i++ {
+		for j := i; j > 0 && pos[fields[j].Tag().ID()] < pos[fields[j-1].Tag().ID()]; j-- {
+			fields[j], fields[j-1] = fields[j-1], fields[j]
+		}
+	}
+	w.fields = fields
+	for id, subs := range w.subs {
+		if depth >= maxFingerprintDepth {
+			return fmt.Errorf("tiff: sub-ifds nested more than %d deep", maxFingerprintDepth)
+		}
+		subIFDs, err := ParseSubIFDs(t, ifd, id)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < len(subs) && i < len(subIFDs); i++ {
+			if err = reorderFields(t, subIFDs[i], subs[i], seen, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tiff
+
+import (
+	"context"
+	"encoding/binary"
+)
+
+// ctxBReader is a BReader whose reads fail once its context is done.  Since
+// the TIFF parsed with it keeps it (see TIFF.R), this also applies to sub-IFDs
+// and image data read later on.
+type ctxBReader struct {
+	br  BReader
+	ctx context.Context
+}
+
+// ContextBReader returns a BReader that reads from br until ctx is done, after
+// which every read returns ctx.Err().
+func ContextBReader(ctx context.Context, br BReader) BReader {
+	return &ctxBReader{br: br, ctx: ctx}
+}
+
+func (b *ctxBReader) Read(p []byte) (n int, err error) {
+	if err = b.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return b.br.Read(p)
+}
+
+func (b *ctxBReader) ReadAt(p []byte, off int64) (n int, err error) {
+	if err = b.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return b.br.ReadAt(p, off)
+}
+
+func (b *ctxBReader) BRead(data interface{}) error {
+	if err := b.ctx.Err(); err != nil {
+		return err
+	}
+	return b.br.BRead(data)
+}
+
+func (b *ctxBReader) BReadSection(data interface{}, offset int64, n int64) error {
+	if err := b.ctx.Err(); err != nil {
+		return err
+	}
+	return b.br.BReadSection(data, offset, n)
+}
+
+func (b *ctxBReader) Seek(offset int64, whence int) (int64, error) {
+	return b.br.Seek(offset, whence)
+}
+
+func (b *ctxBReader) ByteOrder() binary.ByteOrder {
+	return b.br.ByteOrder()
+}
+
+// ContextOf returns the context of br, if it was returned by ContextBReader
+// (possibly wrapped by LimitBReader).  Otherwise it returns
+// context.Background().
+func ContextOf(br BReader) context.Context {
+	for {
+		switch b := br.(type) {
+		case *ctxBReader:
+			return b.ctx
+		case *limitedBReader:
+			br = b.BReader
+		default:
+			return context.Background()
+		}
+	}
+}
+
+// CheckContext returns the error of the context of br (see ContextOf), if it
+// is done.  Parsers and decoders call it between units of work, such as IFDs
+// or strips, so that they stop promptly when the work is no longer wanted.
+func CheckContext(br BReader) error {
+	return ContextOf(br).Err()
+}
+
+// ParseContext is like Parse, but it stops with ctx.Err() once ctx is done.
+// The context is checked between IFDs and before every read, and it remains
+// in effect for reads made later through the TIFF.R of the returned TIFF.
+func ParseContext(ctx context.Context, r ReadAtReadSeeker, tsp TagSpace, ftsp FieldTypeSpace) (TIFF, error) {
+	return parse(ctx, r, tsp, ftsp, nil, 0, nil)
+}
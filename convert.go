@@ -0,0 +1,175 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tiff
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// ConvertToBigTIFF writes a copy of the TIFF found in src to dst as a BigTIFF
+// (a TIFF with 64 bit offsets).  All tags are preserved and data blocks are
+// copied byte for byte.  Offsets to data blocks and sub-IFDs are written as
+// LONG8 and IFD8 values; all other values keep their original types.
+func ConvertToBigTIFF(src ReadAtReadSeeker, dst io.Writer) error {
+	t, err := Parse(src, nil, nil)
+	if err != nil {
+		return err
+	}
+	ifds, err := planTIFF(t, nil)
+	if err != nil {
+		return err
+	}
+	return writeTIFF(dst, t.R().ByteOrder(), true, ifds)
+}
+
+// ConvertToClassic writes a copy of the BigTIFF found in src to dst as a
+// classic TIFF with 32 bit offsets.  The bigtiff package must be imported for
+// src to be parsed.  Offsets to data blocks and sub-IFDs are written as LONG
+// and IFD values.  Other LONG8, SLONG8, and IFD8 values are converted to LONG,
+// SLONG, and IFD.  An error is returned, and nothing is written, if any value
+// does not fit in 32 bits or if the result would be larger than 4GB.
+func ConvertToClassic(src ReadAtReadSeeker, dst io.Writer) error {
+	t, err := Parse(src, nil, nil)
+	if err != nil {
+		return err
+	}
+	ifds, err := planTIFF(t, nil)
+	if err != nil {
+		return err
+	}
+	for _, w := range ifds {
+		if err = narrowFields(w); err != nil {
+			return err
+		}
+	}
+	return writeTIFF(dst, t.R().ByteOrder(), false, ifds)
+}
+
+// ConvertByteOrder writes a copy of the TIFF found in src to dst in byte order
+// order.  Every multi-byte value is converted, including values stored inline
+// in an entry.  Uncompressed strips and tiles with samples of more than 8 bits
+// are converted as well; an error is returned, and nothing is written, if
+// such samples are compressed, since that would take decompressing them.
+// Other data blocks are copied byte for byte.  The copy has the same offset
+// size as src.
+func ConvertByteOrder(src ReadAtReadSeeker, dst io.Writer, order binary.ByteOrder) error {
+	t, err := Parse(src, nil, nil)
+	if err != nil {
+		return err
+	}
+	ifds, err := planTIFF(t, nil)
+	if err != nil {
+		return err
+	}
+	if order != t.R().ByteOrder() {
+		for _, w := range ifds {
+			if err = swapSamples(w); err != nil {
+				return err
+			}
+		}
+	}
+	return writeTIFF(dst, order, t.OffsetSize() == 8, ifds)
+}
+
+// swapSamples marks the strips and tiles of w and its sub-IFDs whose samples
+// need their bytes reversed for the other byte order.
+func swapSamples(w *writeIFD) error {
+	var bps []uint64
+	compression := uint64(1)
+	for _, f := range w.fields {
+		var err error
+		switch f.Tag().ID() {
+		case 258: // BitsPerSample
+			bps, err = uintValues(f)
+		case 259: // Compression
+			var v []uint64
+			if v, err = uintValues(f); err == nil && len(v) > 0 {
+				compression = v[0]
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	var size uint64
+	for i, b := range bps {
+		if b > 8 && (b%8 != 0 || (i > 0 && b != bps[0])) {
+			return fmt.Errorf("tiff: cannot convert the byte order of samples of %v bits", bps)
+		}
+		if b > 8 {
+			size = b / 8
+		}
+	}
+	for id, blocks := range w.blocks {
+		if size == 0 || (id != 273 && id != 324) {
+			continue
+		}
+		if compression != 1 {
+			return fmt.Errorf("tiff: cannot convert the byte order of %d bit samples compressed with scheme %d", size*8, compression)
+		}
+		for i := range blocks {
+			blocks[i].swap = size
+		}
+	}
+	for _, subs := range w.subs {
+		for _, sub := range subs {
+			if err := swapSamples(sub); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// narrowFields replaces the 64 bit integer fields of w and its sub-IFDs with
+// 32 bit ones.  Offset fields are left alone since they are rewritten anyway.
+func narrowFields(w *writeIFD) error {
+	for i, f := range w.fields {
+		id := f.Tag().ID()
+		if _, ok := w.blocks[id]; ok {
+			continue
+		}
+		if subs, ok := w.subs[id]; ok {
+			for _, sub := range subs {
+				if err := narrowFields(sub); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		var typeID uint16
+		switch f.Type().ID() {
+		case FTLong8.ID():
+			typeID = FTLong.ID()
+		case FTSLong8.ID():
+			typeID = FTSLong.ID()
+		case FTIFD8.ID():
+			typeID = FTIFD.ID()
+		default:
+			continue
+		}
+		if f.Count() > math.MaxUint32 {
+			return fmt.Errorf("tiff: tag %d has too many values (%d) for a classic TIFF", id, f.Count())
+		}
+		in := f.Value().Bytes()
+		out := make([]byte, 4*f.Count())
+		for j := uint64(0); j < f.Count(); j++ {
+			v := w.order.Uint64(in[8*j:])
+			if typeID == FTSLong.ID() {
+				if int64(v) < math.MinInt32 || int64(v) > math.MaxInt32 {
+					return fmt.Errorf("tiff: value %d of tag %d does not fit in 32 bits", int64(v), id)
+				}
+			} else if v > math.MaxUint32 {
+				return fmt.Errorf("tiff: value %d of tag %d does not fit in 32 bits", v, id)
+			}
+			w.order.PutUint32(out[4*j:], uint32(v))
+		}
+		w.fields[i] = newField(id, typeID, uint32(f.Count()), out, w.order, nil, nil)
+	}
+	return nil
+}
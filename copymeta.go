@@ -0,0 +1,152 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tiff
+
+import "encoding/binary"
+
+// A MetadataGroup selects groups of metadata fields for MetadataFilter.
+// Groups may be combined with |.
+type MetadataGroup uint
+
+// Groups of metadata fields.
+const (
+	// MetadataExif is the Exif IFD (tag 34665) and its fields.
+	MetadataExif MetadataGroup = 1 << iota
+	// MetadataGPS is the GPS IFD (tag 34853) and its fields.
+	MetadataGPS
+	// MetadataXMP is the XMP packet (tag 700).
+	MetadataXMP
+	// MetadataICC is the ICC profile (tag 34675).
+	MetadataICC
+	// MetadataResolution is XResolution, YResolution, and ResolutionUnit
+	// (tags 282, 283, and 296).
+	MetadataResolution
+
+	MetadataAll = MetadataExif | MetadataGPS | MetadataXMP | MetadataICC | MetadataResolution
+)
+
+// MetadataFilter returns a FieldFilter for CopyMetadata that keeps the fields
+// of the given groups.
+func MetadataFilter(groups MetadataGroup) FieldFilter {
+	return func(parentTagID uint16, f Field) bool {
+		switch parentTagID {
+		case 0:
+			// A field of the main IFD chain, checked below.
+		case exifIFDTagID:
+			return groups&MetadataExif != 0
+		case gpsIFDTagID:
+			return groups&MetadataGPS != 0
+		default:
+			return false
+		}
+		switch f.Tag().ID() {
+		case exifIFDTagID:
+			return groups&MetadataExif != 0
+		case gpsIFDTagID:
+			return groups&MetadataGPS != 0
+		case XMPTagID:
+			return groups&MetadataXMP != 0
+		case ICCProfileTagID:
+			return groups&MetadataICC != 0
+		case 282, 283, 296:
+			return groups&MetadataResolution != 0
+		}
+		return false
+	}
+}
+
+// CopyMetadata copies the fields of src for which filter returns true onto the
+// file in dst, IFD by IFD (the first IFD of src onto the first of dst and so
+// on, as far as both files have IFDs), replacing fields with the same tags.
+// This restores the metadata of a file whose pixels were recompressed by a
+// tool that dropped it.  A nil filter is MetadataFilter(MetadataAll).
+//
+// The changes are made in place with an Editor, so the image data of dst is
+// left untouched.  Fields that point to sub-IFDs through a single offset (such
+// as the Exif IFD) are not copied themselves; instead, the fields of the
+// sub-IFD that filter keeps (given the tag of the sub-IFD as parentTagID) are
+// copied onto the matching sub-IFD of dst, which is created if needed.
+// Fields that hold offsets to data blocks, and any sub-IFDs nested deeper
+// (such as the Interoperability IFD), are never copied, since their offsets
+// would be meaningless in dst.  Values are converted to the byte order of dst.
+func CopyMetadata(src TIFF, dst ReadWriteAtSeeker, filter FieldFilter) error {
+	if filter == nil {
+		filter = MetadataFilter(MetadataAll)
+	}
+	e, err := Edit(dst, nil, nil)
+	if err != nil {
+		return err
+	}
+	bo := e.ByteOrder()
+	srcIFDs, dstIFDs := src.IFDs(), e.TIFF().IFDs()
+	for i := 0; i < len(srcIFDs) && i < len(dstIFDs); i++ {
+		ifd := srcIFDs[i]
+		for _, f := range ifd.Fields() {
+			if !filter(0, f) {
+				continue
+			}
+			if copyableField(f) {
+				if err = e.SetField(i, orderField(f, bo)); err != nil {
+					return err
+				}
+				continue
+			}
+			id := f.Tag().ID()
+			if _, ok := GetSubIFDTag(id); !ok || f.Count() != 1 {
+				continue
+			}
+			subs, err := ParseSubIFDs(src, ifd, id)
+			if err != nil {
+				return err
+			}
+			for _, sf := range subs[0].Fields() {
+				if !filter(id, sf) || !copyableField(sf) {
+					continue
+				}
+				if err = e.SetSubField(i, id, orderField(sf, bo)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return e.Commit()
+}
+
+// copyableField reports whether f can be copied to another file as is: it
+// holds no offsets into the file it was read from.
+func copyableField(f Field) bool {
+	if _, ok := GetDataTags(f.Tag().ID()); ok {
+		return false
+	}
+	_, ok := GetSubIFDTag(f.Tag().ID())
+	return !ok
+}
+
+// orderField returns f with its values encoded in byte order bo.
+func orderField(f Field, bo binary.ByteOrder) Field {
+	if f.Value().Order() == bo {
+		return f
+	}
+	size := f.Type().Size()
+	switch f.Type().ID() {
+	case FTRational.ID(), FTSRational.ID():
+		// Each value is a pair of 4 byte integers.
+		size = 4
+	}
+	buf := f.Value().Bytes()
+	if n := f.Type().Size() * f.Count(); uint64(len(buf)) > n {
+		buf = buf[:n]
+	}
+	out := make([]byte, len(buf))
+	copy(out, buf)
+	if size > 1 {
+		for i := uint64(0); i+size <= uint64(len(out)); i += size {
+			for j, k := i, i+size-1; j < k; j, k = j+1, k-1 {
+				out[j], out[k] = out[k], out[j]
+			}
+		}
+	}
+	return newField(f.Tag().ID(), f.Type().ID(), uint32(f.Count()), out, bo, nil, nil)
+}
@@ -0,0 +1,288 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tiff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Dual-personality DICOM-TIFF files (as used for DICOM whole slide images)
+// start with the 128 byte DICOM preamble, which holds the TIFF header, and the
+// "DICM" prefix.  The DICOM data set follows, and the IFDs and image data of
+// the TIFF are stored inside its elements (usually the Data Set Trailing
+// Padding element, which comes last) with offsets counted from the start of
+// the file as usual.  Parse reads such files as it does any other TIFF.
+const (
+	dicomPreambleSize = 128
+	dicomPrefix       = "DICM"
+	dicomHeaderSize   = dicomPreambleSize + len(dicomPrefix)
+
+	// dicomPaddingTag is the Data Set Trailing Padding element (FFFC,FFFC).
+	dicomPaddingTag = 0xFFFCFFFC
+	// dicomUndefinedLength marks elements whose end is found by a
+	// delimitation item.
+	dicomUndefinedLength = 0xFFFFFFFF
+	// maxDICOMDepth bounds how deeply sequences and items are followed.
+	maxDICOMDepth = 16
+)
+
+// IsDICOM reports whether r holds a DICOM file: the "DICM" prefix follows the
+// 128 byte preamble.
+func IsDICOM(r io.ReaderAt) bool {
+	var prefix [4]byte
+	if _, err := r.ReadAt(prefix[:], dicomPreambleSize); err != nil {
+		return false
+	}
+	return string(prefix[:]) == dicomPrefix
+}
+
+// WriteDICOMTIFF writes the TIFF found in src to dst as a dual-personality
+// DICOM-TIFF file.  dataset holds the encoded DICOM file meta information and
+// data set, in explicit VR little endian, that follow the "DICM" prefix.  The
+// IFDs and image data of the TIFF, with offsets rewritten to match, are
+// stored in a Data Set Trailing Padding element appended to dataset, so
+// dataset must not already end with one.  The file has the same byte order
+// and offset size as src.
+func WriteDICOMTIFF(src ReadAtReadSeeker, dst io.Writer, dataset []byte) error {
+	if len(dataset)%2 != 0 {
+		return fmt.Errorf("tiff: DICOM data set has an odd length (%d bytes)", len(dataset))
+	}
+	t, err := Parse(src, nil, nil)
+	if err != nil {
+		return err
+	}
+	ws, err := planTIFF(t, nil)
+	if err != nil {
+		return err
+	}
+	order, big := t.R().ByteOrder(), t.OffsetSize() == 8
+	// The padding element is written with an explicit length, which is
+	// known once the TIFF has been laid out after its 12 byte header.
+	base := uint64(dicomHeaderSize + len(dataset) + 12)
+	tw, err := newTIFFWriter(dst, order, big, base, ws)
+	if err != nil {
+		return err
+	}
+	length := even(tw.pos - base)
+	if length > math.MaxUint32-1 {
+		return fmt.Errorf("tiff: %d bytes of TIFF data do not fit in a DICOM element", length)
+	}
+
+	hdr := make([]byte, dicomHeaderSize, int(base))
+	copy(hdr, tiffHeader(order, big, ws[0].offset))
+	copy(hdr[dicomPreambleSize:], dicomPrefix)
+	hdr = append(hdr, dataset...)
+	hdr = append(hdr, 0xFC, 0xFF, 0xFC, 0xFF, 'O', 'B', 0, 0, 0, 0, 0, 0)
+	binary.LittleEndian.PutUint32(hdr[len(hdr)-4:], uint32(length))
+	if _, err = dst.Write(hdr); err != nil {
+		return err
+	}
+	if err = tw.writeBody(ws); err != nil {
+		return err
+	}
+	if tw.written%2 != 0 {
+		_, err = dst.Write([]byte{0})
+	}
+	return err
+}
+
+// A dicomElement is a top level element of a DICOM data set.
+type dicomElement struct {
+	tag      uint32 // group << 16 | element
+	offset   int64  // of the element header
+	valueOff int64
+	length   int64 // of the value, including any delimitation items
+}
+
+func (e dicomElement) end() int64 { return e.valueOff + e.length }
+
+// dicomScanner walks the elements of the DICOM data set of a file.
+type dicomScanner struct {
+	r        io.ReaderAt
+	explicit bool // VR of the main data set (the file meta group always has one)
+}
+
+// dicomElements returns the top level elements of the DICOM data set in r,
+// which must be a DICOM file (see IsDICOM).  Only little endian transfer
+// syntaxes are supported.
+func dicomElements(r io.ReaderAt) ([]dicomElement, error) {
+	s := &dicomScanner{r: r, explicit: true}
+	var elems []dicomElement
+	off := int64(dicomHeaderSize)
+	for {
+		e, err := s.element(off, 0)
+		if err == io.EOF {
+			return elems, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if e.tag == 0x00020010 && e.length <= 64 {
+			// Transfer Syntax UID: "1.2.840.10008.1.2" is implicit VR
+			// little endian, and "1.2.840.10008.1.2.2" explicit VR big
+			// endian.  Anything else is explicit VR little endian.
+			uid := make([]byte, e.length)
+			if _, err := r.ReadAt(uid, e.valueOff); err != nil {
+				return nil, fmt.Errorf("tiff: DICOM transfer syntax at offset %d: %v", e.valueOff, err)
+			}
+			switch string(bytes.TrimRight(uid, "\x00 ")) {
+			case "1.2.840.10008.1.2":
+				s.explicit = false
+			case "1.2.840.10008.1.2.2":
+				return nil, fmt.Errorf("tiff: big endian DICOM data sets are not supported")
+			}
+		}
+		elems = append(elems, e)
+		off = e.end()
+	}
+}
+
+// element reads the element at off, skipping over the contents of elements of
+// undefined length.  io.EOF is returned if the data set ends at off.
+func (s *dicomScanner) element(off int64, depth int) (dicomElement, error) {
+	if depth > maxDICOMDepth {
+		return dicomElement{}, fmt.Errorf("tiff: DICOM sequences nested more than %d deep", maxDICOMDepth)
+	}
+	var buf [12]byte
+	n, err := s.r.ReadAt(buf[:8], off)
+	if n == 0 && err == io.EOF {
+		return dicomElement{}, io.EOF
+	}
+	if n < 8 {
+		return dicomElement{}, fmt.Errorf("tiff: DICOM element at offset %d is truncated", off)
+	}
+	le := binary.LittleEndian
+	e := dicomElement{tag: uint32(le.Uint16(buf[0:]))<<16 | uint32(le.Uint16(buf[2:])), offset: off}
+	var length uint32
+	switch vr := string(buf[4:6]); {
+	case e.tag>>16 == 0xFFFE || (!s.explicit && e.tag>>16 != 0x0002):
+		// Items and delimiters, and every element without a VR.
+		length, e.valueOff = le.Uint32(buf[4:]), off+8
+	case vr == "OB" || vr == "OD" || vr == "OF" || vr == "OL" || vr == "OV" || vr == "OW" ||
+		vr == "SQ" || vr == "SV" || vr == "UC" || vr == "UN" || vr == "UR" || vr == "UT" || vr == "UV":
+		if _, err := s.r.ReadAt(buf[8:12], off+8); err != nil {
+			return dicomElement{}, fmt.Errorf("tiff: DICOM element at offset %d is truncated", off)
+		}
+		length, e.valueOff = le.Uint32(buf[8:]), off+12
+	default:
+		length, e.valueOff = uint32(le.Uint16(buf[6:])), off+8
+	}
+	if length != dicomUndefinedLength {
+		e.length = int64(length)
+		return e, nil
+	}
+	// The contents end with an Item Delimitation Item (FFFE,E00D) or a
+	// Sequence Delimitation Item (FFFE,E0DD).
+	for next := e.valueOff; ; {
+		sub, err := s.element(next, depth+1)
+		if err == io.EOF {
+			return dicomElement{}, fmt.Errorf("tiff: DICOM element at offset %d has no delimitation item", off)
+		}
+		if err != nil {
+			return dicomElement{}, err
+		}
+		next = sub.end()
+		if sub.tag == 0xFFFEE00D || sub.tag == 0xFFFEE0DD {
+			e.length = next - e.valueOff
+			return e, nil
+		}
+	}
+}
+
+// mapDICOM adds the DICOM parts of a DICOM-TIFF file to m: the preamble after
+// the TIFF header, and every element of the data set except for what the
+// TIFF itself refers to.  Of the trailing padding element, which holds the
+// TIFF, and of the Pixel Data element (7FE0,0010), whose fragments are the
+// strips or tiles of the TIFF, only the headers are added.  Data sets that
+// cannot be read are left out.
+func (m *regionMapper) mapDICOM(hdr uint64) {
+	r := m.t.R()
+	if !IsDICOM(r) {
+		return
+	}
+	m.add(RegionHeader, hdr, uint64(dicomHeaderSize)-hdr, "DICOM preamble")
+	elems, err := dicomElements(r)
+	if err != nil {
+		return
+	}
+	for _, e := range elems {
+		name := fmt.Sprintf("DICOM element (%04X,%04X)", e.tag>>16, e.tag&0xFFFF)
+		if e.tag != dicomPaddingTag && e.tag != 0x7FE00010 {
+			m.add(RegionHeader, uint64(e.offset), uint64(e.end()-e.offset), name)
+			continue
+		}
+		m.add(RegionHeader, uint64(e.offset), uint64(e.valueOff-e.offset), "%s header", name)
+		if e.tag == dicomPaddingTag {
+			continue
+		}
+		// Encapsulated pixel data is a list of items, each holding a
+		// fragment.
+		var item [8]byte
+		for off := e.valueOff; off+8 <= e.end(); {
+			if _, err := r.ReadAt(item[:], off); err != nil {
+				break
+			}
+			length := int64(binary.LittleEndian.Uint32(item[4:]))
+			if binary.LittleEndian.Uint16(item[0:]) != 0xFFFE || length == dicomUndefinedLength {
+				break
+			}
+			m.add(RegionHeader, uint64(off), 8, "%s item", name)
+			off += 8 + length
+		}
+	}
+}
+
+// A dicomPadding is the Data Set Trailing Padding element that ends a
+// DICOM-TIFF file, which anything appended to the file must be part of.
+type dicomPadding struct {
+	lengthOff int64 // of the 4 byte length of the element
+	valueOff  int64
+}
+
+// dicomAppend checks that data can be appended to the file in rw, which ends
+// at end.  For DICOM files, the data set must end with a trailing padding
+// element of explicit length, which is returned so that it can be grown once
+// the data is written.  For other files, nil is returned.
+func dicomAppend(rw ReadWriteAtSeeker, end int64) (*dicomPadding, error) {
+	if !IsDICOM(rw) {
+		return nil, nil
+	}
+	elems, err := dicomElements(rw)
+	if err != nil {
+		return nil, err
+	}
+	if len(elems) == 0 || elems[len(elems)-1].tag != dicomPaddingTag || elems[len(elems)-1].end() != end {
+		return nil, fmt.Errorf("tiff: DICOM data set does not end with a trailing padding element to hold new data")
+	}
+	last := elems[len(elems)-1]
+	return &dicomPadding{lengthOff: last.valueOff - 4, valueOff: last.valueOff}, nil
+}
+
+// grow extends the padding element to the new end of the file, adding a byte
+// to keep its length even if needed.
+func (p *dicomPadding) grow(rw ReadWriteAtSeeker, end int64) error {
+	if p == nil {
+		return nil
+	}
+	if (end-p.valueOff)%2 != 0 {
+		if _, err := rw.WriteAt([]byte{0}, end); err != nil {
+			return fmt.Errorf("tiff: unable to pad the DICOM data set: %v", err)
+		}
+		end++
+	}
+	if end-p.valueOff > math.MaxUint32-1 {
+		return fmt.Errorf("tiff: DICOM trailing padding would exceed 4GB")
+	}
+	var length [4]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(end-p.valueOff))
+	if _, err := rw.WriteAt(length[:], p.lengthOff); err != nil {
+		return fmt.Errorf("tiff: unable to update the length of the DICOM trailing padding: %v", err)
+	}
+	return nil
+}
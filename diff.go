@@ -0,0 +1,169 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tiff
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// A ChangeKind tells how a field or IFD differs between two files.
+type ChangeKind int
+
+// Kinds of Change.
+const (
+	ChangeAdded ChangeKind = iota
+	ChangeRemoved
+	ChangeModified
+)
+
+func (k ChangeKind) String() string {
+	switch k {
+	case ChangeAdded:
+		return "added"
+	case ChangeRemoved:
+		return "removed"
+	case ChangeModified:
+		return "changed"
+	}
+	return fmt.Sprintf("ChangeKind(%d)", int(k))
+}
+
+// A Change is a difference found by Diff.
+type Change struct {
+	Kind ChangeKind
+	// Path names the IFD holding the field, such as "IFD 0" or
+	// "IFD 0/34665[0]" for the Exif IFD of the first page.
+	Path string
+	// Tag is the field that changed, or 0 if a whole IFD was added or
+	// removed.
+	Tag  uint16
+	Name string
+	// Old and New describe the value in the first and second file.  Old is
+	// empty for added fields and New for removed ones.
+	Old, New string
+}
+
+func (c Change) String() string {
+	if c.Tag == 0 {
+		return fmt.Sprintf("%s: %s", c.Path, c.Kind)
+	}
+	switch c.Kind {
+	case ChangeAdded:
+		return fmt.Sprintf("%s: %s (%d) added: %s", c.Path, c.Name, c.Tag, c.New)
+	case ChangeRemoved:
+		return fmt.Sprintf("%s: %s (%d) removed: %s", c.Path, c.Name, c.Tag, c.Old)
+	}
+	return fmt.Sprintf("%s: %s (%d) changed: %s -> %s", c.Path, c.Name, c.Tag, c.Old, c.New)
+}
+
+// Diff compares the IFDs of a and b, along with the sub-IFDs (such as the
+// Exif and GPS IFDs) they reference, tag by tag.  Like Fingerprint, it looks
+// at content rather than layout: the order of entries, the byte order, where
+// values are stored, and the offsets of data blocks and sub-IFDs are ignored.
+// Fields with offsets to data blocks only differ if the number of blocks does,
+// and sub-IFDs are compared in turn.  Changes are listed by IFD, then by tag.
+func Diff(a, b TIFF) ([]Change, error) {
+	var changes []Change
+	aIFDs, bIFDs := a.IFDs(), b.IFDs()
+	for i := 0; i < len(aIFDs) || i < len(bIFDs); i++ {
+		path := fmt.Sprintf("IFD %d", i)
+		switch {
+		case i >= len(bIFDs):
+			changes = append(changes, Change{Kind: ChangeRemoved, Path: path})
+		case i >= len(aIFDs):
+			changes = append(changes, Change{Kind: ChangeAdded, Path: path})
+		default:
+			var err error
+			if changes, err = diffTree(changes, path, a, aIFDs[i], b, bIFDs[i], 0); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return changes, nil
+}
+
+func diffTree(changes []Change, path string, a TIFF, aIFD IFD, b TIFF, bIFD IFD, depth int) ([]Change, error) {
+	if depth > maxFingerprintDepth {
+		return nil, fmt.Errorf("tiff: sub-ifds nested more than %d deep", maxFingerprintDepth)
+	}
+	for _, id := range mergeTagIDs(sortedTagIDs(aIFD), sortedTagIDs(bIFD)) {
+		af, bf := aIFD.GetField(id), bIFD.GetField(id)
+		switch {
+		case bf == nil:
+			changes = append(changes, Change{Kind: ChangeRemoved, Path: path, Tag: id, Name: af.Tag().Name(), Old: diffValue(af)})
+			continue
+		case af == nil:
+			changes = append(changes, Change{Kind: ChangeAdded, Path: path, Tag: id, Name: bf.Tag().Name(), New: diffValue(bf)})
+			continue
+		}
+		if _, ok := GetSubIFDTag(id); ok {
+			aSubs, err := ParseSubIFDs(a, aIFD, id)
+			if err != nil {
+				return nil, err
+			}
+			bSubs, err := ParseSubIFDs(b, bIFD, id)
+			if err != nil {
+				return nil, err
+			}
+			for i := 0; i < len(aSubs) || i < len(bSubs); i++ {
+				sub := fmt.Sprintf("%s/%d[%d]", path, id, i)
+				switch {
+				case i >= len(bSubs):
+					changes = append(changes, Change{Kind: ChangeRemoved, Path: sub})
+				case i >= len(aSubs):
+					changes = append(changes, Change{Kind: ChangeAdded, Path: sub})
+				default:
+					if changes, err = diffTree(changes, sub, a, aSubs[i], b, bSubs[i], depth+1); err != nil {
+						return nil, err
+					}
+				}
+			}
+			continue
+		}
+		if _, ok := GetDataTags(id); ok {
+			if af.Count() != bf.Count() {
+				changes = append(changes, Change{Kind: ChangeModified, Path: path, Tag: id, Name: af.Tag().Name(), Old: diffValue(af), New: diffValue(bf)})
+			}
+			continue
+		}
+		aClass, aVals := canonicalValue(af)
+		bClass, bVals := canonicalValue(bf)
+		if aClass != bClass || !bytes.Equal(aVals, bVals) {
+			changes = append(changes, Change{Kind: ChangeModified, Path: path, Tag: id, Name: af.Tag().Name(), Old: diffValue(af), New: diffValue(bf)})
+		}
+	}
+	return changes, nil
+}
+
+// mergeTagIDs returns the union of the sorted lists a and b, sorted.
+func mergeTagIDs(a, b []uint16) []uint16 {
+	ids := make([]uint16, 0, len(a)+len(b))
+	for len(a) > 0 || len(b) > 0 {
+		switch {
+		case len(b) == 0 || len(a) > 0 && a[0] < b[0]:
+			ids, a = append(ids, a[0]), a[1:]
+		case len(a) == 0 || b[0] < a[0]:
+			ids, b = append(ids, b[0]), b[1:]
+		default:
+			ids, a, b = append(ids, a[0]), a[1:], b[1:]
+		}
+	}
+	return ids
+}
+
+// diffValue describes the value of f for a Change.  Fields with offsets to
+// data blocks or sub-IFDs are described by their count alone, since the
+// offsets themselves are not compared.
+func diffValue(f Field) string {
+	id := f.Tag().ID()
+	if _, ok := GetDataTags(id); ok {
+		return fmt.Sprintf("%d blocks", f.Count())
+	}
+	if _, ok := GetSubIFDTag(id); ok {
+		return fmt.Sprintf("%d IFDs", f.Count())
+	}
+	return dumpValue(f, &DumpOptions{})
+}
@@ -2,10 +2,53 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
+// Package dng provides the tags of the Digital Negative (DNG) format and the
+// decoding of the opcode lists DNG files carry for raw processing.
 package dng
 
 import "github.com/google/tiff"
 
+// Tags of commonly used DNG fields.
+const (
+	DNGVersionTagID             = 50706
+	DNGBackwardVersionTagID     = 50707
+	UniqueCameraModelTagID      = 50708
+	CFAPlaneColorTagID          = 50710
+	CFALayoutTagID              = 50711
+	LinearizationTableTagID     = 50712
+	BlackLevelRepeatDimTagID    = 50713
+	BlackLevelTagID             = 50714
+	BlackLevelDeltaHTagID       = 50715
+	BlackLevelDeltaVTagID       = 50716
+	WhiteLevelTagID             = 50717
+	DefaultScaleTagID           = 50718
+	DefaultCropOriginTagID      = 50719
+	DefaultCropSizeTagID        = 50720
+	ColorMatrix1TagID           = 50721
+	ColorMatrix2TagID           = 50722
+	CameraCalibration1TagID     = 50723
+	CameraCalibration2TagID     = 50724
+	AnalogBalanceTagID          = 50727
+	AsShotNeutralTagID          = 50728
+	BaselineExposureTagID       = 50730
+	DNGPrivateDataTagID         = 50740
+	CalibrationIlluminant1TagID = 50778
+	CalibrationIlluminant2TagID = 50779
+	ActiveAreaTagID             = 50829
+	MaskedAreasTagID            = 50830
+	ForwardMatrix1TagID         = 50964
+	ForwardMatrix2TagID         = 50965
+	OpcodeList1TagID            = 51008
+	OpcodeList2TagID            = 51009
+	OpcodeList3TagID            = 51022
+	NoiseProfileTagID           = 51041
+)
+
+// DNGTagSpace holds the tags found in the IFDs of DNG files: the baseline and
+// extended TIFF tags along with the DNG tags of every version.  The DNG tags
+// are also registered with tiff.DefaultTagSpace.
+var DNGTagSpace = tiff.NewTagSpace("DNG")
+
 var (
 	DNGv1_0_0_0Tags = tiff.NewTagSet("DNGv1.0.0.0", 32768, 65535)
 	DNGv1_1_0_0Tags = tiff.NewTagSet("DNGv1.1.0.0", 32768, 65535)
@@ -123,4 +166,11 @@ func init() {
 	DNGv1_4_0_0Tags.Register(tiff.NewTag(51112, "RawToPreviewGain", nil))
 	DNGv1_4_0_0Tags.Lock()
 	tiff.DefaultTagSpace.RegisterTagSet(DNGv1_4_0_0Tags)
+
+	DNGTagSpace.RegisterTagSet(tiff.BaselineTags)
+	DNGTagSpace.RegisterTagSet(tiff.ExtendedTags)
+	for _, ts := range []tiff.TagSet{DNGv1_0_0_0Tags, DNGv1_1_0_0Tags, DNGv1_2_0_0Tags, DNGv1_3_0_0Tags, DNGv1_4_0_0Tags} {
+		DNGTagSpace.RegisterTagSet(ts)
+	}
+	tiff.RegisterTagSpace(DNGTagSpace)
 }
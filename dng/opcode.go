@@ -0,0 +1,407 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dng
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	"github.com/google/tiff"
+)
+
+/* Opcode lists
+
+The OpcodeList1, OpcodeList2 and OpcodeList3 fields hold processing steps to
+apply to the raw image: OpcodeList1 to the data as stored, OpcodeList2 after
+linearization and OpcodeList3 after demosaicing.  Whatever the byte order of
+the file, a list is big endian:
+	Bytes 0-3:  the number of opcodes
+	Then, for each opcode:
+	  Bytes 0-3:    the ID of the opcode
+	  Bytes 4-7:    the DNG version the opcode was defined in
+	  Bytes 8-11:   flags (see Opcode)
+	  Bytes 12-15:  the number of bytes of parameters that follow
+Many opcodes apply to an area of the image, described by the same parameters
+at the start of theirs (see Area).
+*/
+
+// An OpcodeID identifies an opcode.
+type OpcodeID uint32
+
+// Opcodes defined by the DNG specification.
+const (
+	OpWarpRectilinear      OpcodeID = 1
+	OpWarpFisheye          OpcodeID = 2
+	OpFixVignetteRadial    OpcodeID = 3
+	OpFixBadPixelsConstant OpcodeID = 4
+	OpFixBadPixelsList     OpcodeID = 5
+	OpTrimBounds           OpcodeID = 6
+	OpMapTable             OpcodeID = 7
+	OpMapPolynomial        OpcodeID = 8
+	OpGainMap              OpcodeID = 9
+	OpDeltaPerRow          OpcodeID = 10
+	OpDeltaPerColumn       OpcodeID = 11
+	OpScalePerRow          OpcodeID = 12
+	OpScalePerColumn       OpcodeID = 13
+)
+
+var opcodeNames = map[OpcodeID]string{
+	OpWarpRectilinear:      "WarpRectilinear",
+	OpWarpFisheye:          "WarpFisheye",
+	OpFixVignetteRadial:    "FixVignetteRadial",
+	OpFixBadPixelsConstant: "FixBadPixelsConstant",
+	OpFixBadPixelsList:     "FixBadPixelsList",
+	OpTrimBounds:           "TrimBounds",
+	OpMapTable:             "MapTable",
+	OpMapPolynomial:        "MapPolynomial",
+	OpGainMap:              "GainMap",
+	OpDeltaPerRow:          "DeltaPerRow",
+	OpDeltaPerColumn:       "DeltaPerColumn",
+	OpScalePerRow:          "ScalePerRow",
+	OpScalePerColumn:       "ScalePerColumn",
+}
+
+func (id OpcodeID) String() string {
+	if name, ok := opcodeNames[id]; ok {
+		return name
+	}
+	return fmt.Sprintf("OpcodeID(%d)", uint32(id))
+}
+
+// Flags of an opcode.
+const (
+	// FlagOptional marks an opcode that readers which do not know it may
+	// skip.
+	FlagOptional = 1 << 0
+	// FlagPreviewSkip marks an opcode that may be skipped when processing
+	// for a preview.
+	FlagPreviewSkip = 1 << 1
+)
+
+// An Opcode is an entry of an opcode list, with its parameters undecoded (see
+// Decode).
+type Opcode struct {
+	ID      OpcodeID
+	Version [4]byte
+	Flags   uint32
+	Params  []byte
+}
+
+// Optional reports whether op may be skipped by readers that do not know it.
+func (op *Opcode) Optional() bool {
+	return op.Flags&FlagOptional != 0
+}
+
+// maxOpcodes bounds the count at the head of an opcode list, which the slice
+// of opcodes is sized by before any of them is parsed.
+const maxOpcodes = 1 << 16
+
+// ParseOpcodeList returns the opcodes of the opcode list b.
+func ParseOpcodeList(b []byte) ([]Opcode, error) {
+	if len(b) < 4 {
+		return nil, fmt.Errorf("dng: opcode list of %d bytes", len(b))
+	}
+	n := binary.BigEndian.Uint32(b)
+	if n > maxOpcodes {
+		return nil, fmt.Errorf("dng: opcode list of %d opcodes", n)
+	}
+	b = b[4:]
+	ops := make([]Opcode, 0, n)
+	for i := uint32(0); i < n; i++ {
+		if len(b) < 16 {
+			return nil, fmt.Errorf("dng: opcode %d is truncated", i)
+		}
+		op := Opcode{
+			ID:    OpcodeID(binary.BigEndian.Uint32(b)),
+			Flags: binary.BigEndian.Uint32(b[8:]),
+		}
+		copy(op.Version[:], b[4:8])
+		size := binary.BigEndian.Uint32(b[12:])
+		if uint64(size) > uint64(len(b)-16) {
+			return nil, fmt.Errorf("dng: opcode %d (%v) has %d bytes of parameters, but %d are left", i, op.ID, size, len(b)-16)
+		}
+		op.Params = b[16 : 16+size]
+		b = b[16+size:]
+		ops = append(ops, op)
+	}
+	return ops, nil
+}
+
+// OpcodeList returns the opcodes of the opcode list held by the field tagID
+// (OpcodeList1TagID, OpcodeList2TagID or OpcodeList3TagID) of ifd.  If ifd has
+// no such field, nil is returned along with a nil error.
+func OpcodeList(ifd tiff.IFD, tagID uint16) ([]Opcode, error) {
+	if !ifd.HasField(tagID) {
+		return nil, nil
+	}
+	f := ifd.GetField(tagID)
+	switch f.Type().ID() {
+	case tiff.FTUndefined.ID(), tiff.FTByte.ID():
+	default:
+		return nil, tiff.ErrInvalidFieldValue{TagID: tagID, Problem: fmt.Sprintf("unexpected field type %q", f.Type().Name())}
+	}
+	return ParseOpcodeList(f.Value().Bytes()[:f.Count()])
+}
+
+// An Area is the part of the image an opcode applies to: the samples of
+// planes Plane to Plane+Planes-1 in the rows Top to Bottom-1 and columns Left
+// to Right-1, taking every RowPitch-th row and every ColPitch-th column.
+type Area struct {
+	Top, Left, Bottom, Right uint32
+	Plane, Planes            uint32
+	RowPitch, ColPitch       uint32
+}
+
+// WarpRectilinear corrects the geometric distortion and lateral chromatic
+// aberration of a rectilinear lens.  Each plane has radial coefficients
+// Radial[0..3] and tangential coefficients Tangential[0..1]; the center is
+// given relative to the image.
+type WarpRectilinear struct {
+	Planes           []WarpPlane
+	CenterX, CenterY float64
+}
+
+// A WarpPlane holds the coefficients of a plane of a warp opcode.
+// WarpFisheye only uses the radial ones.
+type WarpPlane struct {
+	Radial     [4]float64
+	Tangential [2]float64
+}
+
+// WarpFisheye maps a fisheye image to a rectilinear one.
+type WarpFisheye struct {
+	Planes           []WarpPlane
+	CenterX, CenterY float64
+}
+
+// FixVignetteRadial corrects vignetting with a radial gain of coefficients K.
+type FixVignetteRadial struct {
+	K                [5]float64
+	CenterX, CenterY float64
+}
+
+// FixBadPixelsConstant replaces the pixels of the CFA whose value is Constant.
+type FixBadPixelsConstant struct {
+	Constant   uint32
+	BayerPhase uint32
+}
+
+// A BadRect is a rectangle of bad pixels, bottom and right excluded.
+type BadRect struct {
+	Top, Left, Bottom, Right uint32
+}
+
+// FixBadPixelsList replaces the pixels of the CFA that are listed as bad.
+type FixBadPixelsList struct {
+	BayerPhase uint32
+	// Points are the (row, column) of single bad pixels.
+	Points [][2]uint32
+	Rects  []BadRect
+}
+
+// TrimBounds crops the image to a rectangle, bottom and right excluded.
+type TrimBounds struct {
+	Top, Left, Bottom, Right uint32
+}
+
+// MapTable maps the samples of an area through Table; samples past its end
+// map to its last entry.
+type MapTable struct {
+	Area
+	Table []uint16
+}
+
+// MapPolynomial maps the samples of an area, scaled to [0, 1], through the
+// polynomial of coefficients Coefficients, lowest degree first.
+type MapPolynomial struct {
+	Area
+	Coefficients []float64
+}
+
+// GainMap multiplies the samples of an area by gains interpolated from a grid
+// of MapPointsV by MapPointsH points for each of MapPlanes planes, spaced and
+// placed in image coordinates relative to the image size.
+type GainMap struct {
+	Area
+	MapPointsV, MapPointsH   uint32
+	MapSpacingV, MapSpacingH float64
+	MapOriginV, MapOriginH   float64
+	MapPlanes                uint32
+	// Gains are stored by row, then column, then plane.
+	Gains []float32
+}
+
+// PerLine adds (DeltaPerRow, DeltaPerColumn) a value to, or multiplies
+// (ScalePerRow, ScalePerColumn) by a value, the samples of each row or column
+// of an area.  The values are in the order of the rows or columns.
+type PerLine struct {
+	Area
+	Values []float32
+}
+
+// Decode returns the parameters of op decoded into the type that matches its
+// ID: *WarpRectilinear, *WarpFisheye, *FixVignetteRadial,
+// *FixBadPixelsConstant, *FixBadPixelsList, *TrimBounds, *MapTable,
+// *MapPolynomial, *GainMap, or *PerLine for the four opcodes that take a
+// value per row or column.  Opcodes of other IDs are an error.
+func (op *Opcode) Decode() (interface{}, error) {
+	d := &opDecoder{p: op.Params}
+	var v interface{}
+	switch op.ID {
+	case OpWarpRectilinear, OpWarpFisheye:
+		n := d.uint32()
+		per := uint64(6)
+		if op.ID == OpWarpFisheye {
+			per = 4
+		}
+		if !d.fits(uint64(n), per*8) {
+			break
+		}
+		planes := make([]WarpPlane, n)
+		for i := range planes {
+			for j := range planes[i].Radial {
+				planes[i].Radial[j] = d.float64()
+			}
+			if op.ID == OpWarpRectilinear {
+				for j := range planes[i].Tangential {
+					planes[i].Tangential[j] = d.float64()
+				}
+			}
+		}
+		cx, cy := d.float64(), d.float64()
+		if op.ID == OpWarpRectilinear {
+			v = &WarpRectilinear{planes, cx, cy}
+		} else {
+			v = &WarpFisheye{planes, cx, cy}
+		}
+	case OpFixVignetteRadial:
+		var o FixVignetteRadial
+		for i := range o.K {
+			o.K[i] = d.float64()
+		}
+		o.CenterX, o.CenterY = d.float64(), d.float64()
+		v = &o
+	case OpFixBadPixelsConstant:
+		v = &FixBadPixelsConstant{d.uint32(), d.uint32()}
+	case OpFixBadPixelsList:
+		o := &FixBadPixelsList{BayerPhase: d.uint32()}
+		points, rects := d.uint32(), d.uint32()
+		if !d.fits(uint64(points)*8+uint64(rects)*16, 1) {
+			break
+		}
+		o.Points = make([][2]uint32, points)
+		for i := range o.Points {
+			o.Points[i] = [2]uint32{d.uint32(), d.uint32()}
+		}
+		o.Rects = make([]BadRect, rects)
+		for i := range o.Rects {
+			o.Rects[i] = BadRect{d.uint32(), d.uint32(), d.uint32(), d.uint32()}
+		}
+		v = o
+	case OpTrimBounds:
+		v = &TrimBounds{d.uint32(), d.uint32(), d.uint32(), d.uint32()}
+	case OpMapTable:
+		o := &MapTable{Area: d.area()}
+		n := d.uint32()
+		if !d.fits(uint64(n), 2) {
+			break
+		}
+		o.Table = make([]uint16, n)
+		for i := range o.Table {
+			o.Table[i] = d.uint16()
+		}
+		v = o
+	case OpMapPolynomial:
+		o := &MapPolynomial{Area: d.area()}
+		degree := d.uint32()
+		if degree > 8 {
+			return nil, fmt.Errorf("dng: %v of degree %d", op.ID, degree)
+		}
+		o.Coefficients = make([]float64, degree+1)
+		for i := range o.Coefficients {
+			o.Coefficients[i] = d.float64()
+		}
+		v = o
+	case OpGainMap:
+		o := &GainMap{Area: d.area()}
+		o.MapPointsV, o.MapPointsH = d.uint32(), d.uint32()
+		o.MapSpacingV, o.MapSpacingH = d.float64(), d.float64()
+		o.MapOriginV, o.MapOriginH = d.float64(), d.float64()
+		o.MapPlanes = d.uint32()
+		// The number of points fits in 64 bits, but not once multiplied
+		// by the planes, so the size is checked a factor at a time.
+		points := uint64(o.MapPointsV) * uint64(o.MapPointsH)
+		if !d.fits(points, uint64(o.MapPlanes)*4) {
+			break
+		}
+		o.Gains = make([]float32, points*uint64(o.MapPlanes))
+		for i := range o.Gains {
+			o.Gains[i] = d.float32()
+		}
+		v = o
+	case OpDeltaPerRow, OpDeltaPerColumn, OpScalePerRow, OpScalePerColumn:
+		o := &PerLine{Area: d.area()}
+		n := d.uint32()
+		if !d.fits(uint64(n), 4) {
+			break
+		}
+		o.Values = make([]float32, n)
+		for i := range o.Values {
+			o.Values[i] = d.float32()
+		}
+		v = o
+	default:
+		return nil, fmt.Errorf("dng: unknown opcode %v", op.ID)
+	}
+	if d.short {
+		return nil, fmt.Errorf("dng: %v has %d bytes of parameters, which is too few", op.ID, len(op.Params))
+	}
+	return v, nil
+}
+
+// An opDecoder reads the big endian parameters of an opcode, noting when it
+// runs out of bytes rather than failing at each step.
+type opDecoder struct {
+	p     []byte
+	short bool
+}
+
+func (d *opDecoder) next(n int) []byte {
+	if n > len(d.p) {
+		d.short = true
+		d.p = nil
+		return make([]byte, n)
+	}
+	b := d.p[:n]
+	d.p = d.p[n:]
+	return b
+}
+
+// fits reports whether count values of size bytes are left, so that a count
+// read from the parameters can be trusted with an allocation.  It divides
+// rather than multiplies, which can not overflow.
+func (d *opDecoder) fits(count, size uint64) bool {
+	if size != 0 && count > uint64(len(d.p))/size {
+		d.short = true
+		return false
+	}
+	return true
+}
+
+func (d *opDecoder) uint16() uint16 { return binary.BigEndian.Uint16(d.next(2)) }
+func (d *opDecoder) uint32() uint32 { return binary.BigEndian.Uint32(d.next(4)) }
+
+func (d *opDecoder) float32() float32 {
+	return math.Float32frombits(d.uint32())
+}
+
+func (d *opDecoder) float64() float64 {
+	return math.Float64frombits(binary.BigEndian.Uint64(d.next(8)))
+}
+
+func (d *opDecoder) area() Area {
+	return Area{d.uint32(), d.uint32(), d.uint32(), d.uint32(), d.uint32(), d.uint32(), d.uint32(), d.uint32()}
+}
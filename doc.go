@@ -5,6 +5,12 @@
 /*
 Package tiff implements structures and functionality for working with TIFF data structures.
 
+Reading and writing are kept apart by type.  Functions that only read a file
+accept a ReadAtReadSeeker while functions that modify a file in place (such as
+SetXMP and Edit) require a ReadWriteAtSeeker.  Files opened with OpenReadOnly
+(or ParseFile) are of type *ReadOnlyFile, which only satisfies the former, so
+code handling files that must never change can not modify them by accident.
+
 References:
   [TIFF6]:         http://partners.adobe.com/public/developer/en/tiff/TIFF6.pdf
   [TIFFPM6]:       http://partners.adobe.com/public/developer/en/tiff/TIFFPM6.pdf
@@ -0,0 +1,304 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tiff
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// DumpOptions controls the output of Dump.
+type DumpOptions struct {
+	// MaxValues is the number of values printed for a field before the rest
+	// are left out.  Zero means 10; a negative number prints every value.
+	MaxValues int
+	// Strips prints the offset and byte count of each strip or tile, as
+	// tiffinfo -s does.
+	Strips bool
+	// SubIFDs prints the sub-IFDs (such as the Exif IFD) of each IFD after
+	// it.
+	SubIFDs bool
+}
+
+// Dump writes a description of every IFD of t to w in the format of the
+// tiffinfo tool of libtiff: a line per field with the name tiffinfo gives
+// it and its value decoded.  Fields tiffinfo does not know about are printed
+// with their name from the tag space, or as "Tag N", and their values.  A nil
+// opts uses the defaults.
+func Dump(w io.Writer, t TIFF, opts *DumpOptions) error {
+	if opts == nil {
+		opts = &DumpOptions{}
+	}
+	bw := bufio.NewWriter(w)
+	off := t.FirstOffset()
+	for i, ifd := range t.IFDs() {
+		fmt.Fprintf(bw, "=== TIFF directory %d ===\n", i)
+		fmt.Fprintf(bw, "TIFF Directory at offset %#x (%[1]d)\n", off)
+		dumpIFD(bw, t, ifd, opts, "  ", 0)
+		off = ifd.NextOffset()
+	}
+	return bw.Flush()
+}
+
+// Names of fields as tiffinfo prints them.
+var dumpNames = map[uint16]string{
+	255:   "Subfile Type",
+	258:   "Bits/Sample",
+	259:   "Compression Scheme",
+	262:   "Photometric Interpretation",
+	263:   "Thresholding",
+	264:   "Cell Width",
+	265:   "Cell Length",
+	266:   "FillOrder",
+	269:   "DocumentName",
+	270:   "ImageDescription",
+	271:   "Make",
+	272:   "Model",
+	274:   "Orientation",
+	277:   "Samples/Pixel",
+	278:   "Rows/Strip",
+	280:   "Min Sample Value",
+	281:   "Max Sample Value",
+	285:   "PageName",
+	284:   "Planar Configuration",
+	290:   "Gray Response Unit",
+	292:   "Group 3 Options",
+	293:   "Group 4 Options",
+	297:   "Page Number",
+	305:   "Software",
+	306:   "DateTime",
+	315:   "Artist",
+	316:   "HostComputer",
+	317:   "Predictor",
+	318:   "White Point",
+	319:   "Primary Chromaticities",
+	321:   "Halftone Hints",
+	332:   "Ink Set",
+	333:   "Ink Names",
+	334:   "NumberOfInks",
+	336:   "Dot Range",
+	337:   "Target Printer",
+	338:   "Extra Samples",
+	339:   "Sample Format",
+	340:   "Min Sample Value",
+	341:   "Max Sample Value",
+	530:   "YCbCr Subsampling",
+	531:   "YCbCr Positioning",
+	532:   "Reference Black/White",
+	33432: "Copyright",
+}
+
+// Names of the values of enumerated fields as tiffinfo prints them.
+var dumpValueNames = map[uint16]map[uint64]string{
+	255: {1: "full-resolution image", 2: "reduced-resolution image", 3: "single page of multi-page image"},
+	259: {
+		1: "None", 2: "CCITT modified Huffman RLE", 3: "CCITT Group 3", 4: "CCITT Group 4",
+		5: "LZW", 6: "Old-style JPEG", 7: "JPEG", 8: "AdobeDeflate", 32773: "PackBits",
+		32946: "Deflate", 34712: "JPEG2000", 34887: "LERC", 34925: "LZMA",
+		50000: "ZSTD", 50001: "WEBP",
+	},
+	262: {
+		0: "min-is-white", 1: "min-is-black", 2: "RGB color",
+		3: "palette color (RGB from colormap)", 4: "transparency mask",
+		5: "separated", 6: "YCbCr", 8: "CIE L*a*b*", 9: "ICC L*a*b*",
+		10: "ITU L*a*b*", 32844: "CIE Log2(L)", 32845: "CIE Log2(L) (u',v')",
+	},
+	263: {1: "bilevel art scan", 2: "halftone or dithered scan", 3: "error diffused"},
+	266: {1: "msb-to-lsb", 2: "lsb-to-msb"},
+	274: {
+		1: "row 0 top, col 0 lhs", 2: "row 0 top, col 0 rhs",
+		3: "row 0 bottom, col 0 rhs", 4: "row 0 bottom, col 0 lhs",
+		5: "row 0 lhs, col 0 top", 6: "row 0 rhs, col 0 top",
+		7: "row 0 rhs, col 0 bottom", 8: "row 0 lhs, col 0 bottom",
+	},
+	284: {1: "single image plane", 2: "separate image planes"},
+	317: {1: "none", 2: "horizontal differencing", 3: "floating point predictor"},
+	332: {1: "CMYK", 2: "multi-ink or hi-fi"},
+	339: {1: "unsigned integer", 2: "signed integer", 3: "IEEE floating point", 4: "void", 5: "complex signed integer", 6: "complex IEEE floating point"},
+	531: {1: "centered", 2: "cosited"},
+}
+
+// dumpPartners maps the fields that are printed along with another field to
+// that field.  They are printed on their own in IFDs without it.
+var dumpPartners = map[uint16]uint16{
+	257: 256, // ImageLength, with ImageWidth.
+	283: 282, // YResolution, with XResolution.
+	296: 282, // ResolutionUnit, with XResolution.
+	287: 286, // YPosition, with XPosition.
+	323: 322, // TileLength, with TileWidth.
+	279: 273, // StripByteCounts, with StripOffsets.
+	325: 324, // TileByteCounts, with TileOffsets.
+}
+
+// maxDumpDepth bounds how deep Dump follows sub-IFDs, so that sub-IFDs that
+// point back to their parents are not printed over and over.
+const maxDumpDepth = 8
+
+func dumpIFD(w *bufio.Writer, t TIFF, ifd IFD, opts *DumpOptions, indent string, depth int) {
+	for _, f := range ifd.Fields() {
+		id := f.Tag().ID()
+		if partner, ok := dumpPartners[id]; ok && ifd.HasField(partner) {
+			continue
+		}
+		switch id {
+		case 254:
+			v := dumpUint(f, 0)
+			var kinds []string
+			for bit, name := range []string{"reduced-resolution image", "multi-page document", "transparency mask"} {
+				if v&(1<<uint(bit)) != 0 {
+					kinds = append(kinds, name)
+				}
+			}
+			fmt.Fprintf(w, "%sSubfile Type: %s (%d = %#x)\n", indent, strings.Join(kinds, "/"), v, v)
+		case 256:
+			fmt.Fprintf(w, "%sImage Width: %d Image Length: %d\n", indent, dumpUint(f, 0), dumpUint(ifd.GetField(257), 0))
+		case 322:
+			fmt.Fprintf(w, "%sTile Width: %d Tile Length: %d\n", indent, dumpUint(f, 0), dumpUint(ifd.GetField(323), 0))
+		case 282:
+			unit := "(unitless)"
+			switch dumpUint(ifd.GetField(296), ResolutionUnitInch) {
+			case ResolutionUnitInch:
+				unit = "pixels/inch"
+			case ResolutionUnitCentimeter:
+				unit = "pixels/cm"
+			}
+			fmt.Fprintf(w, "%sResolution: %s, %s %s\n", indent, dumpFloat(f), dumpFloat(ifd.GetField(283)), unit)
+		case 286:
+			fmt.Fprintf(w, "%sPosition: %s, %s\n", indent, dumpFloat(f), dumpFloat(ifd.GetField(287)))
+		case 297:
+			fmt.Fprintf(w, "%sPage Number: %d-%d\n", indent, dumpUint(f, 0), dumpUintAt(f, 1))
+		case 273, 324:
+			kind, counts := "Strips", ifd.GetField(279)
+			if id == 324 {
+				kind, counts = "Tiles", ifd.GetField(325)
+			}
+			if !opts.Strips {
+				continue
+			}
+			offs, _ := uintValues(f)
+			var ns []uint64
+			if counts != nil {
+				ns, _ = uintValues(counts)
+			}
+			fmt.Fprintf(w, "%s%d %s:\n", indent, len(offs), kind)
+			for i, o := range offs {
+				var n uint64
+				if i < len(ns) {
+					n = ns[i]
+				}
+				fmt.Fprintf(w, "%s  %3d: [%8d, %8d]\n", indent, i, o, n)
+			}
+		case 320:
+			fmt.Fprintf(w, "%sColor Map: (present)\n", indent)
+		case 347:
+			fmt.Fprintf(w, "%sJPEG Tables: (%d bytes)\n", indent, f.Count())
+		case 700:
+			fmt.Fprintf(w, "%sXMLPacket (XMP Metadata): <present>, %d bytes\n", indent, len(f.Value().Bytes()))
+		case 34675:
+			fmt.Fprintf(w, "%sICC Profile: <present>, %d bytes\n", indent, len(f.Value().Bytes()))
+		case 33723:
+			fmt.Fprintf(w, "%sRichTIFFIPTC Data: <present>, %d bytes\n", indent, len(f.Value().Bytes()))
+		default:
+			fmt.Fprintf(w, "%s%s: %s\n", indent, dumpName(f), dumpValue(f, opts))
+		}
+		if _, ok := GetSubIFDTag(id); !ok || !opts.SubIFDs || depth >= maxDumpDepth {
+			continue
+		}
+		subs, err := ParseSubIFDs(t, ifd, id)
+		if err != nil {
+			fmt.Fprintf(w, "%s  (unable to read sub-IFDs: %v)\n", indent, err)
+			continue
+		}
+		for i, sub := range subs {
+			fmt.Fprintf(w, "%s--- %s %d ---\n", indent, f.Tag().Name(), i)
+			dumpIFD(w, t, sub, opts, indent+"  ", depth+1)
+		}
+	}
+}
+
+// dumpName returns the name tiffinfo gives f.
+func dumpName(f Field) string {
+	id := f.Tag().ID()
+	if name, ok := dumpNames[id]; ok {
+		return name
+	}
+	if name := f.Tag().Name(); name != "" && !strings.HasPrefix(name, "UNKNOWN_TAG_") {
+		return name
+	}
+	return fmt.Sprintf("Tag %d", id)
+}
+
+// dumpValue returns the values of f as tiffinfo prints them: text as it is,
+// the values of enumerated fields by name, and anything else as a comma
+// separated list of at most opts.MaxValues values.
+func dumpValue(f Field, opts *DumpOptions) string {
+	if f.Type().ID() == FTAscii.ID() {
+		return FieldText(f)
+	}
+	if names, ok := dumpValueNames[f.Tag().ID()]; ok && f.Count() == 1 {
+		v := dumpUint(f, 0)
+		if name, ok := names[v]; ok {
+			if f.Tag().ID() == 317 {
+				return fmt.Sprintf("%s %d (%#x)", name, v, v)
+			}
+			return name
+		}
+		return fmt.Sprintf("%d (%#x)", v, v)
+	}
+	max := opts.MaxValues
+	if max == 0 {
+		max = 10
+	}
+	ft := f.Type()
+	buf, bo := f.Value().Bytes(), f.Value().Order()
+	if ft.Size() == 0 || ft.Repr() == nil {
+		return fmt.Sprintf("(%d bytes)", len(buf))
+	}
+	var vals []string
+	for uint64(len(buf)) >= ft.Size() && uint64(len(vals)) < f.Count() {
+		if max > 0 && len(vals) == max {
+			vals = append(vals, "...")
+			break
+		}
+		vals = append(vals, ft.Repr()(buf[:ft.Size()], bo))
+		buf = buf[ft.Size():]
+	}
+	return strings.Join(vals, ",")
+}
+
+// dumpUint returns the first value of f, or def if f is nil or has no
+// unsigned integer value.
+func dumpUint(f Field, def uint64) uint64 {
+	if f == nil {
+		return def
+	}
+	if vals, err := uintValues(f); err == nil && len(vals) > 0 {
+		return vals[0]
+	}
+	return def
+}
+
+// dumpUintAt returns value i of f, or 0.
+func dumpUintAt(f Field, i int) uint64 {
+	if vals, err := uintValues(f); err == nil && i < len(vals) {
+		return vals[i]
+	}
+	return 0
+}
+
+// dumpFloat returns the first RATIONAL value of f in the notation of
+// tiffinfo.
+func dumpFloat(f Field) string {
+	if f == nil {
+		return "0"
+	}
+	rs, err := Rationals(f)
+	if err != nil || len(rs) == 0 {
+		return "0"
+	}
+	return fmt.Sprintf("%g", rs[0].Float64())
+}
@@ -0,0 +1,517 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tiff
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"time"
+)
+
+// ReadWriteAtSeeker is the interface that wraps the Read, ReadAt, WriteAt, and
+// Seek methods.  An os.File opened for both reading and writing satisfies this
+// interface.  It is used for editing the contents of a TIFF in place.
+type ReadWriteAtSeeker interface {
+	ReadAtReadSeeker
+	io.WriterAt
+}
+
+// ifdOffset returns the file offset of the IFD found at index idx of t.IFDs().
+func ifdOffset(t TIFF, idx int) uint64 {
+	if idx == 0 {
+		return t.FirstOffset()
+	}
+	return t.IFDs()[idx-1].NextOffset()
+}
+
+// rewriteIFD writes a replacement for the IFD at index idx of t.IFDs() to the
+// end of rw.  The fields in set are added to the IFD (replacing any existing
+// field with the same tag) and the fields with a tag found in del are removed.
+// Values of fields that are not in set are left where they are in the file.
+// Only once the new IFD and its new values have been written is the offset
+// that pointed to the old IFD (either in the header or in the previous IFD)
+// patched to point to the new IFD.  The old IFD is left in place as unused
+// space.
+func rewriteIFD(rw ReadWriteAtSeeker, t TIFF, idx int, set []Field, del []uint16) error {
+	if t.OffsetSize() != 4 {
+		return fmt.Errorf("tiff: in-place editing is not supported for an offset size of %d", t.OffsetSize())
+	}
+	ifds := t.IFDs()
+	if idx < 0 || idx >= len(ifds) {
+		return fmt.Errorf("tiff: ifd index %d out of range [0, %d)", idx, len(ifds))
+	}
+	bo := t.R().ByteOrder()
+	newOffset, err := appendIFD(rw, bo, ifds[idx], set, del)
+	if err != nil {
+		return err
+	}
+
+	// Point to the new IFD from either the header or the previous IFD.
+	ptrPos := int64(4)
+	if idx > 0 {
+		ptrPos = int64(ifdOffset(t, idx-1)) + 2 + 12*int64(ifds[idx-1].NumEntries())
+	}
+	var ptr [4]byte
+	bo.PutUint32(ptr[:], uint32(newOffset))
+	if _, err = rw.WriteAt(ptr[:], ptrPos); err != nil {
+		return fmt.Errorf("tiff: unable to update the offset to the new ifd: %v", err)
+	}
+	return nil
+}
+
+// appendIFD writes a copy of ifd, changed as described for rewriteIFD, to the
+// end of rw and returns its offset.  A nil ifd writes a new IFD holding just
+// the fields in set.  Nothing is changed to point to the new IFD.
+func appendIFD(rw ReadWriteAtSeeker, bo binary.ByteOrder, ifd IFD, set []Field, del []uint16) (int64, error) {
+	var old []Field
+	var nextOffset uint64
+	if ifd != nil {
+		old, nextOffset = ifd.Fields(), ifd.NextOffset()
+	}
+	fields := make(map[uint16]Field, len(old)+len(set))
+	fresh := make(map[uint16]bool, len(set))
+	for _, f := range old {
+		fields[f.Tag().ID()] = f
+	}
+	for _, f := range set {
+		fields[f.Tag().ID()] = f
+		fresh[f.Tag().ID()] = true
+	}
+	for _, id := range del {
+		delete(fields, id)
+	}
+	if len(fields) > math.MaxUint16 {
+		return 0, fmt.Errorf("tiff: too many entries (%d) for an ifd", len(fields))
+	}
+	ids := make([]uint16, 0, len(fields))
+	for id := range fields {
+		ids = append(ids, id)
+	}
+	sort.Sort(uint16Slice(ids))
+
+	end, err := rw.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, fmt.Errorf("tiff: unable to locate the end of the file: %v", err)
+	}
+	padding, err := dicomAppend(rw, end)
+	if err != nil {
+		return 0, err
+	}
+	// Everything new is gathered in buf and written starting at end.  Values
+	// are expected to begin on a word boundary, so padding is added
+	// wherever needed to keep offsets even.
+	var buf []byte
+	align := func() {
+		if (end+int64(len(buf)))%2 != 0 {
+			buf = append(buf, 0)
+		}
+	}
+	align()
+
+	entries := make([]byte, 0, len(ids)*12)
+	for _, id := range ids {
+		f := fields[id]
+		size := f.Type().Size() * f.Count()
+		var e [12]byte
+		bo.PutUint16(e[0:], id)
+		bo.PutUint16(e[2:], f.Type().ID())
+		bo.PutUint32(e[4:], uint32(f.Count()))
+		switch {
+		case size <= 4:
+			copy(e[8:], f.Value().Bytes())
+		case !fresh[id]:
+			bo.PutUint32(e[8:], uint32(f.Offset()))
+		default:
+			align()
+			bo.PutUint32(e[8:], uint32(end+int64(len(buf))))
+			buf = append(buf, f.Value().Bytes()[:size]...)
+		}
+		entries = append(entries, e[:]...)
+	}
+
+	align()
+	newOffset := end + int64(len(buf))
+	var num [2]byte
+	bo.PutUint16(num[:], uint16(len(ids)))
+	buf = append(buf, num[:]...)
+	buf = append(buf, entries...)
+	var next [4]byte
+	bo.PutUint32(next[:], uint32(nextOffset))
+	buf = append(buf, next[:]...)
+	if end+int64(len(buf)) > math.MaxUint32 {
+		return 0, fmt.Errorf("tiff: edited file would exceed the 4GB limit of 32 bit offsets")
+	}
+
+	if _, err = rw.WriteAt(buf, end); err != nil {
+		return 0, fmt.Errorf("tiff: unable to write the new ifd: %v", err)
+	}
+	if err = padding.grow(rw, end+int64(len(buf))); err != nil {
+		return 0, err
+	}
+	return newOffset, nil
+}
+
+// An Editor collects changes to the entries of the IFDs of a TIFF and applies
+// them to the file in place.  Only the changed IFDs and any new values are
+// written (appended to the end of the file).  Strips, tiles, and the values of
+// unchanged entries are never moved or rewritten, which keeps metadata-only
+// updates of very large files fast.  Editing is limited to the IFDs found in
+// the main IFD chain (see TIFF.IFDs) of files with 32 bit offsets and the
+// sub-IFDs they reference through a single offset (such as the Exif IFD).
+type Editor struct {
+	rw         ReadWriteAtSeeker
+	tsp        TagSpace
+	ftsp       FieldTypeSpace
+	t          TIFF
+	pending    map[int]*ifdEdit
+	subPending map[subIFDKey]*ifdEdit
+	log        *editLogger
+}
+
+// An editLogger holds what LogEdits records with each edit.
+type editLogger struct {
+	author, note string
+}
+
+type ifdEdit struct {
+	set map[uint16]Field
+	del map[uint16]bool
+}
+
+func newIFDEdit() *ifdEdit {
+	return &ifdEdit{set: make(map[uint16]Field, 1), del: make(map[uint16]bool, 1)}
+}
+
+// subIFDKey identifies the sub-IFD referenced by tag tagID of the IFD at index
+// idx.
+type subIFDKey struct {
+	idx   int
+	tagID uint16
+}
+
+// Edit parses the TIFF found in rw and returns an Editor for it.  Changes are
+// only written to rw when Commit is called.  Wrap a file with OpenJournaled
+// for edits that can be rolled back if they are interrupted.
+func Edit(rw ReadWriteAtSeeker, tsp TagSpace, ftsp FieldTypeSpace) (*Editor, error) {
+	e := &Editor{
+		rw:         rw,
+		tsp:        tsp,
+		ftsp:       ftsp,
+		pending:    make(map[int]*ifdEdit, 1),
+		subPending: make(map[subIFDKey]*ifdEdit, 1),
+	}
+	if err := e.parse(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (e *Editor) parse() error {
+	if _, err := e.rw.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("tiff: unable to seek to the start of the file: %v", err)
+	}
+	t, err := Parse(e.rw, e.tsp, e.ftsp)
+	if err != nil {
+		return err
+	}
+	if t.OffsetSize() != 4 {
+		return fmt.Errorf("tiff: in-place editing is not supported for an offset size of %d", t.OffsetSize())
+	}
+	e.t = t
+	return nil
+}
+
+// TIFF returns the TIFF as it was at the last call to Edit or Commit.  Pending
+// changes are not reflected.
+func (e *Editor) TIFF() TIFF {
+	return e.t
+}
+
+// ByteOrder returns the byte order of the file.  Values given to Set must be
+// encoded with this byte order.
+func (e *Editor) ByteOrder() binary.ByteOrder {
+	return e.t.R().ByteOrder()
+}
+
+func (e *Editor) edits(idx int) (*ifdEdit, error) {
+	if idx < 0 || idx >= len(e.t.IFDs()) {
+		return nil, fmt.Errorf("tiff: ifd index %d out of range [0, %d)", idx, len(e.t.IFDs()))
+	}
+	ie := e.pending[idx]
+	if ie == nil {
+		ie = newIFDEdit()
+		e.pending[idx] = ie
+	}
+	return ie, nil
+}
+
+func (e *Editor) subEdits(idx int, subIFDTagID uint16) (*ifdEdit, error) {
+	if idx < 0 || idx >= len(e.t.IFDs()) {
+		return nil, fmt.Errorf("tiff: ifd index %d out of range [0, %d)", idx, len(e.t.IFDs()))
+	}
+	if _, ok := GetSubIFDTag(subIFDTagID); !ok {
+		return nil, fmt.Errorf("tiff: tag %d is not registered as a sub-ifd tag", subIFDTagID)
+	}
+	key := subIFDKey{idx, subIFDTagID}
+	ie := e.subPending[key]
+	if ie == nil {
+		ie = newIFDEdit()
+		e.subPending[key] = ie
+	}
+	return ie, nil
+}
+
+// newField returns a field holding count values of type typeID in value,
+// checking that value is large enough.
+func (e *Editor) newField(tagID, typeID uint16, count uint32, value []byte) (Field, error) {
+	ftsp := e.ftsp
+	if ftsp == nil {
+		ftsp = DefaultFieldTypeSpace
+	}
+	ft := ftsp.GetFieldType(typeID)
+	if problem := checkFieldType(ft, false); problem != "" {
+		return nil, fmt.Errorf("tiff: value for tag %d has type %d: %s", tagID, typeID, problem)
+	}
+	size := ft.Size() * uint64(count)
+	if uint64(len(value)) < size {
+		return nil, fmt.Errorf("tiff: value for tag %d has %d bytes, but %d are needed for %d values of type %d", tagID, len(value), size, count, typeID)
+	}
+	return newField(tagID, typeID, count, value[:size], e.ByteOrder(), e.tsp, e.ftsp), nil
+}
+
+// Set adds an entry to the IFD at index idx, replacing any existing entry with
+// the same tag.  The entry holds count values of type typeID encoded in value
+// using the file's byte order (see ByteOrder).
+func (e *Editor) Set(idx int, tagID, typeID uint16, count uint32, value []byte) error {
+	f, err := e.newField(tagID, typeID, count, value)
+	if err != nil {
+		return err
+	}
+	return e.SetField(idx, f)
+}
+
+// SetValue is like Set, but encodes value as values of type ft with NewEntry
+// and computes their count.
+func (e *Editor) SetValue(idx int, tagID uint16, ft FieldType, value interface{}) error {
+	b, err := NewEntry(tagID, ft, value, e.ByteOrder(), false)
+	if err != nil {
+		return err
+	}
+	f, err := b.Field(e.tsp, e.ftsp)
+	if err != nil {
+		return err
+	}
+	return e.SetField(idx, f)
+}
+
+// SetField adds f to the IFD at index idx, replacing any existing entry with
+// the same tag.  A field taken from another file may be used as long as it has
+// the same byte order.
+func (e *Editor) SetField(idx int, f Field) error {
+	if f.Value().Order() != e.ByteOrder() {
+		return fmt.Errorf("tiff: value for tag %d is not in the byte order of the file", f.Tag().ID())
+	}
+	ie, err := e.edits(idx)
+	if err != nil {
+		return err
+	}
+	id := f.Tag().ID()
+	ie.set[id] = f
+	delete(ie.del, id)
+	return nil
+}
+
+// Delete removes the entry for tagID from the IFD at index idx.  Deleting an
+// entry that does not exist is not an error.
+func (e *Editor) Delete(idx int, tagID uint16) error {
+	ie, err := e.edits(idx)
+	if err != nil {
+		return err
+	}
+	delete(ie.set, tagID)
+	ie.del[tagID] = true
+	return nil
+}
+
+// Field returns the entry for tagID of the IFD at index idx as it will be once
+// the pending changes are committed.  It lets changes that build on an entry
+// (such as edits to the XMP packet) see earlier changes that are not yet
+// committed.
+func (e *Editor) Field(idx int, tagID uint16) (Field, bool) {
+	if idx < 0 || idx >= len(e.t.IFDs()) {
+		return nil, false
+	}
+	if ie := e.pending[idx]; ie != nil {
+		if f, ok := ie.set[tagID]; ok {
+			return f, true
+		}
+		if ie.del[tagID] {
+			return nil, false
+		}
+	}
+	ifd := e.t.IFDs()[idx]
+	if !ifd.HasField(tagID) {
+		return nil, false
+	}
+	return ifd.GetField(tagID), true
+}
+
+// SetSub is like Set, but it changes the sub-IFD referenced by the tag
+// subIFDTagID (which must be registered with RegisterSubIFDTag) of the IFD at
+// index idx.  If the IFD has no such sub-IFD, one is created.
+func (e *Editor) SetSub(idx int, subIFDTagID, tagID, typeID uint16, count uint32, value []byte) error {
+	f, err := e.newField(tagID, typeID, count, value)
+	if err != nil {
+		return err
+	}
+	return e.SetSubField(idx, subIFDTagID, f)
+}
+
+// SetSubField is like SetField for the sub-IFD described by SetSub.
+func (e *Editor) SetSubField(idx int, subIFDTagID uint16, f Field) error {
+	if f.Value().Order() != e.ByteOrder() {
+		return fmt.Errorf("tiff: value for tag %d is not in the byte order of the file", f.Tag().ID())
+	}
+	ie, err := e.subEdits(idx, subIFDTagID)
+	if err != nil {
+		return err
+	}
+	id := f.Tag().ID()
+	ie.set[id] = f
+	delete(ie.del, id)
+	return nil
+}
+
+// DeleteSub is like Delete for the sub-IFD described by SetSub.
+func (e *Editor) DeleteSub(idx int, subIFDTagID, tagID uint16) error {
+	ie, err := e.subEdits(idx, subIFDTagID)
+	if err != nil {
+		return err
+	}
+	delete(ie.set, tagID)
+	ie.del[tagID] = true
+	return nil
+}
+
+// commitSub writes the changed copy of a sub-IFD and queues the change to its
+// parent that points to it.
+func (e *Editor) commitSub(key subIFDKey, ie *ifdEdit) error {
+	parent := e.t.IFDs()[key.idx]
+	var sub IFD
+	typeID := FTLong.ID()
+	if parent.HasField(key.tagID) {
+		f := parent.GetField(key.tagID)
+		if f.Count() != 1 {
+			return fmt.Errorf("tiff: tag %d references %d sub-ifds; only single sub-ifds can be edited", key.tagID, f.Count())
+		}
+		subs, err := ParseSubIFDs(e.t, parent, key.tagID)
+		if err != nil {
+			return err
+		}
+		sub, typeID = subs[0], f.Type().ID()
+	}
+	set, del := ie.lists()
+	off, err := appendIFD(e.rw, e.ByteOrder(), sub, set, del)
+	if err != nil {
+		return err
+	}
+	var ptr [4]byte
+	e.ByteOrder().PutUint32(ptr[:], uint32(off))
+	pe, err := e.edits(key.idx)
+	if err != nil {
+		return err
+	}
+	pe.set[key.tagID] = newField(key.tagID, typeID, 1, ptr[:], e.ByteOrder(), e.tsp, e.ftsp)
+	return nil
+}
+
+func (ie *ifdEdit) lists() (set []Field, del []uint16) {
+	set = make([]Field, 0, len(ie.set))
+	for _, f := range ie.set {
+		set = append(set, f)
+	}
+	del = make([]uint16, 0, len(ie.del))
+	for id := range ie.del {
+		del = append(del, id)
+	}
+	return set, del
+}
+
+// LogEdits makes Commit add a record (see EditRecord) to the edit log of each
+// IFD of the main IFD chain it changes, naming author and describing the edit
+// with note.  Changes to a sub-IFD are recorded in the log of its parent as a
+// change to the tag referencing it.  Logging stays on for later commits, with
+// the author and note of the last call; an empty author and note turn it off.
+func (e *Editor) LogEdits(author, note string) error {
+	if len(author) > math.MaxUint16 || len(note) > math.MaxUint16 {
+		return fmt.Errorf("tiff: edit log author and note are limited to %d bytes", math.MaxUint16)
+	}
+	if author == "" && note == "" {
+		e.log = nil
+	} else {
+		e.log = &editLogger{author, note}
+	}
+	return nil
+}
+
+// Commit writes all pending changes to the file and parses it again so that
+// the Editor (and TIFF) reflect the new contents.  Changed sub-IFDs are
+// written first and their parents are then changed to point to them, so
+// Commit fails, writing nothing, if a parent's tag referencing a changed
+// sub-IFD is also set or deleted.
+func (e *Editor) Commit() error {
+	// A sub-IFD is committed by pointing its tag at the new copy, which an
+	// edit of that tag itself would undo or overwrite, orphaning the copy.
+	for key := range e.subPending {
+		if pe := e.pending[key.idx]; pe != nil {
+			_, set := pe.set[key.tagID]
+			_, del := pe.del[key.tagID]
+			if set || del {
+				return fmt.Errorf("tiff: tag %d of ifd %d and the sub-ifd it references are both edited; commit them separately", key.tagID, key.idx)
+			}
+		}
+	}
+	for key, ie := range e.subPending {
+		if err := e.commitSub(key, ie); err != nil {
+			return err
+		}
+		delete(e.subPending, key)
+	}
+	idxs := make([]int, 0, len(e.pending))
+	for idx := range e.pending {
+		idxs = append(idxs, idx)
+	}
+	sort.Ints(idxs)
+	for _, idx := range idxs {
+		set, del := e.pending[idx].lists()
+		if e.log != nil {
+			f, err := appendEditLog(e.t.IFDs()[idx], set, del, e.log.author, e.log.note, time.Now(), e.ByteOrder(), e.tsp, e.ftsp)
+			if err != nil {
+				return err
+			}
+			set = append(set, f)
+			for i, id := range del {
+				if id == EditLogTagID {
+					// Deleting the log starts a new one.
+					del = append(del[:i], del[i+1:]...)
+					break
+				}
+			}
+		}
+		if err := rewriteIFD(e.rw, e.t, idx, set, del); err != nil {
+			return err
+		}
+		delete(e.pending, idx)
+		// Rewriting an IFD moves it, so the file is parsed again to find
+		// where the pointer to the next edited IFD now lives.
+		if err := e.parse(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,292 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tiff
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// EditLogTagID is the ID of the private tag in which an Editor keeps the log of
+// the edits made to an IFD (see Editor.LogEdits).  It is in the range set
+// aside for reusable private tags, so other writers may use it for something
+// else: it is not registered in DefaultTagSpace, and a value without the
+// signature of an edit log is taken for theirs (see EditLog).
+const EditLogTagID = 65000
+
+// editLogMagic starts the value of an edit log, followed by its version.
+var editLogMagic = []byte("TIFFEDITLOG\x00\x01")
+
+// An EditRecord is an entry of an edit log: one commit of changes to an IFD.
+//
+// Each record holds the Hash of the one before it, so that a record can not be
+// changed, removed, or inserted without breaking the chain, and the State of
+// the IFD once the edit was made, so that edits made without adding a record
+// show up as well.  A log can still be rewritten from scratch by someone who
+// sets out to; it makes tampering evident, not impossible.
+//
+// Edit log structure
+//
+//	Bytes 0-12:  "TIFFEDITLOG", a NUL, and the version (1)
+//	Records, each of:
+//	  8 bytes:   Time, in nanoseconds since the Unix epoch (big endian)
+//	  2 bytes:   length of Author, then Author (UTF-8)
+//	  2 bytes:   length of Note, then Note (UTF-8)
+//	  2 bytes:   number of tags in Set, then the tags (2 bytes each)
+//	  2 bytes:   number of tags in Deleted, then the tags (2 bytes each)
+//	  32 bytes:  State
+//	  32 bytes:  Hash
+type EditRecord struct {
+	Time    time.Time
+	Author  string
+	Note    string
+	Set     []uint16 // tags added or changed, in increasing order
+	Deleted []uint16 // tags removed, in increasing order
+	// State is the hash of the fields of the IFD after the edit, computed
+	// as for FingerprintIFD but leaving out the edit log itself.
+	State Fingerprint
+	// Hash is the SHA-256 of the Hash of the previous record (zeros for
+	// the first record) followed by the encoding of this record up to
+	// Hash.
+	Hash [sha256.Size]byte
+}
+
+// EditLog returns the records of the edit log of ifd, oldest first.  If ifd has
+// no edit log, nil is returned along with a nil error; so it is if another
+// writer used EditLogTagID for something else.  The records are not checked;
+// use VerifyEditLog for that.
+func EditLog(ifd IFD) ([]EditRecord, error) {
+	if !hasEditLog(ifd) {
+		return nil, nil
+	}
+	f := ifd.GetField(EditLogTagID)
+	return decodeEditLog(f.Value().Bytes()[:f.Count()])
+}
+
+// hasEditLog reports whether ifd has an EditLogTagID field holding an edit
+// log, rather than another writer's data.
+func hasEditLog(ifd IFD) bool {
+	if !ifd.HasField(EditLogTagID) {
+		return false
+	}
+	f := ifd.GetField(EditLogTagID)
+	switch f.Type().ID() {
+	case FTUndefined.ID(), FTByte.ID():
+	default:
+		return false
+	}
+	p := f.Value().Bytes()
+	return uint64(len(p)) >= f.Count() && bytes.HasPrefix(p[:f.Count()], editLogMagic)
+}
+
+// VerifyEditLog checks the edit log of ifd: that the hash of each record
+// follows from the records before it, and that the state recorded last is that
+// of the fields of ifd.  The error names the first record that fails.  An IFD
+// without an edit log passes.
+func VerifyEditLog(ifd IFD) error {
+	recs, err := EditLog(ifd)
+	if err != nil || len(recs) == 0 {
+		return err
+	}
+	var prev [sha256.Size]byte
+	for i, rec := range recs {
+		if rec.chainHash(prev) != rec.Hash {
+			return ErrInvalidFieldValue{EditLogTagID, fmt.Sprintf("the hash of record %d does not match its contents", i)}
+		}
+		prev = rec.Hash
+	}
+	if last := len(recs) - 1; recs[last].State != editLogState(ifd.Fields()) {
+		return ErrInvalidFieldValue{EditLogTagID, fmt.Sprintf("the ifd was changed after record %d", last)}
+	}
+	return nil
+}
+
+// encode appends the encoding of rec, up to its Hash, to buf.
+func (rec *EditRecord) encode(buf *bytes.Buffer) {
+	var num [8]byte
+	binary.BigEndian.PutUint64(num[:], uint64(rec.Time.UnixNano()))
+	buf.Write(num[:])
+	for _, s := range []string{rec.Author, rec.Note} {
+		binary.BigEndian.PutUint16(num[:], uint16(len(s)))
+		buf.Write(num[:2])
+		buf.WriteString(s)
+	}
+	for _, ids := range [][]uint16{rec.Set, rec.Deleted} {
+		binary.BigEndian.PutUint16(num[:], uint16(len(ids)))
+		buf.Write(num[:2])
+		for _, id := range ids {
+			binary.BigEndian.PutUint16(num[:], id)
+			buf.Write(num[:2])
+		}
+	}
+	buf.Write(rec.State[:])
+}
+
+// chainHash returns the Hash rec should have when it follows a record whose
+// Hash is prev.
+func (rec *EditRecord) chainHash(prev [sha256.Size]byte) [sha256.Size]byte {
+	var buf bytes.Buffer
+	buf.Write(prev[:])
+	rec.encode(&buf)
+	return sha256.Sum256(buf.Bytes())
+}
+
+func decodeEditLog(p []byte) ([]EditRecord, error) {
+	if !bytes.HasPrefix(p, editLogMagic) {
+		return nil, ErrInvalidFieldValue{EditLogTagID, "not an edit log"}
+	}
+	p = p[len(editLogMagic):]
+	var recs []EditRecord
+	for len(p) > 0 {
+		d := editLogDecoder{p: p}
+		var rec EditRecord
+		rec.Time = time.Unix(0, int64(binary.BigEndian.Uint64(d.next(8)))).UTC()
+		rec.Author = string(d.next(int(d.uint16())))
+		rec.Note = string(d.next(int(d.uint16())))
+		rec.Set = d.tags()
+		rec.Deleted = d.tags()
+		copy(rec.State[:], d.next(sha256.Size))
+		copy(rec.Hash[:], d.next(sha256.Size))
+		if d.short {
+			return nil, ErrInvalidFieldValue{EditLogTagID, fmt.Sprintf("record %d is truncated", len(recs))}
+		}
+		recs = append(recs, rec)
+		p = d.p
+	}
+	return recs, nil
+}
+
+// An editLogDecoder reads the parts of a record, noting when it runs out of
+// bytes rather than failing at each step.
+type editLogDecoder struct {
+	p     []byte
+	short bool
+}
+
+func (d *editLogDecoder) next(n int) []byte {
+	if n > len(d.p) {
+		d.short = true
+		d.p = nil
+		return make([]byte, n)
+	}
+	b := d.p[:n]
+	d.p = d.p[n:]
+	return b
+}
+
+func (d *editLogDecoder) uint16() uint16 {
+	return binary.BigEndian.Uint16(d.next(2))
+}
+
+func (d *editLogDecoder) tags() []uint16 {
+	n := int(d.uint16())
+	if 2*n > len(d.p) {
+		d.short = true
+		return nil
+	}
+	ids := make([]uint16, n)
+	for i := range ids {
+		ids[i] = d.uint16()
+	}
+	return ids
+}
+
+// editLogState returns the State of an IFD holding fields.  When a tag appears
+// more than once, the first field counts, as with IFD.GetField.
+func editLogState(fields []Field) Fingerprint {
+	byID := make(map[uint16]Field, len(fields))
+	ids := make([]uint16, 0, len(fields))
+	for _, f := range fields {
+		id := f.Tag().ID()
+		if _, ok := byID[id]; ok || id == EditLogTagID {
+			continue
+		}
+		byID[id] = f
+		ids = append(ids, id)
+	}
+	sort.Sort(uint16Slice(ids))
+	h := sha256.New()
+	for _, id := range ids {
+		hashField(h, byID[id])
+	}
+	var fp Fingerprint
+	copy(fp[:], h.Sum(nil))
+	return fp
+}
+
+// appendEditLog returns the field holding the edit log of ifd with a record of
+// the changes set and del added to it.  A log that can not be decoded is an
+// error rather than being replaced, since that would hide its history, and so
+// is another writer's EditLogTagID field, which the log would overwrite.
+func appendEditLog(ifd IFD, set []Field, del []uint16, author, note string, now time.Time, bo binary.ByteOrder, tsp TagSpace, ftsp FieldTypeSpace) (Field, error) {
+	var log []byte
+	var prev [sha256.Size]byte
+	if ifd.HasField(EditLogTagID) && !containsTag(del, EditLogTagID) {
+		if !hasEditLog(ifd) {
+			return nil, ErrInvalidFieldValue{EditLogTagID, "the tag holds another writer's data, not an edit log"}
+		}
+		recs, err := EditLog(ifd)
+		if err != nil {
+			return nil, err
+		}
+		f := ifd.GetField(EditLogTagID)
+		log = f.Value().Bytes()[:f.Count()]
+		if len(recs) > 0 {
+			prev = recs[len(recs)-1].Hash
+		}
+	}
+	rec := EditRecord{Time: now, Author: author, Note: note}
+	changed := make(map[uint16]bool, len(set))
+	var fields []Field
+	for _, f := range set {
+		if id := f.Tag().ID(); id != EditLogTagID {
+			changed[id] = true
+			rec.Set = append(rec.Set, id)
+			fields = append(fields, f)
+		}
+	}
+	removed := make(map[uint16]bool, len(del))
+	for _, id := range del {
+		if id != EditLogTagID && !changed[id] && ifd.HasField(id) {
+			removed[id] = true
+			rec.Deleted = append(rec.Deleted, id)
+		}
+	}
+	for _, f := range ifd.Fields() {
+		if id := f.Tag().ID(); !changed[id] && !removed[id] {
+			fields = append(fields, f)
+		}
+	}
+	sort.Sort(uint16Slice(rec.Set))
+	sort.Sort(uint16Slice(rec.Deleted))
+	rec.State = editLogState(fields)
+
+	var buf bytes.Buffer
+	if log == nil {
+		buf.Write(editLogMagic)
+	} else {
+		buf.Write(log)
+	}
+	rec.Hash = rec.chainHash(prev)
+	rec.encode(&buf)
+	buf.Write(rec.Hash[:])
+	if buf.Len() > 1<<31 {
+		return nil, fmt.Errorf("tiff: the edit log has grown too large")
+	}
+	return newField(EditLogTagID, FTUndefined.ID(), uint32(buf.Len()), buf.Bytes(), bo, tsp, ftsp), nil
+}
+
+func containsTag(ids []uint16, id uint16) bool {
+	for _, x := range ids {
+		if x == id {
+			return true
+		}
+	}
+	return false
+}
@@ -5,8 +5,11 @@
 package tiff
 
 import (
+	"encoding/binary"
 	"encoding/json"
 	"fmt"
+	"io"
+	"math"
 )
 
 /*
@@ -75,19 +78,204 @@ func (e *entry) MarshalJSON() ([]byte, error) {
 	return json.Marshal(tmp)
 }
 
+// UnmarshalJSON reads an entry in the form written by MarshalJSON.
+func (e *entry) UnmarshalJSON(data []byte) error {
+	var tmp struct {
+		Tag         uint16  `json:"tagID"`
+		Type        uint16  `json:"typeID"`
+		Count       uint32  `json:"count"`
+		ValueOffset [4]byte `json:"valueOffset"`
+	}
+	if err := json.Unmarshal(data, &tmp); err != nil {
+		return err
+	}
+	e.tagID, e.typeID, e.count, e.valueOffset = tmp.Tag, tmp.Type, tmp.Count, tmp.ValueOffset
+	return nil
+}
+
 func ParseEntry(br BReader) (out Entry, err error) {
 	e := new(entry)
+	pos, _ := br.Seek(0, io.SeekCurrent)
 	if err = br.BRead(&e.tagID); err != nil {
-		return
+		return nil, ReadError(err, "an ifd entry", ErrorContext{Offset: uint64(pos), IFD: -1})
+	}
+	ctx := ErrorContext{Offset: uint64(pos), TagID: e.tagID, IFD: -1}
+	for _, v := range []interface{}{&e.typeID, &e.count, &e.valueOffset} {
+		if err = br.BRead(v); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, ReadError(err, "an ifd entry", ctx)
+		}
+	}
+	return e, nil
+}
+
+// GenericEntry is the view of an IFD entry shared by TIFF and BigTIFF files.
+// Counts and offsets are always 64 bits wide, and IsBig reports whether the
+// entry came from (or is destined for) a BigTIFF, in which case ValueOffset
+// holds 8 bytes instead of 4.  Entries returned by ParseEntry (and by
+// bigtiff.ParseEntry) implement GenericEntry in addition to their own Entry
+// interface.
+type GenericEntry interface {
+	TagID() uint16
+	TypeID() uint16
+	Count64() uint64
+	RawValueOffset() []byte
+	ValueOffset64(bo binary.ByteOrder) uint64
+	IsBig() bool
+}
+
+func (e *entry) Count64() uint64 {
+	return uint64(e.count)
+}
+
+func (e *entry) RawValueOffset() []byte {
+	return e.valueOffset[:]
+}
+
+func (e *entry) ValueOffset64(bo binary.ByteOrder) uint64 {
+	return uint64(bo.Uint32(e.valueOffset[:]))
+}
+
+func (e *entry) IsBig() bool {
+	return false
+}
+
+// NewGenericEntry returns e as a GenericEntry.
+func NewGenericEntry(e Entry) GenericEntry {
+	if ge, ok := e.(GenericEntry); ok {
+		return ge
 	}
-	if err = br.BRead(&e.typeID); err != nil {
-		return
+	return &entry{tagID: e.TagID(), typeID: e.TypeID(), count: e.Count(), valueOffset: e.ValueOffset()}
+}
+
+// ClassicEntry returns ge as an Entry of a TIFF with 32 bit offsets.  An error
+// is returned if the count or the value offset of a BigTIFF entry do not fit.
+// bo is the byte order used to interpret the value offset.
+func ClassicEntry(ge GenericEntry, bo binary.ByteOrder) (Entry, error) {
+	if e, ok := ge.(Entry); ok && !ge.IsBig() {
+		return e, nil
 	}
-	if err = br.BRead(&e.count); err != nil {
-		return
+	if ge.Count64() > math.MaxUint32 {
+		return nil, fmt.Errorf("tiff: count %d of tag %d does not fit in 32 bits", ge.Count64(), ge.TagID())
 	}
-	if err = br.BRead(&e.valueOffset); err != nil {
-		return
+	e := &entry{tagID: ge.TagID(), typeID: ge.TypeID(), count: uint32(ge.Count64())}
+	raw := ge.RawValueOffset()
+	if len(raw) > 4 {
+		// An inline value keeps its leading bytes, but an offset has to be
+		// converted.  Only values of 4 bytes or less fit inline.
+		if DefaultFieldTypeSpace.GetFieldType(ge.TypeID()).Size()*ge.Count64() > 4 {
+			off := ge.ValueOffset64(bo)
+			if off > math.MaxUint32 {
+				return nil, fmt.Errorf("tiff: offset %d of tag %d does not fit in 32 bits", off, ge.TagID())
+			}
+			bo.PutUint32(e.valueOffset[:], uint32(off))
+			return e, nil
+		}
 	}
+	copy(e.valueOffset[:], raw)
 	return e, nil
 }
+
+// EntryOf returns the entry behind f.  Fields parsed by this package or the
+// bigtiff package return their own entries.  For any other Field, an
+// equivalent entry is built from its tag, type, count, offset, and value.
+func EntryOf(f Field) GenericEntry {
+	if ef, ok := f.(interface {
+		GenericEntry() GenericEntry
+	}); ok {
+		return ef.GenericEntry()
+	}
+	return &syntheticEntry{
+		tagID:  f.Tag().ID(),
+		typeID: f.Type().ID(),
+		count:  f.Count(),
+		offset: f.Offset(),
+		value:  f.Value(),
+	}
+}
+
+// syntheticEntry is a GenericEntry built from a Field.
+type syntheticEntry struct {
+	tagID  uint16
+	typeID uint16
+	count  uint64
+	offset uint64
+	value  FieldValue
+}
+
+func (e *syntheticEntry) TagID() uint16   { return e.tagID }
+func (e *syntheticEntry) TypeID() uint16  { return e.typeID }
+func (e *syntheticEntry) Count64() uint64 { return e.count }
+func (e *syntheticEntry) IsBig() bool     { return e.count > math.MaxUint32 || e.offset > math.MaxUint32 }
+
+func (e *syntheticEntry) RawValueOffset() []byte {
+	n := 4
+	if e.IsBig() {
+		n = 8
+	}
+	raw := make([]byte, n)
+	if e.offset != 0 {
+		if n == 8 {
+			e.value.Order().PutUint64(raw, e.offset)
+		} else {
+			e.value.Order().PutUint32(raw, uint32(e.offset))
+		}
+	} else {
+		copy(raw, e.value.Bytes())
+	}
+	return raw
+}
+
+func (e *syntheticEntry) ValueOffset64(bo binary.ByteOrder) uint64 {
+	raw := e.RawValueOffset()
+	if len(raw) == 8 {
+		return bo.Uint64(raw)
+	}
+	return uint64(bo.Uint32(raw))
+}
+
+// EntrySize is the size in bytes of an IFD entry as stored in a TIFF file.
+const EntrySize = 12
+
+// An OrderedEntry is an Entry along with the byte order of its file, which is
+// needed to convert it to and from the 12 bytes it is stored as.  The value
+// offset is kept as raw bytes, so it is not affected by the byte order.
+type OrderedEntry struct {
+	Entry
+	Order binary.ByteOrder
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+func (oe OrderedEntry) MarshalBinary() ([]byte, error) {
+	if oe.Entry == nil || oe.Order == nil {
+		return nil, fmt.Errorf("tiff: entry or byte order missing")
+	}
+	b := make([]byte, EntrySize)
+	oe.Order.PutUint16(b[0:], oe.TagID())
+	oe.Order.PutUint16(b[2:], oe.TypeID())
+	oe.Order.PutUint32(b[4:], oe.Count())
+	vo := oe.ValueOffset()
+	copy(b[8:], vo[:])
+	return b, nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.  Order must be set
+// beforehand; Entry is replaced by the entry held by data.
+func (oe *OrderedEntry) UnmarshalBinary(data []byte) error {
+	if oe.Order == nil {
+		return fmt.Errorf("tiff: byte order missing")
+	}
+	if len(data) != EntrySize {
+		return fmt.Errorf("tiff: an entry is %d bytes, not %d", EntrySize, len(data))
+	}
+	e := &entry{
+		tagID:  oe.Order.Uint16(data[0:]),
+		typeID: oe.Order.Uint16(data[2:]),
+		count:  oe.Order.Uint32(data[4:]),
+	}
+	copy(e.valueOffset[:], data[8:])
+	oe.Entry = e
+	return nil
+}
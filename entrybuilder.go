@@ -0,0 +1,315 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tiff
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+)
+
+// An EntryBuilder is an IFD entry that is being made, along with its value.
+// It implements GenericEntry.  A value that fits in the value offset of the
+// entry (4 bytes, or 8 in a BigTIFF) is stored there; any other value has to
+// be written elsewhere in the file and its offset given with SetOffset.
+type EntryBuilder struct {
+	tagID  uint16
+	ft     FieldType
+	order  binary.ByteOrder
+	big    bool
+	count  uint64
+	value  []byte
+	offset uint64
+}
+
+// NewEntry returns an entry for tagID holding value as values of type ft,
+// encoded in bo, for a BigTIFF if big is set.  See SetValue for the values
+// that are supported.
+func NewEntry(tagID uint16, ft FieldType, value interface{}, bo binary.ByteOrder, big bool) (*EntryBuilder, error) {
+	if problem := checkFieldType(ft, big); problem != "" {
+		return nil, fmt.Errorf("tiff: entry for tag %d: %s", tagID, problem)
+	}
+	b := &EntryBuilder{tagID: tagID, ft: ft, order: bo, big: big}
+	if err := b.SetValue(value); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// SetValue replaces the value of b, computing its count.  The value may be:
+//
+//	a string, for ASCII (a NUL is added if there is none at the end);
+//	a []byte, for BYTE, SBYTE, UNDEFINED and ASCII, taken as it is;
+//	a Rational or SRational, or a slice of them, for RATIONAL and SRATIONAL;
+//	an integer or floating point number, or a slice or array of them, for
+//	any numeric type as long as each value fits in it.  Floating point
+//	numbers are approximated for RATIONAL and SRATIONAL (see RationalOf).
+//
+// A value that no longer fits in the value offset has to be given a new
+// offset with SetOffset.
+func (b *EntryBuilder) SetValue(value interface{}) error {
+	enc, count, err := encodeValue(b.ft, b.order, value)
+	if err != nil {
+		return fmt.Errorf("tiff: entry for tag %d: %v", b.tagID, err)
+	}
+	if !b.big && count > math.MaxUint32 {
+		return fmt.Errorf("tiff: entry for tag %d: %d values do not fit in a classic TIFF", b.tagID, count)
+	}
+	b.value, b.count = enc, count
+	return nil
+}
+
+// Inline reports whether the value of b fits in its value offset.
+func (b *EntryBuilder) Inline() bool {
+	return uint64(len(b.value)) <= b.offsetSize()
+}
+
+// SetOffset sets the file offset at which the value of b is written.  It is
+// an error to set an offset for a value that is stored inline, or one that
+// does not fit in a classic TIFF.
+func (b *EntryBuilder) SetOffset(off uint64) error {
+	if b.Inline() {
+		return fmt.Errorf("tiff: entry for tag %d holds its value inline", b.tagID)
+	}
+	if !b.big && off > math.MaxUint32 {
+		return fmt.Errorf("tiff: offset %d of tag %d does not fit in 32 bits", off, b.tagID)
+	}
+	b.offset = off
+	return nil
+}
+
+// Value returns the encoded value of b, which has to be written at the offset
+// given with SetOffset unless it is stored inline.
+func (b *EntryBuilder) Value() []byte { return b.value }
+
+// Type returns the field type of the values of b.
+func (b *EntryBuilder) Type() FieldType { return b.ft }
+
+// Order returns the byte order the value of b is encoded in.
+func (b *EntryBuilder) Order() binary.ByteOrder { return b.order }
+
+func (b *EntryBuilder) TagID() uint16   { return b.tagID }
+func (b *EntryBuilder) TypeID() uint16  { return b.ft.ID() }
+func (b *EntryBuilder) Count64() uint64 { return b.count }
+func (b *EntryBuilder) IsBig() bool     { return b.big }
+
+func (b *EntryBuilder) RawValueOffset() []byte {
+	raw := make([]byte, b.offsetSize())
+	switch {
+	case b.Inline():
+		copy(raw, b.value)
+	case b.big:
+		b.order.PutUint64(raw, b.offset)
+	default:
+		b.order.PutUint32(raw, uint32(b.offset))
+	}
+	return raw
+}
+
+func (b *EntryBuilder) ValueOffset64(bo binary.ByteOrder) uint64 {
+	if b.big {
+		return bo.Uint64(b.RawValueOffset())
+	}
+	return uint64(bo.Uint32(b.RawValueOffset()))
+}
+
+func (b *EntryBuilder) offsetSize() uint64 {
+	if b.big {
+		return 8
+	}
+	return 4
+}
+
+// Field returns b as a Field of a classic TIFF, as used by Editor.SetField.
+func (b *EntryBuilder) Field(tsp TagSpace, ftsp FieldTypeSpace) (Field, error) {
+	if b.big {
+		return nil, fmt.Errorf("tiff: entry for tag %d is for a BigTIFF", b.tagID)
+	}
+	e := &entry{tagID: b.tagID, typeID: b.ft.ID(), count: uint32(b.count)}
+	copy(e.valueOffset[:], b.RawValueOffset())
+	fv := &fieldValue{order: b.order, value: b.value}
+	if b.Inline() {
+		fv.value = e.valueOffset[:]
+	}
+	return &field{entry: e, value: fv, tsp: tsp, ftsp: ftsp}, nil
+}
+
+var (
+	rationalSliceType  = reflect.TypeOf([]Rational(nil))
+	sRationalSliceType = reflect.TypeOf([]SRational(nil))
+)
+
+// encodeValue returns value encoded as values of type ft in bo, along with the
+// number of values.
+func encodeValue(ft FieldType, bo binary.ByteOrder, value interface{}) ([]byte, uint64, error) {
+	switch v := value.(type) {
+	case string:
+		if ft.ID() != FTAscii.ID() {
+			return nil, 0, fmt.Errorf("a string can not be stored as %s", ft.Name())
+		}
+		b := []byte(v)
+		if len(b) == 0 || b[len(b)-1] != 0 {
+			b = append(b, 0)
+		}
+		return b, uint64(len(b)), nil
+	case []byte:
+		if ft.Size() != 1 || ft.ID() == FTUnicode.ID() {
+			return nil, 0, fmt.Errorf("bytes can not be stored as %s", ft.Name())
+		}
+		return append([]byte(nil), v...), uint64(len(v)), nil
+	case Rational:
+		if ft.ID() == FTRational.ID() {
+			return v.Bytes(bo), 1, nil
+		}
+	case SRational:
+		if ft.ID() == FTSRational.ID() {
+			return v.Bytes(bo), 1, nil
+		}
+	case []Rational:
+		if ft.ID() == FTRational.ID() {
+			out := make([]byte, 0, 8*len(v))
+			for _, r := range v {
+				out = append(out, r.Bytes(bo)...)
+			}
+			return out, uint64(len(v)), nil
+		}
+	case []SRational:
+		if ft.ID() == FTSRational.ID() {
+			out := make([]byte, 0, 8*len(v))
+			for _, r := range v {
+				out = append(out, r.Bytes(bo)...)
+			}
+			return out, uint64(len(v)), nil
+		}
+	}
+	rv := reflect.ValueOf(value)
+	if !rv.IsValid() {
+		return nil, 0, fmt.Errorf("no value")
+	}
+	if rv.Type() == rationalSliceType || rv.Type() == sRationalSliceType || rv.Type() == rationalType || rv.Type() == sRationalType {
+		return nil, 0, fmt.Errorf("a %s can not be stored as %s", rv.Type(), ft.Name())
+	}
+	var vals []reflect.Value
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			vals = append(vals, rv.Index(i))
+		}
+	default:
+		vals = []reflect.Value{rv}
+	}
+	out := make([]byte, ft.Size()*uint64(len(vals)))
+	for i, ev := range vals {
+		if err := encodeNumber(ft, bo, out[uint64(i)*ft.Size():], ev); err != nil {
+			return nil, 0, err
+		}
+	}
+	return out, uint64(len(vals)), nil
+}
+
+// encodeNumber stores the number v in buf as a value of type ft.
+func encodeNumber(ft FieldType, bo binary.ByteOrder, buf []byte, v reflect.Value) error {
+	var f float64
+	var isInt bool
+	var i int64
+	var u uint64
+	neg := false
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, isInt = v.Int(), true
+		u, neg, f = uint64(i), i < 0, float64(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u, isInt = v.Uint(), true
+		i, f = int64(u), float64(u)
+	case reflect.Float32, reflect.Float64:
+		f = v.Float()
+	default:
+		return fmt.Errorf("a %s can not be stored as %s", v.Type(), ft.Name())
+	}
+	// fits reports whether the integer being encoded lies in [lo, hi].
+	fits := func(lo int64, hi uint64) bool {
+		if !isInt {
+			return false
+		}
+		if neg {
+			return i >= lo
+		}
+		return u <= hi
+	}
+	switch ft.ID() {
+	case FTByte.ID(), FTUndefined.ID(), FTAscii.ID():
+		if !fits(0, math.MaxUint8) {
+			break
+		}
+		buf[0] = uint8(u)
+		return nil
+	case FTSByte.ID():
+		if !fits(math.MinInt8, math.MaxInt8) {
+			break
+		}
+		buf[0] = uint8(i)
+		return nil
+	case FTShort.ID(), FTUnicode.ID():
+		if !fits(0, math.MaxUint16) {
+			break
+		}
+		bo.PutUint16(buf, uint16(u))
+		return nil
+	case FTSShort.ID():
+		if !fits(math.MinInt16, math.MaxInt16) {
+			break
+		}
+		bo.PutUint16(buf, uint16(i))
+		return nil
+	case FTLong.ID(), FTIFD.ID():
+		if !fits(0, math.MaxUint32) {
+			break
+		}
+		bo.PutUint32(buf, uint32(u))
+		return nil
+	case FTSLong.ID():
+		if !fits(math.MinInt32, math.MaxInt32) {
+			break
+		}
+		bo.PutUint32(buf, uint32(i))
+		return nil
+	case FTLong8.ID(), FTIFD8.ID():
+		if !fits(0, math.MaxUint64) {
+			break
+		}
+		bo.PutUint64(buf, u)
+		return nil
+	case FTSLong8.ID():
+		if !fits(math.MinInt64, math.MaxInt64) {
+			break
+		}
+		bo.PutUint64(buf, uint64(i))
+		return nil
+	case FTFloat.ID():
+		bo.PutUint32(buf, math.Float32bits(float32(f)))
+		return nil
+	case FTDouble.ID():
+		bo.PutUint64(buf, math.Float64bits(f))
+		return nil
+	case FTRational.ID():
+		r, err := RationalOf(f)
+		if err != nil {
+			return err
+		}
+		copy(buf, r.Bytes(bo))
+		return nil
+	case FTSRational.ID():
+		r, err := SRationalOf(f)
+		if err != nil {
+			return err
+		}
+		copy(buf, r.Bytes(bo))
+		return nil
+	default:
+		return fmt.Errorf("numbers can not be stored as %s", ft.Name())
+	}
+	return fmt.Errorf("%v does not fit in a %s", v.Interface(), ft.Name())
+}
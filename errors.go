@@ -0,0 +1,250 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tiff
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+	"strings"
+)
+
+/*
+The errors returned while parsing a file fall into a few classes, each with its
+own type:
+	ErrShortRead          a read failed part way through
+	ErrBadMagic           the file does not start with a known header
+	ErrInvalidType        a field has a type that cannot be used
+	ErrOffsetOutOfBounds  an offset points outside of the file
+	ErrImplausibleCount   a field has more values than the file can hold
+Each records where the problem was found (see ErrorContext).  Callers can
+branch on the class of an error, whatever its context, with errors.Is:
+	if errors.Is(err, tiff.ErrShortRead{}) {
+		// The file is truncated.
+	}
+and retrieve the details with errors.As.
+*/
+
+// ErrorContext records where in a file a problem was found.
+type ErrorContext struct {
+	// Offset is the file offset of the problem.
+	Offset uint64
+	// TagID is the tag of the field being read, or 0 if the problem is not
+	// with a field.
+	TagID uint16
+	// IFD is the index in the IFD chain of the IFD being read, or -1 if the
+	// problem is not with an IFD of the chain.
+	IFD int
+}
+
+// at returns an ErrorContext for offset off, outside of any IFD.
+func at(off uint64) ErrorContext {
+	return ErrorContext{Offset: off, IFD: -1}
+}
+
+func (c ErrorContext) String() string {
+	var parts []string
+	if c.IFD >= 0 {
+		parts = append(parts, fmt.Sprintf("ifd %d", c.IFD))
+	}
+	if c.TagID != 0 {
+		parts = append(parts, fmt.Sprintf("tag %d", c.TagID))
+	}
+	parts = append(parts, fmt.Sprintf("offset %d", c.Offset))
+	return strings.Join(parts, ", ")
+}
+
+// ErrShortRead is returned when reading part of a file fails, usually because
+// the file is truncated.
+type ErrShortRead struct {
+	ErrorContext
+	// What describes what was being read.
+	What string
+	Err  error
+}
+
+func (e ErrShortRead) Error() string {
+	return fmt.Sprintf("tiff: unable to read %s (%s): %v", e.What, e.ErrorContext, e.Err)
+}
+
+func (e ErrShortRead) Unwrap() error { return e.Err }
+
+// Is reports whether target is an ErrShortRead.
+func (e ErrShortRead) Is(target error) bool {
+	_, ok := target.(ErrShortRead)
+	return ok
+}
+
+// ErrBadMagic is returned when a file does not start with the header of any
+// registered kind of TIFF.  Err is an ErrInvalidByteOrder or an
+// ErrUnsuppTIFFVersion.
+type ErrBadMagic struct {
+	ErrorContext
+	Magic [4]byte
+	Err   error
+}
+
+func (e ErrBadMagic) Error() string {
+	return e.Err.Error()
+}
+
+func (e ErrBadMagic) Unwrap() error { return e.Err }
+
+// Is reports whether target is an ErrBadMagic.
+func (e ErrBadMagic) Is(target error) bool {
+	_, ok := target.(ErrBadMagic)
+	return ok
+}
+
+// ErrInvalidType is returned when a field has a type that is not valid at all
+// or not valid for the way its values are used.
+type ErrInvalidType struct {
+	ErrorContext
+	TypeID uint16
+	// Problem describes what is wrong with the type.
+	Problem string
+}
+
+func (e ErrInvalidType) Error() string {
+	return fmt.Sprintf("tiff: invalid field type %d (%s): %s", e.TypeID, e.ErrorContext, e.Problem)
+}
+
+// Is reports whether target is an ErrInvalidType.
+func (e ErrInvalidType) Is(target error) bool {
+	_, ok := target.(ErrInvalidType)
+	return ok
+}
+
+// ErrOffsetOutOfBounds is returned when an offset points before the end of
+// the header or past the end of the file.  The offset itself is recorded in
+// ErrorContext.
+type ErrOffsetOutOfBounds struct {
+	ErrorContext
+	// What describes what the offset points to.
+	What string
+	Err  error
+}
+
+func (e ErrOffsetOutOfBounds) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("tiff: offset to %s is out of bounds (%s): %v", e.What, e.ErrorContext, e.Err)
+	}
+	return fmt.Sprintf("tiff: offset to %s is out of bounds (%s)", e.What, e.ErrorContext)
+}
+
+func (e ErrOffsetOutOfBounds) Unwrap() error { return e.Err }
+
+// Is reports whether target is an ErrOffsetOutOfBounds.
+func (e ErrOffsetOutOfBounds) Is(target error) bool {
+	_, ok := target.(ErrOffsetOutOfBounds)
+	return ok
+}
+
+// ErrImplausibleCount is returned when the count and type of a field imply
+// values larger than what the file holds past their offset, as in truncated
+// or crafted files.  The values are not read, which spares allocating and
+// reading up to gigabytes for a single field.  The offset of the values is
+// recorded in ErrorContext.
+type ErrImplausibleCount struct {
+	ErrorContext
+	Count  uint64
+	TypeID uint16
+	// Size is the size implied by Count (math.MaxUint64 if it overflows),
+	// and Remaining the number of bytes of the file past the offset.
+	Size, Remaining uint64
+}
+
+func (e ErrImplausibleCount) Error() string {
+	return fmt.Sprintf("tiff: implausible count %d for field type %d (%s): the values would take %d bytes, but %d remain in the file", e.Count, e.TypeID, e.ErrorContext, e.Size, e.Remaining)
+}
+
+// Is reports whether target is an ErrImplausibleCount.
+func (e ErrImplausibleCount) Is(target error) bool {
+	_, ok := target.(ErrImplausibleCount)
+	return ok
+}
+
+// CheckValueSize returns an ErrImplausibleCount if count values of type ft,
+// found at ctx.Offset, would extend past the end of the file br reads, or an
+// ErrOffsetOutOfBounds if the offset itself is past it.  It is meant for use
+// by parsers, including those registered for other versions, before reading
+// the values of a field.  Files whose size br can not tell are not checked.
+func CheckValueSize(br BReader, ctx ErrorContext, count uint64, ft FieldType) error {
+	size, err := FileSize(br)
+	if err != nil || size < 0 {
+		return nil
+	}
+	if ctx.Offset > uint64(size) {
+		return ErrOffsetOutOfBounds{ctx, "the values of a field", nil}
+	}
+	remaining := uint64(size) - ctx.Offset
+	hi, n := bits.Mul64(count, ft.Size())
+	if hi != 0 {
+		n = math.MaxUint64
+	}
+	if n > remaining {
+		return ErrImplausibleCount{ctx, count, ft.ID(), n, remaining}
+	}
+	return nil
+}
+
+// FileSize returns the size of the file br reads, leaving its position where
+// it was.  It seeks, so it must not be called while br is read concurrently.
+func FileSize(br BReader) (int64, error) {
+	cur, err := br.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	size, err := br.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+	if _, err = br.Seek(cur, io.SeekStart); err != nil {
+		return 0, err
+	}
+	return size, nil
+}
+
+// ReadError returns the error for a failure, err, to read what at the location
+// described by ctx.  If nothing at all could be read there (err is io.EOF),
+// the location is past the end of the file and an ErrOffsetOutOfBounds is
+// returned; otherwise an ErrShortRead is returned.  It is meant for use by
+// parsers, including those registered for other versions.
+func ReadError(err error, what string, ctx ErrorContext) error {
+	if err == io.EOF {
+		return ErrOffsetOutOfBounds{ctx, what, err}
+	}
+	return ErrShortRead{ctx, what, err}
+}
+
+// WithIFDIndex returns err with the IFD index of its ErrorContext set to idx,
+// if err is one of the error types above and the index is not already set.
+// Other errors are returned as they are.
+func WithIFDIndex(err error, idx int) error {
+	switch e := err.(type) {
+	case ErrShortRead:
+		if e.IFD < 0 {
+			e.IFD = idx
+		}
+		return e
+	case ErrInvalidType:
+		if e.IFD < 0 {
+			e.IFD = idx
+		}
+		return e
+	case ErrOffsetOutOfBounds:
+		if e.IFD < 0 {
+			e.IFD = idx
+		}
+		return e
+	case ErrImplausibleCount:
+		if e.IFD < 0 {
+			e.IFD = idx
+		}
+		return e
+	}
+	return err
+}
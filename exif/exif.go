@@ -29,37 +29,61 @@ func Parse(r io.Reader) (eIFD, gIFD, ioIFD tiff.IFD, err error) {
 		if t, err = tiff.Parse(rars, nil, nil); err != nil {
 			return
 		}
-		for _, tIFD := range t.IFDs() {
-			if tIFD.HasField(ExifIFDTagID) {
-				eFld := tIFD.GetField(ExifIFDTagID)
-				offset := eFld.Type().Valuer()(eFld.Value().Bytes(), eFld.Value().Order()).Uint()
-				if eIFD, err = tiff.ParseIFD(t.R(), offset, ExifTagSpace, nil); err != nil {
-					return
-				}
-				if tIFD.HasField(GPSIFDTagID) {
-					gFld := tIFD.GetField(GPSIFDTagID)
-					offset = gFld.Type().Valuer()(gFld.Value().Bytes(), gFld.Value().Order()).Uint()
-					if gIFD, err = tiff.ParseIFD(t.R(), offset, GPSTagSpace, nil); err != nil {
-						log.Printf("exif: GPS IFD found, but had trouble retrieving it from offset %d: %v\n", offset, err)
-					}
+		return IFDs(t)
+	case "\xff\xd8", "\x89P": // likely a jpeg or a png
+		var size int64
+		if size, err = rars.Seek(0, io.SeekEnd); err != nil {
+			return
+		}
+		parse := ParseJPEG
+		if two[0] == 0x89 {
+			parse = ParsePNG
+		}
+		var t tiff.TIFF
+		if t, err = parse(rars, size); err != nil {
+			return
+		}
+		return IFDs(t)
+	}
+	// Anything else is currently unsupported.
+	err = fmt.Errorf("exif: unsupported header: %q", two[:])
+	return
+}
+
+// IFDs locates and parses the Exif IFD of t along with the GPS and
+// Interoperability IFDs when they are present.  An error is returned if none
+// of the IFDs of t point to an Exif IFD.
+func IFDs(t tiff.TIFF) (eIFD, gIFD, ioIFD tiff.IFD, err error) {
+	for _, tIFD := range t.IFDs() {
+		if tIFD.HasField(ExifIFDTagID) {
+			eFld := tIFD.GetField(ExifIFDTagID)
+			offset := eFld.Type().Valuer()(eFld.Value().Bytes(), eFld.Value().Order()).Uint()
+			if eIFD, err = tiff.ParseIFD(tiff.IFDReader(t), offset, ExifTagSpace, nil); err != nil {
+				return
+			}
+			if tIFD.HasField(GPSIFDTagID) {
+				gFld := tIFD.GetField(GPSIFDTagID)
+				offset = gFld.Type().Valuer()(gFld.Value().Bytes(), gFld.Value().Order()).Uint()
+				if gIFD, err = tiff.ParseIFD(tiff.IFDReader(t), offset, GPSTagSpace, nil); err != nil {
+					log.Printf("exif: GPS IFD found, but had trouble retrieving it from offset %d: %v\n", offset, err)
 				}
-				if tIFD.HasField(InteroperabilityIFDTagID) {
-					ioFld := tIFD.GetField(InteroperabilityIFDTagID)
-					offset = ioFld.Type().Valuer()(ioFld.Value().Bytes(), ioFld.Value().Order()).Uint()
-					if ioIFD, err = tiff.ParseIFD(t.R(), offset, IOPTagSpace, nil); err != nil {
-						log.Printf("exif: IOP IFD found, but had trouble retrieving it from offset %d: %v\n", offset, err)
-					}
+			}
+			if tIFD.HasField(InteroperabilityIFDTagID) {
+				ioFld := tIFD.GetField(InteroperabilityIFDTagID)
+				offset = ioFld.Type().Valuer()(ioFld.Value().Bytes(), ioFld.Value().Order()).Uint()
+				if ioIFD, err = tiff.ParseIFD(tiff.IFDReader(t), offset, IOPTagSpace, nil); err != nil {
+					log.Printf("exif: IOP IFD found, but had trouble retrieving it from offset %d: %v\n", offset, err)
 				}
-				return
 			}
+			return
 		}
-		err = fmt.Errorf("exif: no exif ifd found in tiff")
-		return
-	case "\xff\xd8": // likely a jpeg
-		err = fmt.Errorf("exif: still working on jpeg support")
-		return
 	}
-	// Anything else is currently unsupported.
-	err = fmt.Errorf("exif: unsupported header: %q", two[:])
+	err = fmt.Errorf("exif: no exif ifd found in tiff")
 	return
 }
+
+func init() {
+	tiff.RegisterSubIFDTag(ExifIFDTagID, ExifTagSpace)
+	tiff.RegisterSubIFDTag(GPSIFDTagID, GPSTagSpace)
+	tiff.RegisterSubIFDTag(InteroperabilityIFDTagID, IOPTagSpace)
+}
@@ -0,0 +1,220 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package exif
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/google/tiff"
+)
+
+/*
+ExifTool (http://www.sno.phy.queensu.ca/~phil/exiftool/TagNames/EXIF.html)
+names most tags the same way the specifications do, but not all of them.  A
+name may also carry a group prefix, as in "ExifIFD:ISO" or "GPS:GPSLatitude".
+The groups understood here are:
+	EXIF        any of the groups below
+	IFD0        the first IFD of the main chain (the main image)
+	IFD1        the second IFD of the main chain (usually the thumbnail)
+	SubIFD      an IFD referenced by the SubIFDs tag (330)
+	ExifIFD     the Exif IFD
+	GPS         the GPS IFD
+	InteropIFD  the Interoperability IFD
+*/
+
+// ExifTool group names.
+const (
+	GroupEXIF    = "EXIF"
+	GroupIFD0    = "IFD0"
+	GroupIFD1    = "IFD1"
+	GroupSubIFD  = "SubIFD"
+	GroupExifIFD = "ExifIFD"
+	GroupGPS     = "GPS"
+	GroupInterop = "InteropIFD"
+)
+
+// An ExifToolTag is the result of resolving an ExifTool tag name.
+type ExifToolTag struct {
+	// Group is the ExifTool group the tag belongs to (never GroupEXIF).
+	Group string
+	TagID uint16
+	// Name is the name of the tag in this package's tag spaces.
+	Name string
+}
+
+// GroupTagSpace returns the TagSpace used for IFDs of the given ExifTool
+// group.
+func GroupTagSpace(group string) tiff.TagSpace {
+	switch group {
+	case GroupExifIFD:
+		return ExifTagSpace
+	case GroupGPS:
+		return GPSTagSpace
+	case GroupInterop:
+		return IOPTagSpace
+	}
+	return tiff.DefaultTagSpace
+}
+
+type exifToolAlias struct {
+	group string
+	tagID uint16
+}
+
+var exifToolAliases = struct {
+	mu     sync.RWMutex
+	byName map[string]exifToolAlias // lower case name -> tag
+	names  map[exifToolAlias]string // tag -> ExifTool name
+}{
+	byName: make(map[string]exifToolAlias, 1),
+	names:  make(map[exifToolAlias]string, 1),
+}
+
+// RegisterExifToolAlias registers name as ExifTool's name for the tag tagID in
+// group.  Names are matched without regard to case, as ExifTool does.
+// Registering a name again replaces the previous registration.
+func RegisterExifToolAlias(name, group string, tagID uint16) {
+	a := exifToolAlias{group, tagID}
+	exifToolAliases.mu.Lock()
+	exifToolAliases.byName[strings.ToLower(name)] = a
+	exifToolAliases.names[a] = name
+	exifToolAliases.mu.Unlock()
+}
+
+// ListExifToolAliases returns the names registered with RegisterExifToolAlias
+// in sorted order.
+func ListExifToolAliases() []string {
+	exifToolAliases.mu.RLock()
+	defer exifToolAliases.mu.RUnlock()
+	names := make([]string, 0, len(exifToolAliases.names))
+	for _, name := range exifToolAliases.names {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// groupsFor returns the groups that a prefix selects.
+func groupsFor(prefix string) []string {
+	switch strings.ToLower(prefix) {
+	case "", strings.ToLower(GroupEXIF):
+		return []string{GroupIFD0, GroupExifIFD, GroupGPS, GroupInterop, GroupIFD1, GroupSubIFD}
+	case strings.ToLower(GroupIFD0):
+		return []string{GroupIFD0}
+	case strings.ToLower(GroupIFD1):
+		return []string{GroupIFD1}
+	case strings.ToLower(GroupSubIFD):
+		return []string{GroupSubIFD}
+	case strings.ToLower(GroupExifIFD):
+		return []string{GroupExifIFD}
+	case strings.ToLower(GroupGPS):
+		return []string{GroupGPS}
+	case strings.ToLower(GroupInterop):
+		return []string{GroupInterop}
+	}
+	return nil
+}
+
+// sameGroup reports whether an alias registered for group applies to want.
+// Tags of the main IFDs are registered for IFD0 but apply to IFD1 and SubIFD
+// as well.
+func sameGroup(group, want string) bool {
+	if group == want {
+		return true
+	}
+	return group == GroupIFD0 && (want == GroupIFD1 || want == GroupSubIFD)
+}
+
+// LookupExifToolName resolves an ExifTool tag name, with or without a group
+// prefix (e.g. "ISO", "ExifIFD:ISO", or "EXIF:CreateDate").  Registered
+// aliases are tried first; otherwise the name is looked up in the tag spaces
+// of the groups selected by the prefix.  Matching ignores case.
+func LookupExifToolName(name string) (ExifToolTag, bool) {
+	prefix := ""
+	if i := strings.LastIndex(name, ":"); i >= 0 {
+		prefix, name = name[:i], name[i+1:]
+	}
+	groups := groupsFor(prefix)
+	lower := strings.ToLower(name)
+
+	exifToolAliases.mu.RLock()
+	a, ok := exifToolAliases.byName[lower]
+	exifToolAliases.mu.RUnlock()
+	if ok {
+		for _, g := range groups {
+			if sameGroup(a.group, g) {
+				return ExifToolTag{g, a.tagID, GroupTagSpace(g).GetTag(a.tagID).Name()}, true
+			}
+		}
+	}
+
+	for _, g := range groups {
+		tsp := GroupTagSpace(g)
+		for _, setName := range tsp.ListTagSets() {
+			ts, _ := tsp.GetTagSet(setName)
+			for _, id := range ts.ListTags() {
+				if t, _ := ts.GetTag(id); strings.ToLower(t.Name()) == lower {
+					return ExifToolTag{g, id, t.Name()}, true
+				}
+			}
+		}
+	}
+	return ExifToolTag{}, false
+}
+
+// ExifToolName returns the name ExifTool uses for tagID in group.  If no alias
+// is registered, the name from the group's TagSpace is returned.
+func ExifToolName(group string, tagID uint16) string {
+	exifToolAliases.mu.RLock()
+	name, ok := exifToolAliases.names[exifToolAlias{group, tagID}]
+	if !ok && (group == GroupIFD1 || group == GroupSubIFD) {
+		name, ok = exifToolAliases.names[exifToolAlias{GroupIFD0, tagID}]
+	}
+	exifToolAliases.mu.RUnlock()
+	if ok {
+		return name
+	}
+	return GroupTagSpace(group).GetTag(tagID).Name()
+}
+
+func init() {
+	// Only names that differ (if only in case) from the ones registered in
+	// the tag spaces are needed here.
+	for _, a := range []struct {
+		name  string
+		group string
+		tagID uint16
+	}{
+		{"SubfileType", GroupIFD0, 254},
+		{"OldSubfileType", GroupIFD0, 255},
+		{"ImageHeight", GroupIFD0, 257},
+		{"ModifyDate", GroupIFD0, 306},
+		{"ThumbnailOffset", GroupIFD0, 513},
+		{"ThumbnailLength", GroupIFD0, 514},
+		{"ApplicationNotes", GroupIFD0, tiff.XMPTagID},
+		{"IPTC-NAA", GroupIFD0, tiff.IPTCTagID},
+		{"ICC_Profile", GroupIFD0, tiff.ICCProfileTagID},
+		{"ExifOffset", GroupIFD0, ExifIFDTagID},
+		{"GPSInfo", GroupIFD0, GPSIFDTagID},
+
+		{"ISO", GroupExifIFD, 34855},
+		{"CreateDate", GroupExifIFD, 36868},
+		{"ExposureCompensation", GroupExifIFD, 37380},
+		{"ExifImageWidth", GroupExifIFD, 40962},
+		{"ExifImageHeight", GroupExifIFD, 40963},
+		{"InteropOffset", GroupExifIFD, InteroperabilityIFDTagID},
+		{"FocalLengthIn35mmFormat", GroupExifIFD, 41989},
+		{"OwnerName", GroupExifIFD, 42032},
+		{"SerialNumber", GroupExifIFD, 42033},
+		{"LensInfo", GroupExifIFD, 42034},
+		{"SubSecTime", GroupExifIFD, 37520},
+		{"SubSecTimeOriginal", GroupExifIFD, 37521},
+		{"SubSecTimeDigitized", GroupExifIFD, 37522},
+	} {
+		RegisterExifToolAlias(a.name, a.group, a.tagID)
+	}
+}
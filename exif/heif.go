@@ -0,0 +1,51 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package exif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/google/tiff"
+)
+
+// HEIFItemStream locates the TIFF stream of the payload of an Exif item of a
+// HEIF or AVIF file, as handed out by container libraries.  The payload starts
+// with a 32 bit big endian count of the bytes that come before the TIFF header
+// (usually an "Exif\0\0" header), which are skipped.  The stream starts at
+// offset off of payload, which all offsets in the stream are relative to.
+func HEIFItemStream(payload []byte) (off int64, err error) {
+	if len(payload) < 4 {
+		return 0, fmt.Errorf("exif: heif exif item of %d bytes is too short", len(payload))
+	}
+	off = 4 + int64(binary.BigEndian.Uint32(payload))
+	if off > int64(len(payload)) {
+		return 0, fmt.Errorf("exif: heif exif item header offset %d is past its end (%d bytes)", off-4, len(payload)-4)
+	}
+	return off, nil
+}
+
+// ParseHEIFItem parses the TIFF stream of the payload of an Exif item of a HEIF
+// or AVIF file (see HEIFItemStream).  Use IFDs to find the Exif IFDs of the
+// result.
+func ParseHEIFItem(payload []byte) (tiff.TIFF, error) {
+	off, err := HEIFItemStream(payload)
+	if err != nil {
+		return nil, err
+	}
+	return tiff.ParseEmbedded(bytes.NewReader(payload), off, int64(len(payload))-off, nil, nil)
+}
+
+// HEIFItem returns the payload of an Exif item of a HEIF or AVIF file holding
+// the TIFF stream stream, for container libraries to write back.  The stream
+// is preceded by an "Exif\0\0" header, which the TIFF header offset counts, as
+// most readers expect.  See WriteJPEG for how stream is usually made.
+func HEIFItem(stream []byte) []byte {
+	payload := make([]byte, 4, 4+len(exifHeader)+len(stream))
+	binary.BigEndian.PutUint32(payload, uint32(len(exifHeader)))
+	payload = append(payload, exifHeader...)
+	return append(payload, stream...)
+}
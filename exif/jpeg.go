@@ -0,0 +1,173 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package exif
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/google/tiff"
+)
+
+// JPEG markers used to find the Exif APP1 segment.
+const (
+	markerSOI  = 0xD8
+	markerSOS  = 0xDA
+	markerEOI  = 0xD9
+	markerAPP0 = 0xE0
+	markerAPP1 = 0xE1
+)
+
+// exifHeader starts the payload of an Exif APP1 segment and is followed by the
+// TIFF stream.
+const exifHeader = "Exif\x00\x00"
+
+// maxExifStream is the largest TIFF stream that fits in an APP1 segment, whose
+// 16 bit length counts itself and the Exif header.
+const maxExifStream = 0xFFFF - 2 - len(exifHeader)
+
+// A jpegSegment is a marker segment of a JPEG file.
+type jpegSegment struct {
+	marker byte
+	offset int64 // of the 0xFF byte of the marker
+	size   int64 // including the marker and the length
+}
+
+// jpegSegments returns the marker segments of the JPEG file in the first size
+// bytes of r that come before the image data: those from the SOI marker up to,
+// but not including, the first SOS marker.
+func jpegSegments(r io.ReaderAt, size int64) ([]jpegSegment, error) {
+	var buf [4]byte
+	if _, err := r.ReadAt(buf[:2], 0); err != nil || buf[0] != 0xFF || buf[1] != markerSOI {
+		return nil, fmt.Errorf("exif: not a jpeg file")
+	}
+	segs := []jpegSegment{{markerSOI, 0, 2}}
+	for off := int64(2); ; {
+		if off+4 > size {
+			return nil, fmt.Errorf("exif: jpeg file ends before the image data")
+		}
+		if _, err := r.ReadAt(buf[:], off); err != nil {
+			return nil, fmt.Errorf("exif: unable to read the jpeg marker at offset %d: %v", off, err)
+		}
+		if buf[0] != 0xFF {
+			return nil, fmt.Errorf("exif: no jpeg marker at offset %d", off)
+		}
+		switch buf[1] {
+		case 0xFF:
+			// Fill byte before a marker.
+			off++
+			continue
+		case markerSOS, markerEOI:
+			return segs, nil
+		}
+		n := int64(binary.BigEndian.Uint16(buf[2:]))
+		if n < 2 || off+2+n > size {
+			return nil, fmt.Errorf("exif: jpeg segment at offset %d has an invalid length %d", off, n)
+		}
+		segs = append(segs, jpegSegment{buf[1], off, 2 + n})
+		off += 2 + n
+	}
+}
+
+// exifSegment returns the index in segs of the Exif APP1 segment of the JPEG
+// file in r, or -1 if it has none.
+func exifSegment(r io.ReaderAt, segs []jpegSegment) (int, error) {
+	hdr := make([]byte, len(exifHeader))
+	for i, s := range segs {
+		if s.marker != markerAPP1 || s.size < 4+int64(len(hdr)) {
+			continue
+		}
+		if _, err := r.ReadAt(hdr, s.offset+4); err != nil {
+			return -1, fmt.Errorf("exif: unable to read the APP1 segment at offset %d: %v", s.offset, err)
+		}
+		if string(hdr) == exifHeader {
+			return i, nil
+		}
+	}
+	return -1, nil
+}
+
+// JPEGExif locates the TIFF stream of the Exif APP1 segment of the JPEG file
+// in the first size bytes of r.  The stream is n bytes long and starts at
+// offset off, which all offsets in the stream are relative to.  An error is
+// returned if the file has no Exif segment.
+func JPEGExif(r io.ReaderAt, size int64) (off, n int64, err error) {
+	segs, err := jpegSegments(r, size)
+	if err != nil {
+		return 0, 0, err
+	}
+	i, err := exifSegment(r, segs)
+	if err != nil {
+		return 0, 0, err
+	}
+	if i < 0 {
+		return 0, 0, fmt.Errorf("exif: no exif segment found in jpeg")
+	}
+	hdr := 4 + int64(len(exifHeader))
+	return segs[i].offset + hdr, segs[i].size - hdr, nil
+}
+
+// ParseJPEG parses the TIFF stream of the Exif APP1 segment of the JPEG file in
+// the first size bytes of r.  Use IFDs to find the Exif IFDs of the result.
+func ParseJPEG(r io.ReaderAt, size int64) (tiff.TIFF, error) {
+	off, n, err := JPEGExif(r, size)
+	if err != nil {
+		return nil, err
+	}
+	return tiff.ParseEmbedded(r, off, n, nil, nil)
+}
+
+// WriteJPEG writes a copy of the JPEG file in the first size bytes of src to
+// dst with stream as the TIFF stream of its Exif APP1 segment.  An existing
+// Exif segment is replaced in place; otherwise the new segment follows the
+// SOI marker and any APP0 (JFIF) segments.  A nil stream removes the Exif
+// segment.  Everything else, including the image data, is copied as it is.
+//
+// stream is usually made by editing a copy of the stream located with
+// JPEGExif (for example with a tiff.Editor over a temporary file) and then
+// passing it through tiff.Compact to drop what the edits left behind.  It must
+// fit in a segment, which holds at most 65527 bytes of it.
+func WriteJPEG(dst io.Writer, src io.ReaderAt, size int64, stream []byte) error {
+	if len(stream) > maxExifStream {
+		return fmt.Errorf("exif: exif stream of %d bytes does not fit in a jpeg segment (at most %d)", len(stream), maxExifStream)
+	}
+	segs, err := jpegSegments(src, size)
+	if err != nil {
+		return err
+	}
+	i, err := exifSegment(src, segs)
+	if err != nil {
+		return err
+	}
+	// The new segment goes at start, and the bytes up to skip are dropped.
+	var start, skip int64
+	if i >= 0 {
+		start, skip = segs[i].offset, segs[i].offset+segs[i].size
+	} else {
+		for _, s := range segs {
+			if s.marker != markerSOI && s.marker != markerAPP0 {
+				break
+			}
+			start = s.offset + s.size
+		}
+		skip = start
+	}
+	if _, err = io.Copy(dst, io.NewSectionReader(src, 0, start)); err != nil {
+		return err
+	}
+	if stream != nil {
+		seg := make([]byte, 4, 4+len(exifHeader)+len(stream))
+		seg[0], seg[1] = 0xFF, markerAPP1
+		binary.BigEndian.PutUint16(seg[2:], uint16(2+len(exifHeader)+len(stream)))
+		seg = append(seg, exifHeader...)
+		seg = append(seg, stream...)
+		if _, err = dst.Write(seg); err != nil {
+			return err
+		}
+	}
+	_, err = io.Copy(dst, io.NewSectionReader(src, skip, size-skip))
+	return err
+}
@@ -0,0 +1,196 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package exif
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/tiff"
+)
+
+// DefaultLang is the language of the default value of a LangAlt.
+const DefaultLang = "x-default"
+
+// A LangAlt is a text value given in several languages, keyed by RFC 3066
+// language tag (such as "en-US").  The value for DefaultLang is the one shown
+// to users whose language is missing; it is the only one that EXIF can hold.
+type LangAlt map[string]string
+
+// Default returns the value for DefaultLang.  If there is none, but there is
+// only one value, that value is returned.
+func (la LangAlt) Default() string {
+	if v, ok := la[DefaultLang]; ok || len(la) != 1 {
+		return v
+	}
+	for _, v := range la {
+		return v
+	}
+	return ""
+}
+
+// A TextProperty is a piece of descriptive text that is recorded both in an
+// EXIF tag of the first IFD and as a language alternative (rdf:Alt) property
+// of the XMP packet.
+type TextProperty int
+
+const (
+	// Description is ImageDescription (tag 270) and dc:description.
+	Description TextProperty = iota + 1
+	// Rights is Copyright (tag 33432) and dc:rights.
+	Rights
+	// Title is XPTitle (tag 40091, written by Windows) and dc:title.
+	Title
+)
+
+var textProperties = map[TextProperty]struct {
+	tagID uint16
+	name  xml.Name
+}{
+	Description: {270, xml.Name{Space: dcNS, Local: "description"}},
+	Rights:      {33432, xml.Name{Space: dcNS, Local: "rights"}},
+	Title:       {tiff.XPTitleTagID, xml.Name{Space: dcNS, Local: "title"}},
+}
+
+func (p TextProperty) String() string {
+	if tp, ok := textProperties[p]; ok {
+		return "dc:" + tp.name.Local
+	}
+	return fmt.Sprintf("TextProperty(%d)", int(p))
+}
+
+// exifText returns the text held by tag tagID of ifd.
+func exifText(ifd tiff.IFD, tagID uint16) (string, error) {
+	if tagID == tiff.XPTitleTagID {
+		return tiff.XP(ifd, tagID)
+	}
+	if !ifd.HasField(tagID) {
+		return "", nil
+	}
+	f := ifd.GetField(tagID)
+	return strings.TrimSpace(tiff.FieldText(f)), nil
+}
+
+// LangText returns the values of p recorded in the first IFD of t.  The
+// languages of the XMP property are returned as they are.  The EXIF tag is
+// used as the default value when the XMP packet has none; if both have one,
+// the XMP value is used (see Reconcile for finding values that disagree).
+func LangText(t tiff.TIFF, p TextProperty) (LangAlt, error) {
+	tp, ok := textProperties[p]
+	if !ok {
+		return nil, fmt.Errorf("exif: unknown text property %d", int(p))
+	}
+	if len(t.IFDs()) == 0 {
+		return nil, fmt.Errorf("exif: no IFDs found")
+	}
+	ifd0 := t.IFDs()[0]
+	props, _, err := readXMP(tiff.XMP(ifd0), map[xml.Name]bool{tp.name: true})
+	if err != nil {
+		return nil, fmt.Errorf("exif: unable to read the xmp packet: %v", err)
+	}
+	la := make(LangAlt)
+	if xp := props[tp.name]; xp != nil {
+		for i, v := range xp.values {
+			lang := xp.langs[i]
+			if lang == "" {
+				lang = DefaultLang
+			}
+			if _, ok := la[lang]; !ok {
+				la[lang] = v
+			}
+		}
+	}
+	if _, ok := la[DefaultLang]; !ok {
+		v, err := exifText(ifd0, tp.tagID)
+		if err != nil {
+			return nil, err
+		}
+		if v != "" {
+			la[DefaultLang] = v
+		}
+	}
+	return la, nil
+}
+
+// SetLangText queues changes on e that set p to la in the first IFD.  The XMP
+// property is replaced by la as a whole and the EXIF tag is set to la.Default.
+// An empty la removes both.  The changes are made when e.Commit is called.
+func SetLangText(e *tiff.Editor, p TextProperty, la LangAlt) error {
+	tp, ok := textProperties[p]
+	if !ok {
+		return fmt.Errorf("exif: unknown text property %d", int(p))
+	}
+	if len(e.TIFF().IFDs()) == 0 {
+		return fmt.Errorf("exif: no IFDs found")
+	}
+	text := xmpText(pendingXMP(e))
+	props, desc, err := readXMP([]byte(text), map[xml.Name]bool{tp.name: true})
+	if err != nil {
+		return fmt.Errorf("exif: unable to read the xmp packet: %v", err)
+	}
+	if desc.start < 0 {
+		return fmt.Errorf("exif: xmp packet has no rdf:Description element")
+	}
+	var edits []edit
+	var added string
+	switch xp := props[tp.name]; {
+	case len(la) == 0 && xp != nil:
+		edits = append(edits, edit{xp.whole, ""})
+	case len(la) == 0:
+	case xp != nil && xp.attr:
+		// An attribute can only hold a simple value, so it is replaced by
+		// an element.
+		edits = append(edits, edit{xp.whole, ""})
+		fallthrough
+	case xp == nil:
+		added = fmt.Sprintf("\n   <dc:%[1]s xmlns:dc=%[2]q>%[3]s</dc:%[1]s>", tp.name.Local, dcNS, langAltContent(la))
+	default:
+		edits = append(edits, edit{xp.value, langAltContent(la)})
+	}
+	if len(edits) > 0 || added != "" {
+		packet := []byte(applyEdits(text, desc, edits, added))
+		if err = e.Set(0, tiff.XMPTagID, tiff.FTByte.ID(), uint32(len(packet)), packet); err != nil {
+			return err
+		}
+	}
+
+	v := la.Default()
+	switch {
+	case v == "":
+		return e.Delete(0, tp.tagID)
+	case tp.tagID == tiff.XPTitleTagID:
+		b := tiff.EncodeXP(v)
+		return e.Set(0, tp.tagID, tiff.FTByte.ID(), uint32(len(b)), b)
+	default:
+		b := append([]byte(v), 0)
+		return e.Set(0, tp.tagID, tiff.FTAscii.ID(), uint32(len(b)), b)
+	}
+}
+
+// langAltContent returns the content of a property element holding la.  The
+// default value comes first, as required by the XMP specification, followed
+// by the other languages in order.
+func langAltContent(la LangAlt) string {
+	langs := make([]string, 0, len(la))
+	for lang := range la {
+		if lang != DefaultLang {
+			langs = append(langs, lang)
+		}
+	}
+	sort.Strings(langs)
+	if _, ok := la[DefaultLang]; ok {
+		langs = append([]string{DefaultLang}, langs...)
+	}
+	var buf bytes.Buffer
+	buf.WriteString("<rdf:Alt xmlns:rdf=\"" + rdfNS + "\">")
+	for _, lang := range langs {
+		fmt.Fprintf(&buf, "<rdf:li xml:lang=%q>%s</rdf:li>", escape(lang), escape(la[lang]))
+	}
+	buf.WriteString("</rdf:Alt>")
+	return buf.String()
+}
@@ -0,0 +1,416 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package exif
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strings"
+
+	"github.com/google/tiff"
+)
+
+// Groups of Metadata properties that do not come from tags.  The rest are the
+// ExifTool groups of the IFDs they come from (see GroupIFD0 and others).
+const (
+	GroupXMP  = "XMP"
+	GroupIPTC = "IPTC"
+	GroupICC  = "ICC_Profile"
+)
+
+// A Property is a single value of a Metadata, along with where it came from.
+type Property struct {
+	// Group is the ExifTool group the value was found in, such as
+	// GroupExifIFD or GroupXMP.
+	Group string
+	// Name is the ExifTool name of a tag, the local name of an XMP
+	// property, or the name of an IPTC dataset.
+	Name string
+	// Value is the value as text.  Lists are separated by ", ".
+	Value string
+	// TagID is the tag the value came from.  For XMP and IPTC values, it
+	// is the tag holding the packet or block.
+	TagID uint16
+	// Path names the IFD holding the tag, such as "IFD 0/34665[0]", and
+	// Offset is where that IFD is in the file (0 if it is not known).
+	Path   string
+	Offset uint64
+	// Location locates a value within the block holding it: the namespace
+	// of an XMP property, or the record and dataset of an IPTC value (such
+	// as "2:25").  It is empty for tags.
+	Location string
+}
+
+// Metadata gathers the metadata of a file from every source, with the
+// provenance of each value, into a single tree: groups of properties.
+type Metadata struct {
+	// Properties holds the properties in the order they are searched by
+	// Get: the first IFD, its Exif, GPS and Interoperability IFDs, the
+	// second IFD (usually the thumbnail), then XMP, IPTC and ICC.
+	Properties []Property
+	// Errors holds the errors met reading the XMP packet and the IPTC
+	// block, by group (GroupXMP or GroupIPTC).  A source that fails adds
+	// no properties; the others are read all the same.
+	Errors map[string]error
+}
+
+// Get returns the first property named name.  The name may carry a group
+// prefix, as in "ExifIFD:ISO" or "XMP:CreatorTool", to choose a source.  Names
+// are matched without regard to case.
+func (m *Metadata) Get(name string) (Property, bool) {
+	all := m.All(name)
+	if len(all) == 0 {
+		return Property{}, false
+	}
+	return all[0], true
+}
+
+// All returns every property named name, in the order of Properties, so that
+// the values that different sources record can be compared.
+func (m *Metadata) All(name string) []Property {
+	var out []Property
+	for _, p := range m.Properties {
+		if matchProperty(p, name) {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// Group returns the properties of group.
+func (m *Metadata) Group(group string) []Property {
+	var out []Property
+	for _, p := range m.Properties {
+		if p.Group == group {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// Groups returns the groups that hold properties, in the order of Properties.
+func (m *Metadata) Groups() []string {
+	var groups []string
+	seen := make(map[string]bool)
+	for _, p := range m.Properties {
+		if !seen[p.Group] {
+			seen[p.Group] = true
+			groups = append(groups, p.Group)
+		}
+	}
+	return groups
+}
+
+func isExifGroup(group string) bool {
+	switch group {
+	case GroupIFD0, GroupIFD1, GroupSubIFD, GroupExifIFD, GroupGPS, GroupInterop:
+		return true
+	}
+	return false
+}
+
+// ReadMetadata gathers the metadata of t: the tags of its first two IFDs and
+// of the Exif, GPS and Interoperability IFDs, the properties of the XMP
+// packet, the datasets of the IPTC block, and the presence of an ICC profile.
+// Tags that only describe the layout of the file (offsets to data and
+// sub-IFDs) are left out, as are the XMP, IPTC and ICC tags themselves, which
+// are given as groups of their own.  A malformed XMP packet or IPTC block is
+// recorded in the Errors of the result rather than returned.
+func ReadMetadata(t tiff.TIFF) (*Metadata, error) {
+	return readMetadata(t, embeddedXMP(t), nil)
+}
+
+// ReadFileMetadata is ReadMetadata for t parsed from the file named name,
+// whose XMP sidecar, if it has one, is merged with the embedded packet (see
+// tiff.XMPWithSidecar).  The properties of the sidecar take precedence.  If
+// the sidecar can not be read or merged, the embedded packet is used alone and
+// the error is recorded in the Errors of the result.
+func ReadFileMetadata(t tiff.TIFF, name string) (*Metadata, error) {
+	packet, err := tiff.XMPWithSidecar(t, name)
+	if err != nil {
+		packet = embeddedXMP(t)
+	}
+	return readMetadata(t, packet, err)
+}
+
+// embeddedXMP returns the XMP packet of the first IFD of t, or nil.
+func embeddedXMP(t tiff.TIFF) []byte {
+	if ifds := t.IFDs(); len(ifds) > 0 {
+		return tiff.XMP(ifds[0])
+	}
+	return nil
+}
+
+// readMetadata is ReadMetadata, taking the XMP of t to be packet.  xmpErr is
+// the error met finding it, if any.
+func readMetadata(t tiff.TIFF, packet []byte, xmpErr error) (*Metadata, error) {
+	m := &Metadata{}
+	ifds := t.IFDs()
+	if len(ifds) == 0 {
+		return m, nil
+	}
+	ifd0 := ifds[0]
+	m.addIFD(GroupIFD0, "IFD 0", ifd0)
+	exifIFDs, err := tiff.ParseSubIFDs(t, ifd0, ExifIFDTagID)
+	if err != nil {
+		return nil, err
+	}
+	for i, e := range exifIFDs {
+		path := fmt.Sprintf("IFD 0/%d[%d]", ExifIFDTagID, i)
+		m.addIFD(GroupExifIFD, path, e)
+		iops, err := tiff.ParseSubIFDs(t, e, InteroperabilityIFDTagID)
+		if err != nil {
+			return nil, err
+		}
+		for j, iop := range iops {
+			m.addIFD(GroupInterop, fmt.Sprintf("%s/%d[%d]", path, InteroperabilityIFDTagID, j), iop)
+		}
+	}
+	gps, err := tiff.ParseSubIFDs(t, ifd0, GPSIFDTagID)
+	if err != nil {
+		return nil, err
+	}
+	for i, g := range gps {
+		m.addIFD(GroupGPS, fmt.Sprintf("IFD 0/%d[%d]", GPSIFDTagID, i), g)
+	}
+	if len(ifds) > 1 {
+		m.addIFD(GroupIFD1, "IFD 1", ifds[1])
+	}
+
+	off := tiff.RawIFDOf(ifd0).Offset()
+	if xmpErr != nil {
+		m.addError(GroupXMP, xmpErr)
+	}
+	if packet != nil {
+		if err = m.addXMP(packet, off); err != nil {
+			m.addError(GroupXMP, err)
+		}
+	}
+	if block, err := tiff.IPTC(ifd0); err != nil {
+		m.addError(GroupIPTC, err)
+	} else {
+		m.addIPTC(block, off)
+	}
+	if ifd0.HasField(tiff.ICCProfileTagID) {
+		f := ifd0.GetField(tiff.ICCProfileTagID)
+		m.Properties = append(m.Properties, Property{
+			Group:  GroupICC,
+			Name:   "ICC_Profile",
+			Value:  fmt.Sprintf("(%d bytes)", f.Count()*f.Type().Size()),
+			TagID:  tiff.ICCProfileTagID,
+			Path:   "IFD 0",
+			Offset: off,
+		})
+	}
+	return m, nil
+}
+
+// addError records err as the error of group, unless it already has one.
+func (m *Metadata) addError(group string, err error) {
+	if m.Errors == nil {
+		m.Errors = make(map[string]error, 1)
+	}
+	if m.Errors[group] == nil {
+		m.Errors[group] = err
+	}
+}
+
+// addIFD adds the tags of ifd, found at path, as properties of group.
+func (m *Metadata) addIFD(group, path string, ifd tiff.IFD) {
+	off := tiff.RawIFDOf(ifd).Offset()
+	for _, f := range ifd.Fields() {
+		id := f.Tag().ID()
+		if _, ok := tiff.GetDataTags(id); ok {
+			continue
+		}
+		if _, ok := tiff.GetSubIFDTag(id); ok {
+			continue
+		}
+		switch id {
+		case tiff.XMPTagID, tiff.IPTCTagID, tiff.ICCProfileTagID:
+			continue
+		}
+		m.Properties = append(m.Properties, Property{
+			Group:  group,
+			Name:   ExifToolName(group, id),
+			Value:  propertyValue(f),
+			TagID:  id,
+			Path:   path,
+			Offset: off,
+		})
+	}
+}
+
+// maxPropertyValues is the number of values of a tag given in a Property
+// before the rest are left out.
+const maxPropertyValues = 64
+
+// propertyValue returns the value of f as text.
+func propertyValue(f tiff.Field) string {
+	ft := f.Type()
+	buf, bo := f.Value().Bytes(), f.Value().Order()
+	if ft.ID() == tiff.FTAscii.ID() {
+		return tiff.FieldText(f)
+	}
+	if ft.Size() == 0 || ft.Repr() == nil || (ft.Size() == 1 && f.Count() > maxPropertyValues) {
+		return fmt.Sprintf("(%d bytes)", f.Count()*ft.Size())
+	}
+	var vals []string
+	for i := uint64(0); i < f.Count() && uint64(len(buf)) >= ft.Size(); i++ {
+		if i == maxPropertyValues {
+			vals = append(vals, "...")
+			break
+		}
+		vals = append(vals, ft.Repr()(buf[:ft.Size()], bo))
+		buf = buf[ft.Size():]
+	}
+	return strings.Join(vals, ", ")
+}
+
+// xmpNode is an element of an XMP packet.
+type xmpNode struct {
+	XMLName xml.Name
+	Attrs   []xml.Attr `xml:",any,attr"`
+	Text    string     `xml:",chardata"`
+	Nodes   []xmpNode  `xml:",any"`
+}
+
+// addXMP adds the properties of every rdf:Description of packet, found in the
+// first IFD at offset off.  Simple properties are given as they are, and
+// arrays (rdf:Bag, rdf:Seq and rdf:Alt) as lists of their items.  Structures
+// are left out.
+func (m *Metadata) addXMP(packet []byte, off uint64) error {
+	var root xmpNode
+	if err := xml.NewDecoder(bytes.NewReader(bytes.TrimRight(packet, "\x00"))).Decode(&root); err != nil {
+		return fmt.Errorf("exif: xmp packet: %v", err)
+	}
+	add := func(name xml.Name, value string) {
+		m.Properties = append(m.Properties, Property{
+			Group:    GroupXMP,
+			Name:     name.Local,
+			Value:    value,
+			TagID:    tiff.XMPTagID,
+			Path:     "IFD 0",
+			Offset:   off,
+			Location: name.Space,
+		})
+	}
+	var walk func(n *xmpNode)
+	walk = func(n *xmpNode) {
+		if n.XMLName.Space != rdfNS || n.XMLName.Local != "Description" {
+			for i := range n.Nodes {
+				walk(&n.Nodes[i])
+			}
+			return
+		}
+		for _, a := range n.Attrs {
+			if a.Name.Space == rdfNS || a.Name.Space == "xmlns" || a.Name.Local == "xmlns" {
+				continue
+			}
+			add(a.Name, a.Value)
+		}
+		for _, p := range n.Nodes {
+			value, ok := xmpValue(&p)
+			if !ok {
+				continue
+			}
+			add(p.XMLName, value)
+		}
+	}
+	walk(&root)
+	return nil
+}
+
+// xmpValue returns the value of the property p as text.  ok is false for
+// structures.
+func xmpValue(p *xmpNode) (value string, ok bool) {
+	if len(p.Nodes) == 0 {
+		return strings.TrimSpace(p.Text), true
+	}
+	if len(p.Nodes) != 1 || p.Nodes[0].XMLName.Space != rdfNS {
+		return "", false
+	}
+	switch p.Nodes[0].XMLName.Local {
+	case "Bag", "Seq", "Alt":
+	default:
+		return "", false
+	}
+	var items []string
+	for _, li := range p.Nodes[0].Nodes {
+		if li.XMLName.Space == rdfNS && li.XMLName.Local == "li" && len(li.Nodes) == 0 {
+			items = append(items, strings.TrimSpace(li.Text))
+		}
+	}
+	return strings.Join(items, ", "), true
+}
+
+// iptcNames holds the names ExifTool gives the datasets of the IPTC
+// application record (record 2) most often found in files.
+var iptcNames = map[byte]string{
+	5:   "ObjectName",
+	15:  "Category",
+	20:  "SupplementalCategories",
+	25:  "Keywords",
+	40:  "SpecialInstructions",
+	55:  "DateCreated",
+	60:  "TimeCreated",
+	80:  "By-line",
+	85:  "By-lineTitle",
+	90:  "City",
+	92:  "Sub-location",
+	95:  "Province-State",
+	100: "Country-PrimaryLocationCode",
+	101: "Country-PrimaryLocationName",
+	103: "OriginalTransmissionReference",
+	105: "Headline",
+	110: "Credit",
+	115: "Source",
+	116: "CopyrightNotice",
+	120: "Caption-Abstract",
+	122: "Writer-Editor",
+}
+
+// addIPTC adds the datasets of the IPTC application record of block, found in
+// the first IFD at offset off.  Repeated datasets, such as Keywords, are given
+// as a single list.  Datasets of other records are left out.
+func (m *Metadata) addIPTC(block []byte, off uint64) {
+	index := make(map[byte]int)
+	for len(block) >= 5 && block[0] == iptcTagMarker {
+		record, dataset := block[1], block[2]
+		n := int(block[3])<<8 | int(block[4])
+		if n&0x8000 != 0 || 5+n > len(block) {
+			// Extended datasets are not used by the application
+			// record.
+			return
+		}
+		value := string(bytes.TrimRight(block[5:5+n], "\x00"))
+		block = block[5+n:]
+		if record != 2 || dataset == 0 {
+			continue
+		}
+		if i, ok := index[dataset]; ok {
+			m.Properties[i].Value += ", " + value
+			continue
+		}
+		name, ok := iptcNames[dataset]
+		if !ok {
+			name = fmt.Sprintf("IPTC_2_%d", dataset)
+		}
+		index[dataset] = len(m.Properties)
+		m.Properties = append(m.Properties, Property{
+			Group:    GroupIPTC,
+			Name:     name,
+			Value:    value,
+			TagID:    tiff.IPTCTagID,
+			Path:     "IFD 0",
+			Offset:   off,
+			Location: fmt.Sprintf("2:%d", dataset),
+		})
+	}
+}
+
+// iptcTagMarker is the byte that starts each IPTC-NAA dataset.
+const iptcTagMarker = 0x1C
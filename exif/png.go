@@ -0,0 +1,129 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package exif
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+
+	"github.com/google/tiff"
+)
+
+// pngSignature starts every PNG file.
+const pngSignature = "\x89PNG\r\n\x1a\n"
+
+// A pngChunk is a chunk of a PNG file.
+type pngChunk struct {
+	typ    string
+	offset int64 // of the length that starts the chunk
+	length int64 // of the data
+}
+
+// size returns the size of the chunk: its length, type, data, and CRC.
+func (c pngChunk) size() int64 { return 12 + c.length }
+
+// pngChunks returns the chunks of the PNG file in the first size bytes of r
+// up to, and including, the IEND chunk.
+func pngChunks(r io.ReaderAt, size int64) ([]pngChunk, error) {
+	sig := make([]byte, len(pngSignature))
+	if _, err := r.ReadAt(sig, 0); err != nil || string(sig) != pngSignature {
+		return nil, fmt.Errorf("exif: not a png file")
+	}
+	var chunks []pngChunk
+	var hdr [8]byte
+	for off := int64(len(pngSignature)); ; {
+		if off+12 > size {
+			return nil, fmt.Errorf("exif: png file ends without an IEND chunk")
+		}
+		if _, err := r.ReadAt(hdr[:], off); err != nil {
+			return nil, fmt.Errorf("exif: unable to read the png chunk at offset %d: %v", off, err)
+		}
+		c := pngChunk{string(hdr[4:]), off, int64(binary.BigEndian.Uint32(hdr[:]))}
+		if c.length > math.MaxInt32 || off+c.size() > size {
+			return nil, fmt.Errorf("exif: png chunk %q at offset %d has an invalid length %d", c.typ, off, c.length)
+		}
+		chunks = append(chunks, c)
+		if c.typ == "IEND" {
+			return chunks, nil
+		}
+		off += c.size()
+	}
+}
+
+// PNGExif locates the TIFF stream held by the eXIf chunk of the PNG file in
+// the first size bytes of r.  The stream is n bytes long and starts at offset
+// off, which all offsets in the stream are relative to.  An error is returned
+// if the file has no eXIf chunk.
+func PNGExif(r io.ReaderAt, size int64) (off, n int64, err error) {
+	chunks, err := pngChunks(r, size)
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, c := range chunks {
+		if c.typ == "eXIf" {
+			return c.offset + 8, c.length, nil
+		}
+	}
+	return 0, 0, fmt.Errorf("exif: no eXIf chunk found in png")
+}
+
+// ParsePNG parses the TIFF stream of the eXIf chunk of the PNG file in the
+// first size bytes of r.  Use IFDs to find the Exif IFDs of the result.
+func ParsePNG(r io.ReaderAt, size int64) (tiff.TIFF, error) {
+	off, n, err := PNGExif(r, size)
+	if err != nil {
+		return nil, err
+	}
+	return tiff.ParseEmbedded(r, off, n, nil, nil)
+}
+
+// WritePNG writes a copy of the PNG file in the first size bytes of src to dst
+// with stream as the TIFF stream of its eXIf chunk.  An existing eXIf chunk is
+// replaced in place; otherwise the new chunk is placed before the first IDAT
+// chunk, as the PNG specification requires.  A nil stream removes the eXIf
+// chunk.  Everything else is copied as it is.  See WriteJPEG for how stream is
+// usually made.
+func WritePNG(dst io.Writer, src io.ReaderAt, size int64, stream []byte) error {
+	if int64(len(stream)) > math.MaxInt32 {
+		return fmt.Errorf("exif: exif stream of %d bytes does not fit in a png chunk", len(stream))
+	}
+	chunks, err := pngChunks(src, size)
+	if err != nil {
+		return err
+	}
+	// The new chunk goes at start, and the bytes up to skip are dropped.
+	var start, skip int64 = -1, -1
+	for _, c := range chunks {
+		if c.typ == "eXIf" {
+			start, skip = c.offset, c.offset+c.size()
+			break
+		}
+		if c.typ == "IDAT" && start < 0 {
+			start, skip = c.offset, c.offset
+		}
+	}
+	if start < 0 {
+		return fmt.Errorf("exif: png file has no IDAT chunk")
+	}
+	if _, err = io.Copy(dst, io.NewSectionReader(src, 0, start)); err != nil {
+		return err
+	}
+	if stream != nil {
+		chunk := make([]byte, 8, 12+len(stream))
+		binary.BigEndian.PutUint32(chunk, uint32(len(stream)))
+		copy(chunk[4:], "eXIf")
+		chunk = append(chunk, stream...)
+		chunk = append(chunk, 0, 0, 0, 0)
+		binary.BigEndian.PutUint32(chunk[len(chunk)-4:], crc32.ChecksumIEEE(chunk[4:len(chunk)-4]))
+		if _, err = dst.Write(chunk); err != nil {
+			return err
+		}
+	}
+	_, err = io.Copy(dst, io.NewSectionReader(src, skip, size-skip))
+	return err
+}
@@ -0,0 +1,158 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package exif
+
+import "strings"
+
+// A Precedence ranks the groups of a Metadata, most trusted first, to choose
+// between sources that record the same value differently.
+type Precedence []string
+
+// DefaultPrecedence follows the Metadata Working Group guidelines: the EXIF
+// tags of the main image are preferred to the XMP packet, which is preferred
+// to the legacy IPTC block.  The thumbnail IFD comes last.
+var DefaultPrecedence = Precedence{
+	GroupExifIFD,
+	GroupIFD0,
+	GroupGPS,
+	GroupInterop,
+	GroupXMP,
+	GroupIPTC,
+	GroupICC,
+	GroupIFD1,
+}
+
+// rank returns the position of group in p, or len(p) if it is not there.
+func (p Precedence) rank(group string) int {
+	for i, g := range p {
+		if strings.EqualFold(g, group) {
+			return i
+		}
+	}
+	return len(p)
+}
+
+// equivalents lists the properties that record the same value in different
+// sources, by the name Resolve also accepts for them.
+var equivalents = []struct {
+	name    string
+	sources []string
+}{
+	{"Description", []string{"IFD0:ImageDescription", "XMP:description", "IPTC:Caption-Abstract"}},
+	{"Title", []string{"XMP:title", "IPTC:ObjectName"}},
+	{"Creator", []string{"IFD0:Artist", "XMP:creator", "IPTC:By-line"}},
+	{"Copyright", []string{"IFD0:Copyright", "XMP:rights", "IPTC:CopyrightNotice"}},
+	{"Keywords", []string{"XMP:subject", "IPTC:Keywords"}},
+	{"DateTimeOriginal", []string{"ExifIFD:DateTimeOriginal", "XMP:DateTimeOriginal", "XMP:DateCreated", "IPTC:DateCreated"}},
+	{"CreateDate", []string{"ExifIFD:CreateDate", "XMP:CreateDate"}},
+	{"ModifyDate", []string{"IFD0:ModifyDate", "XMP:ModifyDate"}},
+	{"Orientation", []string{"IFD0:Orientation", "XMP:Orientation"}},
+	{"Software", []string{"IFD0:Software", "XMP:CreatorTool"}},
+	{"Headline", []string{"XMP:Headline", "IPTC:Headline"}},
+	{"City", []string{"XMP:City", "IPTC:City"}},
+	{"Country", []string{"XMP:Country", "IPTC:Country-PrimaryLocationName"}},
+}
+
+// ResolveOptions control how Resolve chooses between sources.
+type ResolveOptions struct {
+	// Precedence ranks the groups of the Metadata.  If nil,
+	// DefaultPrecedence is used.
+	Precedence Precedence
+	// Overrides replaces Precedence for the values it names, so that, for
+	// example, an application can trust the XMP packet for "Description"
+	// only.  Names are matched as Resolve matches them.
+	Overrides map[string]Precedence
+}
+
+// Candidates returns every value of m that records name, in the order of
+// Properties.  Besides the properties named name, these include their
+// equivalents in other sources: "Description", "ImageDescription",
+// "dc:description" and "Caption-Abstract" all name the ImageDescription tag,
+// the description XMP property and the Caption-Abstract IPTC dataset.  Empty
+// values are left out.
+func (m *Metadata) Candidates(name string) []Property {
+	key, sources := equivalentsOf(name)
+	if sources == nil {
+		sources = []string{key}
+	}
+	var out []Property
+	for _, p := range m.Properties {
+		if p.Value == "" {
+			continue
+		}
+		for _, s := range sources {
+			if matchProperty(p, s) {
+				out = append(out, p)
+				break
+			}
+		}
+	}
+	return out
+}
+
+// Resolve returns the value of m that records name (see Candidates) from the
+// group ranked first by the precedence of opts.  Among values of the same
+// group, and of groups the precedence does not rank (which come after all
+// others), the first in Properties wins.  A nil opts uses DefaultPrecedence.
+func (m *Metadata) Resolve(name string, opts *ResolveOptions) (Property, bool) {
+	if opts == nil {
+		opts = &ResolveOptions{}
+	}
+	prec := opts.Precedence
+	if prec == nil {
+		prec = DefaultPrecedence
+	}
+	key, _ := equivalentsOf(name)
+	for n, p := range opts.Overrides {
+		if k, _ := equivalentsOf(n); strings.EqualFold(k, key) {
+			prec = p
+			break
+		}
+	}
+	var best Property
+	found := false
+	for _, p := range m.Candidates(name) {
+		if !found || prec.rank(p.Group) < prec.rank(best.Group) {
+			best, found = p, true
+		}
+	}
+	return best, found
+}
+
+// equivalentsOf returns the name of the set of equivalent properties name
+// belongs to, and their sources.  If there is none, name is returned as it is,
+// with nil sources.
+func equivalentsOf(name string) (key string, sources []string) {
+	local := name
+	if i := strings.LastIndex(name, ":"); i >= 0 {
+		local = name[i+1:]
+	}
+	for _, e := range equivalents {
+		if strings.EqualFold(e.name, name) {
+			return e.name, e.sources
+		}
+		for _, s := range e.sources {
+			// An XMP prefix, such as "dc:", is not a group, so
+			// names are matched without it.
+			if strings.EqualFold(s, name) || strings.EqualFold(s[strings.Index(s, ":")+1:], local) {
+				return e.name, e.sources
+			}
+		}
+	}
+	return name, nil
+}
+
+// matchProperty reports whether p is named name, which may carry a group
+// prefix.  The EXIF group stands for all the groups of tags.
+func matchProperty(p Property, name string) bool {
+	group := ""
+	if i := strings.LastIndex(name, ":"); i >= 0 {
+		group, name = name[:i], name[i+1:]
+	}
+	if group != "" && !strings.EqualFold(group, p.Group) && !(strings.EqualFold(group, GroupEXIF) && isExifGroup(p.Group)) {
+		return false
+	}
+	return strings.EqualFold(name, p.Name)
+}
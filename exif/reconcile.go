@@ -0,0 +1,512 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package exif
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/tiff"
+)
+
+// A Conflict is a value that the EXIF tags and the XMP packet of a file record
+// differently.
+type Conflict struct {
+	Tag ExifToolTag
+	// Property is the qualified name of the XMP property, such as
+	// "xmp:ModifyDate".
+	Property string
+	// Exif and XMP hold the two values in the form used by the XMP packet
+	// (dates as "2006-01-02T15:04:05", lists separated by "; ").  An empty
+	// string means the value is missing.
+	Exif, XMP string
+}
+
+func (c Conflict) String() string {
+	return fmt.Sprintf("%s:%s = %q, but %s = %q", c.Tag.Group, c.Tag.Name, c.Exif, c.Property, c.XMP)
+}
+
+// A SyncDirection says which of the EXIF tags and the XMP packet is taken to
+// be correct when they are synchronized.
+type SyncDirection int
+
+const (
+	// ExifToXMP copies EXIF tags to the XMP packet.
+	ExifToXMP SyncDirection = iota + 1
+	// XMPToExif copies XMP properties to the EXIF tags.
+	XMPToExif
+)
+
+// XMP namespaces.
+const (
+	rdfNS     = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+	xmpNS     = "http://ns.adobe.com/xap/1.0/"
+	xmpExifNS = "http://ns.adobe.com/exif/1.0/"
+	xmpTIFFNS = "http://ns.adobe.com/tiff/1.0/"
+	dcNS      = "http://purl.org/dc/elements/1.1/"
+)
+
+// xmlLang is the name of the xml:lang attribute.
+var xmlLang = xml.Name{Space: "http://www.w3.org/XML/1998/namespace", Local: "lang"}
+
+// Kinds of reconciled values.
+const (
+	kindDate = iota
+	kindInt
+	kindSeq
+)
+
+// reconciled lists the EXIF tags that have XMP equivalents (see the XMP
+// Specification Part 2 and the Metadata Working Group guidelines).
+var reconciled = []struct {
+	group  string
+	tagID  uint16
+	prefix string
+	name   xml.Name
+	kind   int
+}{
+	{GroupIFD0, 306, "xmp", xml.Name{Space: xmpNS, Local: "ModifyDate"}, kindDate},
+	{GroupExifIFD, 36867, "exif", xml.Name{Space: xmpExifNS, Local: "DateTimeOriginal"}, kindDate},
+	{GroupExifIFD, 36868, "xmp", xml.Name{Space: xmpNS, Local: "CreateDate"}, kindDate},
+	{GroupIFD0, 274, "tiff", xml.Name{Space: xmpTIFFNS, Local: "Orientation"}, kindInt},
+	{GroupIFD0, 315, "dc", xml.Name{Space: dcNS, Local: "creator"}, kindSeq},
+}
+
+// Reconcile compares the EXIF tags of the first IFD of t (and its Exif IFD)
+// with the equivalent properties of its XMP packet and returns those that
+// disagree.  Values found on only one side are not conflicts.  Dates are
+// compared to the precision of the less precise of the two and time zones are
+// ignored, since EXIF dates usually have none.
+func Reconcile(t tiff.TIFF) ([]Conflict, error) {
+	all, err := compare(t)
+	if err != nil {
+		return nil, err
+	}
+	var out []Conflict
+	for _, c := range all {
+		if c.Exif != "" && c.XMP != "" {
+			out = append(out, c)
+		}
+	}
+	return out, nil
+}
+
+// Sync queues changes on e that make the EXIF tags and the XMP packet of the
+// first IFD agree, taking values from the side given by dir.  Values missing
+// from that side are taken from the other one.  The changes are made when
+// e.Commit is called.  The values that were changed are returned.
+func Sync(e *tiff.Editor, dir SyncDirection) ([]Conflict, error) {
+	t := e.TIFF()
+	all, err := compare(t)
+	if err != nil {
+		return nil, err
+	}
+	var toXMP []Conflict
+	for _, c := range all {
+		if c.XMP == "" || (c.Exif != "" && dir == ExifToXMP) {
+			toXMP = append(toXMP, c)
+			continue
+		}
+		if err = setExif(e, c); err != nil {
+			return nil, err
+		}
+	}
+	if len(toXMP) > 0 {
+		packet, err := setXMP(pendingXMP(e), toXMP)
+		if err != nil {
+			return nil, err
+		}
+		if err = e.Set(0, tiff.XMPTagID, tiff.FTByte.ID(), uint32(len(packet)), packet); err != nil {
+			return nil, err
+		}
+	}
+	return all, nil
+}
+
+// pendingXMP returns the XMP packet of the first IFD of the file edited by e,
+// including changes made to it that are not yet committed.
+func pendingXMP(e *tiff.Editor) []byte {
+	f, ok := e.Field(0, tiff.XMPTagID)
+	if !ok {
+		return nil
+	}
+	return f.Value().Bytes()[:f.Count()*f.Type().Size()]
+}
+
+// compare returns every value that differs between the two sides, including
+// those missing from one side.
+func compare(t tiff.TIFF) ([]Conflict, error) {
+	if len(t.IFDs()) == 0 {
+		return nil, fmt.Errorf("exif: no IFDs found")
+	}
+	ifd0 := t.IFDs()[0]
+	var eIFD tiff.IFD
+	if subs, err := tiff.ParseSubIFDs(t, ifd0, ExifIFDTagID); err != nil {
+		return nil, err
+	} else if len(subs) > 0 {
+		eIFD = subs[0]
+	}
+	props, _, err := readXMP(tiff.XMP(ifd0), reconciledNames())
+	if err != nil {
+		return nil, fmt.Errorf("exif: unable to read the xmp packet: %v", err)
+	}
+	var out []Conflict
+	for _, r := range reconciled {
+		ifd := ifd0
+		if r.group == GroupExifIFD {
+			ifd = eIFD
+		}
+		c := Conflict{
+			Tag:      ExifToolTag{r.group, r.tagID, GroupTagSpace(r.group).GetTag(r.tagID).Name()},
+			Property: r.prefix + ":" + r.name.Local,
+			Exif:     exifValue(ifd, r.tagID, r.kind),
+		}
+		if p := props[r.name]; p != nil {
+			c.XMP = strings.Join(p.values, "; ")
+		}
+		if !sameValue(c.Exif, c.XMP, r.kind) {
+			out = append(out, c)
+		}
+	}
+	return out, nil
+}
+
+// exifValue returns the value of tagID in ifd in the form used by XMP.
+func exifValue(ifd tiff.IFD, tagID uint16, kind int) string {
+	if ifd == nil || !ifd.HasField(tagID) {
+		return ""
+	}
+	f := ifd.GetField(tagID)
+	if kind == kindInt {
+		ft := f.Type()
+		if f.Count() == 0 || uint64(len(f.Value().Bytes())) < ft.Size() {
+			return ""
+		}
+		// Writers use signed types for some integers; values of any
+		// other type (such as ASCII) are left out.
+		switch ft.ReflectType().Kind() {
+		case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return fmt.Sprint(ft.Valuer()(f.Value().Bytes(), f.Value().Order()).Uint())
+		case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return fmt.Sprint(ft.Valuer()(f.Value().Bytes(), f.Value().Order()).Int())
+		}
+		return ""
+	}
+	s := strings.TrimSpace(tiff.FieldText(f))
+	if kind == kindDate {
+		// "2006:01:02 15:04:05" becomes "2006-01-02T15:04:05".
+		if strings.Trim(s, "0: ") == "" {
+			return ""
+		}
+		if len(s) >= 10 {
+			s = strings.Replace(s[:10], ":", "-", -1) + strings.Replace(s[10:], " ", "T", 1)
+		}
+	}
+	return s
+}
+
+// sameValue reports whether the two values agree.
+func sameValue(a, b string, kind int) bool {
+	if kind != kindDate || a == "" || b == "" {
+		return a == b
+	}
+	a, b = wallClock(a), wallClock(b)
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	return strings.HasPrefix(b, a)
+}
+
+// wallClock strips the fractional seconds and time zone from an XMP date.
+func wallClock(s string) string {
+	if len(s) > 19 {
+		s = s[:19]
+	}
+	if i := strings.IndexAny(s, "Z+"); i >= 0 {
+		s = s[:i]
+	}
+	if i := strings.LastIndex(s, "-"); i > 10 {
+		s = s[:i]
+	}
+	return s
+}
+
+// setExif queues the change of the EXIF tag of c to its XMP value.
+func setExif(e *tiff.Editor, c Conflict) error {
+	var kind int
+	for _, r := range reconciled {
+		if r.tagID == c.Tag.TagID {
+			kind = r.kind
+		}
+	}
+	typeID, val := tiff.FTAscii.ID(), append([]byte(c.XMP), 0)
+	switch kind {
+	case kindInt:
+		n, err := strconv.ParseUint(c.XMP, 10, 16)
+		if err != nil {
+			return fmt.Errorf("exif: invalid value %q for %s: %v", c.XMP, c.Property, err)
+		}
+		typeID, val = tiff.FTShort.ID(), make([]byte, 2)
+		e.ByteOrder().PutUint16(val, uint16(n))
+	case kindDate:
+		// Missing parts of "2006-01-02T15:04:05" are filled in with zeros.
+		s := wallClock(c.XMP)
+		s += "0000-01-01T00:00:00"[len(s):]
+		s = strings.Replace(s[:10], "-", ":", -1) + " " + s[11:]
+		val = append([]byte(s), 0)
+	}
+	count := uint32(len(val))
+	if typeID == tiff.FTShort.ID() {
+		count = 1
+	}
+	if c.Tag.Group == GroupExifIFD {
+		return e.SetSub(0, ExifIFDTagID, c.Tag.TagID, typeID, count, val)
+	}
+	return e.Set(0, c.Tag.TagID, typeID, count, val)
+}
+
+// reconciledNames returns the names of the XMP properties of reconciled.
+func reconciledNames() map[xml.Name]bool {
+	want := make(map[xml.Name]bool, len(reconciled))
+	for _, r := range reconciled {
+		want[r.name] = true
+	}
+	return want
+}
+
+// A span is a range of bytes of an XMP packet.
+type span struct {
+	start, end int
+}
+
+// An xmpProp is a property found in an XMP packet.
+type xmpProp struct {
+	values []string
+	// langs holds the xml:lang of each of values, or "" for values that
+	// have none.
+	langs []string
+	// value holds the bytes to replace to change the property: the value
+	// of the attribute, or everything between the start and end tags of
+	// the element.
+	value span
+	// whole holds the bytes to remove to delete the property.
+	whole span
+	attr  bool
+}
+
+// readXMP returns the properties named in want found in packet along with the
+// span of the start tag of the first rdf:Description element.  Properties may
+// be given either as elements or as attributes (the short form of RDF).  Only
+// the first occurrence of each property is used.
+func readXMP(packet []byte, want map[xml.Name]bool) (props map[xml.Name]*xmpProp, desc span, err error) {
+	props = make(map[xml.Name]*xmpProp, len(want))
+	desc = span{-1, -1}
+	d := xml.NewDecoder(bytes.NewReader(packet))
+	var (
+		cur   *xmpProp // property whose content is being read
+		curN  xml.Name
+		depth int    // depth of elements within cur
+		lang  string // xml:lang of the rdf:li being read
+		text  bytes.Buffer
+	)
+	for {
+		before := int(d.InputOffset())
+		tok, err := d.Token()
+		if err == io.EOF {
+			return props, desc, nil
+		}
+		if err != nil {
+			return nil, desc, err
+		}
+		after := int(d.InputOffset())
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			if cur != nil {
+				depth++
+				if tok.Name == (xml.Name{Space: rdfNS, Local: "li"}) {
+					text.Reset()
+					lang = ""
+					for _, a := range tok.Attr {
+						if a.Name == xmlLang {
+							lang = a.Value
+						}
+					}
+				}
+				continue
+			}
+			if tok.Name == (xml.Name{Space: rdfNS, Local: "Description"}) && desc.start < 0 {
+				desc = span{before, after}
+			}
+			for _, a := range tok.Attr {
+				if !want[a.Name] || props[a.Name] != nil {
+					continue
+				}
+				p := &xmpProp{values: []string{a.Value}, langs: []string{""}, attr: true}
+				if p.value, p.whole, err = attrValue(packet[before:after], a.Name.Local); err != nil {
+					return nil, desc, err
+				}
+				p.value.start += before
+				p.value.end += before
+				p.whole.start += before
+				p.whole.end += before
+				props[a.Name] = p
+			}
+			if want[tok.Name] && props[tok.Name] == nil {
+				cur, curN, depth = &xmpProp{value: span{after, after}, whole: span{before, after}}, tok.Name, 0
+				text.Reset()
+			}
+		case xml.CharData:
+			if cur != nil {
+				text.Write(tok)
+			}
+		case xml.EndElement:
+			if cur == nil {
+				continue
+			}
+			if depth > 0 {
+				if tok.Name == (xml.Name{Space: rdfNS, Local: "li"}) {
+					cur.values = append(cur.values, strings.TrimSpace(text.String()))
+					cur.langs = append(cur.langs, lang)
+				}
+				depth--
+				continue
+			}
+			if len(cur.values) == 0 {
+				if v := strings.TrimSpace(text.String()); v != "" {
+					cur.values, cur.langs = []string{v}, []string{""}
+				}
+			}
+			cur.value.end = before
+			cur.whole.end = after
+			props[curN] = cur
+			cur = nil
+		}
+	}
+}
+
+var attrRE = regexp.MustCompile(`\s[A-Za-z_][\w.\-]*:([\w.\-]+)\s*=\s*(?:"([^"]*)"|'([^']*)')`)
+
+// attrValue returns the span of the value of the attribute named local in the
+// start tag tag, along with the span of the whole attribute (including the
+// space before it).
+func attrValue(tag []byte, local string) (value, whole span, err error) {
+	for _, m := range attrRE.FindAllSubmatchIndex(tag, -1) {
+		if string(tag[m[2]:m[3]]) != local {
+			continue
+		}
+		if m[4] >= 0 {
+			return span{m[4], m[5]}, span{m[0], m[1]}, nil
+		}
+		return span{m[6], m[7]}, span{m[0], m[1]}, nil
+	}
+	return span{}, span{}, fmt.Errorf("unable to locate attribute %q", local)
+}
+
+// emptyXMP is the packet that values are added to if a file has none.
+const emptyXMP = `<?xpacket begin="` + "\ufeff" + `" id="W5M0MpCehiHzreSzNTczkc9d"?>
+<x:xmpmeta xmlns:x="adobe:ns:meta/">
+ <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+  <rdf:Description rdf:about=""/>
+ </rdf:RDF>
+</x:xmpmeta>
+<?xpacket end="w"?>`
+
+// xmpText returns packet as text, without its padding.  A missing or empty
+// packet is replaced by emptyXMP.
+func xmpText(packet []byte) string {
+	text := string(bytes.TrimRight(packet, "\x00"))
+	if strings.TrimSpace(text) == "" {
+		text = emptyXMP
+	}
+	return text
+}
+
+// An edit replaces the bytes of an XMP packet found in span with text.
+type edit struct {
+	span
+	text string
+}
+
+// applyEdits returns text with edits made and the property elements in added
+// appended to the rdf:Description element whose start tag is desc.
+func applyEdits(text string, desc span, edits []edit, added string) string {
+	if added != "" {
+		tag := text[desc.start:desc.end]
+		if strings.HasSuffix(tag, "/>") {
+			qname := strings.Fields(tag[1:])[0]
+			qname = strings.TrimSuffix(qname, "/>")
+			edits = append(edits, edit{span{desc.end - 2, desc.end}, ">" + added + "\n  </" + qname + ">"})
+		} else {
+			edits = append(edits, edit{span{desc.end, desc.end}, added})
+		}
+	}
+	// Apply the edits from the end of the packet so that the spans of the
+	// earlier ones stay valid.
+	sort.Slice(edits, func(i, j int) bool { return edits[i].start > edits[j].start })
+	for _, ed := range edits {
+		text = text[:ed.start] + ed.text + text[ed.end:]
+	}
+	return text
+}
+
+// setXMP returns a copy of packet with the properties of cs set to their EXIF
+// values.  Properties already present are changed in place; the rest are added
+// to the first rdf:Description element.
+func setXMP(packet []byte, cs []Conflict) ([]byte, error) {
+	text := xmpText(packet)
+	props, desc, err := readXMP([]byte(text), reconciledNames())
+	if err != nil {
+		return nil, fmt.Errorf("exif: unable to read the xmp packet: %v", err)
+	}
+	if desc.start < 0 {
+		return nil, fmt.Errorf("exif: xmp packet has no rdf:Description element")
+	}
+	var edits []edit
+	var added bytes.Buffer
+	for _, c := range cs {
+		for _, r := range reconciled {
+			if r.tagID != c.Tag.TagID || r.group != c.Tag.Group {
+				continue
+			}
+			p := props[r.name]
+			switch {
+			case p != nil && p.attr:
+				edits = append(edits, edit{p.value, escape(c.Exif)})
+			case p != nil:
+				edits = append(edits, edit{p.value, xmpContent(c.Exif, r.kind)})
+			default:
+				fmt.Fprintf(&added, "\n   <%[1]s:%[2]s xmlns:%[1]s=%[3]q>%[4]s</%[1]s:%[2]s>", r.prefix, r.name.Local, r.name.Space, xmpContent(c.Exif, r.kind))
+			}
+		}
+	}
+	return []byte(applyEdits(text, desc, edits, added.String())), nil
+}
+
+// xmpContent returns the content of a property element holding v.
+func xmpContent(v string, kind int) string {
+	if kind != kindSeq {
+		return escape(v)
+	}
+	var buf bytes.Buffer
+	buf.WriteString("<rdf:Seq xmlns:rdf=\"" + rdfNS + "\">")
+	for _, s := range strings.Split(v, ";") {
+		buf.WriteString("<rdf:li>" + escape(strings.TrimSpace(s)) + "</rdf:li>")
+	}
+	buf.WriteString("</rdf:Seq>")
+	return buf.String()
+}
+
+func escape(s string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
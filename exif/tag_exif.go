@@ -5,7 +5,6 @@
 package exif
 
 import (
-	"math/big"
 	"strings"
 
 	"github.com/google/tiff"
@@ -59,15 +58,18 @@ From Interoperability:
   A. Attached Information Related to Interoperability
 */
 
-// fiRat displays rationals (fractions) in n/d notation.  It assumes the
-// underlying Go type is a *big.Rat.  This can be better.
+// fiRat displays rationals (fractions) in reduced n/d notation.
 func fiRat(f tiff.Field) string {
-	return f.Type().Valuer()(f.Value().Bytes(), f.Value().Order()).Interface().(*big.Rat).String()
+	return tiff.DecodeRational(f.Value().Bytes(), f.Value().Order()).Reduce().String()
 }
 
 // fiRatAsFloat displays a rational as a float with 2 decimal points.
 func fiRatAsFloat(f tiff.Field) string {
-	return f.Type().Valuer()(f.Value().Bytes(), f.Value().Order()).Interface().(*big.Rat).FloatString(2)
+	r := tiff.DecodeRational(f.Value().Bytes(), f.Value().Order())
+	if !r.Valid() {
+		return r.String()
+	}
+	return r.Rat().FloatString(2)
 }
 
 /* f/Stop formatting:
@@ -117,6 +119,9 @@ func init() {
 	exifTags.Register(tiff.NewTag(36864, "ExifVersion", nil))
 	exifTags.Register(tiff.NewTag(36867, "DateTimeOriginal", nil))
 	exifTags.Register(tiff.NewTag(36868, "DateTimeDigitized", nil))
+	exifTags.Register(tiff.NewTag(36880, "OffsetTime", nil))
+	exifTags.Register(tiff.NewTag(36881, "OffsetTimeOriginal", nil))
+	exifTags.Register(tiff.NewTag(36882, "OffsetTimeDigitized", nil))
 	exifTags.Register(tiff.NewTag(37121, "ComponentsConfiguration", nil))
 	exifTags.Register(tiff.NewTag(37122, "CompressedBitsPerPixel", nil))
 	exifTags.Register(tiff.NewTag(37377, "ShutterSpeedValue", nil))
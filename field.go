@@ -88,6 +88,10 @@ type field struct {
 	// tsp is the TagSpace that can be used to look up the Tag that
 	// corresponds to the result of entry.TagID().
 	tsp TagSpace
+
+	// offset, if not 0, is where the values are found when that differs
+	// from the offset in entry, as it does in NDPI files larger than 4 GB.
+	offset uint64
 }
 
 func (f *field) Tag() Tag {
@@ -112,6 +116,9 @@ func (f *field) Offset() uint64 {
 	if f.Type().Size()*f.Count() <= 4 {
 		return 0
 	}
+	if f.offset != 0 {
+		return f.offset
+	}
 	offsetBytes := f.entry.ValueOffset()
 	return uint64(f.value.Order().Uint32(offsetBytes[:]))
 }
@@ -120,6 +127,11 @@ func (f *field) Value() FieldValue {
 	return f.value
 }
 
+// GenericEntry returns the entry of f.  See EntryOf.
+func (f *field) GenericEntry() GenericEntry {
+	return NewGenericEntry(f.entry)
+}
+
 func (f *field) String() string {
 	var (
 		theTSP  = f.tsp
@@ -217,29 +229,141 @@ func (f *field) MarshalJSON() ([]byte, error) {
 	return json.Marshal(tmp)
 }
 
+// newField returns a Field for tagID holding count values of type typeID that
+// are encoded in value using bo.  If the value fits in the 4 bytes of the
+// entry, it is stored there.  Otherwise, the value offset is left for a writer
+// to fill in once the location of the value is known.
+func newField(tagID, typeID uint16, count uint32, value []byte, bo binary.ByteOrder, tsp TagSpace, ftsp FieldTypeSpace) Field {
+	e := &entry{tagID: tagID, typeID: typeID, count: count}
+	fv := &fieldValue{order: bo, value: value}
+	if len(value) <= 4 {
+		copy(e.valueOffset[:], value)
+		fv.value = e.valueOffset[:]
+	}
+	return &field{entry: e, value: fv, tsp: tsp, ftsp: ftsp}
+}
+
 func ParseField(br BReader, tsp TagSpace, ftsp FieldTypeSpace) (out Field, err error) {
+	return parseField(br, tsp, ftsp, nil)
+}
+
+// parseField is ParseField, with the offsets of values that are not stored in
+// the entry passed through fix, if it is not nil (see NDPIOffset).
+func parseField(br BReader, tsp TagSpace, ftsp FieldTypeSpace, fix func(uint64) uint64) (out Field, err error) {
 	if ftsp == nil {
 		ftsp = DefaultFieldTypeSpace
 	}
 	if tsp == nil {
 		tsp = DefaultTagSpace
 	}
-	f := &field{ftsp: ftsp, tsp: tsp}
+	f := &field{ftsp: FieldTypeSpaceOf(br, ftsp), tsp: tsp}
 	if f.entry, err = ParseEntry(br); err != nil {
 		return
 	}
+	if e, ok := f.entry.(*entry); ok && QuirksOf(br)&QuirkSignedOffsets != 0 && isOffsetTag(e.tagID) {
+		if typeID, ok := unsignedType(e.typeID); ok {
+			e.typeID = typeID
+		}
+	}
 	fv := &fieldValue{order: br.ByteOrder()}
 	valSize := int64(f.Count()) * int64(f.Type().Size())
 	valOffBytes := f.entry.ValueOffset()
 	if valSize > 4 {
-		fv.value = make([]byte, valSize)
 		offset := int64(br.ByteOrder().Uint32(valOffBytes[:]))
-		if err = br.BReadSection(&fv.value, offset, valSize); err != nil {
+		if fix != nil {
+			if fixed := int64(fix(uint64(offset))); fixed != offset {
+				offset = fixed
+				f.offset = uint64(fixed)
+			}
+		}
+		if err = CheckValueSize(br, ErrorContext{uint64(offset), f.entry.TagID(), -1}, f.Count(), f.Type()); err != nil {
+			return
+		}
+		if err = ChargeValue(br, uint64(offset), uint64(valSize)); err != nil {
 			return
 		}
+		if dv, ok := DeferredValue(br, f.entry.TagID(), offset, valSize); ok {
+			f.value = dv
+			return f, nil
+		}
+		if fv.value, err = ReadValue(br, offset, valSize); err != nil {
+			return nil, ReadError(err, "the values of a field", ErrorContext{uint64(offset), f.Tag().ID(), -1})
+		}
 	} else {
 		fv.value = valOffBytes[:]
 	}
 	f.value = fv
 	return f, nil
 }
+
+// ErrInvalidFieldValue is returned when the type, count, or contents of a field
+// do not match what is required by its tag.
+type ErrInvalidFieldValue struct {
+	TagID   uint16
+	Problem string
+}
+
+func (e ErrInvalidFieldValue) Error() string {
+	return fmt.Sprintf("tiff: invalid value for tag %d: %s", e.TagID, e.Problem)
+}
+
+// uintValues returns the values of f as a slice of uint64.  Only fields with
+// an unsigned integer field type (such as SHORT, LONG, IFD, and the BigTIFF
+// LONG8 and IFD8) are supported.  This is mostly useful for fields holding
+// offsets and byte counts.
+func uintValues(f Field) ([]uint64, error) {
+	var a *OffsetArena
+	return a.Uints(f)
+}
+
+// checkUints checks that f has an unsigned integer type and holds all of its
+// values.
+func checkUints(f Field) error {
+	ft := f.Type()
+	size := ft.Size()
+	if uint64(len(f.Value().Bytes())) < size*f.Count() {
+		return fmt.Errorf("tiff: field %d has %d bytes for %d values", f.Tag().ID(), len(f.Value().Bytes()), f.Count())
+	}
+	if isUintType(ft) {
+		return nil
+	}
+	if _, ok := unsignedType(ft.ID()); ok && isOffsetTag(f.Tag().ID()) {
+		return signedOffsets(f)
+	}
+	return ErrInvalidType{ErrorContext{f.Offset(), f.Tag().ID(), -1}, ft.ID(), fmt.Sprintf("field type %q is not an unsigned integer type", ft.Name())}
+}
+
+// isUintType reports whether ft is an unsigned integer type of 1, 2, 4 or 8
+// bytes.
+func isUintType(ft FieldType) bool {
+	switch k, size := ft.ReflectType().Kind(), ft.Size(); {
+	case k == reflect.Uint8 && size == 1, k == reflect.Uint16 && size == 2,
+		k == reflect.Uint32 && size == 4, k == reflect.Uint64 && size == 8:
+		return true
+	}
+	return false
+}
+
+// decodeUints decodes the values of f, checked by checkUints, into vals.
+func decodeUints(f Field, vals []uint64) {
+	bo := f.Value().Order()
+	buf := f.Value().Bytes()
+	switch f.Type().Size() {
+	case 1:
+		for i := range vals {
+			vals[i] = uint64(buf[i])
+		}
+	case 2:
+		for i := range vals {
+			vals[i] = uint64(bo.Uint16(buf[2*i:]))
+		}
+	case 4:
+		for i := range vals {
+			vals[i] = uint64(bo.Uint32(buf[4*i:]))
+		}
+	case 8:
+		for i := range vals {
+			vals[i] = bo.Uint64(buf[8*i:])
+		}
+	}
+}
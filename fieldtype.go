@@ -51,6 +51,9 @@ type fieldType struct {
 	repr   FieldTypeRepr
 	rval   FieldTypeValuer
 	typ    reflect.Type
+	// unknown is set for the field types that a FieldTypeSpace makes up for
+	// IDs that none of its FieldTypeSets define.
+	unknown bool
 }
 
 func (ft *fieldType) ID() uint16 {
@@ -98,3 +101,31 @@ func (ft *fieldType) MarshalJSON() ([]byte, error) {
 	}
 	return json.Marshal(tmp)
 }
+
+// KnownFieldType reports whether ft is defined by a FieldTypeSet, as opposed
+// to being made up by a FieldTypeSpace for an ID it does not know.  The size
+// of an unknown field type is a guess, so its values can not be trusted.
+func KnownFieldType(ft FieldType) bool {
+	u, ok := ft.(*fieldType)
+	return !ok || !u.unknown
+}
+
+// bigTIFFOnly reports whether ft is one of the field types that BigTIFF adds
+// (LONG8, SLONG8 and IFD8), which classic TIFF files can not hold.
+func bigTIFFOnly(ft FieldType) bool {
+	return ft.ID() >= FTLong8.ID() && ft.ID() <= FTIFD8.ID()
+}
+
+// checkFieldType returns what is wrong with storing values of type ft in a
+// BigTIFF (big) or classic TIFF file, or "" if nothing is.
+func checkFieldType(ft FieldType, big bool) string {
+	switch {
+	case !KnownFieldType(ft):
+		return "the field type is unknown, so the size of its values is too"
+	case ft.Size() == 0:
+		return "the field type has no size"
+	case !big && bigTIFFOnly(ft):
+		return fmt.Sprintf("%s values can only be stored in BigTIFF files", ft.Name())
+	}
+	return ""
+}
@@ -5,32 +5,29 @@
 package tiff
 
 import (
-	"bytes"
 	"encoding/binary"
 	"fmt"
 	"math"
-	"math/big"
 	"reflect"
+	"sync"
 )
 
 /* FieldTypeRepr */
 // These functions provide string representations of values based on field types.
 func reprByte(in []byte, bo binary.ByteOrder) string   { return fmt.Sprintf("%d", in[0]) }
 func reprSByte(in []byte, bo binary.ByteOrder) string  { return fmt.Sprintf("%d", int8(in[0])) }
-func reprASCII(in []byte, bo binary.ByteOrder) string  { return string(in) }
+func reprASCII(in []byte, bo binary.ByteOrder) string  { return DecodeText(in) }
 func reprShort(in []byte, bo binary.ByteOrder) string  { return fmt.Sprintf("%d", bo.Uint16(in)) }
 func reprSShort(in []byte, bo binary.ByteOrder) string { return fmt.Sprintf("%d", int16(bo.Uint16(in))) }
 func reprLong(in []byte, bo binary.ByteOrder) string   { return fmt.Sprintf("%d", bo.Uint32(in)) }
 func reprSLong(in []byte, bo binary.ByteOrder) string  { return fmt.Sprintf("%d", int32(bo.Uint32(in))) }
 func reprRational(in []byte, bo binary.ByteOrder) string {
-	// Print the representation directly to prevent panics from divide by
-	// zero errors when using big.NewRat().
-	return fmt.Sprintf("%d/%d", int64(bo.Uint32(in)), int64(bo.Uint32(in[4:])))
+	// Printed as stored, in "n/d" notation, so that a denominator of 0
+	// shows rather than being divided by.
+	return DecodeRational(in, bo).String()
 }
 func reprSRational(in []byte, bo binary.ByteOrder) string {
-	// Print the representation directly to prevent panics from divide by
-	// zero errors when using big.NewRat()
-	return fmt.Sprintf("%d/%d", int64(int32(bo.Uint32(in))), int64(int32(bo.Uint32(in[4:]))))
+	return DecodeSRational(in, bo).String()
 }
 func reprFloat(in []byte, bo binary.ByteOrder) string {
 	return fmt.Sprintf("%f", math.Float32frombits(bo.Uint32(in)))
@@ -38,12 +35,18 @@ func reprFloat(in []byte, bo binary.ByteOrder) string {
 func reprDouble(in []byte, bo binary.ByteOrder) string {
 	return fmt.Sprintf("%f", math.Float64frombits(bo.Uint64(in)))
 }
+func reprUnicode(in []byte, bo binary.ByteOrder) string { return fmt.Sprintf("%U", bo.Uint16(in)) }
+func reprComplex(in []byte, bo binary.ByteOrder) string {
+	return fmt.Sprintf("%g", complexValue(in, bo))
+}
+func reprLong8(in []byte, bo binary.ByteOrder) string  { return fmt.Sprintf("%d", bo.Uint64(in)) }
+func reprSLong8(in []byte, bo binary.ByteOrder) string { return fmt.Sprintf("%d", int64(bo.Uint64(in))) }
 
 /* FieldTypeValuer */
 func rvalByte(in []byte, bo binary.ByteOrder) reflect.Value  { return reflect.ValueOf(in[0]) }
 func rvalSByte(in []byte, bo binary.ByteOrder) reflect.Value { return reflect.ValueOf(int8(in[0])) }
 func rvalASCII(in []byte, bo binary.ByteOrder) reflect.Value {
-	return reflect.ValueOf(string(bytes.TrimRight(in, "\x00")))
+	return reflect.ValueOf(DecodeText(in))
 }
 func rvalShort(in []byte, bo binary.ByteOrder) reflect.Value { return reflect.ValueOf(bo.Uint16(in)) }
 func rvalSShort(in []byte, bo binary.ByteOrder) reflect.Value {
@@ -54,24 +57,12 @@ func rvalSLong(in []byte, bo binary.ByteOrder) reflect.Value {
 	return reflect.ValueOf(int32(bo.Uint32(in)))
 }
 func rvalRational(in []byte, bo binary.ByteOrder) reflect.Value {
-	denom := int64(bo.Uint32(in[4:]))
-	if denom == 0 {
-		// Prevent panics due to poorly written Rational fields with a
-		// denominator of 0.
-		return reflect.New(reflect.TypeOf(big.Rat{}))
-	}
-	numer := int64(bo.Uint32(in))
-	return reflect.ValueOf(big.NewRat(numer, denom))
+	// Rationals are valued as they are stored; those with a denominator
+	// of 0 are left for the caller to spot (see Rational.Valid).
+	return reflect.ValueOf(DecodeRational(in, bo))
 }
 func rvalSRational(in []byte, bo binary.ByteOrder) reflect.Value {
-	denom := int64(int32(bo.Uint32(in[4:])))
-	if denom == 0 {
-		// Prevent panics due to poorly written Rational fields with a
-		// denominator of 0.  Their usable value would likely be 0.
-		return reflect.New(reflect.TypeOf(big.Rat{}))
-	}
-	numer := int64(int32(bo.Uint32(in)))
-	return reflect.ValueOf(big.NewRat(numer, denom))
+	return reflect.ValueOf(DecodeSRational(in, bo))
 }
 func rvalFloat(in []byte, bo binary.ByteOrder) reflect.Value {
 	return reflect.ValueOf(math.Float32frombits(bo.Uint32(in)))
@@ -79,19 +70,36 @@ func rvalFloat(in []byte, bo binary.ByteOrder) reflect.Value {
 func rvalDouble(in []byte, bo binary.ByteOrder) reflect.Value {
 	return reflect.ValueOf(math.Float64frombits(bo.Uint64(in)))
 }
+func rvalComplex(in []byte, bo binary.ByteOrder) reflect.Value {
+	return reflect.ValueOf(complexValue(in, bo))
+}
+func rvalLong8(in []byte, bo binary.ByteOrder) reflect.Value { return reflect.ValueOf(bo.Uint64(in)) }
+func rvalSLong8(in []byte, bo binary.ByteOrder) reflect.Value {
+	return reflect.ValueOf(int64(bo.Uint64(in)))
+}
+
+// complexValue returns the COMPLEX held by the first 8 bytes of in: a FLOAT
+// real part followed by a FLOAT imaginary part.
+func complexValue(in []byte, bo binary.ByteOrder) complex64 {
+	return complex(math.Float32frombits(bo.Uint32(in)), math.Float32frombits(bo.Uint32(in[4:])))
+}
 
 /* reflect.Type */
 var (
-	typByte   = reflect.TypeOf(byte(0))         // BYTE, UNDEFINED
-	typString = reflect.TypeOf(string(""))      // ASCII
-	typU16    = reflect.TypeOf(uint16(0))       // SHORT
-	typU32    = reflect.TypeOf(uint32(0))       // LONG, IFD
-	typBigRat = reflect.TypeOf((*big.Rat)(nil)) // RATIONAL, SRATIONAL
-	typI8     = reflect.TypeOf(int8(0))         // SBYTE
-	typI16    = reflect.TypeOf(int16(0))        // SSHORT
-	typI32    = reflect.TypeOf(int32(0))        // SLONG
-	typF32    = reflect.TypeOf(float32(0))      // FLOAT
-	typF64    = reflect.TypeOf(float64(0))      // DOUBLE
+	typByte   = reflect.TypeOf(byte(0))      // BYTE, UNDEFINED
+	typString = reflect.TypeOf(string(""))   // ASCII
+	typU16    = reflect.TypeOf(uint16(0))    // SHORT
+	typU32    = reflect.TypeOf(uint32(0))    // LONG, IFD
+	typRat    = reflect.TypeOf(Rational{})   // RATIONAL
+	typSRat   = reflect.TypeOf(SRational{})  // SRATIONAL
+	typI8     = reflect.TypeOf(int8(0))      // SBYTE
+	typI16    = reflect.TypeOf(int16(0))     // SSHORT
+	typI32    = reflect.TypeOf(int32(0))     // SLONG
+	typF32    = reflect.TypeOf(float32(0))   // FLOAT
+	typF64    = reflect.TypeOf(float64(0))   // DOUBLE
+	typC64    = reflect.TypeOf(complex64(0)) // COMPLEX
+	typU64    = reflect.TypeOf(uint64(0))    // LONG8, IFD8
+	typI64    = reflect.TypeOf(int64(0))     // SLONG8
 )
 
 /* Field type definitions
@@ -120,6 +128,10 @@ From [BIGTIFFDESIGN]:
 	13 = IFD	?? 32-bit unsigned integer offset value ??
 	14 = UNICODE	??
 	15 = COMPLEX	??
+From [BIGTIFFDESIGN]:
+	16 = LONG8	64-bit unsigned integer.
+	17 = SLONG8	64-bit signed integer.
+	18 = IFD8	64-bit unsigned integer offset value.
 */
 
 // Default set of Field types.  These are exported for others to use in
@@ -129,19 +141,24 @@ var (
 	FTAscii     = NewFieldType(2, "ASCII", 1, false, reprASCII, rvalASCII, typString)
 	FTShort     = NewFieldType(3, "Short", 2, false, reprShort, rvalShort, typU16)
 	FTLong      = NewFieldType(4, "Long", 4, false, reprLong, rvalLong, typU32)
-	FTRational  = NewFieldType(5, "Rational", 8, false, reprRational, rvalRational, typBigRat)
+	FTRational  = NewFieldType(5, "Rational", 8, false, reprRational, rvalRational, typRat)
 	FTSByte     = NewFieldType(6, "SByte", 1, true, reprSByte, rvalSByte, typI8)
 	FTUndefined = NewFieldType(7, "Undefined", 1, false, reprByte, rvalByte, typByte)
 	FTSShort    = NewFieldType(8, "SShort", 2, true, reprSShort, rvalSShort, typI16)
 	FTSLong     = NewFieldType(9, "SLong", 4, true, reprSLong, rvalSLong, typI32)
-	FTSRational = NewFieldType(10, "SRational", 8, true, reprSRational, rvalSRational, typBigRat)
+	FTSRational = NewFieldType(10, "SRational", 8, true, reprSRational, rvalSRational, typSRat)
 	FTFloat     = NewFieldType(11, "Float", 4, true, reprFloat, rvalFloat, typF32)
 	FTDouble    = NewFieldType(12, "Double", 8, true, reprDouble, rvalDouble, typF64)
 	FTIFD       = NewFieldType(13, "IFD", 4, false, reprLong, rvalLong, typU32)
 
-	// TODO: These two are not complete.  Get the details and finish them.
-	FTUnicode = NewFieldType(14, "Unicode", 2, false, reprByte, rvalByte, typByte)
-	FTComplex = NewFieldType(15, "Complex", 8, true, reprByte, rvalByte, typByte)
+	// See the notes below regarding these two.
+	FTUnicode = NewFieldType(14, "Unicode", 2, false, reprUnicode, rvalShort, typU16)
+	FTComplex = NewFieldType(15, "Complex", 8, true, reprComplex, rvalComplex, typC64)
+
+	// BigTIFF field types.  Classic TIFF files can not hold these.
+	FTLong8  = NewFieldType(16, "LONG8", 8, false, reprLong8, rvalLong8, typU64)
+	FTSLong8 = NewFieldType(17, "SLONG8", 8, true, reprSLong8, rvalSLong8, typI64)
+	FTIFD8   = NewFieldType(18, "IFD8", 8, false, reprLong8, rvalLong8, typU64)
 )
 
 /*
@@ -149,7 +166,7 @@ Regarding UNICODE and COMPLEX field types:
   UNICODE:  In dng_sdk_1_4/dng_sdk/source/dng_tag_types.cpp and in
   dng_sdk_1_4/dng_sdk/source/dng_image_writer.cpp, ttUnicode is defined to
   have a size of 2. In dng_image_writer.cpp, it appears unicode text is encoded
-  with UTF-16.
+  with UTF-16.  Each value is therefore taken to be a UTF-16 code unit.
 
   COMPLEX:  In dng_sdk_1_4/dng_sdk/source/dng_tag_types.cpp, ttComplex is
   defined to have a size of 8.  However, in
@@ -186,10 +203,41 @@ func init() {
 	DefaultFieldTypeSet.Register(FTIFD)
 	DefaultFieldTypeSet.Register(FTUnicode)
 	DefaultFieldTypeSet.Register(FTComplex)
+	DefaultFieldTypeSet.Register(FTLong8)
+	DefaultFieldTypeSet.Register(FTSLong8)
+	DefaultFieldTypeSet.Register(FTIFD8)
 
 	// Prevent further registration in the DefaultFieldTypeSet.  Others should
 	// add to the DefaultFieldTypeSpace instead of the core set.
 	DefaultFieldTypeSet.Lock()
 
 	DefaultFieldTypeSpace.RegisterFieldTypeSet(DefaultFieldTypeSet)
+	DefaultFieldTypeSpace.RegisterFieldTypeSet(PrivateFieldTypeSet)
+}
+
+// PrivateFieldTypeSet holds the field types added with RegisterFieldType.  It
+// is part of the DefaultFieldTypeSpace.
+var PrivateFieldTypeSet = NewFieldTypeSet("Private")
+
+var registerFieldTypeMu sync.Mutex
+
+// RegisterFieldType adds ft, a field type private to some application or
+// format, to the PrivateFieldTypeSet so that fields of its type are decoded
+// and written with its size instead of being treated as unknown.  The IDs 1
+// through 18 belong to TIFF and BigTIFF and can not be registered, nor can an
+// ID that is already registered.
+func RegisterFieldType(ft FieldType) error {
+	if ft.ID() <= FTIFD8.ID() {
+		return fmt.Errorf("tiff: field type %d is reserved", ft.ID())
+	}
+	if ft.Size() == 0 {
+		return fmt.Errorf("tiff: field type %d (%s) has no size", ft.ID(), ft.Name())
+	}
+	registerFieldTypeMu.Lock()
+	defer registerFieldTypeMu.Unlock()
+	if known := DefaultFieldTypeSpace.GetFieldType(ft.ID()); KnownFieldType(known) {
+		return fmt.Errorf("tiff: field type %d is already registered as %s", ft.ID(), known.Name())
+	}
+	PrivateFieldTypeSet.Register(ft)
+	return nil
 }
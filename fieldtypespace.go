@@ -61,7 +61,15 @@ func (ftsp *fieldTypeSpace) GetFieldType(id uint16) FieldType {
 		}
 	}
 	// For unknown field types, just represent them as bytes.
-	return NewFieldType(id, fmt.Sprintf("UNKNOWN_FIELDTYPE_%d", id), 1, false, reprByte, rvalByte, typByte)
+	return &fieldType{
+		id:      id,
+		name:    fmt.Sprintf("UNKNOWN_FIELDTYPE_%d", id),
+		size:    1,
+		repr:    reprByte,
+		rval:    rvalByte,
+		typ:     typByte,
+		unknown: true,
+	}
 }
 
 func (ftsp *fieldTypeSpace) GetFieldTypeSet(name string) (FieldTypeSet, bool) {
@@ -0,0 +1,145 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tiff
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// A FileMap lays out every byte range of a file in order: the header, the
+// IFDs, out-of-line values and data blocks referenced by the file, and the
+// gaps between and after them.
+type FileMap struct {
+	// Size is the size of the file.
+	Size uint64
+	// Regions holds the referenced regions and the gaps (of kind RegionGap
+	// and RegionTrailing), sorted by offset.  Referenced regions may
+	// overlap (see Overlaps).  Single bytes that only word align the next
+	// region are not listed.
+	Regions []Region
+	// Hidden holds the gaps that are not all zero, the likely places for
+	// hidden or appended data.
+	Hidden   []Gap
+	Overlaps []Overlap
+}
+
+// MapFile parses the TIFF found in src and returns the map of its bytes.
+func MapFile(src ReadAtReadSeeker) (*FileMap, error) {
+	t, err := Parse(src, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	rep, err := surfaceOf(t, src)
+	if err != nil {
+		return nil, err
+	}
+	m := &FileMap{Size: rep.Size, Regions: rep.Regions, Overlaps: rep.Overlaps}
+	gaps := rep.Unreferenced
+	if rep.Trailing != nil {
+		gaps = append(gaps, *rep.Trailing)
+	}
+	for _, g := range gaps {
+		m.Regions = append(m.Regions, g.Region)
+		if !g.Zero {
+			m.Hidden = append(m.Hidden, g)
+		}
+	}
+	sort.Stable(regionsByOffset(m.Regions))
+	return m, nil
+}
+
+// Usage returns the number of bytes of the file taken by each kind of region.
+// Bytes shared by overlapping regions are counted for each of them.
+func (m *FileMap) Usage() map[RegionKind]uint64 {
+	u := make(map[RegionKind]uint64)
+	for _, r := range m.Regions {
+		u[r.Kind] += r.Size
+	}
+	return u
+}
+
+// Wasted returns the number of bytes of the file that nothing refers to.
+func (m *FileMap) Wasted() uint64 {
+	u := m.Usage()
+	return u[RegionGap] + u[RegionTrailing]
+}
+
+// Fragmentation returns the share of the data blocks of the file that do not
+// directly follow the block before them in the same field (such as strip 4
+// after strip 3), from 0 for a file whose images are each stored in one run to
+// 1 for one where no two blocks are in order.
+func (m *FileMap) Fragmentation() float64 {
+	// ends maps each field, described as the data blocks are without
+	// " block <i>", to the end of its last block seen.
+	ends := make(map[string]uint64)
+	var pairs, breaks int
+	for _, r := range m.blocksInFieldOrder() {
+		field := r.Desc[:strings.LastIndex(r.Desc, " block ")]
+		end, ok := ends[field]
+		ends[field] = r.End()
+		if !ok {
+			continue
+		}
+		pairs++
+		if r.Offset != end && !(r.Offset == end+1 && end%2 == 1) {
+			breaks++
+		}
+	}
+	if pairs == 0 {
+		return 0
+	}
+	return float64(breaks) / float64(pairs)
+}
+
+// blocksInFieldOrder returns the data regions of m in the order their fields
+// list them.
+func (m *FileMap) blocksInFieldOrder() []Region {
+	var blocks []Region
+	index := make(map[int]int)
+	for _, r := range m.Regions {
+		if r.Kind != RegionData || !strings.Contains(r.Desc, " block ") {
+			continue
+		}
+		var i int
+		fmt.Sscanf(r.Desc[strings.LastIndex(r.Desc, " block ")+len(" block "):], "%d", &i)
+		index[len(blocks)] = i
+		blocks = append(blocks, r)
+	}
+	order := make([]int, len(blocks))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return index[order[a]] < index[order[b]] })
+	out := make([]Region, len(blocks))
+	for i, j := range order {
+		out[i] = blocks[j]
+	}
+	return out
+}
+
+// WriteTo writes m to w, a line per region, with gaps holding anything but
+// zeros flagged.
+func (m *FileMap) WriteTo(w io.Writer) (int64, error) {
+	var n int64
+	hidden := make(map[uint64]bool, len(m.Hidden))
+	for _, g := range m.Hidden {
+		hidden[g.Offset] = true
+	}
+	for _, r := range m.Regions {
+		flag := ""
+		if (r.Kind == RegionGap || r.Kind == RegionTrailing) && hidden[r.Offset] {
+			flag = " (not zero)"
+		}
+		k, err := fmt.Fprintf(w, "%12d %12d %-8s %s%s\n", r.Offset, r.Size, r.Kind, r.Desc, flag)
+		n += int64(k)
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,192 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tiff
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"sort"
+)
+
+// A Fingerprint is a hash of the logical content of the fields of an IFD.  It
+// is comparable, so it can be used as a map key to group files with identical
+// metadata.
+//
+// Fingerprints do not depend on how a file is laid out: the order of entries,
+// the byte order of the file, where values are stored, and the offsets of data
+// blocks and sub-IFDs are all ignored.  Integer values are compared by value,
+// so a SHORT and a LONG holding the same number are the same, and trailing NUL
+// bytes of ASCII values are ignored.
+type Fingerprint [sha256.Size]byte
+
+func (fp Fingerprint) String() string {
+	return hex.EncodeToString(fp[:])
+}
+
+// Value classes used when hashing field values.
+const (
+	fpUnsigned = 'u'
+	fpSigned   = 's'
+	fpASCII    = 'a'
+	fpRaw      = 'r'
+)
+
+// FingerprintIFD returns the Fingerprint of the fields of ifd.  Fields whose
+// values are offsets to data blocks or sub-IFDs (see RegisterDataTags and
+// RegisterSubIFDTag) are left out, since they only describe the layout of a
+// file.  Use FingerprintTIFF to include the content of sub-IFDs.
+func FingerprintIFD(ifd IFD) Fingerprint {
+	var fp Fingerprint
+	h := sha256.New()
+	hashIFD(h, ifd)
+	copy(fp[:], h.Sum(nil))
+	return fp
+}
+
+// FingerprintTIFF returns the Fingerprint of every IFD in the main IFD chain of
+// t along with the sub-IFDs (such as the Exif and GPS IFDs) they reference.
+// The order of the pages matters; the layout of the file does not.
+func FingerprintTIFF(t TIFF) (Fingerprint, error) {
+	var fp Fingerprint
+	h := sha256.New()
+	for i, ifd := range t.IFDs() {
+		fmt.Fprintf(h, "ifd %d\n", i)
+		if err := hashTree(h, t, ifd, 0); err != nil {
+			return fp, err
+		}
+	}
+	copy(fp[:], h.Sum(nil))
+	return fp, nil
+}
+
+// maxFingerprintDepth bounds how deeply sub-IFDs are followed.
+const maxFingerprintDepth = 8
+
+func hashTree(h hash.Hash, t TIFF, ifd IFD, depth int) error {
+	if depth > maxFingerprintDepth {
+		return fmt.Errorf("tiff: sub-ifds nested more than %d deep", maxFingerprintDepth)
+	}
+	hashIFD(h, ifd)
+	for _, id := range sortedTagIDs(ifd) {
+		if _, ok := GetSubIFDTag(id); !ok {
+			continue
+		}
+		subs, err := ParseSubIFDs(t, ifd, id)
+		if err != nil {
+			return err
+		}
+		for i, sub := range subs {
+			fmt.Fprintf(h, "sub %d %d\n", id, i)
+			if err = hashTree(h, t, sub, depth+1); err != nil {
+				return err
+			}
+		}
+		fmt.Fprintf(h, "end %d\n", id)
+	}
+	return nil
+}
+
+func sortedTagIDs(ifd IFD) []uint16 {
+	ids := make([]uint16, 0, len(ifd.Fields()))
+	seen := make(map[uint16]bool, len(ifd.Fields()))
+	for _, f := range ifd.Fields() {
+		if id := f.Tag().ID(); !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	sort.Sort(uint16Slice(ids))
+	return ids
+}
+
+func hashIFD(h hash.Hash, ifd IFD) {
+	for _, id := range sortedTagIDs(ifd) {
+		hashField(h, ifd.GetField(id))
+	}
+}
+
+// hashField adds f to h, unless its values are offsets.
+func hashField(h hash.Hash, f Field) {
+	var num [8]byte
+	id := f.Tag().ID()
+	if _, ok := GetDataTags(id); ok {
+		return
+	}
+	if _, ok := GetSubIFDTag(id); ok {
+		return
+	}
+	class, vals := canonicalValue(f)
+	binary.BigEndian.PutUint16(num[:], id)
+	h.Write(num[:2])
+	h.Write([]byte{class})
+	binary.BigEndian.PutUint64(num[:], uint64(len(vals)))
+	h.Write(num[:])
+	h.Write(vals)
+}
+
+// canonicalValue returns the value of f in a form that does not depend on the
+// byte order or the exact integer type of f.
+func canonicalValue(f Field) (class byte, out []byte) {
+	bo := f.Value().Order()
+	size := f.Type().Size()
+	buf := f.Value().Bytes()
+	if n := size * f.Count(); uint64(len(buf)) > n {
+		buf = buf[:n]
+	}
+	switch f.Type().ID() {
+	case FTByte.ID(), FTShort.ID(), FTLong.ID(), FTLong8.ID():
+		class = fpUnsigned
+	case FTSByte.ID(), FTSShort.ID(), FTSLong.ID(), FTSLong8.ID():
+		class = fpSigned
+	case FTAscii.ID():
+		return fpASCII, bytes.TrimRight(buf, "\x00")
+	case FTRational.ID(), FTSRational.ID():
+		// Each value is a pair of 4 byte integers.
+		size = 4
+		fallthrough
+	default:
+		if size <= 1 || bo == binary.BigEndian {
+			return fpRaw, buf
+		}
+		out = make([]byte, len(buf))
+		for i := uint64(0); i+size <= uint64(len(buf)); i += size {
+			for j := uint64(0); j < size; j++ {
+				out[i+j] = buf[i+size-1-j]
+			}
+		}
+		return fpRaw, out
+	}
+	out = make([]byte, 0, 8*f.Count())
+	var v [8]byte
+	for i := uint64(0); i+size <= uint64(len(buf)); i += size {
+		var x uint64
+		switch size {
+		case 1:
+			x = uint64(buf[i])
+			if class == fpSigned {
+				x = uint64(int64(int8(buf[i])))
+			}
+		case 2:
+			x = uint64(bo.Uint16(buf[i:]))
+			if class == fpSigned {
+				x = uint64(int64(int16(x)))
+			}
+		case 4:
+			x = uint64(bo.Uint32(buf[i:]))
+			if class == fpSigned {
+				x = uint64(int64(int32(x)))
+			}
+		case 8:
+			x = bo.Uint64(buf[i:])
+		}
+		binary.BigEndian.PutUint64(v[:], x)
+		out = append(out, v[:]...)
+	}
+	return class, out
+}
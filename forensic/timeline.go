@@ -0,0 +1,398 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package forensic provides tools for examining tiff files as evidence, such
+// as reconstructing the timeline of events recorded in their metadata.
+package forensic
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/tiff"
+	"github.com/google/tiff/exif"
+)
+
+// An Event is a single date/time found in the metadata of a file.
+type Event struct {
+	// Time is the normalized time of the event.  If the source did not
+	// record a time zone (see HasZone), the wall clock time is given in UTC.
+	Time time.Time
+
+	// HasZone indicates that the source recorded a time zone or offset (or
+	// is defined to be in UTC, as GPS time is).  Without one, Time can only
+	// be compared to other times as a wall clock value.
+	HasZone bool
+
+	// Source identifies where the time was found, for example
+	// "IFD0/DateTime", "Exif/DateTimeOriginal", or "XMP/xmp:CreateDate".
+	Source string
+
+	// Raw is the value exactly as it was found in the file.
+	Raw string
+
+	// Detail holds any additional information recorded with the event,
+	// such as the action of an XMP history entry.
+	Detail string
+}
+
+func (e Event) String() string {
+	ts := e.Time.Format("2006-01-02T15:04:05.999999999")
+	if e.HasZone {
+		ts = e.Time.Format(time.RFC3339Nano)
+	}
+	if e.Detail != "" {
+		return fmt.Sprintf("%s %s (%s)", ts, e.Source, e.Detail)
+	}
+	return fmt.Sprintf("%s %s", ts, e.Source)
+}
+
+// An Inconsistency describes a problem found between (or with) events.
+type Inconsistency struct {
+	Problem string
+	Sources []string
+}
+
+func (i Inconsistency) String() string {
+	return fmt.Sprintf("%s [%s]", i.Problem, strings.Join(i.Sources, ", "))
+}
+
+// A Timeline holds all of the events found in a file in chronological order
+// along with any inconsistencies found between them.
+type Timeline struct {
+	Events          []Event
+	Inconsistencies []Inconsistency
+}
+
+// Event returns the first event from source, if any.
+func (tl *Timeline) Event(source string) (Event, bool) {
+	for _, e := range tl.Events {
+		if e.Source == source {
+			return e, true
+		}
+	}
+	return Event{}, false
+}
+
+func (tl *Timeline) flag(problem string, sources ...string) {
+	tl.Inconsistencies = append(tl.Inconsistencies, Inconsistency{problem, sources})
+}
+
+// exifTimeLayout is the layout of all Exif and TIFF date/time values.
+const exifTimeLayout = "2006:01:02 15:04:05"
+
+// maxZoneOffset is the largest difference between a local time and UTC.
+const maxZoneOffset = 14 * time.Hour
+
+// BuildTimeline gathers the date/time values from every IFD of t, the Exif and
+// GPS IFDs, and the XMP packet (including the xmpMM:History events) into a
+// Timeline and checks them for inconsistencies.
+func BuildTimeline(t tiff.TIFF) (*Timeline, error) {
+	if len(t.IFDs()) == 0 {
+		return nil, fmt.Errorf("forensic: no IFDs found")
+	}
+	tl := new(Timeline)
+	for i, ifd := range t.IFDs() {
+		src := fmt.Sprintf("IFD%d/DateTime", i)
+		if s, ok := asciiValue(ifd, 306); ok {
+			tl.addExif(src, s, "", "")
+		}
+		if x := tiff.XMP(ifd); x != nil {
+			if err := tl.addXMP(x); err != nil {
+				tl.flag(fmt.Sprintf("unreadable xmp packet: %v", err), fmt.Sprintf("IFD%d/XMP", i))
+			}
+		}
+	}
+
+	if eIFD, gIFD, _, err := exif.IFDs(t); err == nil {
+		for _, tm := range []struct {
+			tag, subsec, offset uint16
+			name                string
+		}{
+			{36867, 37521, 36881, "DateTimeOriginal"},
+			{36868, 37522, 36882, "DateTimeDigitized"},
+		} {
+			s, ok := asciiValue(eIFD, tm.tag)
+			if !ok {
+				continue
+			}
+			subsec, _ := asciiValue(eIFD, tm.subsec)
+			offset, _ := asciiValue(eIFD, tm.offset)
+			tl.addExif("Exif/"+tm.name, s, subsec, offset)
+		}
+		if gIFD != nil {
+			tl.addGPS(gIFD)
+		}
+	}
+
+	sort.SliceStable(tl.Events, func(i, j int) bool {
+		return tl.Events[i].Time.Before(tl.Events[j].Time)
+	})
+	tl.check()
+	return tl, nil
+}
+
+func asciiValue(ifd tiff.IFD, tagID uint16) (string, bool) {
+	if ifd == nil || !ifd.HasField(tagID) {
+		return "", false
+	}
+	f := ifd.GetField(tagID)
+	return strings.TrimRight(tiff.FieldText(f), " "), true
+}
+
+func (tl *Timeline) addExif(source, raw, subsec, offset string) {
+	if raw == "" || strings.Trim(raw, "0: ") == "" {
+		tl.flag(fmt.Sprintf("date/time is blank or zero (%q)", raw), source)
+		return
+	}
+	t, err := time.Parse(exifTimeLayout, raw)
+	if err != nil {
+		tl.flag(fmt.Sprintf("unparseable date/time %q", raw), source)
+		return
+	}
+	if subsec = strings.TrimSpace(subsec); subsec != "" {
+		if d, err := time.ParseDuration("0." + subsec + "s"); err == nil {
+			t = t.Add(d)
+		}
+	}
+	e := Event{Time: t, Source: source, Raw: raw}
+	if offset != "" {
+		if zt, err := time.Parse("-07:00", offset); err == nil {
+			_, secs := zt.Zone()
+			e.Time = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.FixedZone("", secs))
+			e.HasZone = true
+			e.Raw += " " + offset
+		}
+	}
+	tl.Events = append(tl.Events, e)
+}
+
+func (tl *Timeline) addGPS(gIFD tiff.IFD) {
+	const source = "GPS/DateStamp+TimeStamp"
+	date, ok := asciiValue(gIFD, 29)
+	if !ok || !gIFD.HasField(7) {
+		return
+	}
+	d, err := time.Parse("2006:01:02", date)
+	if err != nil {
+		tl.flag(fmt.Sprintf("unparseable gps date %q", date), source)
+		return
+	}
+	rs, err := tiff.Rationals(gIFD.GetField(7))
+	if err != nil || len(rs) != 3 {
+		tl.flag("gps time stamp is not 3 rationals", source)
+		return
+	}
+	var secs float64
+	var parts []string
+	for i, scale := range []float64{3600, 60, 1} {
+		if !rs[i].Valid() {
+			tl.flag("gps time stamp has a zero denominator", source)
+			return
+		}
+		secs += rs[i].Float64() * scale
+		parts = append(parts, rs[i].Rat().RatString())
+	}
+	tl.Events = append(tl.Events, Event{
+		Time:    d.Add(time.Duration(secs * float64(time.Second))),
+		HasZone: true,
+		Source:  source,
+		Raw:     date + " " + strings.Join(parts, ":"),
+	})
+}
+
+// xmpDateProps lists the XMP properties (by namespace and local name) that
+// hold dates along with the prefixes used to report them.
+var xmpDateProps = map[xml.Name]string{
+	{Space: "http://ns.adobe.com/xap/1.0/", Local: "CreateDate"}:                 "xmp:CreateDate",
+	{Space: "http://ns.adobe.com/xap/1.0/", Local: "ModifyDate"}:                 "xmp:ModifyDate",
+	{Space: "http://ns.adobe.com/xap/1.0/", Local: "MetadataDate"}:               "xmp:MetadataDate",
+	{Space: "http://ns.adobe.com/photoshop/1.0/", Local: "DateCreated"}:          "photoshop:DateCreated",
+	{Space: "http://ns.adobe.com/exif/1.0/", Local: "DateTimeOriginal"}:          "exif:DateTimeOriginal",
+	{Space: "http://ns.adobe.com/exif/1.0/", Local: "DateTimeDigitized"}:         "exif:DateTimeDigitized",
+	{Space: "http://ns.adobe.com/xap/1.0/sType/ResourceEvent#", Local: "when"}:   "xmpMM:History",
+	{Space: "http://ns.adobe.com/xap/1.0/sType/ResourceEvent#", Local: "action"}: "",
+}
+
+const stEvtNS = "http://ns.adobe.com/xap/1.0/sType/ResourceEvent#"
+
+// xmpTimeLayouts are the date formats allowed by the XMP specification, from
+// most to least precise.
+var xmpTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02",
+	"2006-01",
+	"2006",
+}
+
+func parseXMPTime(s string) (t time.Time, hasZone bool, err error) {
+	for i, layout := range xmpTimeLayouts {
+		if t, err = time.Parse(layout, s); err == nil {
+			return t, i < 2, nil
+		}
+	}
+	return
+}
+
+// addXMP adds the dates found in an XMP packet.  Properties may appear either
+// as elements or as attributes (the short form of RDF), so both are checked.
+// Each rdf:li of the history is one event whose action is kept as the detail.
+func (tl *Timeline) addXMP(packet []byte) error {
+	d := xml.NewDecoder(bytes.NewReader(packet))
+	var (
+		cur     *xml.Name // property whose character data is being read
+		text    bytes.Buffer
+		history int
+		when    string
+		action  string
+	)
+	addHistory := func() {
+		if when != "" {
+			history++
+			tl.addXMPValue(fmt.Sprintf("XMP/xmpMM:History[%d]", history), when, action)
+		}
+		when, action = "", ""
+	}
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			if tok.Name.Local == "li" && tok.Name.Space == "http://www.w3.org/1999/02/22-rdf-syntax-ns#" {
+				addHistory()
+			}
+			for _, a := range tok.Attr {
+				switch {
+				case a.Name.Space == stEvtNS && a.Name.Local == "when":
+					when = a.Value
+				case a.Name.Space == stEvtNS && a.Name.Local == "action":
+					action = a.Value
+				default:
+					if name := xmpDateProps[a.Name]; name != "" {
+						tl.addXMPValue("XMP/"+name, a.Value, "")
+					}
+				}
+			}
+			if _, ok := xmpDateProps[tok.Name]; ok {
+				n := tok.Name
+				cur = &n
+				text.Reset()
+			}
+		case xml.CharData:
+			if cur != nil {
+				text.Write(tok)
+			}
+		case xml.EndElement:
+			if cur == nil || *cur != tok.Name {
+				if tok.Name.Local == "li" {
+					addHistory()
+				}
+				continue
+			}
+			v := strings.TrimSpace(text.String())
+			switch {
+			case cur.Space == stEvtNS && cur.Local == "when":
+				when = v
+			case cur.Space == stEvtNS && cur.Local == "action":
+				action = v
+			default:
+				tl.addXMPValue("XMP/"+xmpDateProps[*cur], v, "")
+			}
+			cur = nil
+		}
+	}
+}
+
+func (tl *Timeline) addXMPValue(source, raw, detail string) {
+	t, hasZone, err := parseXMPTime(raw)
+	if err != nil {
+		tl.flag(fmt.Sprintf("unparseable date/time %q", raw), source)
+		return
+	}
+	tl.Events = append(tl.Events, Event{Time: t, HasZone: hasZone, Source: source, Raw: raw, Detail: detail})
+}
+
+// wallClock returns the time as read from a clock on the wall, dropping any
+// time zone information.
+func wallClock(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+}
+
+// check looks for events that contradict each other.
+func (tl *Timeline) check() {
+	orig, hasOrig := tl.Event("Exif/DateTimeOriginal")
+	digi, hasDigi := tl.Event("Exif/DateTimeDigitized")
+	mod, hasMod := tl.Event("IFD0/DateTime")
+
+	before := func(a, b Event) bool {
+		if a.HasZone && b.HasZone {
+			return a.Time.Before(b.Time)
+		}
+		return wallClock(a.Time).Before(wallClock(b.Time))
+	}
+	if hasOrig && hasDigi && before(digi, orig) {
+		tl.flag("image was digitized before it was taken", orig.Source, digi.Source)
+	}
+	if hasOrig && hasMod && before(mod, orig) {
+		tl.flag("file was modified before the image was taken", orig.Source, mod.Source)
+	}
+
+	// GPS time is UTC.  The local capture time may only differ from it by
+	// the largest possible time zone offset.
+	if gps, ok := tl.Event("GPS/DateStamp+TimeStamp"); ok && hasOrig {
+		diff := wallClock(orig.Time).Sub(gps.Time)
+		if orig.HasZone {
+			diff = orig.Time.Sub(gps.Time)
+			if diff < 0 {
+				diff = -diff
+			}
+			if diff > time.Minute {
+				tl.flag(fmt.Sprintf("gps time differs from capture time by %v", diff), orig.Source, gps.Source)
+			}
+		} else if diff > maxZoneOffset || diff < -maxZoneOffset {
+			tl.flag(fmt.Sprintf("gps time differs from capture time by %v, more than any time zone offset", diff), orig.Source, gps.Source)
+		}
+	}
+
+	// XMP properties that mirror Exif/TIFF values should agree with them.
+	for _, pair := range [][2]string{
+		{"Exif/DateTimeOriginal", "XMP/exif:DateTimeOriginal"},
+		{"Exif/DateTimeOriginal", "XMP/photoshop:DateCreated"},
+		{"Exif/DateTimeDigitized", "XMP/xmp:CreateDate"},
+		{"IFD0/DateTime", "XMP/xmp:ModifyDate"},
+	} {
+		a, okA := tl.Event(pair[0])
+		b, okB := tl.Event(pair[1])
+		if !okA || !okB {
+			continue
+		}
+		diff := wallClock(a.Time).Sub(wallClock(b.Time))
+		if diff >= time.Second || diff <= -time.Second {
+			tl.flag(fmt.Sprintf("values differ by %v", diff), a.Source, b.Source)
+		}
+	}
+
+	// Nothing in the history can happen before the image was created.
+	if hasOrig {
+		for _, e := range tl.Events {
+			if strings.HasPrefix(e.Source, "XMP/xmpMM:History") && before(e, orig) {
+				tl.flag("history event happened before the image was taken", orig.Source, e.Source)
+			}
+		}
+	}
+}
@@ -0,0 +1,193 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package geotiff
+
+import (
+	"encoding/xml"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/google/tiff"
+)
+
+// Tags of the fields GDAL writes to keep metadata that TIFF has no place for.
+const (
+	GDALMetadataTagID = 42112
+	GDALNoDataTagID   = 42113
+)
+
+// A GDALItem is an item of GDAL metadata.
+type GDALItem struct {
+	Name string
+	// Sample is the band (from 0) the item is about, or -1 for an item
+	// about the whole dataset.
+	Sample int
+	// Domain is the metadata domain of the item, empty for the default
+	// one.  Role, if set, marks items GDAL maps to band properties, such
+	// as "offset", "scale", "unittype" and "description".
+	Domain, Role string
+	Value        string
+}
+
+// GDALMetadata is the content of the GDAL_METADATA field: items in the order
+// they are stored.
+type GDALMetadata struct {
+	Items []GDALItem
+}
+
+// gdalXML is the XML form of GDALMetadata:
+//
+//	<GDALMetadata>
+//	  <Item name="STATISTICS_MEAN" sample="0">12.5</Item>
+//	  <Item name="OFFSET" sample="0" role="offset">0</Item>
+//	</GDALMetadata>
+type gdalXML struct {
+	XMLName xml.Name      `xml:"GDALMetadata"`
+	Items   []gdalXMLItem `xml:"Item"`
+}
+
+type gdalXMLItem struct {
+	Name   string `xml:"name,attr"`
+	Sample *int   `xml:"sample,attr"`
+	Domain string `xml:"domain,attr,omitempty"`
+	Role   string `xml:"role,attr,omitempty"`
+	Value  string `xml:",chardata"`
+}
+
+// Get returns the value of the item named name in the default domain for
+// sample (-1 for the dataset).
+func (m *GDALMetadata) Get(name string, sample int) (string, bool) {
+	for _, it := range m.Items {
+		if it.Name == name && it.Sample == sample && it.Domain == "" {
+			return it.Value, true
+		}
+	}
+	return "", false
+}
+
+// Band returns the items of the default domain about sample (-1 for the
+// dataset) by name.
+func (m *GDALMetadata) Band(sample int) map[string]string {
+	items := make(map[string]string)
+	for _, it := range m.Items {
+		if it.Sample == sample && it.Domain == "" {
+			items[it.Name] = it.Value
+		}
+	}
+	return items
+}
+
+// Set sets the value of the item named name in the default domain for sample
+// (-1 for the dataset), adding the item if there is none.
+func (m *GDALMetadata) Set(name string, sample int, value string) {
+	for i, it := range m.Items {
+		if it.Name == name && it.Sample == sample && it.Domain == "" {
+			m.Items[i].Value = value
+			return
+		}
+	}
+	m.Items = append(m.Items, GDALItem{Name: name, Sample: sample, Value: value})
+}
+
+// ParseGDALMetadata parses the XML of a GDAL_METADATA field.
+func ParseGDALMetadata(doc string) (*GDALMetadata, error) {
+	var x gdalXML
+	if err := xml.Unmarshal([]byte(strings.TrimRight(doc, "\x00")), &x); err != nil {
+		return nil, fmt.Errorf("geotiff: invalid GDAL metadata: %v", err)
+	}
+	m := &GDALMetadata{Items: make([]GDALItem, len(x.Items))}
+	for i, it := range x.Items {
+		m.Items[i] = GDALItem{Name: it.Name, Sample: -1, Domain: it.Domain, Role: it.Role, Value: it.Value}
+		if it.Sample != nil {
+			if *it.Sample < 0 {
+				return nil, fmt.Errorf("geotiff: GDAL metadata item %q is about sample %d", it.Name, *it.Sample)
+			}
+			m.Items[i].Sample = *it.Sample
+		}
+	}
+	return m, nil
+}
+
+// String returns m as the XML of a GDAL_METADATA field.
+func (m *GDALMetadata) String() string {
+	var x gdalXML
+	x.Items = make([]gdalXMLItem, len(m.Items))
+	for i, it := range m.Items {
+		x.Items[i] = gdalXMLItem{Name: it.Name, Domain: it.Domain, Role: it.Role, Value: it.Value}
+		if it.Sample >= 0 {
+			sample := it.Sample
+			x.Items[i].Sample = &sample
+		}
+	}
+	b, err := xml.MarshalIndent(x, "", "  ")
+	if err != nil {
+		// Only strings and ints are marshaled, which can not fail.
+		panic(err)
+	}
+	return string(b)
+}
+
+// GDALMetadataOf returns the GDAL metadata of ifd, or nil if it has no
+// GDAL_METADATA field.
+func GDALMetadataOf(ifd tiff.IFD) (*GDALMetadata, error) {
+	doc, ok, err := ascii(ifd, GDALMetadataTagID)
+	if !ok {
+		return nil, err
+	}
+	return ParseGDALMetadata(doc)
+}
+
+// NoData returns the value that marks pixels of ifd without data, as given by
+// its GDAL_NODATA field.  ok is false if ifd has no such field.  The value
+// may be NaN, or an infinity.
+func NoData(ifd tiff.IFD) (v float64, ok bool, err error) {
+	s, ok, err := ascii(ifd, GDALNoDataTagID)
+	if !ok {
+		return 0, false, err
+	}
+	v, err = strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil {
+		return 0, false, tiff.ErrInvalidFieldValue{TagID: GDALNoDataTagID, Problem: fmt.Sprintf("%q is not a number", s)}
+	}
+	return v, true, nil
+}
+
+// SetGDALMetadata queues a change on e that sets the GDAL_METADATA field of the
+// IFD at index idx to m.  The change is made when e.Commit is called.
+func SetGDALMetadata(e *tiff.Editor, idx int, m *GDALMetadata) error {
+	return e.SetValue(idx, GDALMetadataTagID, tiff.FTAscii, m.String())
+}
+
+// SetNoData queues a change on e that sets the GDAL_NODATA field of the IFD at
+// index idx to v.  The change is made when e.Commit is called.
+func SetNoData(e *tiff.Editor, idx int, v float64) error {
+	var s string
+	switch {
+	case math.IsNaN(v):
+		s = "nan"
+	case math.IsInf(v, 1):
+		s = "inf"
+	case math.IsInf(v, -1):
+		s = "-inf"
+	default:
+		s = strconv.FormatFloat(v, 'g', -1, 64)
+	}
+	return e.SetValue(idx, GDALNoDataTagID, tiff.FTAscii, s)
+}
+
+// ascii returns the value of the ASCII field tagID of ifd, without its
+// terminating NUL.  ok is false if ifd has no such field.
+func ascii(ifd tiff.IFD, tagID uint16) (s string, ok bool, err error) {
+	if !ifd.HasField(tagID) {
+		return "", false, nil
+	}
+	f := ifd.GetField(tagID)
+	if f.Type().ID() != tiff.FTAscii.ID() {
+		return "", false, fmt.Errorf("geotiff: field %d is of type %s, not ASCII", tagID, f.Type().Name())
+	}
+	return strings.TrimRight(string(f.Value().Bytes()[:f.Count()]), "\x00"), true, nil
+}
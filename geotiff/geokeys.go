@@ -0,0 +1,165 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package geotiff
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/google/tiff"
+)
+
+// Tags of the fields that hold GeoKeys.
+const (
+	GeoKeyDirectoryTagID = 34735
+	GeoDoubleParamsTagID = 34736
+	GeoAsciiParamsTagID  = 34737
+)
+
+// A GeoKey is an entry of the GeoKey directory.  Value holds a uint16 for keys
+// stored in the directory itself, a []float64 for keys stored in the
+// GeoDoubleParamsTag, a string for keys stored in the GeoAsciiParamsTag and a
+// []uint16 for keys stored elsewhere in the directory.
+type GeoKey struct {
+	ID       uint16      `json:"id"`
+	Name     string      `json:"name,omitempty"`
+	Location uint16      `json:"location,omitempty"`
+	Count    uint16      `json:"count"`
+	Value    interface{} `json:"value"`
+}
+
+func (k GeoKey) String() string {
+	name := k.Name
+	if name == "" {
+		name = fmt.Sprintf("GeoKey%d", k.ID)
+	}
+	return fmt.Sprintf("%s (%d): %v", name, k.ID, k.Value)
+}
+
+// geoKeyNames are the names of the GeoKeys defined by the GeoTIFF
+// specification.
+var geoKeyNames = map[uint16]string{
+	1024: "GTModelTypeGeoKey",
+	1025: "GTRasterTypeGeoKey",
+	1026: "GTCitationGeoKey",
+	2048: "GeographicTypeGeoKey",
+	2049: "GeogCitationGeoKey",
+	2050: "GeogGeodeticDatumGeoKey",
+	2051: "GeogPrimeMeridianGeoKey",
+	2052: "GeogLinearUnitsGeoKey",
+	2053: "GeogLinearUnitSizeGeoKey",
+	2054: "GeogAngularUnitsGeoKey",
+	2055: "GeogAngularUnitSizeGeoKey",
+	2056: "GeogEllipsoidGeoKey",
+	2057: "GeogSemiMajorAxisGeoKey",
+	2058: "GeogSemiMinorAxisGeoKey",
+	2059: "GeogInvFlatteningGeoKey",
+	2060: "GeogAzimuthUnitsGeoKey",
+	2061: "GeogPrimeMeridianLongGeoKey",
+	3072: "ProjectedCSTypeGeoKey",
+	3073: "PCSCitationGeoKey",
+	3074: "ProjectionGeoKey",
+	3075: "ProjCoordTransGeoKey",
+	3076: "ProjLinearUnitsGeoKey",
+	3077: "ProjLinearUnitSizeGeoKey",
+	3078: "ProjStdParallel1GeoKey",
+	3079: "ProjStdParallel2GeoKey",
+	3080: "ProjNatOriginLongGeoKey",
+	3081: "ProjNatOriginLatGeoKey",
+	3082: "ProjFalseEastingGeoKey",
+	3083: "ProjFalseNorthingGeoKey",
+	3084: "ProjFalseOriginLongGeoKey",
+	3085: "ProjFalseOriginLatGeoKey",
+	3086: "ProjFalseOriginEastingGeoKey",
+	3087: "ProjFalseOriginNorthingGeoKey",
+	3088: "ProjCenterLongGeoKey",
+	3089: "ProjCenterLatGeoKey",
+	3090: "ProjCenterEastingGeoKey",
+	3091: "ProjCenterNorthingGeoKey",
+	3092: "ProjScaleAtNatOriginGeoKey",
+	3093: "ProjScaleAtCenterGeoKey",
+	3094: "ProjAzimuthAngleGeoKey",
+	3095: "ProjStraightVertPoleLongGeoKey",
+	4096: "VerticalCSTypeGeoKey",
+	4097: "VerticalCitationGeoKey",
+	4098: "VerticalDatumGeoKey",
+	4099: "VerticalUnitsGeoKey",
+}
+
+// GeoKeys returns the GeoKeys of ifd, or nil if it has no GeoKeyDirectoryTag.
+func GeoKeys(ifd tiff.IFD) ([]GeoKey, error) {
+	if !ifd.HasField(GeoKeyDirectoryTagID) {
+		return nil, nil
+	}
+	dir, err := shorts(ifd.GetField(GeoKeyDirectoryTagID))
+	if err != nil {
+		return nil, err
+	}
+	if len(dir) < 4 {
+		return nil, fmt.Errorf("geotiff: GeoKey directory holds %d values", len(dir))
+	}
+	n := int(dir[3])
+	if len(dir) < 4+4*n {
+		return nil, fmt.Errorf("geotiff: GeoKey directory holds %d values for %d keys", len(dir), n)
+	}
+	var doubles []float64
+	if ifd.HasField(GeoDoubleParamsTagID) {
+		f := ifd.GetField(GeoDoubleParamsTagID)
+		buf, bo := f.Value().Bytes(), f.Value().Order()
+		for len(buf) >= 8 && uint64(len(doubles)) < f.Count() {
+			doubles = append(doubles, math.Float64frombits(bo.Uint64(buf)))
+			buf = buf[8:]
+		}
+	}
+	var ascii string
+	if ifd.HasField(GeoAsciiParamsTagID) {
+		ascii = string(ifd.GetField(GeoAsciiParamsTagID).Value().Bytes())
+	}
+	keys := make([]GeoKey, n)
+	for i := range keys {
+		e := dir[4+4*i:]
+		k := GeoKey{ID: e[0], Name: geoKeyNames[e[0]], Location: e[1], Count: e[2]}
+		start, end := int(e[3]), int(e[3])+int(e[2])
+		switch k.Location {
+		case 0:
+			k.Value = e[3]
+		case GeoDoubleParamsTagID:
+			if end > len(doubles) {
+				return nil, fmt.Errorf("geotiff: GeoKey %d refers to doubles [%d, %d) of %d", k.ID, start, end, len(doubles))
+			}
+			k.Value = doubles[start:end]
+		case GeoAsciiParamsTagID:
+			if end > len(ascii) {
+				return nil, fmt.Errorf("geotiff: GeoKey %d refers to characters [%d, %d) of %d", k.ID, start, end, len(ascii))
+			}
+			// Each string ends with a '|' rather than a NUL.
+			k.Value = strings.TrimRight(ascii[start:end], "|\x00")
+		case GeoKeyDirectoryTagID:
+			if end > len(dir) {
+				return nil, fmt.Errorf("geotiff: GeoKey %d refers to values [%d, %d) of %d", k.ID, start, end, len(dir))
+			}
+			k.Value = dir[start:end]
+		default:
+			return nil, fmt.Errorf("geotiff: GeoKey %d is stored in unsupported tag %d", k.ID, k.Location)
+		}
+		keys[i] = k
+	}
+	return keys, nil
+}
+
+// shorts returns the values of f, which must be of type SHORT.
+func shorts(f tiff.Field) ([]uint16, error) {
+	if f.Type().ID() != tiff.FTShort.ID() {
+		return nil, fmt.Errorf("geotiff: field %d is of type %s, not SHORT", f.Tag().ID(), f.Type().Name())
+	}
+	buf, bo := f.Value().Bytes(), f.Value().Order()
+	vals := make([]uint16, 0, len(buf)/2)
+	for len(buf) >= 2 && uint64(len(vals)) < f.Count() {
+		vals = append(vals, bo.Uint16(buf))
+		buf = buf[2:]
+	}
+	return vals, nil
+}
@@ -0,0 +1,144 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tiff
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// ExtractHead returns the head of the TIFF found in src: a standalone TIFF
+// holding its header, every IFD (sub-IFDs included) and every value, but no
+// image data.  The IFDs and values are packed one after the other, with the
+// offsets to them rewritten to match.  The offsets of strips, tiles and other
+// data blocks (see RegisterDataTags) are left as they are, so that they still
+// locate the data in src; the byte counts are kept too.  A catalog can store
+// the head of a huge raster, which is a few kilobytes, read all of its
+// metadata from it, and fetch tiles from the original file (see OpenStub).
+// The head has the same byte order and offset size as src, and every IFD keeps
+// its fields in the order src lists them.
+func ExtractHead(src ReadAtReadSeeker) ([]byte, error) {
+	t, err := Parse(src, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	ws, err := planTIFF(t, nil)
+	if err != nil {
+		return nil, err
+	}
+	for i, ifd := range t.IFDs() {
+		if err = keepFieldOrder(t, ifd, ws[i]); err != nil {
+			return nil, err
+		}
+		dropBlocks(ws[i])
+	}
+	var buf bytes.Buffer
+	if err = writeTIFF(&buf, t.R().ByteOrder(), t.OffsetSize() == 8, ws); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// dropBlocks marks the data blocks of w and its sub-IFDs as empty, which keeps
+// them from being written and leaves their offsets as they are in the source.
+func dropBlocks(w *writeIFD) {
+	for id, blocks := range w.blocks {
+		dropped := make([]dataBlock, len(blocks))
+		for i, b := range blocks {
+			dropped[i] = dataBlock{src: b.src, offset: b.offset}
+		}
+		w.blocks[id] = dropped
+	}
+	for _, subs := range w.subs {
+		for _, sub := range subs {
+			dropBlocks(sub)
+		}
+	}
+}
+
+// A stubTIFF is a TIFF parsed from a head (see ExtractHead) whose data is read
+// from the original file.
+type stubTIFF struct {
+	TIFF         // parsed from the head
+	data BReader // the original file
+}
+
+func (t *stubTIFF) R() BReader {
+	return t.data
+}
+
+func (t *stubTIFF) ifdReader() BReader {
+	return t.TIFF.R()
+}
+
+// IFDReader returns the BReader that the IFDs of t, sub-IFDs included, are
+// read from.  That is t.R(), except for the TIFFs returned by OpenStub, whose
+// IFDs are read from the head while t.R() reads from the original file.
+// Anything parsing IFDs at offsets found in t should read them through
+// IFDReader.
+func IFDReader(t TIFF) BReader {
+	if s, ok := t.(interface{ ifdReader() BReader }); ok {
+		return s.ifdReader()
+	}
+	return t.R()
+}
+
+// OpenStub parses head, a head returned by ExtractHead, and reattaches it to
+// the first size bytes of data, the file it was extracted from or a copy of it
+// (for example one read over HTTP with range requests).  The IFDs and values
+// come from head, while t.R() reads from data, so that strips, tiles and any
+// other block the offsets of head refer to are read from where they are in the
+// original file.  OpenStub checks that data is large enough to hold every
+// strip and tile of the main IFD chain and the sub-IFDs.
+func OpenStub(head []byte, data io.ReaderAt, size int64) (TIFF, error) {
+	t, err := Parse(bytes.NewReader(head), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	s := &stubTIFF{TIFF: t, data: NewBReaderAt(data, size, t.R().ByteOrder())}
+	for _, ifd := range t.IFDs() {
+		if err = checkStubData(s, ifd, uint64(size), 0); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// checkStubData checks that the data blocks of ifd, an IFD of the stub t, and
+// of its sub-IFDs end within size bytes.
+func checkStubData(t TIFF, ifd IFD, size uint64, depth int) error {
+	for _, f := range ifd.Fields() {
+		id := f.Tag().ID()
+		if countID, ok := GetDataTags(id); ok && ifd.HasField(countID) {
+			offsets, err := uintValues(f)
+			if err != nil {
+				return err
+			}
+			counts, err := uintValues(ifd.GetField(countID))
+			if err != nil {
+				return err
+			}
+			for i := 0; i < len(offsets) && i < len(counts); i++ {
+				if end := offsets[i] + counts[i]; end < offsets[i] || end > size {
+					return fmt.Errorf("tiff: block %d of tag %d ends at %d, past the %d bytes of the data source", i, id, end, size)
+				}
+			}
+		}
+		if _, ok := GetSubIFDTag(id); !ok || depth >= maxFingerprintDepth {
+			continue
+		}
+		subs, err := ParseSubIFDs(t, ifd, id)
+		if err != nil {
+			return err
+		}
+		for _, sub := range subs {
+			if err = checkStubData(t, sub, size, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tiff
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// ICCProfileTagID is the ID of the tag holding an embedded ICC profile (tag
+// 34675).  The profile is stored as UNDEFINED values.
+const ICCProfileTagID = 34675
+
+// iccHeaderSize is the size of the fixed header found at the start of every
+// ICC profile.
+const iccHeaderSize = 128
+
+// validateICCProfile checks that p looks like an ICC profile.  Only the header
+// is checked: the declared profile size and the 'acsp' file signature.
+func validateICCProfile(p []byte) error {
+	if len(p) < iccHeaderSize {
+		return ErrInvalidFieldValue{ICCProfileTagID, fmt.Sprintf("%d bytes is too short for an icc profile header", len(p))}
+	}
+	// ICC profiles are always big endian, regardless of the TIFF byte order.
+	if size := binary.BigEndian.Uint32(p); uint64(size) > uint64(len(p)) {
+		return ErrInvalidFieldValue{ICCProfileTagID, fmt.Sprintf("icc profile declares %d bytes, but only %d are present", size, len(p))}
+	}
+	if sig := string(p[36:40]); sig != "acsp" {
+		return ErrInvalidFieldValue{ICCProfileTagID, fmt.Sprintf("invalid icc profile signature %q", sig)}
+	}
+	return nil
+}
+
+// ICCProfile returns the ICC profile embedded in ifd.  The field's type and
+// count are checked along with the profile header.  If ifd has no ICC profile,
+// nil is returned along with a nil error.
+func ICCProfile(ifd IFD) ([]byte, error) {
+	if !ifd.HasField(ICCProfileTagID) {
+		return nil, nil
+	}
+	f := ifd.GetField(ICCProfileTagID)
+	switch f.Type().ID() {
+	case FTUndefined.ID(), FTByte.ID():
+	default:
+		return nil, ErrInvalidFieldValue{ICCProfileTagID, fmt.Sprintf("unexpected field type %q", f.Type().Name())}
+	}
+	p := f.Value().Bytes()[:f.Count()]
+	if err := validateICCProfile(p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// SetICCProfile embeds profile in the IFD at index idx of t.IFDs(), replacing
+// any existing profile.  The profile header is checked before anything is
+// written.  The profile and a new copy of the IFD are appended to the end of
+// the file behind rw (see SetXMP).
+func SetICCProfile(rw ReadWriteAtSeeker, t TIFF, idx int, profile []byte) error {
+	if err := validateICCProfile(profile); err != nil {
+		return err
+	}
+	f := newField(ICCProfileTagID, FTUndefined.ID(), uint32(len(profile)), profile, t.R().ByteOrder(), nil, nil)
+	return rewriteIFD(rw, t, idx, []Field{f}, nil)
+}
+
+// RemoveICCProfile removes the ICC profile from the IFD at index idx of
+// t.IFDs().
+func RemoveICCProfile(rw ReadWriteAtSeeker, t TIFF, idx int) error {
+	return rewriteIFD(rw, t, idx, nil, []uint16{ICCProfileTagID})
+}
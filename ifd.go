@@ -22,11 +22,67 @@ type IFD interface {
 	GetField(tagID uint16) Field
 }
 
+// A RawIFD is the directory structure of an IFD exactly as it is stored in a
+// file: where it is, its entries in file order (duplicates included), and the
+// offset to the next IFD.  Unlike the fields of an IFD, entries are not
+// interpreted through a TagSpace, which suits tools that check the file
+// itself, such as validators and forensic tools.
+type RawIFD interface {
+	// Offset returns the offset of the IFD in the file, or 0 if it is not
+	// known.
+	Offset() uint64
+	NumEntries() uint64
+	Entries() []GenericEntry
+	NextOffset() uint64
+}
+
+// RawIFDOf returns the directory structure of ifd.  IFDs parsed by this
+// package or the bigtiff package return their own.  For any other IFD, one is
+// built from its fields, with an Offset of 0.
+func RawIFDOf(ifd IFD) RawIFD {
+	if r, ok := ifd.(RawIFD); ok {
+		return r
+	}
+	return syntheticIFD{ifd}
+}
+
+// syntheticIFD is a RawIFD built from an IFD.
+type syntheticIFD struct {
+	IFD
+}
+
+func (s syntheticIFD) Offset() uint64 { return 0 }
+
+func (s syntheticIFD) Entries() []GenericEntry {
+	entries := make([]GenericEntry, len(s.Fields()))
+	for i, f := range s.Fields() {
+		entries[i] = EntryOf(f)
+	}
+	return entries
+}
+
 type imageFileDirectory struct {
 	numEntries uint16
 	fields     []Field
 	nextOffset uint32
+	nextHigh   uint32 // the high bits of nextOffset, in NDPI files
 	fieldMap   map[uint16]Field
+	offset     uint64
+	fix        func(uint64) uint64 // the fix of offsets, in large NDPI files
+}
+
+// Offset returns the offset of ifd in the file it was parsed from.
+func (ifd *imageFileDirectory) Offset() uint64 {
+	return ifd.offset
+}
+
+// Entries returns the entries of ifd in the order they are stored.
+func (ifd *imageFileDirectory) Entries() []GenericEntry {
+	entries := make([]GenericEntry, len(ifd.fields))
+	for i, f := range ifd.fields {
+		entries[i] = EntryOf(f)
+	}
+	return entries
 }
 
 func (ifd *imageFileDirectory) NumEntries() uint64 {
@@ -38,7 +94,7 @@ func (ifd *imageFileDirectory) Fields() []Field {
 }
 
 func (ifd *imageFileDirectory) NextOffset() uint64 {
-	return uint64(ifd.nextOffset)
+	return uint64(ifd.nextHigh)<<32 | uint64(ifd.nextOffset)
 }
 
 func (ifd *imageFileDirectory) HasField(tagID uint16) bool {
@@ -70,6 +126,16 @@ Fields (%d):
 }
 
 func ParseIFD(br BReader, offset uint64, tsp TagSpace, ftsp FieldTypeSpace) (out IFD, err error) {
+	ifd, err := parseIFD(br, offset, tsp, ftsp, nil)
+	if err != nil {
+		return nil, err
+	}
+	return ifd, nil
+}
+
+// parseIFD is ParseIFD, with the offsets of values passed through fix (see
+// parseField).
+func parseIFD(br BReader, offset uint64, tsp TagSpace, ftsp FieldTypeSpace, fix func(uint64) uint64) (out *imageFileDirectory, err error) {
 	if br == nil {
 		return nil, errors.New("tiff: no BReader supplied")
 	}
@@ -81,22 +147,27 @@ func ParseIFD(br BReader, offset uint64, tsp TagSpace, ftsp FieldTypeSpace) (out
 	}
 	ifd := &imageFileDirectory{
 		fieldMap: make(map[uint16]Field, 1),
+		offset:   offset,
+		fix:      fix,
 	}
 	br.Seek(int64(offset), 0)
 	if err = br.BRead(&ifd.numEntries); err != nil {
-		err = fmt.Errorf("tiff: unable to read the number of entries for the IFD at offset %#08x: %v", offset, err)
+		err = ReadError(err, "the number of entries of an ifd", at(offset))
+		return
+	}
+	if err = ChargeIFD(br, offset, uint64(ifd.numEntries)); err != nil {
 		return
 	}
 	for i := uint16(0); i < ifd.numEntries; i++ {
 		var f Field
-		if f, err = ParseField(br, tsp, ftsp); err != nil {
+		if f, err = parseField(br, tsp, ftsp, fix); err != nil {
 			return
 		}
 		ifd.fields = append(ifd.fields, f)
 		ifd.fieldMap[f.Tag().ID()] = f
 	}
 	if err = br.BRead(&ifd.nextOffset); err != nil {
-		err = fmt.Errorf("tiff: unable to read the offset for the next ifd: %v", err)
+		err = ReadError(err, "the offset to the next ifd", at(offset+2+12*uint64(ifd.numEntries)))
 		return
 	}
 	return ifd, nil
@@ -0,0 +1,62 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package image
+
+import "fmt"
+
+// An Allocator provides the large buffers that DecodeRaw fills: the pixels of
+// the RawImage it returns and the compressed bytes of each strip or tile.  A
+// program can use one to take them from huge pages or memory pinned for a GPU,
+// to recycle them, or to refuse those over a threshold (see CappedAllocator).
+// Its methods may be called by several goroutines at once.
+type Allocator interface {
+	// Alloc returns a buffer of n bytes, which need not be zeroed, or an
+	// error that fails the decode.
+	Alloc(n int) ([]byte, error)
+	// Free is called with the buffers returned by Alloc that are no longer
+	// used once the decode is done with them.  The pixels of a RawImage
+	// that DecodeRaw returns are never freed; they belong to the caller.
+	Free(b []byte)
+}
+
+// alloc returns a buffer of n bytes from a, or from the heap if a is nil.
+func alloc(a Allocator, n int) ([]byte, error) {
+	if a == nil {
+		return make([]byte, n), nil
+	}
+	b, err := a.Alloc(n)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) < n {
+		a.Free(b)
+		return nil, fmt.Errorf("tiff/image: allocator returned %d bytes, but %d were asked for", len(b), n)
+	}
+	return b[:n], nil
+}
+
+// free hands b back to a, if a is not nil.
+func free(a Allocator, b []byte) {
+	if a != nil && b != nil {
+		a.Free(b)
+	}
+}
+
+// CappedAllocator returns an Allocator that takes buffers from the heap, but
+// fails with an ErrQuotaExceeded for any buffer larger than max bytes.
+func CappedAllocator(max int) Allocator {
+	return cappedAllocator(max)
+}
+
+type cappedAllocator int
+
+func (c cappedAllocator) Alloc(n int) ([]byte, error) {
+	if n > int(c) {
+		return nil, ErrQuotaExceeded{int64(n), int64(c)}
+	}
+	return make([]byte, n), nil
+}
+
+func (cappedAllocator) Free([]byte) {}
@@ -5,8 +5,8 @@
 package image
 
 import (
-	"bytes"
 	"sort"
+	"strings"
 	"sync"
 
 	"github.com/google/tiff"
@@ -68,7 +68,7 @@ func findAlternateTIFFHandler(t tiff.TIFF) TIFFHandler {
 	// to playing guessing games in a generic package.
 	if ifd0.HasField(271) {
 		f := ifd0.GetField(271)
-		maker := string(bytes.TrimRight(f.Value().Bytes(), " \x00"))
+		maker := strings.TrimRight(tiff.FieldText(f), " ")
 		hndlr := GetHandlerByMake(maker)
 		if hndlr != nil && hndlr.CanHandle(t) {
 			return hndlr
@@ -0,0 +1,228 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package image
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"sort"
+	"strings"
+)
+
+// An AssociatedImage is an image of a Slide that is not part of its pyramid,
+// such as the photo of its label.  It is held either by an IFD of the slide,
+// or, for some Philips slides, as a JPEG embedded in the ImageDescription.
+type AssociatedImage struct {
+	// Name is "label", "macro" or "thumbnail".
+	Name          string
+	Width, Height int
+	// IFD is the index of the IFD holding the image, or -1 if it is
+	// embedded in the ImageDescription.
+	IFD int
+
+	s    *Slide
+	jpeg []byte
+}
+
+// Decode returns the image.
+func (a *AssociatedImage) Decode() (image.Image, error) {
+	if a.IFD < 0 {
+		return jpeg.Decode(bytes.NewReader(a.jpeg))
+	}
+	raw, err := DecodeRaw(a.s.t.IFDs()[a.IFD], a.s.t.R(), nil)
+	if err != nil {
+		return nil, err
+	}
+	return raw.Image()
+}
+
+// AssociatedImages returns the associated images of s sorted by name, both
+// those in IFDs (see Slide.Associated) and those embedded in the
+// ImageDescription of Philips slides.  Images in IFDs come first when a name
+// is found in both.
+func (s *Slide) AssociatedImages() ([]*AssociatedImage, error) {
+	var out []*AssociatedImage
+	seen := make(map[string]bool)
+	for name, idx := range s.Associated {
+		l, err := LayoutOf(s.t.IFDs()[idx])
+		if err != nil {
+			return nil, fmt.Errorf("tiff/image: %s image in IFD %d: %v", name, idx, err)
+		}
+		out = append(out, &AssociatedImage{Name: name, Width: l.Width, Height: l.Height, IFD: idx, s: s})
+		seen[name] = true
+	}
+	if s.Vendor == SlidePhilips {
+		embedded, err := philipsImages(description(s.t.IFDs()[0]))
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range embedded {
+			if seen[a.Name] {
+				continue
+			}
+			cfg, err := jpeg.DecodeConfig(bytes.NewReader(a.jpeg))
+			if err != nil {
+				return nil, fmt.Errorf("tiff/image: embedded %s image: %v", a.Name, err)
+			}
+			a.Width, a.Height, a.s = cfg.Width, cfg.Height, s
+			out = append(out, a)
+			seen[a.Name] = true
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
+
+// philipsImages returns the label and macro images embedded in the XML of a
+// Philips ImageDescription (see philipsObjects).
+func philipsImages(desc string) ([]*AssociatedImage, error) {
+	objs, err := philipsObjects([]byte(desc))
+	if err != nil {
+		return nil, err
+	}
+	var out []*AssociatedImage
+	for _, obj := range objs {
+		data, err := base64.StdEncoding.DecodeString(obj.data)
+		if err != nil || len(data) == 0 {
+			continue
+		}
+		out = append(out, &AssociatedImage{Name: obj.name, IFD: -1, jpeg: data})
+	}
+	return out, nil
+}
+
+// A philipsObject is an image embedded in a Philips ImageDescription.
+type philipsObject struct {
+	name string // "label" or "macro"
+	data string // the base64 encoded JPEG
+	// start and end locate the text of the PIM_DP_IMAGE_DATA attribute in
+	// the description, so that it can be blanked (see RedactSlide).
+	start, end int64
+}
+
+// philipsObjects returns the images embedded in the XML of a Philips
+// ImageDescription: DataObjects of type DPScannedImage whose PIM_DP_IMAGE_TYPE
+// is LABELIMAGE or MACROIMAGE, holding a base64 encoded JPEG in
+// PIM_DP_IMAGE_DATA.
+func philipsObjects(desc []byte) ([]philipsObject, error) {
+	d := xml.NewDecoder(bytes.NewReader(desc))
+	var (
+		out   []philipsObject
+		stack []*philipsObject
+		kinds []string // the PIM_DP_IMAGE_TYPE of each object of stack
+	)
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return out, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("tiff/image: Philips ImageDescription: %v", err)
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			switch tok.Name.Local {
+			case "DataObject":
+				stack = append(stack, &philipsObject{})
+				kinds = append(kinds, "")
+			case "Attribute":
+				if len(stack) == 0 {
+					continue
+				}
+				switch attr(tok, "Name") {
+				case "PIM_DP_IMAGE_TYPE":
+					var v struct {
+						Text string `xml:",chardata"`
+					}
+					if err := d.DecodeElement(&v, &tok); err != nil {
+						return nil, fmt.Errorf("tiff/image: Philips ImageDescription: %v", err)
+					}
+					kinds[len(kinds)-1] = strings.TrimSpace(v.Text)
+				case "PIM_DP_IMAGE_DATA":
+					obj := stack[len(stack)-1]
+					if obj.start, obj.end, obj.data, err = elementText(d); err != nil {
+						return nil, fmt.Errorf("tiff/image: Philips ImageDescription: %v", err)
+					}
+				}
+			}
+		case xml.EndElement:
+			if tok.Name.Local != "DataObject" || len(stack) == 0 {
+				continue
+			}
+			obj, kind := stack[len(stack)-1], kinds[len(kinds)-1]
+			stack, kinds = stack[:len(stack)-1], kinds[:len(kinds)-1]
+			switch kind {
+			case "LABELIMAGE":
+				obj.name = "label"
+			case "MACROIMAGE":
+				obj.name = "macro"
+			default:
+				continue
+			}
+			if obj.data != "" {
+				out = append(out, *obj)
+			}
+		}
+	}
+}
+
+// elementText reads the text of the element whose start d has just read, up
+// to and including its end, and returns where the text starts and ends in the
+// input along with the text, trimmed of spaces.
+func elementText(d *xml.Decoder) (start, end int64, text string, err error) {
+	start = d.InputOffset()
+	var b strings.Builder
+	for {
+		end = d.InputOffset()
+		tok, err := d.Token()
+		if err != nil {
+			return 0, 0, "", err
+		}
+		switch tok := tok.(type) {
+		case xml.CharData:
+			b.Write(tok)
+		case xml.EndElement:
+			return start, end, strings.TrimSpace(b.String()), nil
+		}
+	}
+}
+
+// philipsRedactions returns the ranges of file offsets holding the images
+// named in want that are embedded in the ImageDescription of the first IFD of
+// the Philips slide s.
+func (s *Slide) philipsRedactions(want map[string]bool) ([][2]int64, error) {
+	ifd := s.t.IFDs()[0]
+	if s.Vendor != SlidePhilips || !ifd.HasField(270) {
+		return nil, nil
+	}
+	f := ifd.GetField(270)
+	objs, err := philipsObjects(bytes.TrimRight(f.Value().Bytes()[:f.Count()], "\x00"))
+	if err != nil {
+		return nil, err
+	}
+	var ranges [][2]int64
+	for _, obj := range objs {
+		if want[obj.name] {
+			off := int64(f.Offset())
+			ranges = append(ranges, [2]int64{off + obj.start, off + obj.end})
+		}
+	}
+	return ranges, nil
+}
+
+// attr returns the value of the attribute name of el, or "".
+func attr(el xml.StartElement, name string) string {
+	for _, a := range el.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,208 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package image
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+
+	"github.com/google/tiff"
+)
+
+/* Palette, CMYK and YCbCr
+
+The ColorMap of palette images (PhotometricInterpretation 3) holds 16 bit
+values, but some writers store 8 bit ones in it.  As libtiff does, a ColorMap
+with no value over 255 is taken to be one of those and scaled up.
+
+Prepress scans are often stored as CMYK (PhotometricInterpretation 5 with
+InkSet 1) and photographs as YCbCr (PhotometricInterpretation 6), which RawImage
+converts to RGB:
+	- CMYK inks are taken to be ideal: each of R, G and B is what C, M or Y
+	  and K leave of white.  No ICC profile is applied.
+	- YCbCr codes are first brought to full range through
+	  ReferenceBlackWhite, then converted with the luma coefficients of
+	  YCbCrCoefficients, as in section 21 of the TIFF specification.
+The Cb and Cr samples of YCbCr images may be subsampled (YCbCrSubsampling).
+Each data unit then holds the Y samples of a block of pixels followed by the Cb
+and Cr they share, which DecodeRaw upsamples by giving them to every pixel of
+the block.  YCbCrPositioning is ignored.
+*/
+
+const inkSetCMYK = 1
+
+// Palette returns the colors of the ColorMap of img, one for each of its
+// entries.
+func (img *RawImage) Palette() color.Palette {
+	n := len(img.ColorMap) / 3
+	eightBit := true
+	for _, v := range img.ColorMap {
+		if v > 0xFF {
+			eightBit = false
+			break
+		}
+	}
+	value := func(v uint16) uint16 {
+		if eightBit {
+			return v<<8 | v
+		}
+		return v
+	}
+	pal := make(color.Palette, n)
+	for i := range pal {
+		pal[i] = color.RGBA64{value(img.ColorMap[i]), value(img.ColorMap[n+i]), value(img.ColorMap[2*n+i]), 0xFFFF}
+	}
+	return pal
+}
+
+// YCbCrParams holds how the samples of a YCbCr image map to RGB.
+type YCbCrParams struct {
+	// Coefficients are the LumaRed, LumaGreen and LumaBlue of
+	// YCbCrCoefficients.
+	Coefficients [3]tiff.Rational
+	// ReferenceBlackWhite holds the codes of black and white for Y, Cb and
+	// Cr in turn.
+	ReferenceBlackWhite [6]tiff.Rational
+}
+
+// ycbcrParams returns the YCbCrParams given by the YCbCrCoefficients and
+// ReferenceBlackWhite fields of an image with bps bit samples, using the
+// defaults of the TIFF specification for missing fields.
+func ycbcrParams(coefs, refs []tiff.Rational, bps int) (*YCbCrParams, error) {
+	max := uint32(1)<<uint(bps) - 1
+	half := uint32(1) << uint(bps-1)
+	rat := func(num, den uint32) tiff.Rational { return tiff.Rational{Num: num, Den: den} }
+	p := &YCbCrParams{
+		Coefficients:        [3]tiff.Rational{rat(299, 1000), rat(587, 1000), rat(114, 1000)},
+		ReferenceBlackWhite: [6]tiff.Rational{rat(0, 1), rat(max, 1), rat(half, 1), rat(max, 1), rat(half, 1), rat(max, 1)},
+	}
+	if coefs != nil {
+		if len(coefs) != 3 {
+			return nil, fmt.Errorf("tiff/image: %d YCbCrCoefficients, not 3", len(coefs))
+		}
+		copy(p.Coefficients[:], coefs)
+	}
+	if refs != nil {
+		if len(refs) != 6 {
+			return nil, fmt.Errorf("tiff/image: %d ReferenceBlackWhite values, not 6", len(refs))
+		}
+		copy(p.ReferenceBlackWhite[:], refs)
+	}
+	for _, r := range append(p.Coefficients[:], p.ReferenceBlackWhite[:]...) {
+		if !r.Valid() {
+			return nil, fmt.Errorf("tiff/image: invalid YCbCr parameter %v", r)
+		}
+	}
+	if p.Coefficients[1].Num == 0 {
+		return nil, fmt.Errorf("tiff/image: LumaGreen is 0")
+	}
+	for i := 0; i < 6; i += 2 {
+		if p.ReferenceBlackWhite[i].Float64() == p.ReferenceBlackWhite[i+1].Float64() {
+			return nil, fmt.Errorf("tiff/image: ReferenceBlackWhite gives the same code to black and white")
+		}
+	}
+	return p, nil
+}
+
+// subsampling returns the subsampling given by the YCbCrSubsampling field v,
+// which is (2, 2) if the field is missing.
+func subsampling(v []uint16) (image.Point, error) {
+	if v == nil {
+		return image.Pt(2, 2), nil
+	}
+	valid := func(n uint16) bool { return n == 1 || n == 2 || n == 4 }
+	if len(v) != 2 || !valid(v[0]) || !valid(v[1]) || v[1] > v[0] {
+		return image.Point{}, fmt.Errorf("tiff/image: invalid YCbCrSubsampling %v", v)
+	}
+	return image.Pt(int(v[0]), int(v[1])), nil
+}
+
+// rgb returns the color of the pixel at (x, y) of the YCbCr image img,
+// scaled to 16 bits.
+func (p *YCbCrParams) rgb(img *RawImage, x, y int) (r, g, b uint16) {
+	max := float64(uint64(1)<<uint(img.BitsPerSample) - 1)
+	half := float64(uint64(1)<<uint(img.BitsPerSample-1) - 1)
+	ref := func(s int, scale float64) float64 {
+		v, _ := img.value(x, y, s)
+		black, white := p.ReferenceBlackWhite[2*s].Float64(), p.ReferenceBlackWhite[2*s+1].Float64()
+		return (v - black) * scale / (white - black)
+	}
+	yy, cb, cr := ref(0, max), ref(1, half), ref(2, half)
+	lr, lg, lb := p.Coefficients[0].Float64(), p.Coefficients[1].Float64(), p.Coefficients[2].Float64()
+	rf := cr*(2-2*lr) + yy
+	bf := cb*(2-2*lb) + yy
+	gf := (yy - lb*bf - lr*rf) / lg
+	scale := func(v float64) uint16 {
+		switch {
+		case v <= 0:
+			return 0
+		case v >= max:
+			return 0xFFFF
+		}
+		return uint16(v/max*0xFFFF + 0.5)
+	}
+	return scale(rf), scale(gf), scale(bf)
+}
+
+// cmykToRGB returns the color of the pixel at (x, y) of the CMYK image img,
+// scaled to 16 bits.
+func (img *RawImage) cmykToRGB(x, y int) (r, g, b uint16) {
+	k := 0xFFFF - uint32(img.sample(x, y, 3))
+	ink := func(s int) uint16 {
+		return uint16((0xFFFF - uint32(img.sample(x, y, s))) * k / 0xFFFF)
+	}
+	return ink(0), ink(1), ink(2)
+}
+
+// rgbImage returns an image of the size of img whose pixels have the colors
+// returned by rgb and the alpha of img, if it has an alpha sample, or are
+// opaque.  Images with unassociated alpha give an *image.NRGBA, others an
+// *image.RGBA, or their 16 bit versions for 16 bit samples.
+func (img *RawImage) rgbImage(rgb func(x, y int) (r, g, b uint16)) image.Image {
+	a, associated := img.alpha()
+	rect := image.Rect(0, 0, img.Width, img.Height)
+	wide, unassociated := img.BitsPerSample == 16, a >= 0 && !associated
+	// The pixels of RGBA and NRGBA images (and of their 16 bit versions)
+	// are laid out alike.
+	var out image.Image
+	var pix []byte
+	var stride int
+	switch {
+	case wide && unassociated:
+		m := image.NewNRGBA64(rect)
+		out, pix, stride = m, m.Pix, m.Stride
+	case wide:
+		m := image.NewRGBA64(rect)
+		out, pix, stride = m, m.Pix, m.Stride
+	case unassociated:
+		m := image.NewNRGBA(rect)
+		out, pix, stride = m, m.Pix, m.Stride
+	default:
+		m := image.NewRGBA(rect)
+		out, pix, stride = m, m.Pix, m.Stride
+	}
+	for y := 0; y < img.Height; y++ {
+		for x := 0; x < img.Width; x++ {
+			r, g, b := rgb(x, y)
+			alpha := uint16(0xFFFF)
+			if a >= 0 {
+				alpha = img.sample(x, y, a)
+			}
+			if wide {
+				p := pix[y*stride+8*x:]
+				binary.BigEndian.PutUint16(p, r)
+				binary.BigEndian.PutUint16(p[2:], g)
+				binary.BigEndian.PutUint16(p[4:], b)
+				binary.BigEndian.PutUint16(p[6:], alpha)
+				continue
+			}
+			p := pix[y*stride+4*x:]
+			p[0], p[1], p[2], p[3] = uint8(r>>8), uint8(g>>8), uint8(b>>8), uint8(alpha>>8)
+		}
+	}
+	return out
+}
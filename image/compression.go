@@ -6,7 +6,10 @@ package image
 
 import (
 	"fmt"
+	"sort"
 	"sync"
+
+	"github.com/google/tiff"
 )
 
 type CompressionError struct {
@@ -95,12 +98,9 @@ func decompPackBits(in []byte) ([]byte, error) {
 			if len(buf) == 0 {
 				return nil, CompressionError{"PackBits", "not enough bytes to complete decompression"}
 			} else {
-				tmp := make([]byte, -n+1)
-				b := buf[0]
-				for i := range tmp {
-					tmp[i] = b
+				for i, b := 0, buf[0]; i < -n+1; i++ {
+					out = append(out, b)
 				}
-				out = append(out, tmp...)
 			}
 			buf = buf[1:]
 		}
@@ -128,6 +128,28 @@ var (
 	}
 )
 
+// A ChunkCompression is a Compression that decompresses strips and tiles with
+// parameters taken from the image they belong to: its size, its samples, and
+// fields such as JPEGTables or T4Options, as the codecs registered by package
+// github.com/google/tiff/image/libtiff do.  Before decompressing a strip or
+// tile with a ChunkCompression, decoders call its ForChunk method and use the
+// Compression it returns instead.
+type ChunkCompression interface {
+	Compression
+	// ForChunk returns a Compression that decompresses strip or tile i of
+	// the image described by ifd, laid out as l.
+	ForChunk(ifd tiff.IFD, l Layout, i int) (Compression, error)
+}
+
+// forChunk returns the Compression that decompresses chunk i of the image
+// described by ifd and l in place of c (see ChunkCompression).
+func forChunk(c Compression, ifd tiff.IFD, l Layout, i int) (Compression, error) {
+	if cc, ok := c.(ChunkCompression); ok {
+		return cc.ForChunk(ifd, l, i)
+	}
+	return c, nil
+}
+
 /* Registration pieces for Compression methods */
 var allCompressions = struct {
 	mu   sync.RWMutex
@@ -148,6 +170,18 @@ func GetCompression(id uint16) Compression {
 	return allCompressions.list[id]
 }
 
+// ListCompressions returns the registered Compressions, by ID.
+func ListCompressions() []Compression {
+	allCompressions.mu.RLock()
+	defer allCompressions.mu.RUnlock()
+	list := make([]Compression, 0, len(allCompressions.list))
+	for _, c := range allCompressions.list {
+		list = append(list, c)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID() < list[j].ID() })
+	return list
+}
+
 func init() {
 	RegisterCompression(uncompressedCompression)
 	RegisterCompression(packbitsCompression)
@@ -0,0 +1,169 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package image
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+
+	"github.com/google/tiff"
+)
+
+/* Deflate Compression and Decompression
+
+Compression
+	Tag 259 (Compression)
+		8 = Deflate (zlib format, as registered by Adobe)
+		32946 = Deflate (the original, unregistered value still written by some software)
+
+Creating a zlib writer or reader allocates large buffers and tables.  For
+services that compress or decompress many strips or tiles, that state is kept
+in pools and reused.  Writers are pooled separately for each compression level
+since a writer cannot change its level once created.  Deflate is the only codec
+of this package with such state: PackBits and Uncompressed allocate nothing but
+their output, and the codecs of package github.com/google/tiff/image/libtiff
+manage their own.  LZW is not among them: this package has no LZW codec of
+its own, and files using it are decoded by package
+github.com/google/tiff/image/libtiff.
+
+A zlib stream of a few kilobytes can inflate to gigabytes.  Before decoding a
+strip or tile, decoders ask for a Compression bound to it (see
+ChunkCompression) and that Compression fails as soon as the output grows past
+the size of a full chunk of the image.  The size of a full chunk rather than
+that of the chunk itself is the bound, since some writers store the last strip
+of an image padded to RowsPerStrip rows.
+*/
+
+// codecPoolKey identifies a set of interchangeable codec states.
+type codecPoolKey struct {
+	codec    string
+	settings int
+}
+
+var codecPools = struct {
+	mu   sync.Mutex
+	list map[codecPoolKey]*sync.Pool
+}{
+	list: make(map[codecPoolKey]*sync.Pool, 1),
+}
+
+// getCodecPool returns the pool for key, using newFn to create a pool the first
+// time key is seen.
+func getCodecPool(key codecPoolKey, newFn func() interface{}) *sync.Pool {
+	codecPools.mu.Lock()
+	defer codecPools.mu.Unlock()
+	p := codecPools.list[key]
+	if p == nil {
+		p = &sync.Pool{New: newFn}
+		codecPools.list[key] = p
+	}
+	return p
+}
+
+type deflateCodec struct {
+	level   int
+	writers *sync.Pool // of *zlib.Writer
+	readers *sync.Pool // of io.ReadCloser that are also zlib.Resetter
+}
+
+// NewDeflateCompression returns a Compression using the Deflate (zlib) method
+// for the compression value id (8 or 32946) that compresses at the given
+// zlib level.  Codecs with the same level share their pooled state.
+func NewDeflateCompression(id uint16, level int) (Compression, error) {
+	if _, err := zlib.NewWriterLevel(ioutil.Discard, level); err != nil {
+		return nil, CompressionError{"Deflate", err.Error()}
+	}
+	dc := &deflateCodec{
+		level: level,
+		writers: getCodecPool(codecPoolKey{"deflate-writer", level}, func() interface{} {
+			w, _ := zlib.NewWriterLevel(nil, level)
+			return w
+		}),
+		// A reader can only be created from a valid stream, so none are made
+		// up front; see decompress.
+		readers: getCodecPool(codecPoolKey{"deflate-reader", 0}, func() interface{} { return nil }),
+	}
+	return deflateCompression{
+		Compression: NewCompression(id, "Deflate", dc.compress, func(in []byte) ([]byte, error) {
+			return dc.decompress(in, -1)
+		}),
+		dc: dc,
+	}, nil
+}
+
+// A deflateCompression is the ChunkCompression of Deflate, whose chunks
+// decompress to at most the size of a full chunk of their image.
+type deflateCompression struct {
+	Compression
+	dc *deflateCodec
+}
+
+func (c deflateCompression) ForChunk(ifd tiff.IFD, l Layout, i int) (Compression, error) {
+	max := l.fullChunkSize()
+	return NewCompression(c.ID(), c.Name(), c.dc.compress, func(in []byte) ([]byte, error) {
+		return c.dc.decompress(in, max)
+	}), nil
+}
+
+func (dc *deflateCodec) compress(in []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := dc.writers.Get().(*zlib.Writer)
+	defer dc.writers.Put(w)
+	w.Reset(&buf)
+	if _, err := w.Write(in); err != nil {
+		return nil, CompressionError{"Deflate", err.Error()}
+	}
+	if err := w.Close(); err != nil {
+		return nil, CompressionError{"Deflate", err.Error()}
+	}
+	return buf.Bytes(), nil
+}
+
+// decompress inflates in, failing if the output is more than max bytes.  A
+// negative max means no limit.
+func (dc *deflateCodec) decompress(in []byte, max int) ([]byte, error) {
+	var r io.ReadCloser
+	var err error
+	if v := dc.readers.Get(); v != nil {
+		r = v.(io.ReadCloser)
+		err = r.(zlib.Resetter).Reset(bytes.NewReader(in), nil)
+	} else {
+		r, err = zlib.NewReader(bytes.NewReader(in))
+	}
+	if err != nil {
+		return nil, CompressionError{"Deflate", err.Error()}
+	}
+	var src io.Reader = r
+	if max >= 0 {
+		src = io.LimitReader(r, int64(max)+1)
+	}
+	out, err := ioutil.ReadAll(src)
+	if err != nil {
+		return nil, CompressionError{"Deflate", fmt.Sprintf("after %d bytes: %v", len(out), err)}
+	}
+	if max >= 0 && len(out) > max {
+		dc.readers.Put(r)
+		return nil, CompressionError{"Deflate", fmt.Sprintf("decompresses to more than the %d bytes of a chunk", max)}
+	}
+	if err = r.Close(); err != nil {
+		return nil, CompressionError{"Deflate", err.Error()}
+	}
+	dc.readers.Put(r)
+	return out, nil
+}
+
+func init() {
+	for _, id := range []uint16{8, 32946} {
+		c, err := NewDeflateCompression(id, zlib.DefaultCompression)
+		if err != nil {
+			panic(err)
+		}
+		RegisterCompression(c)
+	}
+}
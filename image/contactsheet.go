@@ -0,0 +1,264 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package image
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"strings"
+
+	"github.com/google/tiff"
+)
+
+// ContactSheetOptions controls ContactSheet.
+type ContactSheetOptions struct {
+	// ThumbSize is the largest width and height of a thumbnail.  Zero means
+	// 160.
+	ThumbSize int
+	// Columns is the number of thumbnails in each row.  Zero picks a
+	// number that makes the sheet roughly square.
+	Columns int
+	// Levels includes the reduced resolution levels of a pyramidal image
+	// (the sub-IFDs of tag 330) after each page.
+	Levels bool
+	// Pipeline is passed to DecodeRaw for each page.
+	Pipeline *PipelineOptions
+}
+
+// A sheetEntry is a page or level shown on a contact sheet.
+type sheetEntry struct {
+	label string
+	ifd   tiff.IFD
+	page  int // in the main IFD chain, or -1 for a level
+}
+
+const (
+	sheetPadding = 8
+	glyphWidth   = 5
+	glyphHeight  = 7
+)
+
+// ContactSheet renders a grid of thumbnails of the pages of t (and of their
+// levels, if requested), each labeled with its index and size, for a quick
+// visual check of a multi-page or pyramidal file.  Pages are labeled "#2",
+// levels "#2.1" for the first level of page 2.  Pages that can not be decoded
+// are shown as an empty box labeled with "?" instead of their size.  Pages with
+// overviews (see OpenPyramid) are drawn from the smallest overview that is at
+// least as large as a thumbnail.
+func ContactSheet(t tiff.TIFF, opts *ContactSheetOptions) (*image.RGBA, error) {
+	var o ContactSheetOptions
+	if opts != nil {
+		o = *opts
+	}
+	if o.ThumbSize <= 0 {
+		o.ThumbSize = 160
+	}
+	var entries []sheetEntry
+	for i, ifd := range t.IFDs() {
+		entries = append(entries, sheetEntry{fmt.Sprintf("#%d", i), ifd, i})
+		if !o.Levels {
+			continue
+		}
+		subs, err := tiff.ParseSubIFDs(t, ifd, tiff.SubIFDsTagID)
+		if err != nil {
+			return nil, err
+		}
+		for j, sub := range subs {
+			entries = append(entries, sheetEntry{fmt.Sprintf("#%d.%d", i, j+1), sub, -1})
+		}
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("tiff/image: no pages to show")
+	}
+	cols := o.Columns
+	if cols <= 0 {
+		cols = int(math.Ceil(math.Sqrt(float64(len(entries)))))
+	}
+	rows := (len(entries) + cols - 1) / cols
+	cellW := o.ThumbSize + sheetPadding
+	cellH := o.ThumbSize + glyphHeight + 2*sheetPadding
+	sheet := image.NewRGBA(image.Rect(0, 0, cols*cellW+sheetPadding, rows*cellH+sheetPadding))
+	draw.Draw(sheet, sheet.Bounds(), image.NewUniform(color.Gray{0xE0}), image.Point{}, draw.Src)
+
+	for i, e := range entries {
+		if err := tiff.CheckContext(t.R()); err != nil {
+			return nil, err
+		}
+		cell := image.Pt(i%cols*cellW+sheetPadding, i/cols*cellH+sheetPadding)
+		label := e.label + " ?"
+		src, full := sheetSource(t, e, o.ThumbSize)
+		if img, err := decodeForSheet(src.IFD, t.R(), o.Pipeline); err == nil {
+			b := img.Bounds()
+			w, h := b.Dx(), b.Dy()
+			if src.IFD != full.IFD {
+				// Label the page with its own size, turned as
+				// the level was if it was oriented.
+				w, h = full.Width, full.Height
+				if b.Dx() != src.Width {
+					w, h = h, w
+				}
+			}
+			label = fmt.Sprintf("%s %dX%d", e.label, w, h)
+			th := thumbnail(img, o.ThumbSize)
+			off := cell.Add(image.Pt((o.ThumbSize-th.Bounds().Dx())/2, (o.ThumbSize-th.Bounds().Dy())/2))
+			draw.Draw(sheet, th.Bounds().Add(off), th, image.Point{}, draw.Src)
+		} else {
+			box := image.Rectangle{cell, cell.Add(image.Pt(o.ThumbSize, o.ThumbSize))}
+			draw.Draw(sheet, box, image.NewUniform(color.Gray{0xA0}), image.Point{}, draw.Src)
+		}
+		clip := image.Rect(cell.X, cell.Y+o.ThumbSize, cell.X+o.ThumbSize, cell.Y+cellH-sheetPadding)
+		drawLabel(sheet.SubImage(clip).(*image.RGBA), image.Pt(cell.X, cell.Y+o.ThumbSize+sheetPadding/2), label)
+	}
+	return sheet, nil
+}
+
+// sheetSource returns the level to draw the thumbnail of e from, and the
+// level of e itself.  For a page with overviews, that is the smallest level at
+// least as large as a thumbnail of size pixels, as Pyramid.BestOverview picks
+// it, so that large images are not decoded in full.
+func sheetSource(t tiff.TIFF, e sheetEntry, size int) (src, full Overview) {
+	full = Overview{IFD: e.ifd}
+	if e.page < 0 {
+		return full, full
+	}
+	p, err := OpenPyramid(t, e.page)
+	if err != nil || len(p.Levels) < 2 {
+		return full, full
+	}
+	full = p.Levels[0]
+	longest := full.Width
+	if full.Height > longest {
+		longest = full.Height
+	}
+	if longest <= size {
+		return full, full
+	}
+	return p.Levels[p.BestLevel(float64(size)/float64(longest))], full
+}
+
+func decodeForSheet(ifd tiff.IFD, br tiff.BReader, opts *PipelineOptions) (image.Image, error) {
+	raw, err := DecodeRaw(ifd, br, opts)
+	if err != nil {
+		return nil, err
+	}
+	return raw.Image()
+}
+
+// thumbnail returns img scaled down (never up) to fit in a square of size
+// pixels, averaging the pixels that fall in each pixel of the thumbnail.
+func thumbnail(img image.Image, size int) *image.RGBA {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w > size || h > size {
+		if w >= h {
+			w, h = size, max1(h*size/w)
+		} else {
+			w, h = max1(w*size/h), size
+		}
+	}
+	th := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		y0, y1 := b.Min.Y+y*b.Dy()/h, b.Min.Y+max1((y+1)*b.Dy()/h)
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < w; x++ {
+			x0, x1 := b.Min.X+x*b.Dx()/w, b.Min.X+max1((x+1)*b.Dx()/w)
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+			var r, g, bl, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, _ := img.At(sx, sy).RGBA()
+					r, g, bl, n = r+uint64(cr), g+uint64(cg), bl+uint64(cb), n+1
+				}
+			}
+			th.SetRGBA(x, y, color.RGBA{uint8(r / n >> 8), uint8(g / n >> 8), uint8(bl / n >> 8), 0xFF})
+		}
+	}
+	return th
+}
+
+func max1(n int) int {
+	if n < 1 {
+		return 1
+	}
+	return n
+}
+
+// drawLabel draws s in black with its top left corner at pt.  Lower case
+// letters are drawn as upper case and characters missing from the font as
+// "?".  Nothing is drawn outside of the bounds of dst.
+func drawLabel(dst *image.RGBA, pt image.Point, s string) {
+	for _, c := range strings.ToUpper(s) {
+		g, ok := labelFont[c]
+		if !ok {
+			g = labelFont['?']
+		}
+		for y, bits := range g {
+			for x := 0; x < glyphWidth; x++ {
+				if bits&(1<<uint(glyphWidth-1-x)) != 0 {
+					if p := pt.Add(image.Pt(x, y)); p.In(dst.Bounds()) {
+						dst.SetRGBA(p.X, p.Y, color.RGBA{0, 0, 0, 0xFF})
+					}
+				}
+			}
+		}
+		pt.X += glyphWidth + 1
+	}
+}
+
+// labelFont is a 5x7 pixel font with just the characters needed for labels.
+// Each row of a glyph is given by the low 5 bits of a byte, the highest of
+// which is the leftmost pixel.
+var labelFont = map[rune][glyphHeight]byte{
+	' ': {},
+	'#': {0x0A, 0x0A, 0x1F, 0x0A, 0x1F, 0x0A, 0x0A},
+	'-': {0x00, 0x00, 0x00, 0x1F, 0x00, 0x00, 0x00},
+	'.': {0x00, 0x00, 0x00, 0x00, 0x00, 0x0C, 0x0C},
+	'/': {0x00, 0x01, 0x02, 0x04, 0x08, 0x10, 0x00},
+	':': {0x00, 0x0C, 0x0C, 0x00, 0x0C, 0x0C, 0x00},
+	'?': {0x0E, 0x11, 0x01, 0x02, 0x04, 0x00, 0x04},
+	'0': {0x0E, 0x11, 0x13, 0x15, 0x19, 0x11, 0x0E},
+	'1': {0x04, 0x0C, 0x04, 0x04, 0x04, 0x04, 0x0E},
+	'2': {0x0E, 0x11, 0x01, 0x02, 0x04, 0x08, 0x1F},
+	'3': {0x1F, 0x02, 0x04, 0x02, 0x01, 0x11, 0x0E},
+	'4': {0x02, 0x06, 0x0A, 0x12, 0x1F, 0x02, 0x02},
+	'5': {0x1F, 0x10, 0x1E, 0x01, 0x01, 0x11, 0x0E},
+	'6': {0x06, 0x08, 0x10, 0x1E, 0x11, 0x11, 0x0E},
+	'7': {0x1F, 0x01, 0x02, 0x04, 0x08, 0x08, 0x08},
+	'8': {0x0E, 0x11, 0x11, 0x0E, 0x11, 0x11, 0x0E},
+	'9': {0x0E, 0x11, 0x11, 0x0F, 0x01, 0x02, 0x0C},
+	'A': {0x0E, 0x11, 0x11, 0x1F, 0x11, 0x11, 0x11},
+	'B': {0x1E, 0x11, 0x11, 0x1E, 0x11, 0x11, 0x1E},
+	'C': {0x0E, 0x11, 0x10, 0x10, 0x10, 0x11, 0x0E},
+	'D': {0x1C, 0x12, 0x11, 0x11, 0x11, 0x12, 0x1C},
+	'E': {0x1F, 0x10, 0x10, 0x1E, 0x10, 0x10, 0x1F},
+	'F': {0x1F, 0x10, 0x10, 0x1E, 0x10, 0x10, 0x10},
+	'G': {0x0E, 0x11, 0x10, 0x17, 0x11, 0x11, 0x0F},
+	'H': {0x11, 0x11, 0x11, 0x1F, 0x11, 0x11, 0x11},
+	'I': {0x0E, 0x04, 0x04, 0x04, 0x04, 0x04, 0x0E},
+	'J': {0x07, 0x02, 0x02, 0x02, 0x02, 0x12, 0x0C},
+	'K': {0x11, 0x12, 0x14, 0x18, 0x14, 0x12, 0x11},
+	'L': {0x10, 0x10, 0x10, 0x10, 0x10, 0x10, 0x1F},
+	'M': {0x11, 0x1B, 0x15, 0x15, 0x11, 0x11, 0x11},
+	'N': {0x11, 0x11, 0x19, 0x15, 0x13, 0x11, 0x11},
+	'O': {0x0E, 0x11, 0x11, 0x11, 0x11, 0x11, 0x0E},
+	'P': {0x1E, 0x11, 0x11, 0x1E, 0x10, 0x10, 0x10},
+	'Q': {0x0E, 0x11, 0x11, 0x11, 0x15, 0x12, 0x0D},
+	'R': {0x1E, 0x11, 0x11, 0x1E, 0x14, 0x12, 0x11},
+	'S': {0x0F, 0x10, 0x10, 0x0E, 0x01, 0x01, 0x1E},
+	'T': {0x1F, 0x04, 0x04, 0x04, 0x04, 0x04, 0x04},
+	'U': {0x11, 0x11, 0x11, 0x11, 0x11, 0x11, 0x0E},
+	'V': {0x11, 0x11, 0x11, 0x11, 0x11, 0x0A, 0x04},
+	'W': {0x11, 0x11, 0x11, 0x15, 0x15, 0x15, 0x0A},
+	'X': {0x11, 0x11, 0x0A, 0x04, 0x0A, 0x11, 0x11},
+	'Y': {0x11, 0x11, 0x11, 0x0A, 0x04, 0x04, 0x04},
+	'Z': {0x1F, 0x01, 0x02, 0x04, 0x08, 0x10, 0x1F},
+}
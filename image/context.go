@@ -0,0 +1,100 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package image
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"io"
+
+	"github.com/google/tiff"
+)
+
+// A ContextDecoder is a Decoder that can stop decoding part way through an
+// image once a context is done, typically by calling tiff.CheckContext between
+// strips or tiles.  Decoders that do not implement it are still stopped by any
+// read they make through the tiff.BReader they were given.
+type ContextDecoder interface {
+	Decoder
+	ImageContext(ctx context.Context) (image.Image, error)
+}
+
+// A ContextChunkReader is a ChunkReader that can stop reading a strip or tile
+// once a context is done.
+type ContextChunkReader interface {
+	ChunkReader
+	ReadChunkContext(ctx context.Context, i int) ([]byte, error)
+}
+
+// ReadChunkContext is like cr.ReadChunk(i), but it stops with ctx.Err() once
+// ctx is done.  ChunkReaders that do not implement ContextChunkReader are only
+// checked before and after the read.
+func ReadChunkContext(ctx context.Context, cr ChunkReader, i int) ([]byte, error) {
+	if ccr, ok := cr.(ContextChunkReader); ok {
+		return ccr.ReadChunkContext(ctx, i)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	out, err := cr.ReadChunk(i)
+	if err != nil {
+		return nil, err
+	}
+	return out, ctx.Err()
+}
+
+// DecodeRawContext is like DecodeRaw, but it stops with ctx.Err() once ctx is
+// done: it is checked between strips or tiles and on every read of br.
+func DecodeRawContext(ctx context.Context, ifd tiff.IFD, br tiff.BReader, opts *PipelineOptions) (*RawImage, error) {
+	return DecodeRaw(ifd, tiff.ContextBReader(ctx, br), opts)
+}
+
+// decoderContext parses the file in r and returns its Decoder, stopping with
+// ctx.Err() once ctx is done.
+func decoderContext(ctx context.Context, r io.Reader) (dec Decoder, err error) {
+	var t tiff.TIFF
+	if t, _, err = tiff.ParseWithOptions(tiff.NewReadAtReadSeeker(r), &tiff.ParseOptions{Context: ctx}); err != nil {
+		return
+	}
+	if dec, err = getDecoder(t); err != nil {
+		return
+	}
+	if dec == nil {
+		return nil, fmt.Errorf("tiff/image: no decoder available for this tiff")
+	}
+	return dec, ctx.Err()
+}
+
+// DecodeContext is like Decode, but it stops with ctx.Err() once ctx is done.
+// The context is checked between IFDs while parsing and, while decoding, on
+// every read of image data (and between strips or tiles by decoders that
+// implement ContextDecoder).
+func DecodeContext(ctx context.Context, r io.Reader) (img image.Image, err error) {
+	var dec Decoder
+	if dec, err = decoderContext(ctx, r); err != nil {
+		return
+	}
+	if cd, ok := dec.(ContextDecoder); ok {
+		return cd.ImageContext(ctx)
+	}
+	if img, err = dec.Image(); err != nil {
+		return
+	}
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+	return img, nil
+}
+
+// DecodeConfigContext is like DecodeConfig, but it stops with ctx.Err() once
+// ctx is done.
+func DecodeConfigContext(ctx context.Context, r io.Reader) (cfg image.Config, err error) {
+	var dec Decoder
+	if dec, err = decoderContext(ctx, r); err != nil {
+		return
+	}
+	return dec.Config()
+}
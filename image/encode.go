@@ -0,0 +1,748 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package image
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"sort"
+
+	"github.com/google/tiff"
+)
+
+// An OverviewMode tells Encode whether to write overviews of the image, and
+// where.
+type OverviewMode int
+
+const (
+	// NoOverviews writes the image alone.
+	NoOverviews OverviewMode = iota
+	// OverviewIFDs writes overviews in the main IFD chain after the image,
+	// as Cloud Optimized GeoTIFFs and whole slide images do.
+	OverviewIFDs
+	// OverviewSubIFDs writes overviews in the SubIFDs (tag 330) of the
+	// IFD of the image, as OME-TIFF files do, so that readers that only
+	// look at the main IFD chain see a single image.
+	OverviewSubIFDs
+)
+
+// An OverviewFilter tells Encode how to reduce each 2 by 2 block of pixels to
+// a single pixel of the next overview.
+type OverviewFilter int
+
+const (
+	// OverviewBox averages the pixels of the block (a box filter).
+	OverviewBox OverviewFilter = iota
+	// OverviewNearest takes the top left pixel of the block, for images
+	// whose samples are classes or labels rather than intensities.
+	OverviewNearest
+)
+
+// defaultMinOverviewSize is the size below which no overviews are made for a
+// striped image, if EncodeOptions.MinOverviewSize is not set.
+const defaultMinOverviewSize = 256
+
+// EncodeOptions controls Encode.
+type EncodeOptions struct {
+	// Compression is the Compression tag value to compress strips or tiles
+	// with (see GetCompression).  Zero means 1, no compression.
+	Compression uint16
+	// Codec, if not nil, compresses strips or tiles in place of the codec
+	// registered for Compression, and its ID is written.  It allows for
+	// codecs with settings of their own, such as a Deflate level (see
+	// NewDeflateCompression and TrialCompressions).
+	Codec Compression
+	// SelectCodec, if not nil, chooses the codec of each image from its
+	// pixels, in place of Codec and Compression (see EncodePages).
+	// Overviews are compressed with the codec of their image.
+	SelectCodec CodecSelector
+	// TileWidth and TileHeight are the size of tiles, which must be
+	// multiples of 16.  Zero means the image is written in strips.
+	TileWidth, TileHeight int
+	// RowsPerStrip is the number of rows in each strip.  Zero means
+	// strips of about 8 KiB.
+	RowsPerStrip int
+
+	// Overviews tells whether to write overviews of the image, and where.
+	// Each overview is half the size of the one before (rounded up), down
+	// to the first that fits in MinOverviewSize pixels either way.
+	Overviews      OverviewMode
+	OverviewFilter OverviewFilter
+	// MinOverviewSize is the size of the smallest overview.  Zero means
+	// the larger side of a tile, or 256 for strips.
+	MinOverviewSize int
+
+	// COG lays the file out as a Cloud Optimized GeoTIFF, as GDAL's
+	// validate_cloud_optimized_geotiff.py checks: the image is tiled (in
+	// tiles of 256 by 256 pixels if no size is given), overviews are in the
+	// main IFD chain from the largest to the smallest, all IFDs and their
+	// values come before the image data, and the tiles of the smallest
+	// overview come first, those of the full resolution image last.  The
+	// tiles of each image are in ascending order.
+	COG bool
+	// GhostArea, along with COG, writes GDAL's structural metadata after
+	// the header and a leader and trailer around each tile, which lets GDAL
+	// read tiles without first reading their offsets.
+	GhostArea bool
+}
+
+// Encode writes img to w as a classic TIFF, laid out as opts directs, along
+// with overviews if opts asks for them.  Samples are written in the byte order
+// of img (little endian if it has none), so they need no swapping.  A nil opts
+// writes a single uncompressed image in strips.
+func Encode(w io.Writer, img *RawImage, opts *EncodeOptions) error {
+	var o EncodeOptions
+	if opts != nil {
+		o = *opts
+	}
+	if err := checkEncodable(img); err != nil {
+		return err
+	}
+	tiled, err := o.tiling()
+	if err != nil {
+		return err
+	}
+	c, err := o.codec(img)
+	if err != nil {
+		return err
+	}
+	if img.ByteOrder == nil {
+		withOrder := *img
+		withOrder.ByteOrder = binary.LittleEndian
+		img = &withOrder
+	}
+	levels := []*RawImage{img}
+	if o.Overviews != NoOverviews {
+		min := o.MinOverviewSize
+		if min <= 0 {
+			min = defaultMinOverviewSize
+			if tiled {
+				min = o.TileWidth
+				if o.TileHeight > min {
+					min = o.TileHeight
+				}
+			}
+		}
+		for last := img; last.Width > min || last.Height > min; {
+			ov, err := halve(last, o.OverviewFilter)
+			if err != nil {
+				return err
+			}
+			levels = append(levels, ov)
+			last = ov
+		}
+	}
+	bo := img.ByteOrder
+	ims := make([]*encodedImage, len(levels))
+	for i, lv := range levels {
+		im, err := encodeImage(lv, c, &o)
+		if err != nil {
+			return err
+		}
+		im.reduced = i > 0
+		ims[i] = im
+	}
+	fl := fileLayout{subIFDs: o.Overviews == OverviewSubIFDs, cog: o.COG}
+	if o.COG && o.GhostArea {
+		fl.leaders, fl.ghost = true, cogGhostArea()
+	}
+	return writeEncoded(w, bo, ims, fl)
+}
+
+// FromImage returns the pixels of m as a RawImage for Encode, in little endian,
+// with 16 bit samples for *image.Gray16, *image.RGBA64 and *image.NRGBA64 and 8
+// bit samples for all others.  *image.Gray and *image.Gray16 give a grayscale
+// image.  All others give RGB samples followed by an alpha sample, marked by
+// ExtraSamples: associated alpha for *image.RGBA and *image.RGBA64, since their
+// colors are premultiplied, and unassociated alpha otherwise.
+func FromImage(m image.Image) *RawImage {
+	b := m.Bounds()
+	img := &RawImage{
+		Width:           b.Dx(),
+		Height:          b.Dy(),
+		SamplesPerPixel: 4,
+		BitsPerSample:   8,
+		Photometric:     photometricRGB,
+		SampleFormat:    SampleFormatUint,
+		ExtraSamples:    []uint16{ExtraSampleUnassociatedAlpha},
+		ByteOrder:       binary.LittleEndian,
+	}
+	model := color.NRGBA64Model
+	switch m.(type) {
+	case *image.Gray, *image.Gray16:
+		img.SamplesPerPixel, img.Photometric, img.ExtraSamples = 1, photometricBlackIsZero, nil
+		model = color.Gray16Model
+	case *image.RGBA, *image.RGBA64:
+		img.ExtraSamples[0] = ExtraSampleAssociatedAlpha
+		model = color.RGBA64Model
+	}
+	switch m.(type) {
+	case *image.Gray16, *image.RGBA64, *image.NRGBA64:
+		img.BitsPerSample = 16
+	}
+	img.Stride = img.Width * img.SamplesPerPixel * img.BitsPerSample / 8
+	img.Pix = make([]byte, img.Stride*img.Height)
+	for y := 0; y < img.Height; y++ {
+		for x := 0; x < img.Width; x++ {
+			var v [4]uint16
+			switch c := model.Convert(m.At(b.Min.X+x, b.Min.Y+y)).(type) {
+			case color.Gray16:
+				v[0] = c.Y
+			case color.RGBA64:
+				v = [4]uint16{c.R, c.G, c.B, c.A}
+			case color.NRGBA64:
+				v = [4]uint16{c.R, c.G, c.B, c.A}
+			}
+			for s := 0; s < img.SamplesPerPixel; s++ {
+				if img.BitsPerSample == 16 {
+					img.setValue(x, y, s, float64(v[s]))
+				} else {
+					img.setValue(x, y, s, float64(v[s]>>8))
+				}
+			}
+		}
+	}
+	return img
+}
+
+// checkEncodable returns an error if img can not be written by Encode.
+func checkEncodable(img *RawImage) error {
+	if img.Width <= 0 || img.Height <= 0 || img.SamplesPerPixel <= 0 || img.BitsPerSample <= 0 {
+		return fmt.Errorf("tiff/image: invalid image layout")
+	}
+	if img.Photometric == photometricPalette {
+		return fmt.Errorf("tiff/image: encoding palette images is not supported")
+	}
+	if n := img.SamplesPerPixel - colorSamples(img.Photometric); len(img.ExtraSamples) > n {
+		return fmt.Errorf("tiff/image: %d ExtraSamples for %d samples beyond the color samples", len(img.ExtraSamples), n)
+	}
+	if need := (img.Width*img.SamplesPerPixel*img.BitsPerSample + 7) / 8; img.Stride < need || len(img.Pix) < img.Stride*(img.Height-1)+need {
+		return fmt.Errorf("tiff/image: %d bytes of pixels with a stride of %d do not hold a %dx%d image", len(img.Pix), img.Stride, img.Width, img.Height)
+	}
+	return nil
+}
+
+// An encodedImage is an image of a file being written by Encode, with its
+// strips or tiles compressed.
+type encodedImage struct {
+	l       Layout
+	chunks  [][]byte
+	reduced bool
+	// page and pages number a page written by EncodePages, from 0, and
+	// the pages of its file.  pages is 0 for other images.
+	page, pages int
+
+	entries []*tiff.EntryBuilder
+	ifdOff  uint64
+	end     uint64 // of the IFD and the values that follow it
+}
+
+// tiling checks the tile size of o, setting the default tile size of COGs, and
+// reports whether the image is tiled.
+func (o *EncodeOptions) tiling() (tiled bool, err error) {
+	tiled = o.TileWidth != 0 || o.TileHeight != 0
+	if o.COG {
+		if o.Overviews == OverviewSubIFDs {
+			return false, fmt.Errorf("tiff/image: the overviews of a cog must be in the main IFD chain")
+		}
+		if !tiled {
+			o.TileWidth, o.TileHeight, tiled = 256, 256, true
+		}
+	}
+	if tiled && (o.TileWidth <= 0 || o.TileHeight <= 0 || o.TileWidth%16 != 0 || o.TileHeight%16 != 0) {
+		return false, fmt.Errorf("tiff/image: tile size %dx%d is not a multiple of 16", o.TileWidth, o.TileHeight)
+	}
+	return tiled, nil
+}
+
+// codec returns the codec that img is compressed with, as o directs.
+func (o *EncodeOptions) codec(img *RawImage) (Compression, error) {
+	if o.SelectCodec != nil {
+		c, err := o.SelectCodec(img)
+		if err == nil && c == nil {
+			err = fmt.Errorf("tiff/image: SelectCodec chose no codec")
+		}
+		return c, err
+	}
+	if o.Codec != nil {
+		return o.Codec, nil
+	}
+	id := o.Compression
+	if id == 0 {
+		id = 1
+	}
+	c := GetCompression(id)
+	if c == nil {
+		return nil, CompressionNotSupported{id}
+	}
+	return c, nil
+}
+
+// encodeImage splits img into strips or tiles as o directs and compresses them
+// with c.
+func encodeImage(img *RawImage, c Compression, o *EncodeOptions) (*encodedImage, error) {
+	l := encodeLayout(img, c.ID(), o)
+	im := &encodedImage{l: l, chunks: make([][]byte, l.NumChunks())}
+	for i := range im.chunks {
+		data, err := c.Compress(l.extract(img, i))
+		if err != nil {
+			return nil, err
+		}
+		im.chunks[i] = data
+	}
+	im.l.Offsets = make([]uint64, len(im.chunks))
+	im.l.ByteCounts = make([]uint64, len(im.chunks))
+	for i, data := range im.chunks {
+		im.l.ByteCounts[i] = uint64(len(data))
+	}
+	return im, nil
+}
+
+// encodeLayout returns the Layout, without offsets or byte counts, that img is
+// written with when compressed with the Compression value id, as o directs.
+func encodeLayout(img *RawImage, id uint16, o *EncodeOptions) Layout {
+	l := Layout{
+		Width:           img.Width,
+		Height:          img.Height,
+		SamplesPerPixel: img.SamplesPerPixel,
+		BitsPerSample:   img.BitsPerSample,
+		Compression:     id,
+		Photometric:     img.Photometric,
+		SampleFormat:    img.SampleFormat,
+		YCbCr:           img.YCbCr,
+		InkSet:          img.InkSet,
+		ExtraSamples:    img.ExtraSamples,
+		Orientation:     img.Orientation,
+		ChunkWidth:      img.Width,
+	}
+	if l.SampleFormat == 0 {
+		l.SampleFormat = SampleFormatUint
+	}
+	switch {
+	case o.TileWidth > 0:
+		l.Tiled = true
+		l.ChunkWidth, l.ChunkHeight = o.TileWidth, o.TileHeight
+	case o.RowsPerStrip > 0:
+		l.ChunkHeight = o.RowsPerStrip
+	default:
+		l.ChunkHeight = 8192 / l.rowBytes(l.Width)
+	}
+	if l.ChunkHeight < 1 {
+		l.ChunkHeight = 1
+	} else if !l.Tiled && l.ChunkHeight > l.Height {
+		l.ChunkHeight = l.Height
+	}
+	return l
+}
+
+// extract returns the data of chunk i of img, undoing place.  Parts of tiles
+// that lie outside of the image are zeros.
+func (l Layout) extract(img *RawImage, i int) []byte {
+	out := make([]byte, l.chunkSize(i))
+	r := l.ChunkBounds(i)
+	dst := l.rowBytes(l.ChunkWidth)
+	x0 := l.rowBytes(r.Min.X)
+	n := dst
+	if r.Max.X > l.Width {
+		n = l.rowBytes(l.Width) - x0
+	}
+	for y := r.Min.Y; y < r.Max.Y && y < l.Height; y++ {
+		off := y*img.Stride + x0
+		copy(out[(y-r.Min.Y)*dst:], img.Pix[off:off+n])
+	}
+	return out
+}
+
+// buildEntries makes the entries of the IFD of im, with nsub SubIFDs.  The
+// values of the entries holding offsets are set by setOffsets.
+func (im *encodedImage) buildEntries(bo binary.ByteOrder, nsub int) error {
+	l := im.l
+	perSample := func(v uint16) []uint16 {
+		vals := make([]uint16, l.SamplesPerPixel)
+		for i := range vals {
+			vals[i] = v
+		}
+		return vals
+	}
+	n := len(im.chunks)
+	type spec struct {
+		tagID uint16
+		ft    tiff.FieldType
+		value interface{}
+	}
+	specs := []spec{
+		{256, tiff.FTLong, uint32(l.Width)},
+		{257, tiff.FTLong, uint32(l.Height)},
+		{258, tiff.FTShort, perSample(uint16(l.BitsPerSample))},
+		{259, tiff.FTShort, l.Compression},
+		{262, tiff.FTShort, l.Photometric},
+	}
+	if im.reduced {
+		specs = append([]spec{{254, tiff.FTLong, uint32(1)}}, specs...)
+	}
+	if im.pages > 0 {
+		specs = append([]spec{{254, tiff.FTLong, uint32(2)}}, specs...)
+		specs = append(specs, spec{297, tiff.FTShort, []uint16{uint16(im.page), uint16(im.pages)}})
+	}
+	if l.Tiled {
+		specs = append(specs,
+			spec{277, tiff.FTShort, uint16(l.SamplesPerPixel)},
+			spec{284, tiff.FTShort, uint16(1)},
+			spec{322, tiff.FTLong, uint32(l.ChunkWidth)},
+			spec{323, tiff.FTLong, uint32(l.ChunkHeight)},
+			spec{324, tiff.FTLong, make([]uint32, n)},
+			spec{325, tiff.FTLong, make([]uint32, n)},
+		)
+	} else {
+		specs = append(specs,
+			spec{273, tiff.FTLong, make([]uint32, n)},
+			spec{277, tiff.FTShort, uint16(l.SamplesPerPixel)},
+			spec{278, tiff.FTLong, uint32(l.ChunkHeight)},
+			spec{279, tiff.FTLong, make([]uint32, n)},
+			spec{284, tiff.FTShort, uint16(1)},
+		)
+	}
+	if nsub > 0 {
+		specs = append(specs, spec{tiff.SubIFDsTagID, tiff.FTIFD, make([]uint32, nsub)})
+	}
+	if l.SampleFormat != SampleFormatUint {
+		specs = append(specs, spec{339, tiff.FTShort, perSample(l.SampleFormat)})
+	}
+	if l.Orientation > OrientationTopLeft {
+		specs = append(specs, spec{274, tiff.FTShort, l.Orientation})
+	}
+	if len(l.ExtraSamples) > 0 {
+		specs = append(specs, spec{338, tiff.FTShort, l.ExtraSamples})
+	}
+	if l.Photometric == photometricSeparated && l.InkSet != 0 {
+		specs = append(specs, spec{332, tiff.FTShort, l.InkSet})
+	}
+	if l.Photometric == photometricYCbCr {
+		// The samples of a RawImage are never subsampled.
+		specs = append(specs, spec{530, tiff.FTShort, []uint16{1, 1}})
+		if p := l.YCbCr; p != nil {
+			specs = append(specs,
+				spec{529, tiff.FTRational, p.Coefficients[:]},
+				spec{532, tiff.FTRational, p.ReferenceBlackWhite[:]},
+			)
+		}
+	}
+	sort.SliceStable(specs, func(i, j int) bool { return specs[i].tagID < specs[j].tagID })
+	im.entries = im.entries[:0]
+	for _, s := range specs {
+		e, err := tiff.NewEntry(s.tagID, s.ft, s.value, bo, false)
+		if err != nil {
+			return err
+		}
+		im.entries = append(im.entries, e)
+	}
+	return nil
+}
+
+// placeIFD puts the IFD of im at off, followed by the values that do not fit
+// in its entries, and returns where they end.
+func (im *encodedImage) placeIFD(off uint64) (uint64, error) {
+	im.ifdOff = off
+	pos := off + 2 + 12*uint64(len(im.entries)) + 4
+	for _, e := range im.entries {
+		if e.Inline() {
+			continue
+		}
+		pos = even(pos)
+		if err := e.SetOffset(pos); err != nil {
+			return 0, err
+		}
+		pos += uint64(len(e.Value()))
+	}
+	im.end = pos
+	return pos, nil
+}
+
+// setOffsets sets the values of the entries of im that hold the offsets and
+// byte counts of its strips or tiles, and the offsets of subs.
+func (im *encodedImage) setOffsets(subs []*encodedImage) error {
+	vals := make(map[uint16][]uint32)
+	offsets, counts := uint16(273), uint16(279)
+	if im.l.Tiled {
+		offsets, counts = 324, 325
+	}
+	for i := range im.chunks {
+		vals[offsets] = append(vals[offsets], uint32(im.l.Offsets[i]))
+		vals[counts] = append(vals[counts], uint32(im.l.ByteCounts[i]))
+	}
+	for _, sub := range subs {
+		vals[tiff.SubIFDsTagID] = append(vals[tiff.SubIFDsTagID], uint32(sub.ifdOff))
+	}
+	for _, e := range im.entries {
+		if v, ok := vals[e.TagID()]; ok {
+			if err := e.SetValue(v); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ifdBytes returns the IFD of im, pointing to the next one at next, followed by
+// the values that do not fit in its entries, as placed by placeIFD.
+func (im *encodedImage) ifdBytes(bo binary.ByteOrder, next uint64) []byte {
+	b := make([]byte, im.end-im.ifdOff)
+	bo.PutUint16(b, uint16(len(im.entries)))
+	p := b[2:]
+	for _, e := range im.entries {
+		bo.PutUint16(p, e.TagID())
+		bo.PutUint16(p[2:], e.TypeID())
+		bo.PutUint32(p[4:], uint32(e.Count64()))
+		copy(p[8:12], e.RawValueOffset())
+		p = p[12:]
+	}
+	bo.PutUint32(p, uint32(next))
+	for _, e := range im.entries {
+		if !e.Inline() {
+			copy(b[e.ValueOffset64(bo)-im.ifdOff:], e.Value())
+		}
+	}
+	return b
+}
+
+// even rounds off up to a word boundary, where the TIFF specification wants
+// IFDs and values to start.
+func even(off uint64) uint64 {
+	return off + off&1
+}
+
+// A filePiece is a run of bytes of a file being written, at an offset.
+type filePiece struct {
+	off  uint64
+	data []byte
+}
+
+// A fileLayout describes how writeEncoded lays out a file.
+type fileLayout struct {
+	// subIFDs writes the overviews in the SubIFDs of the first IFD.
+	subIFDs bool
+	// cog writes the IFDs (and their values) first, then the strips or
+	// tiles of each image, from the smallest overview to the full
+	// resolution image.  Otherwise each image is written as its strips or
+	// tiles followed by its IFD.
+	cog bool
+	// ghost is written right after the header.
+	ghost []byte
+	// leaders writes the size of each strip or tile before it and repeats
+	// its last 4 bytes after it.
+	leaders bool
+}
+
+// writeEncoded writes a TIFF holding ims, in the byte order bo, to w, laid out
+// as fl directs.  The first image is the full resolution one and the rest its
+// overviews, or the pages of a document.
+func writeEncoded(w io.Writer, bo binary.ByteOrder, ims []*encodedImage, fl fileLayout) error {
+	for i, im := range ims {
+		nsub := 0
+		if fl.subIFDs && i == 0 {
+			nsub = len(ims) - 1
+		}
+		if err := im.buildEntries(bo, nsub); err != nil {
+			return err
+		}
+	}
+	pos := even(8 + uint64(len(fl.ghost)))
+	placeChunks := func(im *encodedImage) {
+		for i, data := range im.chunks {
+			if fl.leaders {
+				pos += 4
+			}
+			im.l.Offsets[i] = pos
+			pos += uint64(len(data))
+			if fl.leaders {
+				pos += 4
+			}
+			pos = even(pos)
+		}
+	}
+	var err error
+	for _, im := range ims {
+		if !fl.cog {
+			placeChunks(im)
+		}
+		if pos, err = im.placeIFD(pos); err != nil {
+			return err
+		}
+		pos = even(pos)
+	}
+	if fl.cog {
+		for i := len(ims) - 1; i >= 0; i-- {
+			placeChunks(ims[i])
+		}
+	}
+	return writePieces(w, bo, ims, fl, pos)
+}
+
+// writePieces sets the offsets of ims, as placed by writeEncoded, and writes
+// the header, IFDs and strips or tiles to w, the file ending at size.
+func writePieces(w io.Writer, bo binary.ByteOrder, ims []*encodedImage, fl fileLayout, size uint64) error {
+	if size > math.MaxUint32 {
+		return fmt.Errorf("tiff/image: %d bytes do not fit in a classic TIFF", size)
+	}
+	var subs []*encodedImage
+	chain := ims
+	if fl.subIFDs {
+		chain, subs = ims[:1], ims[1:]
+	}
+	hdr := make([]byte, 8)
+	if bo == binary.BigEndian {
+		copy(hdr, "MM")
+	} else {
+		copy(hdr, "II")
+	}
+	bo.PutUint16(hdr[2:], 42)
+	bo.PutUint32(hdr[4:], uint32(ims[0].ifdOff))
+	pieces := []filePiece{{0, hdr}}
+	if fl.ghost != nil {
+		pieces = append(pieces, filePiece{8, fl.ghost})
+	}
+	for i, im := range ims {
+		var next uint64
+		if i+1 < len(chain) {
+			next = chain[i+1].ifdOff
+		}
+		var s []*encodedImage
+		if i == 0 {
+			s = subs
+		}
+		if err := im.setOffsets(s); err != nil {
+			return err
+		}
+		pieces = append(pieces, filePiece{im.ifdOff, im.ifdBytes(bo, next)})
+		for j, data := range im.chunks {
+			off := im.l.Offsets[j]
+			if fl.leaders {
+				data = withLeader(bo, data)
+				off -= 4
+			}
+			pieces = append(pieces, filePiece{off, data})
+		}
+	}
+	sort.SliceStable(pieces, func(i, j int) bool { return pieces[i].off < pieces[j].off })
+	var pos uint64
+	for _, p := range pieces {
+		if p.off < pos {
+			return fmt.Errorf("tiff/image: internal error: pieces overlap at offset %d", p.off)
+		}
+		if _, err := w.Write(make([]byte, p.off-pos)); err != nil {
+			return err
+		}
+		if _, err := w.Write(p.data); err != nil {
+			return err
+		}
+		pos = p.off + uint64(len(p.data))
+	}
+	_, err := w.Write(make([]byte, size-pos))
+	return err
+}
+
+// withLeader returns data preceded by its size and followed by its last 4
+// bytes (padded with zeros if it is shorter), as GDAL's ghost area describes.
+func withLeader(bo binary.ByteOrder, data []byte) []byte {
+	b := make([]byte, 4, 8+len(data))
+	bo.PutUint32(b, uint32(len(data)))
+	b = append(b, data...)
+	last := data
+	if len(last) > 4 {
+		last = last[len(last)-4:]
+	}
+	b = append(b, last...)
+	return append(b, make([]byte, 4-len(last))...)
+}
+
+// cogGhostArea returns the ghost area GDAL writes after the header of a Cloud
+// Optimized GeoTIFF, which tells readers how the file is laid out, including
+// the leaders and trailers of its tiles (see fileLayout).
+func cogGhostArea() []byte {
+	content := "LAYOUT=IFDS_BEFORE_DATA\n" +
+		"BLOCK_ORDER=ROW_MAJOR\n" +
+		"BLOCK_LEADER=SIZE_AS_UINT4\n" +
+		"BLOCK_TRAILER=LAST_4_BYTES_REPEATED\n" +
+		"KNOWN_INCOMPATIBLE_EDITION=NO\n "
+	return []byte(fmt.Sprintf("GDAL_STRUCTURAL_METADATA_SIZE=%06d bytes\n%s", len(content), content))
+}
+
+// halve returns img reduced to half its size (rounded up) with filter f.
+func halve(img *RawImage, f OverviewFilter) (*RawImage, error) {
+	w, h := (img.Width+1)/2, (img.Height+1)/2
+	dst := &RawImage{
+		Width:           w,
+		Height:          h,
+		SamplesPerPixel: img.SamplesPerPixel,
+		BitsPerSample:   img.BitsPerSample,
+		Photometric:     img.Photometric,
+		SampleFormat:    img.SampleFormat,
+		YCbCr:           img.YCbCr,
+		InkSet:          img.InkSet,
+		ExtraSamples:    img.ExtraSamples,
+		Orientation:     img.Orientation,
+		ByteOrder:       img.ByteOrder,
+		Stride:          (w*img.SamplesPerPixel*img.BitsPerSample + 7) / 8,
+	}
+	dst.Pix = make([]byte, dst.Stride*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			for s := 0; s < img.SamplesPerPixel; s++ {
+				v, ok := img.value(2*x, 2*y, s)
+				if !ok {
+					return nil, fmt.Errorf("tiff/image: making overviews of %d bit samples of format %d is not supported", img.BitsPerSample, img.SampleFormat)
+				}
+				if f == OverviewBox {
+					n := 1
+					for _, p := range [][2]int{{2*x + 1, 2 * y}, {2 * x, 2*y + 1}, {2*x + 1, 2*y + 1}} {
+						if p[0] < img.Width && p[1] < img.Height {
+							u, _ := img.value(p[0], p[1], s)
+							v += u
+							n++
+						}
+					}
+					v /= float64(n)
+				}
+				dst.setValue(x, y, s, v)
+			}
+		}
+	}
+	return dst, nil
+}
+
+// setValue sets sample s of the pixel at (x, y) to v, rounded for integer
+// samples.  It undoes value, for the same sizes of samples.
+func (img *RawImage) setValue(x, y, s int, v float64) {
+	bps := img.BitsPerSample
+	bit := (x*img.SamplesPerPixel + s) * bps
+	p := img.Pix[y*img.Stride+bit/8:]
+	bo := img.ByteOrder
+	if img.SampleFormat == SampleFormatFloat {
+		switch bps {
+		case 32:
+			bo.PutUint32(p, math.Float32bits(float32(v)))
+		case 64:
+			bo.PutUint64(p, math.Float64bits(v))
+		}
+		return
+	}
+	n := uint64(int64(math.Floor(v + 0.5)))
+	switch bps {
+	case 1, 2, 4:
+		shift := uint(8 - bps - bit%8)
+		mask := byte(1<<uint(bps)-1) << shift
+		p[0] = p[0]&^mask | byte(n)<<shift&mask
+	case 8:
+		p[0] = byte(n)
+	case 16:
+		bo.PutUint16(p, uint16(n))
+	case 32:
+		bo.PutUint32(p, uint32(n))
+	}
+}
@@ -42,7 +42,21 @@ func validateTIFF(t tiff.TIFF) error {
 	return nil
 }
 
+// getDecoder returns the Decoder for t, checking the size of the image against
+// the Limits enforced by t.R(), if any.
 func getDecoder(t tiff.TIFF) (dec Decoder, err error) {
+	if dec, err = findDecoder(t); err != nil || dec == nil {
+		return
+	}
+	if l, ok := tiff.LimitsOf(t.R()); ok {
+		if err = checkLimits(dec, l); err != nil {
+			return nil, err
+		}
+	}
+	return dec, nil
+}
+
+func findDecoder(t tiff.TIFF) (dec Decoder, err error) {
 	if err = validateTIFF(t); err != nil {
 		return
 	}
@@ -0,0 +1,30 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+/*
+Package libtiff registers codecs backed by libtiff for the compressions that
+package github.com/google/tiff/image does not implement in Go, such as LZW,
+JPEG, CCITT fax, LZMA, ZSTD and WebP.  It is imported for its side effects:
+
+	import _ "github.com/google/tiff/image/libtiff"
+
+The bridge uses cgo and is only built with the libtiff build tag (go build
+-tags libtiff), with libtiff 4 and its headers found through pkg-config.
+Without the tag the package is empty, so that programs importing it still build
+in pure Go and simply go without the extra codecs.
+
+Every codec that the linked libtiff has configured is registered with
+image.RegisterCompression, unless a codec for the same Compression value is
+already registered.  The codecs only decompress.  They are ChunkCompressions:
+each strip or tile is handed to libtiff as the single strip of a small TIFF
+made up from the layout and fields of its image (including JPEGTables,
+T4Options, T6Options and FillOrder), and the samples are returned in the byte
+order of the file, as the image package expects.  The Predictor is left out,
+since the image package undoes it once the data is decompressed.
+
+libtiff reports errors and warnings through handlers that are global to the
+process.  The package sets both to nil when it registers its codecs, so that
+libtiff stays silent; failures are reported as image.CompressionErrors.
+*/
+package libtiff
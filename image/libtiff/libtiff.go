@@ -0,0 +1,357 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build cgo && libtiff
+// +build cgo,libtiff
+
+package libtiff
+
+/*
+#cgo pkg-config: libtiff-4
+#include <stdlib.h>
+#include <string.h>
+#include <tiffio.h>
+
+// A memFile is a TIFF held in memory, read through the client procedures
+// below.
+typedef struct {
+	const char *data;
+	toff_t size;
+	toff_t pos;
+} memFile;
+
+static tmsize_t memRead(thandle_t h, void *buf, tmsize_t n) {
+	memFile *m = (memFile *)h;
+	if (m->pos >= m->size) {
+		return 0;
+	}
+	if ((toff_t)n > m->size - m->pos) {
+		n = (tmsize_t)(m->size - m->pos);
+	}
+	memcpy(buf, m->data + m->pos, n);
+	m->pos += n;
+	return n;
+}
+
+static tmsize_t memWrite(thandle_t h, void *buf, tmsize_t n) {
+	return -1;
+}
+
+static toff_t memSeek(thandle_t h, toff_t off, int whence) {
+	memFile *m = (memFile *)h;
+	switch (whence) {
+	case SEEK_SET:
+		m->pos = off;
+		break;
+	case SEEK_CUR:
+		m->pos += off;
+		break;
+	case SEEK_END:
+		m->pos = m->size + off;
+		break;
+	}
+	return m->pos;
+}
+
+static int memClose(thandle_t h) {
+	return 0;
+}
+
+static toff_t memSize(thandle_t h) {
+	return ((memFile *)h)->size;
+}
+
+static int memMap(thandle_t h, void **base, toff_t *size) {
+	return 0;
+}
+
+static void memUnmap(thandle_t h, void *base, toff_t size) {
+}
+
+// decodeStrip decodes the first strip of the TIFF held by the size bytes at
+// data.  It returns the decoded bytes, which the caller must free, and sets
+// *n to their number, or returns NULL.  *swapped is set if libtiff swapped the
+// bytes of the samples to the byte order of the host.
+static void *decodeStrip(const char *data, tmsize_t size, tmsize_t *n, int *swapped) {
+	memFile m = {data, (toff_t)size, 0};
+	TIFF *tif = TIFFClientOpen("chunk", "rm", (thandle_t)&m, memRead, memWrite, memSeek, memClose, memSize, memMap, memUnmap);
+	if (tif == NULL) {
+		return NULL;
+	}
+	*swapped = TIFFIsByteSwapped(tif);
+	tmsize_t want = TIFFStripSize(tif);
+	void *out = want > 0 ? malloc(want) : NULL;
+	if (out != NULL) {
+		*n = TIFFReadEncodedStrip(tif, 0, out, want);
+		if (*n < 0) {
+			free(out);
+			out = NULL;
+		}
+	}
+	TIFFClose(tif);
+	return out;
+}
+
+// configuredSchemes stores the Compression values of at most max codecs that
+// libtiff has configured in schemes, and returns their number.
+static int configuredSchemes(uint16_t *schemes, int max) {
+	TIFFCodec *codecs = TIFFGetConfiguredCODECs();
+	int n = 0;
+	if (codecs == NULL) {
+		return 0;
+	}
+	for (TIFFCodec *c = codecs; c->name != NULL && n < max; c++) {
+		schemes[n++] = c->scheme;
+	}
+	_TIFFfree(codecs);
+	return n;
+}
+
+static const char *codecName(uint16_t scheme) {
+	const TIFFCodec *c = TIFFFindCODEC(scheme);
+	return c == NULL ? "" : c->name;
+}
+
+static void silence(void) {
+	TIFFSetErrorHandler(NULL);
+	TIFFSetWarningHandler(NULL);
+}
+*/
+import "C"
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"unsafe"
+
+	"github.com/google/tiff"
+	"github.com/google/tiff/image"
+)
+
+// passedTags are the fields of the image that are handed to libtiff as they
+// are, for the codecs that take parameters from them.
+var passedTags = []uint16{
+	266, // FillOrder
+	292, // T4Options
+	293, // T6Options
+	347, // JPEGTables
+	530, // YCbCrSubsampling
+}
+
+// A codec is a compression implemented by libtiff.
+type codec struct {
+	id   uint16
+	name string
+}
+
+func (c *codec) ID() uint16 {
+	return c.id
+}
+
+func (c *codec) Name() string {
+	return c.name
+}
+
+func (c *codec) Compress([]byte) ([]byte, error) {
+	return nil, image.CompressionError{Method: c.name, Message: "libtiff codecs only decompress"}
+}
+
+func (c *codec) Decompress([]byte) ([]byte, error) {
+	return nil, image.CompressionError{Method: c.name, Message: "the layout of the image is needed to decompress (see ForChunk)"}
+}
+
+func (c *codec) ForChunk(ifd tiff.IFD, l image.Layout, i int) (image.Compression, error) {
+	return &chunkCodec{codec: c, ifd: ifd, l: l, i: i}, nil
+}
+
+// A chunkCodec decompresses a single strip or tile with libtiff.
+type chunkCodec struct {
+	*codec
+	ifd tiff.IFD
+	l   image.Layout
+	i   int
+}
+
+func (cc *chunkCodec) Decompress(in []byte) ([]byte, error) {
+	if len(in) == 0 {
+		return nil, image.CompressionError{Method: cc.name, Message: fmt.Sprintf("strip or tile %d is empty", cc.i)}
+	}
+	bo := cc.byteOrder()
+	file := cc.tiff(bo, in)
+	var n C.tmsize_t
+	var swapped C.int
+	out := C.decodeStrip((*C.char)(unsafe.Pointer(&file[0])), C.tmsize_t(len(file)), &n, &swapped)
+	if out == nil {
+		return nil, image.CompressionError{Method: cc.name, Message: fmt.Sprintf("libtiff could not decode strip or tile %d", cc.i)}
+	}
+	defer C.free(out)
+	data := C.GoBytes(out, C.int(n))
+	if swapped != 0 {
+		swap(data, cc.l.BitsPerSample)
+	}
+	return data, nil
+}
+
+// byteOrder returns the byte order of the file holding the image.
+func (cc *chunkCodec) byteOrder() binary.ByteOrder {
+	if fs := cc.ifd.Fields(); len(fs) > 0 {
+		return fs[0].Value().Order()
+	}
+	return binary.LittleEndian
+}
+
+// tiff returns a TIFF in byte order bo whose single strip is in, and whose
+// fields describe chunk cc.i.  Tiles are described as strips of the size of
+// the tile, and each plane of an image with separate planes as a grayscale
+// image.
+func (cc *chunkCodec) tiff(bo binary.ByteOrder, in []byte) []byte {
+	l := cc.l
+	r := l.ChunkBounds(cc.i)
+	width, height := r.Dx(), r.Dy()
+	if !l.Tiled && r.Max.Y > l.Height {
+		height = l.Height - r.Min.Y
+	}
+	spp, photometric := l.SamplesPerPixel, l.Photometric
+	if l.Planar {
+		spp = 1
+	}
+	// libtiff wants a ColorMap for palette images and three samples for
+	// RGB ones, which the codecs themselves have no use for.
+	if photometric == 3 || l.Planar {
+		photometric = 1
+	}
+	perSample := func(v uint16) []uint16 {
+		vals := make([]uint16, spp)
+		for i := range vals {
+			vals[i] = v
+		}
+		return vals
+	}
+	e := entries{
+		{256, 4, 1, u32(bo, uint32(width))},
+		{257, 4, 1, u32(bo, uint32(height))},
+		{258, 3, uint32(spp), u16s(bo, perSample(uint16(l.BitsPerSample)))},
+		{259, 3, 1, u16s(bo, []uint16{l.Compression})},
+		{262, 3, 1, u16s(bo, []uint16{photometric})},
+		{273, 4, 1, nil}, // set below
+		{277, 3, 1, u16s(bo, []uint16{uint16(spp)})},
+		{278, 4, 1, u32(bo, uint32(height))},
+		{279, 4, 1, u32(bo, uint32(len(in)))},
+		{284, 3, 1, u16s(bo, []uint16{1})},
+		{339, 3, uint32(spp), u16s(bo, perSample(l.SampleFormat))},
+	}
+	if !l.Planar && len(l.ExtraSamples) > 0 {
+		e = append(e, entry{338, 3, uint32(len(l.ExtraSamples)), u16s(bo, l.ExtraSamples)})
+	}
+	for _, id := range passedTags {
+		if !cc.ifd.HasField(id) {
+			continue
+		}
+		f := cc.ifd.GetField(id)
+		size := f.Type().Size() * f.Count()
+		if b := f.Value().Bytes(); uint64(len(b)) >= size {
+			e = append(e, entry{id, f.Type().ID(), uint32(f.Count()), b[:size]})
+		}
+	}
+	sort.Slice(e, func(i, j int) bool { return e[i].id < e[j].id })
+	return e.tiff(bo, in)
+}
+
+type entry struct {
+	id, typeID uint16
+	count      uint32
+	value      []byte
+}
+
+type entries []entry
+
+// tiff returns a classic TIFF in byte order bo with a single IFD holding e, and
+// data as its single strip, which the StripOffsets entry of e is set to.
+func (e entries) tiff(bo binary.ByteOrder, data []byte) []byte {
+	ifdSize := 2 + 12*len(e) + 4
+	var values []byte
+	valuesOff := 8 + ifdSize
+	for _, en := range e {
+		if len(en.value) > 4 {
+			values = append(values, en.value...)
+			if len(values)%2 != 0 {
+				values = append(values, 0)
+			}
+		}
+	}
+	dataOff := valuesOff + len(values)
+	for i := range e {
+		if e[i].id == 273 {
+			e[i].value = u32(bo, uint32(dataOff))
+		}
+	}
+	out := make([]byte, 8, dataOff+len(data))
+	if bo == binary.BigEndian {
+		copy(out, "MM\x00\x2a")
+	} else {
+		copy(out, "II\x2a\x00")
+	}
+	bo.PutUint32(out[4:], 8)
+	out = append(out, make([]byte, ifdSize)...)
+	bo.PutUint16(out[8:], uint16(len(e)))
+	off := valuesOff
+	for i, en := range e {
+		p := out[10+12*i:]
+		bo.PutUint16(p, en.id)
+		bo.PutUint16(p[2:], en.typeID)
+		bo.PutUint32(p[4:], en.count)
+		if len(en.value) > 4 {
+			bo.PutUint32(p[8:], uint32(off))
+			off += len(en.value) + len(en.value)%2
+		} else {
+			copy(p[8:12], en.value)
+		}
+	}
+	out = append(out, values...)
+	return append(out, data...)
+}
+
+func u32(bo binary.ByteOrder, v uint32) []byte {
+	b := make([]byte, 4)
+	bo.PutUint32(b, v)
+	return b
+}
+
+func u16s(bo binary.ByteOrder, vs []uint16) []byte {
+	b := make([]byte, 2*len(vs))
+	for i, v := range vs {
+		bo.PutUint16(b[2*i:], v)
+	}
+	return b
+}
+
+// swap reverses the bytes of each sample of bps bits in data, undoing the
+// swapping libtiff does for files whose byte order is not that of the host.
+func swap(data []byte, bps int) {
+	size := bps / 8
+	switch size {
+	case 2, 3, 4, 8:
+	default:
+		return
+	}
+	for i := 0; i+size <= len(data); i += size {
+		for j, k := i, i+size-1; j < k; j, k = j+1, k-1 {
+			data[j], data[k] = data[k], data[j]
+		}
+	}
+}
+
+func init() {
+	C.silence()
+	var schemes [64]C.uint16_t
+	n := int(C.configuredSchemes(&schemes[0], C.int(len(schemes))))
+	for _, s := range schemes[:n] {
+		id := uint16(s)
+		if id == 1 || image.GetCompression(id) != nil {
+			continue
+		}
+		image.RegisterCompression(&codec{id: id, name: C.GoString(C.codecName(s))})
+	}
+}
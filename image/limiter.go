@@ -0,0 +1,188 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package image
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"sync"
+
+	"github.com/google/tiff"
+)
+
+// A Limiter caps the resources used by decode operations.  A single Limiter
+// is meant to be shared by every decode running in a process (e.g. all of the
+// requests handled by a server) so that together they stay within a budget.
+//
+// Acquire blocks until mem bytes of memory and one unit of CPU (a worker) are
+// available and then reserves them, or until ctx is done, in which case it
+// reserves nothing and returns ctx.Err().  Release returns them once the work
+// is done.  Every successful Acquire must be followed by exactly one Release
+// with the same value.
+type Limiter interface {
+	Acquire(ctx context.Context, mem int64) error
+	Release(mem int64)
+}
+
+// ErrQuotaExceeded is returned when a decode operation needs more memory than
+// a Limiter will ever allow, so it could never be started.
+type ErrQuotaExceeded struct {
+	Need  int64
+	Limit int64
+}
+
+func (e ErrQuotaExceeded) Error() string {
+	return fmt.Sprintf("tiff/image: decode needs %d bytes, but the limit is %d", e.Need, e.Limit)
+}
+
+// NewLimiter returns a Limiter that allows at most maxMemory bytes to be in use
+// by at most maxWorkers decode operations at any one time.  A value of zero or
+// less for either means no limit for that resource.
+func NewLimiter(maxMemory int64, maxWorkers int) Limiter {
+	return &limiter{maxMem: maxMemory, maxWorkers: maxWorkers, released: make(chan struct{})}
+}
+
+type limiter struct {
+	mu         sync.Mutex
+	maxMem     int64
+	maxWorkers int
+	mem        int64
+	workers    int
+	// released is closed, and replaced, by each Release, so that it wakes
+	// every Acquire waiting for room.  Unlike a sync.Cond, it can be
+	// waited for along with a context.
+	released chan struct{}
+}
+
+func (l *limiter) Acquire(ctx context.Context, mem int64) error {
+	if mem < 0 {
+		mem = 0
+	}
+	if l.maxMem > 0 && mem > l.maxMem {
+		return ErrQuotaExceeded{mem, l.maxMem}
+	}
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		l.mu.Lock()
+		if (l.maxMem <= 0 || l.mem+mem <= l.maxMem) && (l.maxWorkers <= 0 || l.workers < l.maxWorkers) {
+			l.mem += mem
+			l.workers++
+			l.mu.Unlock()
+			return nil
+		}
+		released := l.released
+		l.mu.Unlock()
+		select {
+		case <-released:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (l *limiter) Release(mem int64) {
+	if mem < 0 {
+		mem = 0
+	}
+	l.mu.Lock()
+	l.mem -= mem
+	l.workers--
+	close(l.released)
+	l.released = make(chan struct{})
+	l.mu.Unlock()
+}
+
+// DecompressLimited decompresses in with c once l has granted the memory for
+// the input and for size bytes of output.  size is the expected size of the
+// decompressed data (e.g. the number of bytes in a full strip).  It gives up
+// waiting for l with ctx.Err() once ctx is done.
+func DecompressLimited(ctx context.Context, l Limiter, c Compression, in []byte, size int64) ([]byte, error) {
+	mem := int64(len(in)) + size
+	if err := l.Acquire(ctx, mem); err != nil {
+		return nil, err
+	}
+	defer l.Release(mem)
+	return c.Decompress(in)
+}
+
+// bytesPerPixel returns the number of bytes used by each pixel of an image
+// using the color model m.
+func bytesPerPixel(m color.Model) int64 {
+	switch m {
+	case color.GrayModel, color.AlphaModel:
+		return 1
+	case color.Gray16Model, color.Alpha16Model:
+		return 2
+	case color.RGBAModel, color.NRGBAModel:
+		return 4
+	}
+	// Assume the largest of the standard models for anything else.
+	return 8
+}
+
+// DecodeLimited is like DecodeContext, but the decode only starts once l has
+// granted the memory needed for the decoded image, which is held until the
+// decode is done.
+func DecodeLimited(ctx context.Context, r io.Reader, l Limiter) (img image.Image, err error) {
+	var dec Decoder
+	if dec, err = decoderContext(ctx, r); err != nil {
+		return
+	}
+	var cfg image.Config
+	if cfg, err = dec.Config(); err != nil {
+		return
+	}
+	mem := int64(cfg.Width) * int64(cfg.Height) * bytesPerPixel(cfg.ColorModel)
+	if err = l.Acquire(ctx, mem); err != nil {
+		return
+	}
+	defer l.Release(mem)
+	if cd, ok := dec.(ContextDecoder); ok {
+		return cd.ImageContext(ctx)
+	}
+	return dec.Image()
+}
+
+// checkLimits returns a tiff.ErrLimitExceeded if the image decoded by dec is
+// larger than l allows.
+func checkLimits(dec Decoder, l tiff.Limits) error {
+	cfg, err := dec.Config()
+	if err != nil {
+		return err
+	}
+	if l.MaxWidth > 0 && cfg.Width > l.MaxWidth {
+		return tiff.ErrLimitExceeded{Limit: "MaxWidth", Value: uint64(cfg.Width), Max: uint64(l.MaxWidth)}
+	}
+	if l.MaxHeight > 0 && cfg.Height > l.MaxHeight {
+		return tiff.ErrLimitExceeded{Limit: "MaxHeight", Value: uint64(cfg.Height), Max: uint64(l.MaxHeight)}
+	}
+	if px := int64(cfg.Width) * int64(cfg.Height); l.MaxPixels > 0 && px > l.MaxPixels {
+		return tiff.ErrLimitExceeded{Limit: "MaxPixels", Value: uint64(px), Max: uint64(l.MaxPixels)}
+	}
+	return nil
+}
+
+// DecodeWithLimits is like Decode, but parsing the file and decoding its image
+// are bounded by l.  A tiff.ErrLimitExceeded is returned if the file needs more
+// than l allows.
+func DecodeWithLimits(r io.Reader, l tiff.Limits) (img image.Image, err error) {
+	var dec Decoder
+	var t tiff.TIFF
+	if t, _, err = tiff.ParseWithOptions(tiff.NewReadAtReadSeeker(r), &tiff.ParseOptions{Limits: &l}); err != nil {
+		return
+	}
+	if dec, err = getDecoder(t); err != nil {
+		return
+	}
+	if dec == nil {
+		return nil, fmt.Errorf("tiff/image: no decoder available for this tiff")
+	}
+	return dec.Image()
+}
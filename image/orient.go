@@ -0,0 +1,121 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package image
+
+import "github.com/google/tiff"
+
+/* Orientation
+
+The Orientation tag tells where the first row and the first column of the
+stored image belong on the display, so that a camera held sideways can write
+its rows as the sensor reads them.  Values 5 to 8 swap rows and columns, and
+so the width and height of the displayed image.  DecodeRaw leaves pixels in
+the order they are stored unless PipelineOptions.Orient is set; Oriented does
+the same for a RawImage at hand.  Values outside 1 to 8 are treated as 1.
+*/
+
+// Values of the Orientation tag (274), named for where the first row and the
+// first column of the stored image are on the display.
+const (
+	OrientationTopLeft     = 1 // as stored
+	OrientationTopRight    = 2 // mirrored left to right
+	OrientationBottomRight = 3 // turned by 180 degrees
+	OrientationBottomLeft  = 4 // mirrored top to bottom
+	OrientationLeftTop     = 5 // mirrored along the main diagonal
+	OrientationRightTop    = 6 // turned by 90 degrees clockwise to display
+	OrientationRightBottom = 7 // mirrored along the other diagonal
+	OrientationLeftBottom  = 8 // turned by 90 degrees counterclockwise to display
+)
+
+// OrientationOf returns the Orientation of the image described by ifd, as
+// the file gives it, or OrientationTopLeft if it has none.
+func OrientationOf(ifd tiff.IFD) (uint16, error) {
+	var f struct {
+		Orientation *uint16 `tiff:"field,tag=274"`
+	}
+	if err := tiff.UnmarshalIFD(ifd, &f); err != nil {
+		return 0, err
+	}
+	if f.Orientation == nil {
+		return OrientationTopLeft, nil
+	}
+	return *f.Orientation, nil
+}
+
+// Oriented returns img turned and flipped as its Orientation directs, with
+// Orientation 1.  It returns img itself if it needs no change.
+func (img *RawImage) Oriented() *RawImage {
+	// Without an Allocator, oriented can not fail.
+	dst, _ := img.oriented(nil)
+	return dst
+}
+
+// oriented is Oriented, taking the pixels of the result from a and handing
+// those of img back to it.
+func (img *RawImage) oriented(a Allocator) (*RawImage, error) {
+	o := img.Orientation
+	if o <= OrientationTopLeft || o > OrientationLeftBottom {
+		return img, nil
+	}
+	dst := *img
+	dst.Orientation = OrientationTopLeft
+	if o >= OrientationLeftTop {
+		dst.Width, dst.Height = img.Height, img.Width
+	}
+	bpp := img.SamplesPerPixel * img.BitsPerSample
+	dst.Stride = (dst.Width*bpp + 7) / 8
+	var err error
+	if dst.Pix, err = alloc(a, dst.Stride*dst.Height); err != nil {
+		return nil, err
+	}
+	if bpp%8 != 0 {
+		// Sub-byte pixels are set bit by bit, so the bits of
+		// neighbours sharing a byte must start cleared.
+		for i := range dst.Pix {
+			dst.Pix[i] = 0
+		}
+	}
+	w, h := img.Width-1, img.Height-1
+	for y := 0; y < dst.Height; y++ {
+		for x := 0; x < dst.Width; x++ {
+			var sx, sy int
+			switch o {
+			case OrientationTopRight:
+				sx, sy = w-x, y
+			case OrientationBottomRight:
+				sx, sy = w-x, h-y
+			case OrientationBottomLeft:
+				sx, sy = x, h-y
+			case OrientationLeftTop:
+				sx, sy = y, x
+			case OrientationRightTop:
+				sx, sy = y, h-x
+			case OrientationRightBottom:
+				sx, sy = w-y, h-x
+			case OrientationLeftBottom:
+				sx, sy = w-y, x
+			}
+			copyPixel(dst.Pix[y*dst.Stride:], x, img.Pix[sy*img.Stride:], sx, bpp)
+		}
+	}
+	free(a, img.Pix)
+	return &dst, nil
+}
+
+// copyPixel copies pixel sx of the row src to pixel dx of the row dst, for
+// pixels of bpp bits.
+func copyPixel(dst []byte, dx int, src []byte, sx, bpp int) {
+	if bpp%8 == 0 {
+		n := bpp / 8
+		copy(dst[dx*n:dx*n+n], src[sx*n:])
+		return
+	}
+	for i := 0; i < bpp; i++ {
+		s, d := sx*bpp+i, dx*bpp+i
+		if src[s/8]&(0x80>>uint(s%8)) != 0 {
+			dst[d/8] |= 0x80 >> uint(d%8)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package image
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/google/tiff"
+)
+
+// An Overview is a level of a Pyramid.
+type Overview struct {
+	// Path names the IFD of the level, such as "IFD 2" or "IFD 0/330[1]".
+	Path          string
+	IFD           tiff.IFD
+	Width, Height int
+	// Scale is the width of the level over the width of the full
+	// resolution image: 1 for the full resolution image itself, 0.5 for an
+	// overview of half its size.
+	Scale float64
+}
+
+// A Pyramid is a full resolution image along with its reduced resolution
+// overviews, largest first.
+type Pyramid struct {
+	Levels []Overview
+
+	t tiff.TIFF
+}
+
+// OpenPyramid returns the Pyramid of the full resolution image in IFD page of
+// the main IFD chain of t.  Overviews are the reduced resolution IFDs (see
+// tiff.KindOf) that follow it in the chain, as Cloud Optimized GeoTIFFs store
+// them, and those in its SubIFDs (tag 330), as OME-TIFF and DNG files do.
+// Transparency masks are left out.  An image without overviews is a Pyramid
+// of a single level.
+func OpenPyramid(t tiff.TIFF, page int) (*Pyramid, error) {
+	ifds := t.IFDs()
+	if page < 0 || page >= len(ifds) {
+		return nil, fmt.Errorf("tiff/image: IFD %d out of range [0, %d)", page, len(ifds))
+	}
+	if k := tiff.KindOf(ifds[page]); k == tiff.IFDReduced || k == tiff.IFDMask {
+		return nil, fmt.Errorf("tiff/image: IFD %d holds a %s image", page, k)
+	}
+	p := &Pyramid{t: t}
+	add := func(path string, ifd tiff.IFD) error {
+		l, err := LayoutOf(ifd)
+		if err != nil {
+			return fmt.Errorf("tiff/image: %s of pyramid: %v", path, err)
+		}
+		p.Levels = append(p.Levels, Overview{Path: path, IFD: ifd, Width: l.Width, Height: l.Height})
+		return nil
+	}
+	if err := add(fmt.Sprintf("IFD %d", page), ifds[page]); err != nil {
+		return nil, err
+	}
+	for i := page + 1; i < len(ifds); i++ {
+		k := tiff.KindOf(ifds[i])
+		if k == tiff.IFDMask {
+			continue
+		}
+		if k != tiff.IFDReduced {
+			break
+		}
+		if err := add(fmt.Sprintf("IFD %d", i), ifds[i]); err != nil {
+			return nil, err
+		}
+	}
+	subs, err := tiff.ParseSubIFDs(t, ifds[page], tiff.SubIFDsTagID)
+	if err != nil {
+		return nil, err
+	}
+	for j, sub := range subs {
+		if tiff.KindOf(sub) != tiff.IFDReduced {
+			continue
+		}
+		if err = add(fmt.Sprintf("IFD %d/%d[%d]", page, tiff.SubIFDsTagID, j), sub); err != nil {
+			return nil, err
+		}
+	}
+	sort.SliceStable(p.Levels[1:], func(i, j int) bool {
+		return p.Levels[1+i].Width > p.Levels[1+j].Width
+	})
+	for i := range p.Levels {
+		if full := p.Levels[0].Width; full > 0 {
+			p.Levels[i].Scale = float64(p.Levels[i].Width) / float64(full)
+		}
+	}
+	return p, nil
+}
+
+// BestLevel returns the index of the level of p to draw at targetScale (the
+// size wanted over the size of the full resolution image): the smallest level
+// at least as large as targetScale asks for, so that it is only ever scaled
+// down.  Scales above 1 give the full resolution image.
+func (p *Pyramid) BestLevel(targetScale float64) int {
+	best := 0
+	for i, o := range p.Levels {
+		if o.Scale >= targetScale && o.Scale < p.Levels[best].Scale {
+			best = i
+		}
+	}
+	return best
+}
+
+// BestOverview returns the level of p to draw at targetScale (see BestLevel)
+// and a ChunkReader for its strips or tiles.
+func (p *Pyramid) BestOverview(targetScale float64) (Overview, ChunkReader, error) {
+	if targetScale <= 0 {
+		return Overview{}, nil, fmt.Errorf("tiff/image: invalid target scale %g", targetScale)
+	}
+	o := p.Levels[p.BestLevel(targetScale)]
+	cr, err := NewChunkReader(o.IFD, p.t.R())
+	if err != nil {
+		return Overview{}, nil, fmt.Errorf("tiff/image: %s of pyramid: %v", o.Path, err)
+	}
+	return o, cr, nil
+}
+
+// BestLevel returns the index of the level of s to draw at a downsample
+// factor (the size of the first level over the size wanted): the smallest
+// level whose Downsample is at most downsample.
+func (s *Slide) BestLevel(downsample float64) int {
+	best := 0
+	for i, l := range s.Levels {
+		if l.Downsample <= downsample && l.Downsample > s.Levels[best].Downsample {
+			best = i
+		}
+	}
+	return best
+}
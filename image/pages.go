@@ -0,0 +1,96 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package image
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+/* Choosing codecs by content
+
+A scanned document mixes pages that compress in different ways: text pages
+are nearly bilevel and shrink to little, photographs barely shrink with the
+same codec.  TIFF records the Compression of an image in its IFD, once for all
+of its strips or tiles, so a codec can not be chosen tile by tile without
+writing files that readers reject.  It can be chosen image by image: a
+CodecSelector looks at the pixels of each page written by EncodePages (or the
+image written by Encode) and returns the codec to compress it with.
+SmallestCodec is a selector that tries codecs on a sample of tiles (see
+TrialCompressions).
+*/
+
+// A CodecSelector returns the codec to compress img with (see
+// EncodeOptions.SelectCodec).
+type CodecSelector func(img *RawImage) (Compression, error)
+
+// SmallestCodec returns a CodecSelector that compresses sample strips or tiles
+// of each image with the candidates of opts, as TrialCompressions does, and
+// chooses the one whose output is the smallest.  The strip or tile size of
+// opts.Encode should match that of the EncodeOptions it is used with.
+func SmallestCodec(opts *TrialOptions) CodecSelector {
+	return func(img *RawImage) (Compression, error) {
+		trials, err := TrialCompressions(img, opts)
+		if err != nil {
+			return nil, err
+		}
+		if len(trials) == 0 || trials[0].Err != nil {
+			return nil, fmt.Errorf("tiff/image: no candidate codec compressed the image")
+		}
+		return trials[0].Compression, nil
+	}
+}
+
+// EncodePages writes pages to w as a classic TIFF document, each page in its
+// own IFD of the main IFD chain, marked as a page by NewSubfileType and
+// numbered by PageNumber.  Each page is compressed with the codec
+// opts.SelectCodec chooses for it, if set, and laid out in strips or tiles as
+// opts directs otherwise.  Overviews and COG layouts are not supported.  The
+// pages must share their byte order (pages with none are little endian).
+func EncodePages(w io.Writer, pages []*RawImage, opts *EncodeOptions) error {
+	var o EncodeOptions
+	if opts != nil {
+		o = *opts
+	}
+	if len(pages) == 0 || len(pages) > math.MaxUint16 {
+		return fmt.Errorf("tiff/image: can not write %d pages", len(pages))
+	}
+	if o.Overviews != NoOverviews || o.COG {
+		return fmt.Errorf("tiff/image: overviews and cogs of multipage documents are not supported")
+	}
+	if _, err := o.tiling(); err != nil {
+		return err
+	}
+	var bo binary.ByteOrder
+	ims := make([]*encodedImage, len(pages))
+	for i, img := range pages {
+		if err := checkEncodable(img); err != nil {
+			return err
+		}
+		if img.ByteOrder == nil {
+			withOrder := *img
+			withOrder.ByteOrder = binary.LittleEndian
+			img = &withOrder
+		}
+		if i == 0 {
+			bo = img.ByteOrder
+		} else if img.ByteOrder != bo {
+			return fmt.Errorf("tiff/image: page %d is in %v, not %v as page 0", i, img.ByteOrder, bo)
+		}
+		c, err := o.codec(img)
+		if err != nil {
+			return err
+		}
+		im, err := encodeImage(img, c, &o)
+		if err != nil {
+			return err
+		}
+		im.page, im.pages = i, len(pages)
+		ims[i] = im
+	}
+	return writeEncoded(w, bo, ims, fileLayout{})
+}
@@ -0,0 +1,133 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package image
+
+import (
+	"image"
+	"image/color"
+)
+
+/* Perceptual hashes
+
+Both hashes shrink the image to a small grid of average luminance values:
+	aHash: an 8x8 grid.  Bit i is set when cell i is brighter than the
+	       average of all cells.
+	dHash: a 9x8 grid.  Bit i is set when a cell is brighter than the cell
+	       to its right, giving 8 comparisons for each of the 8 rows.
+Images that look alike have hashes that differ in only a few bits (see
+HashDistance).  Since each grid cell is just a sum over the pixels it covers,
+the hashes can be built up one strip or tile at a time as they are decoded,
+without keeping the whole image in memory or decoding it a second time.
+*/
+
+// A PerceptualHasher computes the aHash and dHash of an image from pieces of
+// it (strips, tiles, or the whole image) given in any order.
+type PerceptualHasher struct {
+	width, height int
+	aSum          [64]uint64
+	aCnt          [64]uint64
+	dSum          [72]uint64
+	dCnt          [72]uint64
+}
+
+// NewPerceptualHasher returns a PerceptualHasher for an image of the given
+// size.
+func NewPerceptualHasher(width, height int) *PerceptualHasher {
+	return &PerceptualHasher{width: width, height: height}
+}
+
+// Add adds the pixels of piece to the hash.  The bounds of piece give its
+// position within the full image, so a decoded tile should have the bounds of
+// the area it covers.  Pixels outside of the full image are ignored.
+func (ph *PerceptualHasher) Add(piece image.Image) {
+	if ph.width <= 0 || ph.height <= 0 {
+		return
+	}
+	b := piece.Bounds().Intersect(image.Rect(0, 0, ph.width, ph.height))
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		ay := y * 8 / ph.height
+		for x := b.Min.X; x < b.Max.X; x++ {
+			lum := uint64(color.Gray16Model.Convert(piece.At(x, y)).(color.Gray16).Y)
+			a := ay*8 + x*8/ph.width
+			ph.aSum[a] += lum
+			ph.aCnt[a]++
+			d := ay*9 + x*9/ph.width
+			ph.dSum[d] += lum
+			ph.dCnt[d]++
+		}
+	}
+}
+
+func mean(sum, cnt uint64) uint64 {
+	if cnt == 0 {
+		return 0
+	}
+	return sum / cnt
+}
+
+// AHash returns the average hash of the pixels added so far.
+func (ph *PerceptualHasher) AHash() uint64 {
+	var cells [64]uint64
+	var total uint64
+	for i := range cells {
+		cells[i] = mean(ph.aSum[i], ph.aCnt[i])
+		total += cells[i]
+	}
+	avg := total / 64
+	var h uint64
+	for i, c := range cells {
+		if c > avg {
+			h |= 1 << uint(i)
+		}
+	}
+	return h
+}
+
+// DHash returns the difference hash of the pixels added so far.
+func (ph *PerceptualHasher) DHash() uint64 {
+	var h uint64
+	for row := 0; row < 8; row++ {
+		for col := 0; col < 8; col++ {
+			left := mean(ph.dSum[row*9+col], ph.dCnt[row*9+col])
+			right := mean(ph.dSum[row*9+col+1], ph.dCnt[row*9+col+1])
+			if left > right {
+				h |= 1 << uint(row*8+col)
+			}
+		}
+	}
+	return h
+}
+
+// PerceptualHash returns the aHash and dHash of img.
+func PerceptualHash(img image.Image) (aHash, dHash uint64) {
+	b := img.Bounds()
+	ph := NewPerceptualHasher(b.Dx(), b.Dy())
+	ph.Add(&translated{img, b.Min})
+	return ph.AHash(), ph.DHash()
+}
+
+// translated moves an image so that its bounds start at the origin.
+type translated struct {
+	image.Image
+	min image.Point
+}
+
+func (t *translated) Bounds() image.Rectangle {
+	return t.Image.Bounds().Sub(t.min)
+}
+
+func (t *translated) At(x, y int) color.Color {
+	return t.Image.At(x+t.min.X, y+t.min.Y)
+}
+
+// HashDistance returns the number of bits that differ between two hashes.
+// Hashes of near duplicate images typically differ in fewer than 10 bits.
+func HashDistance(a, b uint64) int {
+	n := 0
+	for x := a ^ b; x != 0; x &= x - 1 {
+		n++
+	}
+	return n
+}
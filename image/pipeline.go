@@ -0,0 +1,698 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package image
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+	"runtime"
+	"sync"
+
+	"github.com/google/tiff"
+)
+
+/* Decode pipeline
+
+Decompressing LZW or Deflate data is CPU bound, so DecodeRaw spreads the
+strips or tiles of an image over a pool of goroutines:
+	1. A single goroutine reads the compressed bytes of each strip or tile in
+	   file order through the tiff.BReader, so any BReader may be used.
+	2. Workers decompress them, each one as soon as it is read.
+	3. The decompressed data is copied to its place in the image, which
+	   workers can do at the same time since no two chunks overlap.
+The result holds the samples of the image as they are stored in the file; it is
+not converted to a color model.
+*/
+
+// A Layout describes how the samples of an image are split into strips or
+// tiles.
+type Layout struct {
+	Width, Height   int
+	SamplesPerPixel int
+	BitsPerSample   int
+	Compression     uint16
+	Photometric     uint16
+	SampleFormat    uint16
+	// Tiled reports whether the image is stored in tiles.  ChunkWidth and
+	// ChunkHeight are the size of a tile, or the width of the image and
+	// RowsPerStrip for strips.
+	Tiled                   bool
+	ChunkWidth, ChunkHeight int
+	// Planar reports whether the samples are stored in separate planes
+	// (PlanarConfiguration 2): the strips or tiles holding the first sample
+	// of each pixel come first, then those holding the second, and so on.
+	Planar bool
+	// Subsampling is the YCbCrSubsampling of a YCbCr image: the width and
+	// height of the blocks of pixels that share their Cb and Cr samples.
+	// The zero value, like (1, 1), means the samples are not subsampled.
+	// Subsampled data is upsampled as it is placed, so that every pixel of
+	// a RawImage holds its own Y, Cb and Cr.
+	Subsampling image.Point
+	// YCbCr is set for YCbCr images, and InkSet for CMYK (separated)
+	// images.
+	YCbCr  *YCbCrParams
+	InkSet uint16
+	// ColorMap is set for palette images: the red of each entry, then the
+	// green of each entry, then the blue, as 16 bit values.
+	ColorMap []uint16
+	// ExtraSamples tells what each sample of a pixel past its color
+	// samples holds (see ExtraSampleAssociatedAlpha).
+	ExtraSamples []uint16
+	// Orientation is the Orientation (tag 274) of the image, 1 if it has
+	// none.  It is left as the file gives it; see OrientationTopLeft.
+	Orientation uint16
+	// Predictor is the Predictor (tag 317) the samples were differenced
+	// with before compression, 1 if none.  It is undone as strips and
+	// tiles are decompressed.
+	Predictor           uint16
+	Offsets, ByteCounts []uint64
+}
+
+// layoutFields are the fields of an IFD that a Layout is made from, other than
+// the offsets and byte counts, which are decoded on their own (see
+// LayoutOfArena).
+type layoutFields struct {
+	ImageWidth          *uint32         `tiff:"field,tag=256"`
+	ImageLength         *uint32         `tiff:"field,tag=257"`
+	BitsPerSample       []uint16        `tiff:"field,tag=258"`
+	Compression         *uint16         `tiff:"field,tag=259"`
+	Photometric         *uint16         `tiff:"field,tag=262"`
+	Orientation         *uint16         `tiff:"field,tag=274"`
+	SamplesPerPixel     *uint16         `tiff:"field,tag=277"`
+	RowsPerStrip        *uint32         `tiff:"field,tag=278"`
+	PlanarConfiguration *uint16         `tiff:"field,tag=284"`
+	Predictor           *uint16         `tiff:"field,tag=317"`
+	TileWidth           *uint32         `tiff:"field,tag=322"`
+	TileLength          *uint32         `tiff:"field,tag=323"`
+	ColorMap            []uint16        `tiff:"field,tag=320"`
+	InkSet              *uint16         `tiff:"field,tag=332"`
+	ExtraSamples        []uint16        `tiff:"field,tag=338"`
+	SampleFormat        []uint16        `tiff:"field,tag=339"`
+	YCbCrCoefficients   []tiff.Rational `tiff:"field,tag=529"`
+	YCbCrSubsampling    []uint16        `tiff:"field,tag=530"`
+	ReferenceBlackWhite []tiff.Rational `tiff:"field,tag=532"`
+}
+
+// LayoutOf returns the Layout of the image described by ifd.  Fields that are
+// missing take their default value from the TIFF specification.
+func LayoutOf(ifd tiff.IFD) (l Layout, err error) {
+	return layoutOf(ifd, true, nil)
+}
+
+// LayoutOfArena is like LayoutOf, but decodes the offsets and byte counts of
+// the strips or tiles into memory from a, which a program going through many
+// pages can Reset and reuse for each of them.  The Layout must not be used
+// once a is Reset.
+func LayoutOfArena(ifd tiff.IFD, a *tiff.OffsetArena) (Layout, error) {
+	return layoutOf(ifd, true, a)
+}
+
+// layoutOf is LayoutOfArena, leaving ByteCounts nil rather than failing if ifd
+// has no byte counts and needCounts is not set.
+func layoutOf(ifd tiff.IFD, needCounts bool, a *tiff.OffsetArena) (l Layout, err error) {
+	var lf layoutFields
+	if err = tiff.UnmarshalIFD(ifd, &lf); err != nil {
+		return
+	}
+	offsets, counts, tiled := uint16(273), uint16(279), ifd.HasField(324)
+	if tiled {
+		offsets, counts = 324, 325
+	}
+	if ifd.HasField(offsets) {
+		if l.Offsets, err = a.Uints(ifd.GetField(offsets)); err != nil {
+			return
+		}
+		// Past 4 GB, NDPI files keep the high bits of the offsets
+		// elsewhere (see tiff.DataOffsets).
+		if l.Offsets, err = tiff.DataOffsets(ifd, l.Offsets); err != nil {
+			return
+		}
+	}
+	if ifd.HasField(counts) {
+		if l.ByteCounts, err = a.Uints(ifd.GetField(counts)); err != nil {
+			return
+		}
+	}
+	if lf.ImageWidth == nil || lf.ImageLength == nil {
+		return l, fmt.Errorf("tiff/image: missing image dimensions")
+	}
+	l.Width, l.Height = int(*lf.ImageWidth), int(*lf.ImageLength)
+	l.SamplesPerPixel, l.BitsPerSample, l.Compression = 1, 1, 1
+	if lf.SamplesPerPixel != nil {
+		l.SamplesPerPixel = int(*lf.SamplesPerPixel)
+	}
+	if len(lf.BitsPerSample) > 0 {
+		l.BitsPerSample = int(lf.BitsPerSample[0])
+		for _, bps := range lf.BitsPerSample[1:] {
+			if int(bps) != l.BitsPerSample {
+				return l, fmt.Errorf("tiff/image: samples of different sizes (%v) are not supported", lf.BitsPerSample)
+			}
+		}
+	}
+	if lf.Compression != nil {
+		l.Compression = *lf.Compression
+	}
+	if lf.Photometric != nil {
+		l.Photometric = *lf.Photometric
+	} else if l.SamplesPerPixel >= 3 {
+		l.Photometric = 2 // RGB
+	} else {
+		l.Photometric = 1 // BlackIsZero
+	}
+	l.Orientation = OrientationTopLeft
+	if lf.Orientation != nil {
+		l.Orientation = *lf.Orientation
+	}
+	l.SampleFormat = SampleFormatUint
+	if len(lf.SampleFormat) > 0 {
+		l.SampleFormat = lf.SampleFormat[0]
+	}
+	if n := l.SamplesPerPixel - colorSamples(l.Photometric); len(lf.ExtraSamples) > 0 && len(lf.ExtraSamples) <= n {
+		l.ExtraSamples = lf.ExtraSamples
+	}
+	if lf.PlanarConfiguration != nil && *lf.PlanarConfiguration != 1 && l.SamplesPerPixel > 1 {
+		if *lf.PlanarConfiguration != 2 {
+			return l, fmt.Errorf("tiff/image: unsupported PlanarConfiguration %d", *lf.PlanarConfiguration)
+		}
+		if l.BitsPerSample%8 != 0 {
+			return l, fmt.Errorf("tiff/image: separate planes of %d bit samples are not supported", l.BitsPerSample)
+		}
+		l.Planar = true
+	}
+	switch l.Photometric {
+	case photometricSeparated:
+		l.InkSet = inkSetCMYK
+		if lf.InkSet != nil {
+			l.InkSet = *lf.InkSet
+		}
+	case photometricPalette:
+		if len(lf.ColorMap) == 0 || len(lf.ColorMap)%3 != 0 {
+			return l, fmt.Errorf("tiff/image: palette image with a ColorMap of %d values", len(lf.ColorMap))
+		}
+		if l.SamplesPerPixel < 1 || l.BitsPerSample > 16 {
+			return l, fmt.Errorf("tiff/image: palette images of %d bit samples are not supported", l.BitsPerSample)
+		}
+		l.ColorMap = lf.ColorMap
+	case photometricYCbCr:
+		if l.YCbCr, err = ycbcrParams(lf.YCbCrCoefficients, lf.ReferenceBlackWhite, l.BitsPerSample); err != nil {
+			return
+		}
+		if l.Subsampling, err = subsampling(lf.YCbCrSubsampling); err != nil {
+			return
+		}
+	}
+	switch {
+	case tiled:
+		if lf.TileWidth == nil || lf.TileLength == nil || *lf.TileWidth == 0 || *lf.TileLength == 0 {
+			return l, fmt.Errorf("tiff/image: missing tile dimensions")
+		}
+		l.Tiled = true
+		l.ChunkWidth, l.ChunkHeight = int(*lf.TileWidth), int(*lf.TileLength)
+	case l.Offsets != nil:
+		l.ChunkWidth, l.ChunkHeight = l.Width, l.Height
+		if lf.RowsPerStrip != nil && *lf.RowsPerStrip > 0 && int64(*lf.RowsPerStrip) < int64(l.Height) {
+			l.ChunkHeight = int(*lf.RowsPerStrip)
+		}
+	default:
+		return l, fmt.Errorf("tiff/image: no strips or tiles found")
+	}
+	if l.Width <= 0 || l.Height <= 0 || l.SamplesPerPixel <= 0 || l.BitsPerSample <= 0 {
+		return l, fmt.Errorf("tiff/image: invalid image layout")
+	}
+	if len(l.ByteCounts) != len(l.Offsets) && (needCounts || l.ByteCounts != nil) {
+		return l, fmt.Errorf("tiff/image: %d offsets but %d byte counts", len(l.Offsets), len(l.ByteCounts))
+	}
+	if l.subsampled() {
+		switch {
+		case l.SamplesPerPixel != 3 || l.BitsPerSample != 8:
+			return l, fmt.Errorf("tiff/image: subsampled YCbCr images need 3 samples of 8 bits, not %d of %d", l.SamplesPerPixel, l.BitsPerSample)
+		case l.Planar:
+			return l, fmt.Errorf("tiff/image: subsampled YCbCr samples in separate planes are not supported")
+		case !l.Tiled && l.ChunkHeight < l.Height && l.ChunkHeight%l.Subsampling.Y != 0:
+			return l, fmt.Errorf("tiff/image: RowsPerStrip %d is not a multiple of the vertical subsampling %d", l.ChunkHeight, l.Subsampling.Y)
+		}
+	}
+	l.Predictor = predictorNone
+	if lf.Predictor != nil {
+		l.Predictor = *lf.Predictor
+	}
+	switch l.Predictor {
+	case predictorNone:
+	case predictorHorizontal, predictorFloat:
+		bps := l.BitsPerSample
+		ok := bps%8 == 0 && !l.subsampled()
+		if l.Predictor == predictorHorizontal {
+			ok = ok && (bps == 8 || bps == 16 || bps == 32 || bps == 64)
+		}
+		if !ok {
+			return l, fmt.Errorf("tiff/image: Predictor %d with %d bit samples is not supported", l.Predictor, bps)
+		}
+	default:
+		return l, fmt.Errorf("tiff/image: unsupported Predictor %d", l.Predictor)
+	}
+	if n := l.NumChunks(); len(l.Offsets) < n {
+		return l, fmt.Errorf("tiff/image: %d strips or tiles found, but %d are needed", len(l.Offsets), n)
+	}
+	return l, nil
+}
+
+// Values of the Predictor tag.
+const (
+	predictorNone       = 1
+	predictorHorizontal = 2 // horizontal differencing
+	predictorFloat      = 3 // floating point horizontal differencing
+)
+
+// unpredict undoes the Predictor of l in place on data, the decompressed data
+// of chunk i, whose samples are in byte order bo.
+func (l Layout) unpredict(i int, data []byte, bo binary.ByteOrder) {
+	if l.Predictor != predictorHorizontal && l.Predictor != predictorFloat {
+		return
+	}
+	row := l.chunkRowBytes(l.ChunkWidth)
+	spp := l.SamplesPerPixel
+	if l.Planar {
+		spp = 1
+	}
+	size := l.BitsPerSample / 8
+	var tmp []byte
+	if l.Predictor == predictorFloat {
+		tmp = make([]byte, row)
+	}
+	for off := 0; off+row <= l.chunkSize(i) && off+row <= len(data); off += row {
+		r := data[off : off+row]
+		if l.Predictor == predictorFloat {
+			unpredictFloat(r, tmp, spp, size, bo)
+			continue
+		}
+		for j := spp * size; j < len(r); j += size {
+			p := r[j-spp*size:]
+			switch size {
+			case 1:
+				r[j] += p[0]
+			case 2:
+				bo.PutUint16(r[j:], bo.Uint16(r[j:])+bo.Uint16(p))
+			case 4:
+				bo.PutUint32(r[j:], bo.Uint32(r[j:])+bo.Uint32(p))
+			case 8:
+				bo.PutUint64(r[j:], bo.Uint64(r[j:])+bo.Uint64(p))
+			}
+		}
+	}
+}
+
+// unpredictFloat undoes floating point differencing on the row r of samples of
+// size bytes, spp to a pixel, using tmp, which is as long as r.  The encoder
+// splits the bytes of the row into planes, from the most significant byte of
+// each sample to the least, and differences them byte by byte.  The samples
+// are put back in byte order bo.
+func unpredictFloat(r, tmp []byte, spp, size int, bo binary.ByteOrder) {
+	for j := spp; j < len(r); j++ {
+		r[j] += r[j-spp]
+	}
+	copy(tmp, r)
+	n := len(r) / size
+	big := bo.Uint16([]byte{0, 1}) == 1
+	for k := 0; k < n; k++ {
+		for b := 0; b < size; b++ {
+			if big {
+				r[k*size+b] = tmp[b*n+k]
+			} else {
+				r[k*size+size-1-b] = tmp[b*n+k]
+			}
+		}
+	}
+}
+
+// maxExpansion and chunkSlack bound the byte count of a strip or tile: no
+// codec makes data more than maxExpansion times larger, plus chunkSlack bytes
+// for headers and tables.  A larger count is damage, and is rejected before a
+// buffer of its size is allocated.
+const (
+	maxExpansion = 4
+	chunkSlack   = 64 << 10
+)
+
+// checkChunk checks the offset and byte count of chunk i of a file of size
+// bytes (-1 if unknown) before its compressed bytes are read.
+func (l Layout) checkChunk(i int, size int64) error {
+	off, n := l.Offsets[i], l.ByteCounts[i]
+	if max := uint64(l.chunkSize(i))*maxExpansion + chunkSlack; n > max {
+		return fmt.Errorf("tiff/image: strip or tile %d has a byte count of %d, but holds %d bytes decompressed", i, n, l.chunkSize(i))
+	}
+	if size >= 0 && (off > uint64(size) || n > uint64(size)-off) {
+		return fmt.Errorf("tiff/image: strip or tile %d (%d bytes at offset %d) ends past the %d bytes of the file", i, n, off, size)
+	}
+	return nil
+}
+
+// across returns the number of chunks in each row of chunks.
+func (l Layout) across() int {
+	return (l.Width + l.ChunkWidth - 1) / l.ChunkWidth
+}
+
+// perPlane returns the number of strips or tiles needed to cover the image
+// once.
+func (l Layout) perPlane() int {
+	return l.across() * ((l.Height + l.ChunkHeight - 1) / l.ChunkHeight)
+}
+
+// NumChunks returns the number of strips or tiles needed to cover the image:
+// once for each sample if the samples are in separate planes.
+func (l Layout) NumChunks() int {
+	if l.Planar {
+		return l.perPlane() * l.SamplesPerPixel
+	}
+	return l.perPlane()
+}
+
+// ChunkBounds returns the area of the image covered by chunk i.  For tiles at
+// the right and bottom edges, the area extends past the image.
+func (l Layout) ChunkBounds(i int) image.Rectangle {
+	i %= l.perPlane()
+	x, y := i%l.across()*l.ChunkWidth, i/l.across()*l.ChunkHeight
+	return image.Rect(x, y, x+l.ChunkWidth, y+l.ChunkHeight)
+}
+
+// ChunkPlane returns the sample that chunk i holds when the samples are in
+// separate planes, and 0 otherwise.
+func (l Layout) ChunkPlane(i int) int {
+	if !l.Planar {
+		return 0
+	}
+	return i / l.perPlane()
+}
+
+// rowBytes returns the number of bytes in a row of n pixels.
+func (l Layout) rowBytes(n int) int {
+	return (n*l.SamplesPerPixel*l.BitsPerSample + 7) / 8
+}
+
+// chunkRowBytes returns the number of bytes in a row of n pixels of a chunk,
+// which holds a single sample of each pixel if the samples are in separate
+// planes.
+func (l Layout) chunkRowBytes(n int) int {
+	if l.Planar {
+		return (n*l.BitsPerSample + 7) / 8
+	}
+	return l.rowBytes(n)
+}
+
+// subsampled reports whether the Cb and Cr samples of l are subsampled.
+func (l Layout) subsampled() bool {
+	return l.Subsampling.X > 1 || l.Subsampling.Y > 1
+}
+
+// unitRowBytes returns the number of bytes in a row of the data units of a
+// subsampled chunk.  Each data unit holds the Y samples of a block of
+// Subsampling pixels, row by row, followed by their Cb and Cr.
+func (l Layout) unitRowBytes() int {
+	s := l.Subsampling
+	return (l.ChunkWidth + s.X - 1) / s.X * (s.X*s.Y + 2)
+}
+
+// chunkSize returns the number of bytes chunk i holds once decompressed.
+func (l Layout) chunkSize(i int) int {
+	rows := l.ChunkHeight
+	if r := l.ChunkBounds(i); !l.Tiled && r.Max.Y > l.Height {
+		rows = l.Height - r.Min.Y
+	}
+	return l.rowsSize(rows)
+}
+
+// fullChunkSize returns the size in bytes of a strip or tile of l that is not
+// cut short by the bottom of the image.
+func (l Layout) fullChunkSize() int {
+	return l.rowsSize(l.ChunkHeight)
+}
+
+// rowsSize returns the size in bytes of rows rows of a strip or tile of l.
+func (l Layout) rowsSize(rows int) int {
+	if s := l.Subsampling; l.subsampled() {
+		return l.unitRowBytes() * ((rows + s.Y - 1) / s.Y)
+	}
+	return l.chunkRowBytes(l.ChunkWidth) * rows
+}
+
+// A RawImage holds the samples of an image as they are stored in the file.
+// Pixels are packed in rows of Stride bytes, each pixel holding
+// SamplesPerPixel samples of BitsPerSample bits.  Samples of more than 8 bits
+// are in ByteOrder.  Photometric is the PhotometricInterpretation of the
+// image and SampleFormat its SampleFormat.  YCbCr, InkSet, ColorMap and
+// ExtraSamples are as in Layout.
+type RawImage struct {
+	Width, Height   int
+	SamplesPerPixel int
+	BitsPerSample   int
+	Photometric     uint16
+	SampleFormat    uint16
+	YCbCr           *YCbCrParams
+	InkSet          uint16
+	ColorMap        []uint16
+	ExtraSamples    []uint16
+	Orientation     uint16
+	ByteOrder       binary.ByteOrder
+	Stride          int
+	Pix             []byte
+}
+
+// newRawImage returns a blank RawImage for the chunks of l, with samples in
+// byte order bo and pixels taken from a (see Allocator).
+func (l Layout) newRawImage(bo binary.ByteOrder, a Allocator) (*RawImage, error) {
+	img := &RawImage{
+		Width:           l.Width,
+		Height:          l.Height,
+		SamplesPerPixel: l.SamplesPerPixel,
+		BitsPerSample:   l.BitsPerSample,
+		Photometric:     l.Photometric,
+		SampleFormat:    l.SampleFormat,
+		YCbCr:           l.YCbCr,
+		InkSet:          l.InkSet,
+		ColorMap:        l.ColorMap,
+		ExtraSamples:    l.ExtraSamples,
+		Orientation:     l.Orientation,
+		ByteOrder:       bo,
+		Stride:          l.rowBytes(l.Width),
+	}
+	var err error
+	if img.Pix, err = alloc(a, img.Stride*img.Height); err != nil {
+		return nil, err
+	}
+	return img, nil
+}
+
+// PipelineOptions controls DecodeRaw.
+type PipelineOptions struct {
+	// Workers is the number of goroutines that decompress strips or tiles.
+	// Zero means runtime.GOMAXPROCS(0).
+	Workers int
+	// Limiter, if not nil, is acquired for the compressed and decompressed
+	// size of each strip or tile while it is decompressed (see
+	// DecompressLimited).
+	Limiter Limiter
+	// Allocator, if not nil, provides the pixels of the RawImage and the
+	// buffers that the compressed strips or tiles are read into.
+	Allocator Allocator
+	// Orient turns and flips the image as its Orientation directs, so that
+	// its first pixel is at the top left of the display.  The RawImage then
+	// has Orientation 1.  Without it, pixels are in the order they are
+	// stored and Orientation tells how to show them (see Oriented).
+	Orient bool
+}
+
+// DecodeRaw decompresses the strips or tiles of the image described by ifd,
+// read through br, and assembles them into a RawImage.  A nil opts uses the
+// defaults described by PipelineOptions.  Decoding stops at the first error,
+// including the context of br being done (see tiff.CheckContext).
+func DecodeRaw(ifd tiff.IFD, br tiff.BReader, opts *PipelineOptions) (*RawImage, error) {
+	l, err := LayoutOf(ifd)
+	if err != nil {
+		return nil, err
+	}
+	c := GetCompression(l.Compression)
+	if c == nil {
+		return nil, CompressionNotSupported{l.Compression}
+	}
+	var o PipelineOptions
+	if opts != nil {
+		o = *opts
+	}
+	if o.Workers <= 0 {
+		o.Workers = runtime.GOMAXPROCS(0)
+	}
+	size, err := tiff.FileSize(br)
+	if err != nil {
+		size = -1
+	}
+	img, err := l.newRawImage(br.ByteOrder(), o.Allocator)
+	if err != nil {
+		return nil, err
+	}
+
+	type job struct {
+		i  int
+		in []byte
+	}
+	var (
+		jobs     = make(chan job)
+		done     = make(chan struct{})
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	fail := func(err error) {
+		errOnce.Do(func() {
+			firstErr = err
+			close(done)
+		})
+	}
+	for w := 0; w < o.Workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				var out []byte
+				cc, err := forChunk(c, ifd, l, j.i)
+				switch {
+				case err != nil:
+				case o.Limiter != nil:
+					out, err = DecompressLimited(tiff.ContextOf(br), o.Limiter, cc, j.in, int64(l.chunkSize(j.i)))
+				default:
+					out, err = cc.Decompress(j.in)
+				}
+				if err == nil {
+					l.unpredict(j.i, out, img.ByteOrder)
+					err = l.place(img, j.i, out)
+				}
+				free(o.Allocator, j.in)
+				if err != nil {
+					fail(err)
+				}
+			}
+		}()
+	}
+
+read:
+	for i, n := 0, l.NumChunks(); i < n; i++ {
+		if err := tiff.CheckContext(br); err != nil {
+			fail(err)
+			break
+		}
+		in, err := l.readChunk(br, i, size, o.Allocator)
+		if err != nil {
+			fail(err)
+			break
+		}
+		select {
+		case jobs <- job{i, in}:
+		case <-done:
+			free(o.Allocator, in)
+			break read
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	if firstErr != nil {
+		free(o.Allocator, img.Pix)
+		return nil, firstErr
+	}
+	if o.Orient {
+		return img.oriented(o.Allocator)
+	}
+	return img, nil
+}
+
+// readChunk returns the compressed bytes of chunk i, read from a file of size
+// bytes (-1 if unknown) into a buffer taken from a (see Allocator).
+func (l Layout) readChunk(br tiff.BReader, i int, size int64, a Allocator) ([]byte, error) {
+	if err := l.checkChunk(i, size); err != nil {
+		return nil, err
+	}
+	in, err := alloc(a, int(l.ByteCounts[i]))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := br.ReadAt(in, int64(l.Offsets[i])); err != nil {
+		free(a, in)
+		return nil, fmt.Errorf("tiff/image: unable to read strip or tile %d: %v", i, err)
+	}
+	return in, nil
+}
+
+// place copies the decompressed data of chunk i to its place in img.  Parts of
+// tiles that lie outside of the image are dropped.  The samples of a chunk of
+// a separate plane are interleaved with those of the other planes, and
+// subsampled chunks are upsampled.
+func (l Layout) place(img *RawImage, i int, data []byte) error {
+	if want := l.chunkSize(i); len(data) < want {
+		return fmt.Errorf("tiff/image: strip or tile %d holds %d bytes, but %d are needed", i, len(data), want)
+	}
+	r := l.ChunkBounds(i)
+	if l.Planar {
+		l.placePlane(img, r, l.ChunkPlane(i), data)
+		return nil
+	}
+	if l.subsampled() {
+		l.placeUnits(img, r, data)
+		return nil
+	}
+	src := l.rowBytes(l.ChunkWidth)
+	x0 := l.rowBytes(r.Min.X)
+	n := src
+	if r.Max.X > l.Width {
+		n = l.rowBytes(l.Width) - x0
+	}
+	for y := r.Min.Y; y < r.Max.Y && y < l.Height; y++ {
+		off := y*img.Stride + x0
+		copy(img.Pix[off:off+n], data[(y-r.Min.Y)*src:])
+	}
+	return nil
+}
+
+// placePlane copies the samples of plane p held by data, covering r, to their
+// place in the pixels of img.  Samples are whole bytes (see layoutOf).
+func (l Layout) placePlane(img *RawImage, r image.Rectangle, p int, data []byte) {
+	size := l.BitsPerSample / 8
+	pixel := size * l.SamplesPerPixel
+	src := l.chunkRowBytes(l.ChunkWidth)
+	x1 := r.Max.X
+	if x1 > l.Width {
+		x1 = l.Width
+	}
+	for y := r.Min.Y; y < r.Max.Y && y < l.Height; y++ {
+		row := data[(y-r.Min.Y)*src:]
+		dst := img.Pix[y*img.Stride+r.Min.X*pixel+p*size:]
+		for x := 0; x < x1-r.Min.X; x++ {
+			copy(dst[x*pixel:x*pixel+size], row[x*size:])
+		}
+	}
+}
+
+// placeUnits copies the YCbCr data units held by data, covering r, to their
+// place in img, giving each pixel of a unit its Cb and Cr.
+func (l Layout) placeUnits(img *RawImage, r image.Rectangle, data []byte) {
+	s := l.Subsampling
+	size := s.X*s.Y + 2
+	src := l.unitRowBytes()
+	y1 := r.Max.Y
+	if y1 > l.Height {
+		y1 = l.Height
+	}
+	for uy := 0; r.Min.Y+uy*s.Y < y1; uy++ {
+		row := data[uy*src:]
+		for ux := 0; ux*s.X < l.ChunkWidth && r.Min.X+ux*s.X < l.Width; ux++ {
+			unit := row[ux*size:]
+			cb, cr := unit[s.X*s.Y], unit[s.X*s.Y+1]
+			for j := 0; j < s.Y && r.Min.Y+uy*s.Y+j < y1; j++ {
+				y := r.Min.Y + uy*s.Y + j
+				for i := 0; i < s.X && r.Min.X+ux*s.X+i < l.Width; i++ {
+					p := img.Pix[y*img.Stride+3*(r.Min.X+ux*s.X+i):]
+					p[0], p[1], p[2] = unit[j*s.X+i], cb, cr
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,216 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package image
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+)
+
+// PreviewOptions controls Preview.
+type PreviewOptions struct {
+	// Low and High are the percentiles of the sample values that become 0
+	// and 255.  Values outside of them are clipped.  Zero for both means
+	// 0.5 and 99.5.
+	Low, High float64
+	// Linked stretches all bands with the same range, taken from the
+	// samples of every band, which keeps the color balance of RGB images.
+	// Otherwise each band is stretched on its own.
+	Linked bool
+	// Bands, if not empty, holds a BandOptions for each band to show, in
+	// sample order, which selects up to SamplesPerPixel bands even if the
+	// image is not RGB.  This is how the channels of microscopy images are
+	// usually viewed: each through its own color table, added together.
+	Bands []BandOptions
+}
+
+// BandOptions controls how Preview shows one band of an image once its
+// contrast is stretched.
+type BandOptions struct {
+	// Gamma is applied to the stretched values scaled to [0, 1], as
+	// v^(1/Gamma), so values above 1 brighten the middle tones.  Zero means
+	// 1.
+	Gamma float64
+	// LUT maps the 256 levels of the band to colors.  The colors of all
+	// bands are added together.  A nil LUT is a ramp from black to red,
+	// green or blue for the first three bands of RGB or multi-band images,
+	// and to white otherwise.
+	LUT *[256]color.RGBA
+}
+
+// histogramBins is the number of bins used to find percentiles.
+const histogramBins = 1 << 16
+
+// Preview returns an 8 bit rendering of img, stretching the contrast so that
+// the range between two percentiles of its sample values covers the whole
+// output range.  Scientific data (16 bit, 32 bit, or floating point samples)
+// often only uses a small part of its possible range and would otherwise
+// render as a black rectangle.  NaN and infinite samples become 0.  Images with
+// 3 or more samples per pixel and a PhotometricInterpretation of RGB, and all
+// images previewed with Bands, give an *image.RGBA; all others give an
+// *image.Gray of their first sample.
+func Preview(img *RawImage, opts *PreviewOptions) (image.Image, error) {
+	o := PreviewOptions{Low: 0.5, High: 99.5}
+	if opts != nil && (opts.Low != 0 || opts.High != 0) {
+		o.Low, o.High = opts.Low, opts.High
+	}
+	if opts != nil {
+		o.Linked, o.Bands = opts.Linked, opts.Bands
+	}
+	if !(0 <= o.Low && o.Low < o.High && o.High <= 100) {
+		return nil, fmt.Errorf("tiff/image: invalid percentiles %g and %g", o.Low, o.High)
+	}
+	if _, ok := img.value(0, 0, 0); !ok || img.Width == 0 || img.Height == 0 {
+		return nil, fmt.Errorf("tiff/image: unable to preview %d bit samples of format %d", img.BitsPerSample, img.SampleFormat)
+	}
+	bands := 1
+	switch {
+	case len(o.Bands) > 0:
+		bands = len(o.Bands)
+		if bands > img.SamplesPerPixel {
+			bands = img.SamplesPerPixel
+		}
+	case img.Photometric == photometricRGB && img.SamplesPerPixel >= 3:
+		bands = 3
+	}
+	gammas := make([]float64, bands)
+	luts := make([]*[256]color.RGBA, bands)
+	for b := range luts {
+		gammas[b] = 1
+		if b < len(o.Bands) {
+			g := o.Bands[b].Gamma
+			if g < 0 || math.IsNaN(g) || math.IsInf(g, 0) {
+				return nil, fmt.Errorf("tiff/image: invalid gamma %g for band %d", g, b)
+			}
+			if g > 0 {
+				gammas[b] = g
+			}
+			luts[b] = o.Bands[b].LUT
+		}
+		if luts[b] == nil {
+			luts[b] = rampLUT(b, bands)
+		}
+	}
+
+	ranges := make([][2]float64, bands)
+	if o.Linked {
+		lo, hi := img.percentiles(0, bands, o.Low, o.High)
+		for b := range ranges {
+			ranges[b] = [2]float64{lo, hi}
+		}
+	} else {
+		for b := range ranges {
+			ranges[b][0], ranges[b][1] = img.percentiles(b, b+1, o.Low, o.High)
+		}
+	}
+	stretch := func(x, y, b int) uint8 {
+		v, _ := img.value(x, y, b)
+		lo, hi := ranges[b][0], ranges[b][1]
+		switch {
+		case math.IsNaN(v) || math.IsInf(v, 0) || v <= lo:
+			return 0
+		case v >= hi:
+			return 0xFF
+		}
+		t := (v - lo) / (hi - lo)
+		if gammas[b] != 1 {
+			t = math.Pow(t, 1/gammas[b])
+		}
+		return uint8(t*0xFF + 0.5)
+	}
+
+	r := image.Rect(0, 0, img.Width, img.Height)
+	if bands == 1 && len(o.Bands) == 0 {
+		out := image.NewGray(r)
+		for y := 0; y < img.Height; y++ {
+			for x := 0; x < img.Width; x++ {
+				out.Pix[y*out.Stride+x] = stretch(x, y, 0)
+			}
+		}
+		return out, nil
+	}
+	out := image.NewRGBA(r)
+	for y := 0; y < img.Height; y++ {
+		for x := 0; x < img.Width; x++ {
+			var sum [3]int
+			for b, lut := range luts {
+				c := lut[stretch(x, y, b)]
+				sum[0], sum[1], sum[2] = sum[0]+int(c.R), sum[1]+int(c.G), sum[2]+int(c.B)
+			}
+			p := out.Pix[y*out.Stride+4*x:]
+			p[0], p[1], p[2], p[3] = clamp8(sum[0]), clamp8(sum[1]), clamp8(sum[2]), 0xFF
+		}
+	}
+	return out, nil
+}
+
+// rampLUT returns the color table used for band b of an image shown with
+// bands bands when none is given.
+func rampLUT(b, bands int) *[256]color.RGBA {
+	if bands == 1 || b >= 3 {
+		return ColorLUT(color.RGBA{0xFF, 0xFF, 0xFF, 0xFF})
+	}
+	return ColorLUT(defaultChannelColors[b])
+}
+
+func clamp8(v int) uint8 {
+	if v > 0xFF {
+		return 0xFF
+	}
+	return uint8(v)
+}
+
+// percentiles returns the values below which low and high percent of the
+// finite values of samples [b0, b1) of img fall.  They are found from a
+// histogram spanning the range of the values, so they are approximate when the
+// values are spread over more than histogramBins distinct values.
+func (img *RawImage) percentiles(b0, b1 int, low, high float64) (lo, hi float64) {
+	each := func(fn func(v float64)) {
+		for y := 0; y < img.Height; y++ {
+			for x := 0; x < img.Width; x++ {
+				for b := b0; b < b1; b++ {
+					if v, _ := img.value(x, y, b); !math.IsNaN(v) && !math.IsInf(v, 0) {
+						fn(v)
+					}
+				}
+			}
+		}
+	}
+	min, max := math.Inf(1), math.Inf(-1)
+	each(func(v float64) {
+		min, max = math.Min(min, v), math.Max(max, v)
+	})
+	if min >= max {
+		// A single value (or none): map it to black.
+		if math.IsInf(min, 0) {
+			return 0, 1
+		}
+		return min, min + 1
+	}
+	hist := make([]uint64, histogramBins)
+	scale := float64(histogramBins-1) / (max - min)
+	var n uint64
+	each(func(v float64) {
+		hist[int((v-min)*scale)]++
+		n++
+	})
+	find := func(pct float64) float64 {
+		want := uint64(pct / 100 * float64(n))
+		var sum uint64
+		for i, c := range hist {
+			if sum += c; sum > want {
+				return min + float64(i)/scale
+			}
+		}
+		return max
+	}
+	lo, hi = find(low), find(high)
+	if hi <= lo {
+		hi = lo + 1/scale
+	}
+	return lo, hi
+}
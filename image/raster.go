@@ -0,0 +1,229 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package image
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/google/tiff"
+)
+
+// A Raster holds the samples of an image decoded into a slice of the Go type
+// that matches their SampleFormat and BitsPerSample, for elevation models and
+// scientific data that image.Image can not represent.  Samples are in the
+// order they are stored: pixel by pixel, row by row, with SamplesPerPixel
+// samples per pixel, so that sample s of the pixel at (x, y) is at index
+// (y*Width+x)*SamplesPerPixel+s.
+type Raster struct {
+	Width, Height   int
+	SamplesPerPixel int
+	// Data is, for unsigned samples, a []uint8 (for samples of 1 to 8
+	// bits), []uint16, []uint32 or []uint64; for signed samples, an
+	// []int8, []int16, []int32 or []int64; and for floating point samples,
+	// a []float32 (for 16 or 32 bit samples) or []float64.
+	Data interface{}
+}
+
+// DecodeRaster decodes the image described by ifd, read through br, into a
+// Raster (see DecodeRaw).
+func DecodeRaster(ifd tiff.IFD, br tiff.BReader, opts *PipelineOptions) (*Raster, error) {
+	img, err := DecodeRaw(ifd, br, opts)
+	if err != nil {
+		return nil, err
+	}
+	return img.Raster()
+}
+
+// Raster returns the samples of img decoded into a Raster, honoring its
+// SampleFormat, BitsPerSample and ByteOrder.
+func (img *RawImage) Raster() (*Raster, error) {
+	r := &Raster{Width: img.Width, Height: img.Height, SamplesPerPixel: img.SamplesPerPixel}
+	n := img.Width * img.SamplesPerPixel
+	bo := img.ByteOrder
+	bps := img.BitsPerSample
+	format := img.SampleFormat
+	if format == 0 {
+		format = SampleFormatUint
+	}
+	unsupported := fmt.Errorf("tiff/image: %d bit samples of SampleFormat %d are not supported", bps, format)
+	// rows calls f with each row of img and the index of its first sample.
+	rows := func(f func(p []byte, i int)) {
+		for y := 0; y < img.Height; y++ {
+			f(img.Pix[y*img.Stride:], y*n)
+		}
+	}
+	total := n * img.Height
+	switch format {
+	case SampleFormatUint:
+		switch bps {
+		case 1, 2, 4, 8:
+			d := make([]uint8, total)
+			rows(func(p []byte, i int) {
+				if bps == 8 {
+					copy(d[i:i+n], p)
+					return
+				}
+				for j := 0; j < n; j++ {
+					bit := j * bps
+					d[i+j] = p[bit/8] >> uint(8-bps-bit%8) & (1<<uint(bps) - 1)
+				}
+			})
+			r.Data = d
+		case 16:
+			d := make([]uint16, total)
+			rows(func(p []byte, i int) {
+				for j := 0; j < n; j++ {
+					d[i+j] = bo.Uint16(p[2*j:])
+				}
+			})
+			r.Data = d
+		case 32:
+			d := make([]uint32, total)
+			rows(func(p []byte, i int) {
+				for j := 0; j < n; j++ {
+					d[i+j] = bo.Uint32(p[4*j:])
+				}
+			})
+			r.Data = d
+		case 64:
+			d := make([]uint64, total)
+			rows(func(p []byte, i int) {
+				for j := 0; j < n; j++ {
+					d[i+j] = bo.Uint64(p[8*j:])
+				}
+			})
+			r.Data = d
+		default:
+			return nil, unsupported
+		}
+	case SampleFormatInt:
+		switch bps {
+		case 8:
+			d := make([]int8, total)
+			rows(func(p []byte, i int) {
+				for j := 0; j < n; j++ {
+					d[i+j] = int8(p[j])
+				}
+			})
+			r.Data = d
+		case 16:
+			d := make([]int16, total)
+			rows(func(p []byte, i int) {
+				for j := 0; j < n; j++ {
+					d[i+j] = int16(bo.Uint16(p[2*j:]))
+				}
+			})
+			r.Data = d
+		case 32:
+			d := make([]int32, total)
+			rows(func(p []byte, i int) {
+				for j := 0; j < n; j++ {
+					d[i+j] = int32(bo.Uint32(p[4*j:]))
+				}
+			})
+			r.Data = d
+		case 64:
+			d := make([]int64, total)
+			rows(func(p []byte, i int) {
+				for j := 0; j < n; j++ {
+					d[i+j] = int64(bo.Uint64(p[8*j:]))
+				}
+			})
+			r.Data = d
+		default:
+			return nil, unsupported
+		}
+	case SampleFormatFloat:
+		switch bps {
+		case 16, 32:
+			d := make([]float32, total)
+			rows(func(p []byte, i int) {
+				for j := 0; j < n; j++ {
+					if bps == 16 {
+						d[i+j] = halfToFloat32(bo.Uint16(p[2*j:]))
+					} else {
+						d[i+j] = math.Float32frombits(bo.Uint32(p[4*j:]))
+					}
+				}
+			})
+			r.Data = d
+		case 64:
+			d := make([]float64, total)
+			rows(func(p []byte, i int) {
+				for j := 0; j < n; j++ {
+					d[i+j] = math.Float64frombits(bo.Uint64(p[8*j:]))
+				}
+			})
+			r.Data = d
+		default:
+			return nil, unsupported
+		}
+	default:
+		return nil, unsupported
+	}
+	return r, nil
+}
+
+// At returns sample s of the pixel at (x, y) as a float64.  Integers past
+// 2^53 lose precision.
+func (r *Raster) At(x, y, s int) float64 {
+	i := (y*r.Width+x)*r.SamplesPerPixel + s
+	switch d := r.Data.(type) {
+	case []uint8:
+		return float64(d[i])
+	case []uint16:
+		return float64(d[i])
+	case []uint32:
+		return float64(d[i])
+	case []uint64:
+		return float64(d[i])
+	case []int8:
+		return float64(d[i])
+	case []int16:
+		return float64(d[i])
+	case []int32:
+		return float64(d[i])
+	case []int64:
+		return float64(d[i])
+	case []float32:
+		return float64(d[i])
+	case []float64:
+		return d[i]
+	}
+	panic(fmt.Sprintf("tiff/image: Raster holds a %T", r.Data))
+}
+
+// Float64s returns the samples of r converted to float64, for code that
+// handles every SampleFormat the same way.
+func (r *Raster) Float64s() []float64 {
+	out := make([]float64, r.Width*r.Height*r.SamplesPerPixel)
+	for i := range out {
+		out[i] = r.At(i/r.SamplesPerPixel%r.Width, i/r.SamplesPerPixel/r.Width, i%r.SamplesPerPixel)
+	}
+	return out
+}
+
+// halfToFloat32 returns the value of the IEEE 754 half precision number h.
+func halfToFloat32(h uint16) float32 {
+	sign := uint32(h>>15) << 31
+	exp := uint32(h>>10) & 0x1F
+	frac := uint32(h) & 0x3FF
+	switch {
+	case exp == 0x1F: // infinity or NaN
+		return math.Float32frombits(sign | 0xFF<<23 | frac<<13)
+	case exp == 0 && frac == 0:
+		return math.Float32frombits(sign)
+	case exp == 0: // subnormal: normalize it
+		exp = 127 - 15 + 1
+		for frac&0x400 == 0 {
+			frac <<= 1
+			exp--
+		}
+		frac &= 0x3FF
+		return math.Float32frombits(sign | exp<<23 | frac<<13)
+	}
+	return math.Float32frombits(sign | (exp+127-15)<<23 | frac<<13)
+}
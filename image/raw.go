@@ -0,0 +1,267 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package image
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+)
+
+// Values of the PhotometricInterpretation tag (262).
+const (
+	photometricWhiteIsZero = 0
+	photometricBlackIsZero = 1
+	photometricRGB         = 2
+	photometricPalette     = 3
+	photometricSeparated   = 5
+	photometricYCbCr       = 6
+)
+
+// Values of the SampleFormat tag (339).
+const (
+	SampleFormatUint  = 1
+	SampleFormatInt   = 2
+	SampleFormatFloat = 3
+)
+
+// Values of the ExtraSamples tag (338), which tell what each sample past the
+// color samples of a pixel holds.  Associated alpha is premultiplied: the color
+// samples have already been multiplied by it.
+const (
+	ExtraSampleUnspecified       = 0
+	ExtraSampleAssociatedAlpha   = 1
+	ExtraSampleUnassociatedAlpha = 2
+)
+
+// colorSamples returns the number of color samples in each pixel of an image
+// with PhotometricInterpretation photometric.
+func colorSamples(photometric uint16) int {
+	switch photometric {
+	case photometricRGB, photometricYCbCr:
+		return 3
+	case photometricSeparated:
+		return 4
+	}
+	return 1
+}
+
+// alpha returns the sample of each pixel of img that holds its alpha, and
+// whether the alpha is associated, or -1 if img has no alpha (see
+// ExtraSamples).
+func (img *RawImage) alpha() (s int, associated bool) {
+	n := colorSamples(img.Photometric)
+	for i, v := range img.ExtraSamples {
+		if (v == ExtraSampleAssociatedAlpha || v == ExtraSampleUnassociatedAlpha) && n+i < img.SamplesPerPixel {
+			return n + i, v == ExtraSampleAssociatedAlpha
+		}
+	}
+	return -1, false
+}
+
+// value returns sample s of the pixel at (x, y) as it is stored, whatever its
+// SampleFormat.  ok is false for sizes of samples that are not supported.
+func (img *RawImage) value(x, y, s int) (v float64, ok bool) {
+	bps := img.BitsPerSample
+	bit := (x*img.SamplesPerPixel + s) * bps
+	p := img.Pix[y*img.Stride+bit/8:]
+	bo := img.ByteOrder
+	switch img.SampleFormat {
+	case SampleFormatFloat:
+		switch bps {
+		case 32:
+			return float64(math.Float32frombits(bo.Uint32(p))), true
+		case 64:
+			return math.Float64frombits(bo.Uint64(p)), true
+		}
+	case SampleFormatInt:
+		switch bps {
+		case 8:
+			return float64(int8(p[0])), true
+		case 16:
+			return float64(int16(bo.Uint16(p))), true
+		case 32:
+			return float64(int32(bo.Uint32(p))), true
+		}
+	default:
+		switch bps {
+		case 1, 2, 4:
+			return float64(p[0] >> uint(8-bps-bit%8) & (1<<uint(bps) - 1)), true
+		case 8:
+			return float64(p[0]), true
+		case 16:
+			return float64(bo.Uint16(p)), true
+		case 32:
+			return float64(bo.Uint32(p)), true
+		}
+	}
+	return 0, false
+}
+
+// sample returns sample s of the pixel at (x, y), scaled to 16 bits.
+func (img *RawImage) sample(x, y, s int) uint16 {
+	bps := img.BitsPerSample
+	bit := (x*img.SamplesPerPixel + s) * bps
+	row := img.Pix[y*img.Stride:]
+	switch bps {
+	case 8:
+		v := uint16(row[bit/8])
+		return v<<8 | v
+	case 16:
+		return img.ByteOrder.Uint16(row[bit/8:])
+	case 1, 2, 4:
+		v := uint16(row[bit/8]>>(8-bps-bit%8)) & (1<<bps - 1)
+		return uint16(uint32(v) * 0xFFFF / (1<<bps - 1))
+	}
+	return 0
+}
+
+// Image returns img converted to an image.Image.  Bilevel, grayscale, RGB,
+// palette, CMYK and YCbCr images with 1, 2, 4, 8 or 16 bit unsigned samples are
+// supported.  WhiteIsZero images are inverted, so that they give an *image.Gray
+// (or *image.Gray16) that looks as intended.  Palette images of up to 8 bits
+// give an *image.Paletted (see Palette); CMYK, YCbCr and 16 bit palette images
+// are converted to RGB.  An alpha sample, as marked by ExtraSamples, gives an
+// *image.NRGBA (or *image.NRGBA64) if it is unassociated and an *image.RGBA (or
+// *image.RGBA64) if it is associated; palette images of up to 8 bits leave it
+// out.  Other samples beyond the color samples are ignored.  Use Preview for
+// signed or floating point samples.
+func (img *RawImage) Image() (image.Image, error) {
+	if img.SampleFormat != SampleFormatUint && img.SampleFormat != 0 {
+		return nil, fmt.Errorf("tiff/image: SampleFormat %d is not supported", img.SampleFormat)
+	}
+	switch img.BitsPerSample {
+	case 1, 2, 4, 8, 16:
+	default:
+		return nil, fmt.Errorf("tiff/image: %d bit samples are not supported", img.BitsPerSample)
+	}
+	r := image.Rect(0, 0, img.Width, img.Height)
+	switch img.Photometric {
+	case photometricWhiteIsZero, photometricBlackIsZero:
+		if img.SamplesPerPixel < 1 {
+			break
+		}
+		invert := img.Photometric == photometricWhiteIsZero
+		if a, associated := img.alpha(); a >= 0 {
+			return img.rgbImage(func(x, y int) (r, g, b uint16) {
+				v := img.sample(x, y, 0)
+				if invert {
+					// Inverting a premultiplied value leaves it
+					// premultiplied by the same alpha.
+					top := uint16(0xFFFF)
+					if associated {
+						top = img.sample(x, y, a)
+					}
+					if v > top {
+						v = top
+					}
+					v = top - v
+				}
+				return v, v, v
+			}), nil
+		}
+		if img.BitsPerSample == 16 {
+			out := image.NewGray16(r)
+			for y := 0; y < img.Height; y++ {
+				for x := 0; x < img.Width; x++ {
+					v := img.sample(x, y, 0)
+					if invert {
+						v = 0xFFFF - v
+					}
+					out.SetGray16(x, y, color.Gray16{v})
+				}
+			}
+			return out, nil
+		}
+		out := image.NewGray(r)
+		for y := 0; y < img.Height; y++ {
+			for x := 0; x < img.Width; x++ {
+				v := uint8(img.sample(x, y, 0) >> 8)
+				if invert {
+					v = 0xFF - v
+				}
+				out.Pix[y*out.Stride+x] = v
+			}
+		}
+		return out, nil
+	case photometricRGB:
+		if img.SamplesPerPixel < 3 {
+			break
+		}
+		if a, _ := img.alpha(); a >= 0 {
+			return img.rgbImage(func(x, y int) (r, g, b uint16) {
+				return img.sample(x, y, 0), img.sample(x, y, 1), img.sample(x, y, 2)
+			}), nil
+		}
+		if img.BitsPerSample == 16 {
+			out := image.NewRGBA64(r)
+			for y := 0; y < img.Height; y++ {
+				for x := 0; x < img.Width; x++ {
+					out.SetRGBA64(x, y, color.RGBA64{img.sample(x, y, 0), img.sample(x, y, 1), img.sample(x, y, 2), 0xFFFF})
+				}
+			}
+			return out, nil
+		}
+		out := image.NewRGBA(r)
+		for y := 0; y < img.Height; y++ {
+			for x := 0; x < img.Width; x++ {
+				p := out.Pix[y*out.Stride+4*x:]
+				p[0] = uint8(img.sample(x, y, 0) >> 8)
+				p[1] = uint8(img.sample(x, y, 1) >> 8)
+				p[2] = uint8(img.sample(x, y, 2) >> 8)
+				p[3] = 0xFF
+			}
+		}
+		return out, nil
+	case photometricPalette:
+		if img.SamplesPerPixel < 1 || len(img.ColorMap) == 0 {
+			break
+		}
+		pal := img.Palette()
+		if img.BitsPerSample == 16 {
+			return img.rgbImage(func(x, y int) (r, g, b uint16) {
+				if i := int(img.sample(x, y, 0)); i < len(pal) {
+					c := pal[i].(color.RGBA64)
+					return c.R, c.G, c.B
+				}
+				return 0, 0, 0
+			}), nil
+		}
+		// Indexes past the end of the ColorMap are black.
+		n := 1 << uint(img.BitsPerSample)
+		for len(pal) < n {
+			pal = append(pal, color.RGBA64{0, 0, 0, 0xFFFF})
+		}
+		out := image.NewPaletted(r, pal[:n])
+		for y := 0; y < img.Height; y++ {
+			for x := 0; x < img.Width; x++ {
+				v, _ := img.value(x, y, 0)
+				out.Pix[y*out.Stride+x] = uint8(v)
+			}
+		}
+		return out, nil
+	case photometricSeparated:
+		if img.SamplesPerPixel < 4 {
+			break
+		}
+		if img.InkSet != inkSetCMYK && img.InkSet != 0 {
+			return nil, fmt.Errorf("tiff/image: InkSet %d is not supported", img.InkSet)
+		}
+		return img.rgbImage(img.cmykToRGB), nil
+	case photometricYCbCr:
+		if img.SamplesPerPixel < 3 {
+			break
+		}
+		p := img.YCbCr
+		if p == nil {
+			p, _ = ycbcrParams(nil, nil, img.BitsPerSample)
+		}
+		return img.rgbImage(func(x, y int) (r, g, b uint16) {
+			return p.rgb(img, x, y)
+		}), nil
+	}
+	return nil, fmt.Errorf("tiff/image: PhotometricInterpretation %d with %d samples per pixel is not supported", img.Photometric, img.SamplesPerPixel)
+}
@@ -0,0 +1,110 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package image
+
+import (
+	"fmt"
+
+	"github.com/google/tiff"
+)
+
+// Resample returns a copy of src scaled to w by h pixels.  Images with 8 bit
+// samples are interpolated bilinearly.  Other images must have whole bytes per
+// pixel and are scaled by taking the nearest pixel, since the samples are kept
+// in the byte order of the file; so are palette images, whose samples are
+// indexes into the ColorMap rather than intensities.
+func Resample(src *RawImage, w, h int) (*RawImage, error) {
+	if w <= 0 || h <= 0 {
+		return nil, fmt.Errorf("tiff/image: invalid size %dx%d", w, h)
+	}
+	bitsPerPixel := src.SamplesPerPixel * src.BitsPerSample
+	if bitsPerPixel%8 != 0 {
+		return nil, fmt.Errorf("tiff/image: resampling %d bit pixels is not supported", bitsPerPixel)
+	}
+	bpp := bitsPerPixel / 8
+	dst := &RawImage{
+		Width:           w,
+		Height:          h,
+		SamplesPerPixel: src.SamplesPerPixel,
+		BitsPerSample:   src.BitsPerSample,
+		Photometric:     src.Photometric,
+		SampleFormat:    src.SampleFormat,
+		YCbCr:           src.YCbCr,
+		InkSet:          src.InkSet,
+		ColorMap:        src.ColorMap,
+		ExtraSamples:    src.ExtraSamples,
+		Orientation:     src.Orientation,
+		ByteOrder:       src.ByteOrder,
+		Stride:          w * bpp,
+	}
+	dst.Pix = make([]byte, dst.Stride*h)
+	// Pixel centers of dst are mapped to positions in src.
+	sx := float64(src.Width) / float64(w)
+	sy := float64(src.Height) / float64(h)
+	for y := 0; y < h; y++ {
+		fy := (float64(y)+0.5)*sy - 0.5
+		for x := 0; x < w; x++ {
+			fx := (float64(x)+0.5)*sx - 0.5
+			out := dst.Pix[y*dst.Stride+x*bpp:]
+			if src.BitsPerSample != 8 || src.Photometric == photometricPalette {
+				p := src.pixel(int(fx+0.5), int(fy+0.5), bpp)
+				copy(out[:bpp], p)
+				continue
+			}
+			x0, y0 := int(fx), int(fy)
+			if fx < 0 {
+				x0 = -1
+			}
+			if fy < 0 {
+				y0 = -1
+			}
+			ax, ay := fx-float64(x0), fy-float64(y0)
+			p00, p10 := src.pixel(x0, y0, bpp), src.pixel(x0+1, y0, bpp)
+			p01, p11 := src.pixel(x0, y0+1, bpp), src.pixel(x0+1, y0+1, bpp)
+			for s := 0; s < bpp; s++ {
+				top := float64(p00[s])*(1-ax) + float64(p10[s])*ax
+				bot := float64(p01[s])*(1-ax) + float64(p11[s])*ax
+				out[s] = uint8(top*(1-ay) + bot*ay + 0.5)
+			}
+		}
+	}
+	return dst, nil
+}
+
+// pixel returns the bpp bytes of the pixel at (x, y), clamping coordinates
+// outside of img to its edges.
+func (img *RawImage) pixel(x, y, bpp int) []byte {
+	if x < 0 {
+		x = 0
+	} else if x >= img.Width {
+		x = img.Width - 1
+	}
+	if y < 0 {
+		y = 0
+	} else if y >= img.Height {
+		y = img.Height - 1
+	}
+	off := y*img.Stride + x*bpp
+	return img.Pix[off : off+bpp]
+}
+
+// DecodeForPrint decodes the image described by ifd with DecodeRaw and
+// resamples it so that it prints at width by height inches at dpi pixels per
+// inch.  The resolution tags of the file are left alone; set them with
+// tiff.SetResolution when writing the result.
+func DecodeForPrint(ifd tiff.IFD, br tiff.BReader, width, height, dpi float64, opts *PipelineOptions) (*RawImage, error) {
+	w, h := tiff.PixelsForPrintSize(width, height, dpi)
+	if w <= 0 || h <= 0 {
+		return nil, fmt.Errorf("tiff/image: invalid print size %gx%g at %g dpi", width, height, dpi)
+	}
+	raw, err := DecodeRaw(ifd, br, opts)
+	if err != nil {
+		return nil, err
+	}
+	if raw.Width == w && raw.Height == h {
+		return raw, nil
+	}
+	return Resample(raw, w, h)
+}
@@ -0,0 +1,595 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package image
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/tiff"
+)
+
+/* Whole slide images
+
+Slide scanners write a pyramid of tiled images of a microscope slide, from the
+full resolution scan down to small overviews, along with a few associated
+images such as a photo of the slide label.  The files are TIFF or BigTIFF, but
+each vendor has its own way of telling the levels of the pyramid from the
+associated images, so the vendor is detected first:
+	Philips   ImageDescription of the first IFD is XML (a DataObject of type
+	          DPUfsImport).  Associated images have "Label" or "Macro" as
+	          ImageDescription.  Tiles that were not scanned have no data:
+	          their offset and byte count are 0, and some files leave out
+	          TileByteCounts entirely.
+	Ventana   The XMP packet of the first IFD holds an iScan element.  Levels
+	          have ImageDescriptions of the form "level=N mag=M quality=Q" and
+	          are not always stored in order; the label image is called
+	          "Label Image" (or "Label_Image") and the overview "Thumbnail".
+	Aperio    ImageDescription of the first IFD starts with "Aperio" and
+	          holds the properties of the slide after the first line, as
+	          "|key = value" pairs.  The thumbnail is the untiled second
+	          IFD; the label and macro images are untiled IFDs whose
+	          ImageDescription has "label" or "macro" at the start of its
+	          second line.
+	Hamamatsu NDPI files (see tiff.IsNDPI).  Levels are not tiled but
+	          stored as a single JPEG strip each, marked with the
+	          magnification of the objective in NDPI_SOURCELENS; a lens of
+	          -1 marks the macro image and -2 the map of the scanned area.
+	          Levels at focal planes other than 0 are left out.  Offsets of
+	          files past 4 GB are fixed as tiff.DataOffsets describes, and
+	          the properties of the slide are "key=value" lines in
+	          NDPI_PROPERTY_MAP.
+	Generic   Tiled IFDs are levels, from the largest down.  Untiled IFDs
+	          after the first are associated images, named after the word
+	          "label" or "macro" in their ImageDescription.
+*/
+
+// A SlideVendor identifies the conventions a whole slide image follows.
+type SlideVendor int
+
+const (
+	SlideGeneric SlideVendor = iota
+	SlidePhilips
+	SlideVentana
+	SlideAperio
+	SlideHamamatsu
+)
+
+func (v SlideVendor) String() string {
+	switch v {
+	case SlideGeneric:
+		return "generic"
+	case SlidePhilips:
+		return "philips"
+	case SlideVentana:
+		return "ventana"
+	case SlideAperio:
+		return "aperio"
+	case SlideHamamatsu:
+		return "hamamatsu"
+	}
+	return fmt.Sprintf("SlideVendor(%d)", int(v))
+}
+
+// A SlideLevel is a level of the pyramid of a Slide.
+type SlideLevel struct {
+	// IFD is the index of the IFD of the level in the main IFD chain.
+	IFD           int
+	Width, Height int
+	// Downsample is the width of the first level over the width of this
+	// one.
+	Downsample float64
+}
+
+// A Slide is a whole slide image: a pyramid of tiled levels, from the full
+// resolution down, and named associated images.
+type Slide struct {
+	Vendor SlideVendor
+	Levels []SlideLevel
+	// Associated maps the names of the associated images ("label",
+	// "macro", "thumbnail", and "map" for Hamamatsu slides) to the index
+	// of their IFD.
+	Associated map[string]int
+	// Properties holds the properties Aperio and Hamamatsu slides give,
+	// such as "MPP" or "AppMag" (Aperio) and "Objective.Lens.Magnificant"
+	// (Hamamatsu).  It is nil for other vendors.
+	Properties map[string]string
+
+	t tiff.TIFF
+}
+
+// OpenSlide returns the Slide held by t, following the conventions of the
+// vendor that wrote it.
+func OpenSlide(t tiff.TIFF) (*Slide, error) {
+	ifds := t.IFDs()
+	if len(ifds) == 0 {
+		return nil, fmt.Errorf("tiff/image: no IFDs found")
+	}
+	s := &Slide{Vendor: slideVendor(t), Associated: make(map[string]int), t: t}
+	s.Properties = slideProperties(s.Vendor, ifds[0])
+	type candidate struct {
+		idx, order int
+		l          Layout
+	}
+	var levels []candidate
+	for i, ifd := range ifds {
+		desc := description(ifd)
+		if name := s.associatedName(i, ifd, desc); name != "" {
+			if _, ok := s.Associated[name]; !ok {
+				s.Associated[name] = i
+			}
+			continue
+		}
+		if s.Vendor == SlideHamamatsu {
+			if !ndpiLevel(ifd) {
+				continue
+			}
+		} else if !ifd.HasField(322) || tiff.KindOf(ifd) == tiff.IFDMask {
+			continue
+		}
+		l, err := layoutOf(s.t.IFDs()[i], s.Vendor != SlidePhilips, nil)
+		if err != nil {
+			return nil, fmt.Errorf("tiff/image: IFD %d of slide: %v", i, err)
+		}
+		order := -1
+		if s.Vendor == SlideVentana {
+			order = ventanaLevel(desc)
+			if order < 0 {
+				continue
+			}
+		}
+		levels = append(levels, candidate{i, order, l})
+	}
+	if len(levels) == 0 {
+		return nil, fmt.Errorf("tiff/image: no tiled levels found in %s slide", s.Vendor)
+	}
+	sort.SliceStable(levels, func(i, j int) bool {
+		if levels[i].order != levels[j].order {
+			return levels[i].order < levels[j].order
+		}
+		return levels[i].l.Width > levels[j].l.Width
+	})
+	for _, c := range levels {
+		s.Levels = append(s.Levels, SlideLevel{
+			IFD:        c.idx,
+			Width:      c.l.Width,
+			Height:     c.l.Height,
+			Downsample: float64(levels[0].l.Width) / float64(c.l.Width),
+		})
+	}
+	return s, nil
+}
+
+// slideVendor returns the vendor that wrote t.
+func slideVendor(t tiff.TIFF) SlideVendor {
+	ifd0 := t.IFDs()[0]
+	desc := description(ifd0)
+	switch {
+	case strings.HasPrefix(desc, "<?xml") && strings.Contains(desc, "DPUfsImport"):
+		return SlidePhilips
+	case strings.Contains(tiff.XMPString(ifd0), "<iScan"):
+		return SlideVentana
+	case strings.HasPrefix(desc, "Aperio"):
+		return SlideAperio
+	case tiff.IsNDPI(t):
+		return SlideHamamatsu
+	}
+	return SlideGeneric
+}
+
+// associatedName returns the name of the associated image held by IFD i, or
+// "" if it holds none.
+func (s *Slide) associatedName(i int, ifd tiff.IFD, desc string) string {
+	switch s.Vendor {
+	case SlidePhilips:
+		switch {
+		case strings.HasPrefix(desc, "Label"):
+			return "label"
+		case strings.HasPrefix(desc, "Macro"):
+			return "macro"
+		}
+	case SlideVentana:
+		switch {
+		case strings.HasPrefix(desc, "Label Image"), strings.HasPrefix(desc, "Label_Image"):
+			return "label"
+		case strings.HasPrefix(desc, "Thumbnail"):
+			return "thumbnail"
+		}
+	case SlideAperio:
+		if ifd.HasField(322) {
+			return ""
+		}
+		lines := strings.Split(desc, "\n")
+		if len(lines) > 1 {
+			switch f := strings.Fields(lines[1]); {
+			case len(f) > 0 && f[0] == "label":
+				return "label"
+			case len(f) > 0 && f[0] == "macro":
+				return "macro"
+			}
+		}
+		if i == 1 {
+			return "thumbnail"
+		}
+	case SlideHamamatsu:
+		switch ndpiLens(ifd) {
+		case -1:
+			return "macro"
+		case -2:
+			return "map"
+		}
+	default:
+		if i == 0 || ifd.HasField(322) {
+			return ""
+		}
+		lower := strings.ToLower(desc)
+		switch {
+		case strings.Contains(lower, "label"):
+			return "label"
+		case strings.Contains(lower, "macro"):
+			return "macro"
+		case i == 1:
+			return "thumbnail"
+		}
+	}
+	return ""
+}
+
+// ventanaLevel returns N from a Ventana level description "level=N ...", or
+// -1 if desc is not one.
+func ventanaLevel(desc string) int {
+	for _, kv := range strings.Fields(desc) {
+		if strings.HasPrefix(kv, "level=") {
+			if n, err := strconv.Atoi(kv[len("level="):]); err == nil && n >= 0 {
+				return n
+			}
+		}
+	}
+	return -1
+}
+
+// ndpiLens returns the NDPI_SOURCELENS of ifd, or 0 if it has none.
+func ndpiLens(ifd tiff.IFD) float64 {
+	var lens struct {
+		Lens *float32 `tiff:"field,tag=65421"`
+	}
+	if tiff.UnmarshalIFD(ifd, &lens) != nil || lens.Lens == nil {
+		return 0
+	}
+	return float64(*lens.Lens)
+}
+
+// ndpiLevel reports whether ifd of a Hamamatsu slide holds a level of the
+// pyramid at focal plane 0.
+func ndpiLevel(ifd tiff.IFD) bool {
+	var plane struct {
+		Plane *int32 `tiff:"field,tag=65424"`
+	}
+	if tiff.UnmarshalIFD(ifd, &plane) != nil || (plane.Plane != nil && *plane.Plane != 0) {
+		return false
+	}
+	return ndpiLens(ifd) > 0
+}
+
+// slideProperties returns the properties of a slide of vendor v, whose first
+// IFD is ifd0.
+func slideProperties(v SlideVendor, ifd0 tiff.IFD) map[string]string {
+	var pairs []string
+	var sep string
+	switch v {
+	case SlideAperio:
+		pairs, sep = strings.Split(description(ifd0), "|"), "="
+		if len(pairs) > 0 {
+			// The first part is the name of the library and
+			// the size of the image.
+			pairs = pairs[1:]
+		}
+	case SlideHamamatsu:
+		if !ifd0.HasField(tiff.NDPIPropertyMapTagID) {
+			return nil
+		}
+		f := ifd0.GetField(tiff.NDPIPropertyMapTagID)
+		text := tiff.FieldText(f)
+		pairs, sep = strings.FieldsFunc(text, func(r rune) bool { return r == '\r' || r == '\n' }), "="
+	default:
+		return nil
+	}
+	props := make(map[string]string, len(pairs))
+	for _, p := range pairs {
+		kv := strings.SplitN(p, sep, 2)
+		if len(kv) == 2 {
+			props[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+		}
+	}
+	return props
+}
+
+// description returns the ImageDescription of ifd, or "".
+func description(ifd tiff.IFD) string {
+	if !ifd.HasField(270) {
+		return ""
+	}
+	f := ifd.GetField(270)
+	return strings.TrimSpace(tiff.FieldText(f))
+}
+
+// Layout returns the Layout of level i of s.  Byte counts that a Philips slide
+// leaves out are worked out from what the file holds after each tile.
+func (s *Slide) Layout(i int) (Layout, error) {
+	if i < 0 || i >= len(s.Levels) {
+		return Layout{}, fmt.Errorf("tiff/image: level %d out of range [0, %d)", i, len(s.Levels))
+	}
+	if s.Vendor != SlidePhilips {
+		return layoutOf(s.t.IFDs()[s.Levels[i].IFD], true, nil)
+	}
+	l, err := layoutOf(s.t.IFDs()[s.Levels[i].IFD], false, nil)
+	if err != nil || l.ByteCounts != nil {
+		return l, err
+	}
+	size, err := s.t.R().Seek(0, io.SeekEnd)
+	if err != nil {
+		return l, err
+	}
+	regions, err := tiff.Regions(s.t)
+	if err != nil {
+		return l, err
+	}
+	l.ByteCounts = inferByteCounts(l.Offsets, regions, uint64(size))
+	return l, nil
+}
+
+// inferByteCounts returns the byte count of each chunk at offsets, taken to
+// run up to the next chunk or referenced region of the file (such as an IFD,
+// the values of a field or the strips of another image) or to its end.
+// Chunks at offset 0 hold no data.
+func inferByteCounts(offsets []uint64, regions []tiff.Region, size uint64) []uint64 {
+	starts := make([]uint64, 0, len(offsets)+len(regions))
+	for _, o := range offsets {
+		if o != 0 {
+			starts = append(starts, o)
+		}
+	}
+	for _, r := range regions {
+		starts = append(starts, r.Offset)
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i] < starts[j] })
+	counts := make([]uint64, len(offsets))
+	for i, o := range offsets {
+		if o == 0 || o >= size {
+			continue
+		}
+		next := size
+		j := sort.Search(len(starts), func(j int) bool { return starts[j] > o })
+		if j < len(starts) {
+			next = starts[j]
+		}
+		counts[i] = next - o
+	}
+	return counts
+}
+
+// ChunkReader returns a ChunkReader for the tiles of level i of s.  Tiles
+// that hold no data (as in sparse Philips slides) read as white.
+func (s *Slide) ChunkReader(i int) (ChunkReader, error) {
+	l, err := s.Layout(i)
+	if err != nil {
+		return nil, err
+	}
+	c := GetCompression(l.Compression)
+	if c == nil {
+		return nil, CompressionNotSupported{l.Compression}
+	}
+	ifd := s.t.IFDs()[s.Levels[i].IFD]
+	return &slideChunkReader{*newChunkReader(ifd, l, c, s.t.R())}, nil
+}
+
+// decodeLevel decodes the whole of level i of s, which should be a small one,
+// through the quirks of its ChunkReader.
+func (s *Slide) decodeLevel(i int) (*RawImage, error) {
+	cr, err := s.ChunkReader(i)
+	if err != nil {
+		return nil, err
+	}
+	l := cr.Layout()
+	img, err := l.newRawImage(s.t.R().ByteOrder(), nil)
+	if err != nil {
+		return nil, err
+	}
+	for c := 0; c < l.NumChunks(); c++ {
+		data, err := cr.ReadChunk(c)
+		if err != nil {
+			return nil, err
+		}
+		if err = l.place(img, c, data); err != nil {
+			return nil, err
+		}
+	}
+	return img, nil
+}
+
+type slideChunkReader struct {
+	chunkReader
+}
+
+func (cr *slideChunkReader) ReadChunk(i int) ([]byte, error) {
+	if out, ok := cr.white(i); ok {
+		return out, nil
+	}
+	return cr.chunkReader.ReadChunk(i)
+}
+
+func (cr *slideChunkReader) ReadChunkContext(ctx context.Context, i int) ([]byte, error) {
+	if out, ok := cr.white(i); ok {
+		return out, ctx.Err()
+	}
+	return cr.chunkReader.ReadChunkContext(ctx, i)
+}
+
+// white returns the data of tile i if it holds none, which reads as white.
+func (cr *slideChunkReader) white(i int) ([]byte, bool) {
+	if i < 0 || i >= len(cr.l.ByteCounts) || cr.l.ByteCounts[i] != 0 {
+		return nil, false
+	}
+	out := make([]byte, cr.l.chunkSize(i))
+	for j := range out {
+		out[j] = 0xFF
+	}
+	return out, true
+}
+
+// RedactSlide writes a copy of the slide found in src to dst without the
+// associated images named in names ("label" and "macro" if none are given),
+// which often show patient identifiers.  Images embedded in the
+// ImageDescription of a Philips slide are blanked: their base64 text is
+// replaced with spaces.  The levels of the pyramid and any other associated
+// images are kept.  Identifiers held elsewhere, such as in the rest of the
+// ImageDescription, are left alone.
+func RedactSlide(src tiff.ReadAtReadSeeker, dst io.Writer, names ...string) error {
+	t, err := tiff.Parse(src, nil, nil)
+	if err != nil {
+		return err
+	}
+	s, err := OpenSlide(t)
+	if err != nil {
+		return err
+	}
+	ranges, err := s.philipsRedactions(redactedNames(names))
+	if err != nil {
+		return err
+	}
+	if len(ranges) > 0 {
+		src = &blankedReader{src, ranges}
+	}
+	drop := make(map[int]bool)
+	for _, idx := range s.redacted(names) {
+		drop[idx] = true
+	}
+	var keep []int
+	for i := range t.IFDs() {
+		if !drop[i] {
+			keep = append(keep, i)
+		}
+	}
+	if _, err = src.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return tiff.WritePages(src, dst, keep)
+}
+
+// Blank overwrites the image data of the associated images named in names
+// ("label" and "macro" if none are given) in place through w, which must
+// write to the file s was read from.  Each strip or tile is replaced with a
+// black one when its compression can encode one in the space the old one
+// took, and with zeros otherwise, which leaves it unreadable.  Images embedded
+// in the ImageDescription of a Philips slide have their base64 text replaced
+// with spaces.  The IFDs are left as they are.
+func (s *Slide) Blank(w io.WriterAt, names ...string) error {
+	ranges, err := s.philipsRedactions(redactedNames(names))
+	if err != nil {
+		return err
+	}
+	for _, r := range ranges {
+		if _, err := w.WriteAt(bytes.Repeat([]byte{' '}, int(r[1]-r[0])), r[0]); err != nil {
+			return fmt.Errorf("tiff/image: unable to blank embedded image: %v", err)
+		}
+	}
+	size, err := tiff.FileSize(s.t.R())
+	if err != nil {
+		size = -1
+	}
+	for _, idx := range s.redacted(names) {
+		l, err := layoutOf(s.t.IFDs()[idx], true, nil)
+		if err != nil {
+			return fmt.Errorf("tiff/image: IFD %d of slide: %v", idx, err)
+		}
+		c := GetCompression(l.Compression)
+		for i, off := range l.Offsets {
+			if err := l.checkChunk(i, size); err != nil {
+				return fmt.Errorf("tiff/image: IFD %d of slide: %v", idx, err)
+			}
+			blank := make([]byte, l.ByteCounts[i])
+			if c != nil {
+				if enc, err := c.Compress(make([]byte, l.chunkSize(i))); err == nil && len(enc) <= len(blank) {
+					copy(blank, enc)
+				}
+			}
+			if _, err := w.WriteAt(blank, int64(off)); err != nil {
+				return fmt.Errorf("tiff/image: unable to blank strip or tile %d of IFD %d: %v", i, idx, err)
+			}
+		}
+	}
+	return nil
+}
+
+// redacted returns the indexes of the IFDs holding associated images named in
+// names, or label and macro images if names is empty.  Unlike Associated, it
+// lists every such IFD, not only the first of each name.
+func (s *Slide) redacted(names []string) []int {
+	want := redactedNames(names)
+	var idxs []int
+	for i, ifd := range s.t.IFDs() {
+		if want[s.associatedName(i, ifd, description(ifd))] {
+			idxs = append(idxs, i)
+		}
+	}
+	return idxs
+}
+
+// redactedNames returns the set of names, or label and macro if names is
+// empty.
+func redactedNames(names []string) map[string]bool {
+	if len(names) == 0 {
+		names = []string{"label", "macro"}
+	}
+	want := make(map[string]bool, len(names))
+	for _, name := range names {
+		want[name] = true
+	}
+	return want
+}
+
+// A blankedReader reads a file with the bytes in some ranges of offsets
+// replaced by spaces.
+type blankedReader struct {
+	tiff.ReadAtReadSeeker
+	ranges [][2]int64
+}
+
+func (r *blankedReader) ReadAt(p []byte, off int64) (int, error) {
+	n, err := r.ReadAtReadSeeker.ReadAt(p, off)
+	r.blank(p[:n], off)
+	return n, err
+}
+
+func (r *blankedReader) Read(p []byte) (int, error) {
+	off, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	n, err := r.ReadAtReadSeeker.Read(p)
+	r.blank(p[:n], off)
+	return n, err
+}
+
+// blank blanks the bytes of p, read at off, that fall in the ranges of r.
+func (r *blankedReader) blank(p []byte, off int64) {
+	for _, rg := range r.ranges {
+		lo, hi := rg[0], rg[1]
+		if lo < off {
+			lo = off
+		}
+		if end := off + int64(len(p)); hi > end {
+			hi = end
+		}
+		for i := lo; i < hi; i++ {
+			p[i-off] = ' '
+		}
+	}
+}
@@ -0,0 +1,359 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package image
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"strings"
+
+	"github.com/google/tiff"
+	"github.com/google/tiff/imagej"
+	"github.com/google/tiff/ome"
+)
+
+/* Microscopy stacks
+
+ImageJ and OME-TIFF files store each plane of a multi-dimensional image (a
+channel of a z-slice at a time point) in an IFD of its own and describe the
+dimensions in the ImageDescription tag (270) of the first IFD:
+	ImageJ:   "ImageJ=1.53t\nimages=6\nchannels=3\nslices=2\n...", with the
+	          planes in channel, slice, frame order (channels vary fastest)
+	          and the colors of the channels in their lookup tables (see
+	          package imagej).
+	OME-TIFF: an OME-XML document whose Pixels element gives the sizes and
+	          the order of the dimensions, the Channel elements their colors,
+	          and the TiffData elements which IFDs hold which planes.
+Only the first image of an OME-TIFF file, and only planes stored in the file
+itself, are supported.
+*/
+
+// A Stack describes how the IFDs of a microscopy file hold the planes of a
+// multi-channel image.
+type Stack struct {
+	Channels, Slices, Frames int
+	// Names and Colors hold the name and the display color of each channel
+	// as given by the file.  Missing colors are zero.
+	Names  []string
+	Colors []color.RGBA
+	// order lists the dimensions ('C', 'Z' and 'T') from the fastest
+	// varying to the slowest, and planes maps the index of a plane in that
+	// order to the index of the IFD holding it (-1 if none does).
+	order  string
+	planes []int
+}
+
+// StackOf returns the Stack described by the ImageDescription of the first IFD
+// of t, which must be written by ImageJ or be OME-XML.
+func StackOf(t tiff.TIFF) (*Stack, error) {
+	if len(t.IFDs()) == 0 {
+		return nil, fmt.Errorf("tiff/image: no IFDs found")
+	}
+	ifd0 := t.IFDs()[0]
+	if !ifd0.HasField(270) {
+		return nil, fmt.Errorf("tiff/image: no ImageDescription, so not an ImageJ or OME-TIFF stack")
+	}
+	f := ifd0.GetField(270)
+	desc := strings.TrimSpace(tiff.FieldText(f))
+	var s *Stack
+	var err error
+	switch {
+	case strings.HasPrefix(desc, "ImageJ="):
+		s, err = imageJStack(t)
+	case strings.HasPrefix(desc, "<") && strings.Contains(desc, "<OME"):
+		s, err = omeStack(desc)
+	default:
+		return nil, fmt.Errorf("tiff/image: ImageDescription is not from ImageJ or OME-TIFF")
+	}
+	if err != nil {
+		return nil, err
+	}
+	for i, ifd := range s.planes {
+		if ifd >= len(t.IFDs()) {
+			s.planes[i] = -1
+		}
+	}
+	return s, nil
+}
+
+// imageJStack returns the Stack of an ImageJ file, with the colors of the
+// channels taken from their lookup tables.
+func imageJStack(t tiff.TIFF) (*Stack, error) {
+	m, err := imagej.Parse(t)
+	if err != nil {
+		return nil, err
+	}
+	s := &Stack{Channels: m.Channels, Slices: m.Slices, Frames: m.Frames, order: "CZT"}
+	n, err := s.numPlanes()
+	if err != nil {
+		return nil, err
+	}
+	s.planes = make([]int, n)
+	for i := range s.planes {
+		s.planes[i] = i
+	}
+	s.Names = make([]string, s.Channels)
+	s.Colors = make([]color.RGBA, s.Channels)
+	if len(m.LUTs) == s.Channels {
+		for i := range m.LUTs {
+			r, g, b := m.LUTs[i].Color()
+			s.Colors[i] = color.RGBA{r, g, b, 0xFF}
+		}
+	}
+	return s, nil
+}
+
+// omeStack returns the Stack of the first image of the OME-XML desc (see
+// package ome).  Planes held by other files are left out.
+func omeStack(desc string) (*Stack, error) {
+	m, err := ome.ParseXML([]byte(desc))
+	if err != nil {
+		return nil, err
+	}
+	if len(m.Images) == 0 {
+		return nil, fmt.Errorf("tiff/image: OME-XML has no images")
+	}
+	img := m.Images[0]
+	s := &Stack{Channels: img.EffectiveSizeC(), Slices: img.SizeZ, Frames: img.SizeT, order: img.DimensionOrder[2:]}
+	n, err := s.numPlanes()
+	if err != nil {
+		return nil, err
+	}
+	s.Names = make([]string, s.Channels)
+	s.Colors = make([]color.RGBA, s.Channels)
+	for i, ch := range img.Channels {
+		if i >= s.Channels {
+			break
+		}
+		s.Names[i] = ch.Name
+		if ch.HasColor {
+			c := ch.Color
+			s.Colors[i] = color.RGBA{uint8(c >> 24), uint8(c >> 16), uint8(c >> 8), 0xFF}
+		}
+	}
+	s.planes = make([]int, n)
+	for c := 0; c < s.Channels; c++ {
+		for z := 0; z < s.Slices; z++ {
+			for t := 0; t < s.Frames; t++ {
+				i, _ := s.planeIndex(c, z, t)
+				s.planes[i] = -1
+				if p, err := img.PlaneAt(z, c, t); err == nil && p.UUID == "" && p.FileName == "" {
+					s.planes[i] = p.IFD
+				}
+			}
+		}
+	}
+	return s, nil
+}
+
+// numPlanes returns the number of planes in s, checking that its sizes are
+// valid.
+func (s *Stack) numPlanes() (int, error) {
+	const maxPlanes = 1 << 20
+	if s.Channels <= 0 || s.Slices <= 0 || s.Frames <= 0 ||
+		int64(s.Channels)*int64(s.Slices)*int64(s.Frames) > maxPlanes {
+		return 0, fmt.Errorf("tiff/image: invalid stack of %d channels, %d slices and %d frames", s.Channels, s.Slices, s.Frames)
+	}
+	return s.Channels * s.Slices * s.Frames, nil
+}
+
+// planeIndex returns the index of a plane in the order of the planes of s.
+func (s *Stack) planeIndex(c, z, t int) (int, bool) {
+	if c < 0 || c >= s.Channels || z < 0 || z >= s.Slices || t < 0 || t >= s.Frames {
+		return 0, false
+	}
+	pos := map[byte]int{'C': c, 'Z': z, 'T': t}
+	size := map[byte]int{'C': s.Channels, 'Z': s.Slices, 'T': s.Frames}
+	i, stride := 0, 1
+	for j := 0; j < len(s.order); j++ {
+		d := s.order[j]
+		i += pos[d] * stride
+		stride *= size[d]
+	}
+	return i, true
+}
+
+// IFD returns the index in the IFD chain of the IFD that holds channel c of
+// slice z at frame t.  Channels, slices and frames are counted from 0.
+func (s *Stack) IFD(c, z, t int) (int, error) {
+	i, ok := s.planeIndex(c, z, t)
+	if !ok {
+		return 0, fmt.Errorf("tiff/image: plane (c=%d, z=%d, t=%d) is outside of the stack", c, z, t)
+	}
+	if s.planes[i] < 0 {
+		return 0, fmt.Errorf("tiff/image: plane (c=%d, z=%d, t=%d) is not stored in the file", c, z, t)
+	}
+	return s.planes[i], nil
+}
+
+// Coords returns the channel, slice and frame of the plane held by the IFD at
+// index ifd in the IFD chain.  ok is false if it holds none.
+func (s *Stack) Coords(ifd int) (c, z, t int, ok bool) {
+	for i, idx := range s.planes {
+		if idx != ifd {
+			continue
+		}
+		coord := map[byte]*int{'C': &c, 'Z': &z, 'T': &t}
+		size := map[byte]int{'C': s.Channels, 'Z': s.Slices, 'T': s.Frames}
+		for j := 0; j < len(s.order); j++ {
+			d := s.order[j]
+			*coord[d] = i % size[d]
+			i /= size[d]
+		}
+		return c, z, t, true
+	}
+	return 0, 0, 0, false
+}
+
+// ZSeries returns the indices of the IFDs holding the slices of channel c at
+// frame t, in slice order.
+func (s *Stack) ZSeries(c, t int) ([]int, error) {
+	ifds := make([]int, s.Slices)
+	for z := range ifds {
+		var err error
+		if ifds[z], err = s.IFD(c, z, t); err != nil {
+			return nil, err
+		}
+	}
+	return ifds, nil
+}
+
+// TimeSeries returns the indices of the IFDs holding the frames of channel c
+// of slice z, in time order.
+func (s *Stack) TimeSeries(c, z int) ([]int, error) {
+	ifds := make([]int, s.Frames)
+	for t := range ifds {
+		var err error
+		if ifds[t], err = s.IFD(c, z, t); err != nil {
+			return nil, err
+		}
+	}
+	return ifds, nil
+}
+
+// DecodePlane decodes channel c of slice z at frame t of the stack s, which
+// must describe tf, with DecodeRaw.
+func DecodePlane(tf tiff.TIFF, s *Stack, c, z, t int, opts *PipelineOptions) (*RawImage, error) {
+	idx, err := s.IFD(c, z, t)
+	if err != nil {
+		return nil, err
+	}
+	if ifds := tf.IFDs(); idx >= len(ifds) {
+		return nil, fmt.Errorf("tiff/image: plane (c=%d, z=%d, t=%d) is in IFD %d, but the file has %d IFDs", c, z, t, idx, len(ifds))
+	}
+	return DecodeRaw(tf.IFDs()[idx], tf.R(), opts)
+}
+
+// defaultChannelColors are the colors given to channels that have none, in
+// the order that ImageJ uses for composite images.
+var defaultChannelColors = []color.RGBA{
+	{0xFF, 0, 0, 0xFF},
+	{0, 0xFF, 0, 0xFF},
+	{0, 0, 0xFF, 0xFF},
+	{0xFF, 0xFF, 0xFF, 0xFF},
+	{0, 0xFF, 0xFF, 0xFF},
+	{0xFF, 0, 0xFF, 0xFF},
+	{0xFF, 0xFF, 0, 0xFF},
+}
+
+// ColorLUT returns a color table for BandOptions that ramps from black to c.
+func ColorLUT(c color.RGBA) *[256]color.RGBA {
+	var lut [256]color.RGBA
+	for i := range lut {
+		lut[i] = color.RGBA{
+			uint8((int(c.R)*i + 127) / 255),
+			uint8((int(c.G)*i + 127) / 255),
+			uint8((int(c.B)*i + 127) / 255),
+			0xFF,
+		}
+	}
+	return &lut
+}
+
+// A CompositeChannel selects a channel to show in Composite.
+type CompositeChannel struct {
+	Channel int
+	// Color is the pseudo-color of the channel.  The zero value uses the
+	// color given by the file, or else the color ImageJ would use.
+	Color color.RGBA
+	// Gamma is as in BandOptions.
+	Gamma float64
+}
+
+// CompositeOptions controls Composite.
+type CompositeOptions struct {
+	// Channels lists the channels to show.  Nil shows all of them.
+	Channels []CompositeChannel
+	// Slice and Frame select the plane of each channel.
+	Slice, Frame int
+	// Low and High are the percentiles used to stretch the contrast of
+	// each channel, as in PreviewOptions.
+	Low, High float64
+	// Pipeline is passed to DecodeRaw for each plane.
+	Pipeline *PipelineOptions
+}
+
+// Composite decodes a plane of each selected channel of the stack t and adds
+// them together in their pseudo-colors, as ImageJ shows composite images.  The
+// contrast of each channel is stretched on its own (see Preview).
+func Composite(t tiff.TIFF, opts *CompositeOptions) (*image.RGBA, error) {
+	s, err := StackOf(t)
+	if err != nil {
+		return nil, err
+	}
+	var o CompositeOptions
+	if opts != nil {
+		o = *opts
+	}
+	chans := o.Channels
+	if chans == nil {
+		for c := 0; c < s.Channels; c++ {
+			chans = append(chans, CompositeChannel{Channel: c})
+		}
+	}
+	if len(chans) == 0 {
+		return nil, fmt.Errorf("tiff/image: no channels to composite")
+	}
+	var out *image.RGBA
+	for _, ch := range chans {
+		if err := tiff.CheckContext(t.R()); err != nil {
+			return nil, err
+		}
+		raw, err := DecodePlane(t, s, ch.Channel, o.Slice, o.Frame, o.Pipeline)
+		if err != nil {
+			return nil, fmt.Errorf("tiff/image: channel %d: %v", ch.Channel, err)
+		}
+		c := ch.Color
+		if c == (color.RGBA{}) {
+			c = s.Colors[ch.Channel]
+		}
+		if c == (color.RGBA{}) {
+			c = defaultChannelColors[ch.Channel%len(defaultChannelColors)]
+		}
+		p, err := Preview(raw, &PreviewOptions{
+			Low:   o.Low,
+			High:  o.High,
+			Bands: []BandOptions{{Gamma: ch.Gamma, LUT: ColorLUT(c)}},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("tiff/image: channel %d: %v", ch.Channel, err)
+		}
+		rgba := p.(*image.RGBA)
+		if out == nil {
+			out = rgba
+			continue
+		}
+		if !rgba.Rect.Eq(out.Rect) {
+			return nil, fmt.Errorf("tiff/image: channel %d is %v, not %v like the others", ch.Channel, rgba.Rect.Size(), out.Rect.Size())
+		}
+		for i, v := range rgba.Pix {
+			if i%4 != 3 {
+				out.Pix[i] = clamp8(int(out.Pix[i]) + int(v))
+			}
+		}
+	}
+	return out, nil
+}
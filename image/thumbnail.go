@@ -0,0 +1,124 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package image
+
+import (
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"sort"
+
+	"github.com/google/tiff"
+)
+
+// A ThumbnailSource tells how Thumbnails found an image.
+type ThumbnailSource int
+
+// Sources of thumbnails.
+const (
+	// ThumbnailReduced is an IFD of the main IFD chain marked as a reduced
+	// resolution image by NewSubfileType (or SubfileType).
+	ThumbnailReduced ThumbnailSource = iota
+	// ThumbnailSubIFD is a reduced resolution image in the SubIFDs (tag
+	// 330) of an IFD, as DNG and TIFF/EP files store their previews.
+	ThumbnailSubIFD
+	// ThumbnailJPEG is a JPEG stream referenced by JPEGInterchangeFormat
+	// (tag 513), as the Exif thumbnail is stored.
+	ThumbnailJPEG
+)
+
+func (s ThumbnailSource) String() string {
+	switch s {
+	case ThumbnailReduced:
+		return "reduced"
+	case ThumbnailSubIFD:
+		return "subifd"
+	case ThumbnailJPEG:
+		return "jpeg"
+	}
+	return fmt.Sprintf("ThumbnailSource(%d)", int(s))
+}
+
+// An ImageRef refers to a thumbnail or preview image of a TIFF without
+// decoding it.
+type ImageRef struct {
+	Source ThumbnailSource
+	// Path names the IFD the image was found in, such as "IFD 1" or
+	// "IFD 0/330[0]".
+	Path string
+	// Width and Height are the size of the image, or 0 if a JPEG stream
+	// does not give it.
+	Width, Height int
+	// IFD holds the image, unless Source is ThumbnailJPEG.
+	IFD tiff.IFD
+	// Offset and Size locate the JPEG stream if Source is ThumbnailJPEG.
+	Offset, Size int64
+
+	r tiff.BReader
+}
+
+// Decode decodes the image.
+func (ref *ImageRef) Decode() (image.Image, error) {
+	if ref.Source == ThumbnailJPEG {
+		return jpeg.Decode(io.NewSectionReader(ref.r, ref.Offset, ref.Size))
+	}
+	raw, err := DecodeRaw(ref.IFD, ref.r, nil)
+	if err != nil {
+		return nil, err
+	}
+	return raw.Image()
+}
+
+// Thumbnails returns the reduced resolution and preview images of t, smallest
+// first, so that a viewer can show one without decoding a full resolution
+// page: IFDs marked as reduced resolution images by NewSubfileType (tag 254)
+// or SubfileType (tag 255), in the main IFD chain or in SubIFDs (tag 330),
+// and JPEG streams referenced by JPEGInterchangeFormat (tag 513) from any of
+// them.
+func Thumbnails(t tiff.TIFF) ([]ImageRef, error) {
+	var refs []ImageRef
+	add := func(src ThumbnailSource, path string, ifd tiff.IFD) {
+		if ifd.HasField(513) && ifd.HasField(514) {
+			off, n := jpegStream(ifd)
+			ref := ImageRef{Source: ThumbnailJPEG, Path: path, Offset: off, Size: n, r: t.R()}
+			if cfg, err := jpeg.DecodeConfig(io.NewSectionReader(t.R(), off, n)); err == nil {
+				ref.Width, ref.Height = cfg.Width, cfg.Height
+			}
+			refs = append(refs, ref)
+		}
+		if tiff.KindOf(ifd) != tiff.IFDReduced {
+			return
+		}
+		if l, err := LayoutOf(ifd); err == nil {
+			refs = append(refs, ImageRef{Source: src, Path: path, Width: l.Width, Height: l.Height, IFD: ifd, r: t.R()})
+		}
+	}
+	for i, ifd := range t.IFDs() {
+		add(ThumbnailReduced, fmt.Sprintf("IFD %d", i), ifd)
+		subs, err := tiff.ParseSubIFDs(t, ifd, tiff.SubIFDsTagID)
+		if err != nil {
+			return nil, err
+		}
+		for j, sub := range subs {
+			add(ThumbnailSubIFD, fmt.Sprintf("IFD %d/%d[%d]", i, tiff.SubIFDsTagID, j), sub)
+		}
+	}
+	sort.SliceStable(refs, func(i, j int) bool {
+		return refs[i].Width*refs[i].Height < refs[j].Width*refs[j].Height
+	})
+	return refs, nil
+}
+
+// jpegStream returns the offset and size of the JPEG stream referenced by the
+// JPEGInterchangeFormat and JPEGInterchangeFormatLength tags of ifd.
+func jpegStream(ifd tiff.IFD) (off, n int64) {
+	var js struct {
+		Offset uint64 `tiff:"field,tag=513"`
+		Length uint64 `tiff:"field,tag=514"`
+	}
+	tiff.UnmarshalIFD(ifd, &js)
+	return int64(js.Offset), int64(js.Length)
+}
@@ -0,0 +1,252 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package image
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/google/tiff"
+)
+
+// A ChunkReader decodes single strips or tiles of an image, for callers that
+// only need part of it (such as a server handing out the tiles of a Cloud
+// Optimized GeoTIFF).  It is safe for concurrent use if the tiff.BReader it
+// reads from is (see tiff.NewBReaderAt).
+type ChunkReader interface {
+	Layout() Layout
+	// ReadChunk returns the decompressed data of strip or tile i, holding
+	// rows of the full width of the chunk (see Layout.ChunkBounds).
+	ReadChunk(i int) ([]byte, error)
+}
+
+type chunkReader struct {
+	ifd  tiff.IFD
+	l    Layout
+	c    Compression
+	br   tiff.BReader
+	size int64 // of the file, -1 if unknown
+}
+
+// newChunkReader returns a chunkReader for the image of layout l described by
+// ifd, read through br.
+func newChunkReader(ifd tiff.IFD, l Layout, c Compression, br tiff.BReader) *chunkReader {
+	size, err := tiff.FileSize(br)
+	if err != nil {
+		size = -1
+	}
+	return &chunkReader{ifd: ifd, l: l, c: c, br: br, size: size}
+}
+
+// NewChunkReader returns a ChunkReader for the image described by ifd, read
+// through br.
+func NewChunkReader(ifd tiff.IFD, br tiff.BReader) (ChunkReader, error) {
+	l, err := LayoutOf(ifd)
+	if err != nil {
+		return nil, err
+	}
+	c := GetCompression(l.Compression)
+	if c == nil {
+		return nil, CompressionNotSupported{l.Compression}
+	}
+	return newChunkReader(ifd, l, c, br), nil
+}
+
+func (cr *chunkReader) Layout() Layout {
+	return cr.l
+}
+
+func (cr *chunkReader) ReadChunk(i int) ([]byte, error) {
+	return cr.readChunk(cr.br, i)
+}
+
+func (cr *chunkReader) ReadChunkContext(ctx context.Context, i int) ([]byte, error) {
+	return cr.readChunk(tiff.ContextBReader(ctx, cr.br), i)
+}
+
+// readChunk is ReadChunk, reading through br, which reads the file of cr.br.
+func (cr *chunkReader) readChunk(br tiff.BReader, i int) ([]byte, error) {
+	if i < 0 || i >= cr.l.NumChunks() {
+		return nil, fmt.Errorf("tiff/image: strip or tile %d out of range [0, %d)", i, cr.l.NumChunks())
+	}
+	if err := tiff.CheckContext(br); err != nil {
+		return nil, err
+	}
+	in, err := cr.l.readChunk(br, i, cr.size, nil)
+	if err != nil {
+		return nil, err
+	}
+	c, err := forChunk(cr.c, cr.ifd, cr.l, i)
+	if err != nil {
+		return nil, err
+	}
+	out, err := c.Decompress(in)
+	if err != nil {
+		return nil, err
+	}
+	want := cr.l.chunkSize(i)
+	if len(out) < want {
+		return nil, fmt.Errorf("tiff/image: strip or tile %d holds %d bytes, but %d are needed", i, len(out), want)
+	}
+	cr.l.unpredict(i, out, cr.br.ByteOrder())
+	return out[:want:want], nil
+}
+
+// A TileCache keeps decoded strips and tiles in memory, up to a total size,
+// dropping those used least recently to make room for new ones.  One cache can
+// be shared by the ChunkReaders of many images (see Wrap) and is safe for
+// concurrent use.  When several goroutines ask for the same missing tile at
+// once, it is only decoded once.
+type TileCache struct {
+	mu       sync.Mutex
+	maxBytes int64
+	size     int64
+	lru      *list.List // of *tileEntry, most recently used first
+	entries  map[tileKey]*list.Element
+	loading  map[tileKey]*tileLoad
+	hits     uint64
+	misses   uint64
+}
+
+// tileKey identifies a tile of an image.
+type tileKey struct {
+	image interface{}
+	index int
+}
+
+type tileEntry struct {
+	key  tileKey
+	data []byte
+}
+
+// A tileLoad is a tile being decoded.  done is closed once data and err are
+// set.
+type tileLoad struct {
+	done chan struct{}
+	data []byte
+	err  error
+}
+
+// NewTileCache returns a TileCache holding at most maxBytes bytes of decoded
+// data.
+func NewTileCache(maxBytes int64) *TileCache {
+	return &TileCache{
+		maxBytes: maxBytes,
+		lru:      list.New(),
+		entries:  make(map[tileKey]*list.Element, 1),
+		loading:  make(map[tileKey]*tileLoad, 1),
+	}
+}
+
+// Wrap returns a ChunkReader that reads the chunks of r through c.  The image
+// read by r is identified in the cache by key, which must be comparable.  All
+// ChunkReaders of the same image should be wrapped with the same key so they
+// share entries: for a parsed tiff.TIFF that is kept around, the tiff.IFD of
+// the image will do; if files are parsed again for each request, use
+// something like the file name and the index of the IFD.  The data returned by
+// the wrapped ReadChunk is shared and must not be modified.
+func (c *TileCache) Wrap(r ChunkReader, key interface{}) ChunkReader {
+	return &cachedChunkReader{ChunkReader: r, c: c, image: key}
+}
+
+// Stats returns the number of reads served from the cache and the number that
+// had to be decoded.
+func (c *TileCache) Stats() (hits, misses uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hits, c.misses
+}
+
+// Size returns the number of bytes of decoded data held by the cache.
+func (c *TileCache) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
+
+func (c *TileCache) get(key tileKey, load func() ([]byte, error)) ([]byte, error) {
+	c.mu.Lock()
+	if el, ok := c.entries[key]; ok {
+		c.lru.MoveToFront(el)
+		c.hits++
+		c.mu.Unlock()
+		return el.Value.(*tileEntry).data, nil
+	}
+	if l, ok := c.loading[key]; ok {
+		c.hits++
+		c.mu.Unlock()
+		<-l.done
+		return l.data, l.err
+	}
+	c.misses++
+	l := &tileLoad{done: make(chan struct{})}
+	c.loading[key] = l
+	c.mu.Unlock()
+
+	// The load is released even if load panics, so that the callers
+	// waiting for it fail instead of waiting forever, and later calls
+	// load again.
+	defer func() {
+		c.mu.Lock()
+		delete(c.loading, key)
+		if l.err == nil {
+			c.add(key, l.data)
+		}
+		c.mu.Unlock()
+		close(l.done)
+	}()
+	l.err = errLoadPanicked
+	l.data, l.err = load()
+	return l.data, l.err
+}
+
+// errLoadPanicked is the error of a load that panicked, as the callers that
+// were waiting for it see it.
+var errLoadPanicked = errors.New("tiff/image: reading the strip or tile panicked")
+
+// add adds data to the cache, evicting the least recently used entries to
+// make room.  Data larger than the whole cache is not kept.  c.mu must be
+// held.
+func (c *TileCache) add(key tileKey, data []byte) {
+	n := int64(len(data))
+	if n > c.maxBytes {
+		return
+	}
+	for c.size+n > c.maxBytes {
+		el := c.lru.Back()
+		e := el.Value.(*tileEntry)
+		c.lru.Remove(el)
+		delete(c.entries, e.key)
+		c.size -= int64(len(e.data))
+	}
+	c.entries[key] = c.lru.PushFront(&tileEntry{key, data})
+	c.size += n
+}
+
+type cachedChunkReader struct {
+	ChunkReader
+	c     *TileCache
+	image interface{}
+}
+
+func (cr *cachedChunkReader) ReadChunk(i int) ([]byte, error) {
+	return cr.c.get(tileKey{cr.image, i}, func() ([]byte, error) {
+		return cr.ChunkReader.ReadChunk(i)
+	})
+}
+
+// ReadChunkContext reads a missing chunk with ctx.  Callers waiting for the
+// same chunk share its read, and so its error if ctx is done first.
+func (cr *cachedChunkReader) ReadChunkContext(ctx context.Context, i int) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return cr.c.get(tileKey{cr.image, i}, func() ([]byte, error) {
+		return ReadChunkContext(ctx, cr.ChunkReader, i)
+	})
+}
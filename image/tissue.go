@@ -0,0 +1,157 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package image
+
+import (
+	"fmt"
+	"image/color"
+)
+
+// TissueOptions controls Slide.TissueMask.  Zero values take the defaults
+// given for each field.
+type TissueOptions struct {
+	// Level picks the level the pixels are classified on, counting up
+	// from the smallest: 0 is the smallest level, 1 the one above it, and
+	// so on.
+	Level int
+	// MaxLuminance is the luminance, from 0 to 1, above which an
+	// unsaturated pixel is glass.  Zero means 0.85.
+	MaxLuminance float64
+	// MinSaturation is the saturation, from 0 to 1, above which a pixel is
+	// tissue however bright it is.  Zero means 0.07.
+	MinSaturation float64
+	// MinFraction is the share of tissue pixels a tile needs to be marked
+	// as tissue.  Zero means 0.05.
+	MinFraction float64
+}
+
+// A TissueMask marks the tiles of the first level of a Slide that show
+// tissue rather than empty glass.
+type TissueMask struct {
+	// TileWidth and TileHeight are the size of the tiles of the first
+	// level, and Across and Down the number of them in each row and
+	// column.
+	TileWidth, TileHeight int
+	Across, Down          int
+	// Tissue holds a value per tile, row by row.
+	Tissue []bool
+}
+
+// At reports whether the tile at column col and row row shows tissue.
+func (m *TissueMask) At(col, row int) bool {
+	if col < 0 || col >= m.Across || row < 0 || row >= m.Down {
+		return false
+	}
+	return m.Tissue[row*m.Across+col]
+}
+
+// Count returns the number of tiles that show tissue.
+func (m *TissueMask) Count() int {
+	n := 0
+	for _, t := range m.Tissue {
+		if t {
+			n++
+		}
+	}
+	return n
+}
+
+// TissueMask classifies the tiles of the first level of s as tissue or
+// background from the pixels of a small level: bright pixels of little
+// saturation are glass, anything else is tissue.  A nil opts uses the
+// defaults described by TissueOptions.
+func (s *Slide) TissueMask(opts *TissueOptions) (*TissueMask, error) {
+	var o TissueOptions
+	if opts != nil {
+		o = *opts
+	}
+	if o.MaxLuminance == 0 {
+		o.MaxLuminance = 0.85
+	}
+	if o.MinSaturation == 0 {
+		o.MinSaturation = 0.07
+	}
+	if o.MinFraction == 0 {
+		o.MinFraction = 0.05
+	}
+	level := len(s.Levels) - 1 - o.Level
+	if level < 0 || level >= len(s.Levels) {
+		return nil, fmt.Errorf("tiff/image: level %d from the smallest out of range [0, %d)", o.Level, len(s.Levels))
+	}
+	l0, err := s.Layout(0)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := s.decodeLevel(level)
+	if err != nil {
+		return nil, err
+	}
+	img, err := raw.Image()
+	if err != nil {
+		return nil, err
+	}
+	m := &TissueMask{
+		TileWidth:  l0.ChunkWidth,
+		TileHeight: l0.ChunkHeight,
+		Across:     (l0.Width + l0.ChunkWidth - 1) / l0.ChunkWidth,
+		Down:       (l0.Height + l0.ChunkHeight - 1) / l0.ChunkHeight,
+	}
+	m.Tissue = make([]bool, m.Across*m.Down)
+	// Tiles of the first level map to areas of the small level scaled by
+	// its size, which is not always an exact fraction of the first.
+	sx := float64(raw.Width) / float64(l0.Width)
+	sy := float64(raw.Height) / float64(l0.Height)
+	for row := 0; row < m.Down; row++ {
+		y0, y1 := scaledSpan(row, m.TileHeight, sy, raw.Height)
+		for col := 0; col < m.Across; col++ {
+			x0, x1 := scaledSpan(col, m.TileWidth, sx, raw.Width)
+			var tissue, total int
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					total++
+					if isTissue(img.At(x, y), o) {
+						tissue++
+					}
+				}
+			}
+			m.Tissue[row*m.Across+col] = total > 0 && float64(tissue) >= o.MinFraction*float64(total)
+		}
+	}
+	return m, nil
+}
+
+// scaledSpan returns the span of pixels of a level scaled by scale that tile i
+// of size n covers, holding at least one pixel and clipped to max.
+func scaledSpan(i, n int, scale float64, max int) (lo, hi int) {
+	lo = int(float64(i*n) * scale)
+	hi = int(float64((i+1)*n) * scale)
+	if hi <= lo {
+		hi = lo + 1
+	}
+	if hi > max {
+		hi = max
+	}
+	return lo, hi
+}
+
+// isTissue reports whether c is a pixel of tissue.
+func isTissue(c color.Color, o TissueOptions) bool {
+	r, g, b, _ := c.RGBA()
+	lum := (0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)) / 0xFFFF
+	max, min := r, r
+	for _, v := range []uint32{g, b} {
+		if v > max {
+			max = v
+		}
+		if v < min {
+			min = v
+		}
+	}
+	sat := 0.0
+	if max > 0 {
+		sat = float64(max-min) / float64(max)
+	}
+	return lum <= o.MaxLuminance || sat >= o.MinSaturation
+}
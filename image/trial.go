@@ -0,0 +1,193 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package image
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"time"
+)
+
+/* Choosing a codec
+
+How well a codec does depends on the data: Deflate may halve a scanned page
+and barely shrink a noisy elevation model, and its higher levels cost time
+that a conversion of terabytes has to pay for every tile.  TrialCompressions
+measures this before committing to a choice: it cuts a sample of the chunks
+an image would be written in, as Encode would cut them, compresses each with
+every candidate and reports the sizes and times.  The sample is spread evenly
+over the image, so that borders and empty areas count as much as they do in
+the whole.
+*/
+
+// TrialOptions are the options of TrialCompressions.
+type TrialOptions struct {
+	// Encode gives the strip or tile sizes the image is to be written with.
+	// Its Compression and Codec are ignored.  Nil means the defaults of
+	// Encode.
+	Encode *EncodeOptions
+	// Candidates are the codecs to try.  Nil means every registered
+	// Compression, with Deflate tried at levels 1, 6 and 9.
+	Candidates []Compression
+	// Samples is the number of chunks compressed with each candidate.  Zero
+	// means 16.  Images with fewer chunks are compressed whole.
+	Samples int
+}
+
+// A CompressionTrial is the outcome of compressing sample chunks of an image
+// with a codec.
+type CompressionTrial struct {
+	// Label names the codec, with its level for the Deflate levels tried
+	// by default.
+	Label       string
+	Compression Compression
+	// RawBytes and CompressedBytes are the sizes of the sample chunks
+	// before and after compression, and Ratio the first over the second.
+	RawBytes, CompressedBytes int64
+	Ratio                     float64
+	// CompressTime and DecompressTime are the times taken to compress the
+	// sample chunks and decompress them back.
+	CompressTime, DecompressTime time.Duration
+	// EstimatedBytes is the size of the data of the whole image, projected
+	// from the sample.
+	EstimatedBytes int64
+	// Err is set if the codec failed to compress the sample or to restore
+	// it, in which case the sizes and times are zero.
+	Err error
+}
+
+func (t CompressionTrial) String() string {
+	if t.Err != nil {
+		return fmt.Sprintf("%s: %v", t.Label, t.Err)
+	}
+	return fmt.Sprintf("%s: %d -> %d bytes (ratio %.2f), compress %v, decompress %v, about %d bytes in all",
+		t.Label, t.RawBytes, t.CompressedBytes, t.Ratio, t.CompressTime, t.DecompressTime, t.EstimatedBytes)
+}
+
+// TrialCompressions compresses sample chunks of img with each candidate codec
+// of opts, and returns the outcomes from the smallest to the largest output.
+// Trials that failed come last.  The result is an estimate to choose the
+// EncodeOptions of a conversion with: a codec that does well on the sample
+// may do worse on parts of the image it left out.
+func TrialCompressions(img *RawImage, opts *TrialOptions) ([]CompressionTrial, error) {
+	if opts == nil {
+		opts = &TrialOptions{}
+	}
+	var eo EncodeOptions
+	if opts.Encode != nil {
+		eo = *opts.Encode
+	}
+	if err := checkEncodable(img); err != nil {
+		return nil, err
+	}
+	if _, err := eo.tiling(); err != nil {
+		return nil, err
+	}
+	candidates := opts.Candidates
+	if candidates == nil {
+		var err error
+		if candidates, err = defaultCandidates(); err != nil {
+			return nil, err
+		}
+	}
+	n := opts.Samples
+	if n <= 0 {
+		n = 16
+	}
+	// The layout does not depend on the codec, except for the
+	// Compression value it records.
+	l := encodeLayout(img, 1, &eo)
+	total := l.NumChunks()
+	if n > total {
+		n = total
+	}
+	chunks := make([][]byte, n)
+	var raw, all int64
+	for i := range chunks {
+		chunks[i] = l.extract(img, i*total/n)
+		raw += int64(len(chunks[i]))
+	}
+	for i := 0; i < total; i++ {
+		all += int64(l.chunkSize(i))
+	}
+	trials := make([]CompressionTrial, len(candidates))
+	for i, c := range candidates {
+		trials[i] = trialCompression(c, chunks)
+		if t := &trials[i]; t.Err == nil {
+			t.RawBytes = raw
+			t.Ratio = float64(raw) / float64(t.CompressedBytes)
+			t.EstimatedBytes = int64(float64(all) / t.Ratio)
+		}
+	}
+	sort.SliceStable(trials, func(i, j int) bool {
+		if (trials[i].Err == nil) != (trials[j].Err == nil) {
+			return trials[i].Err == nil
+		}
+		return trials[i].CompressedBytes < trials[j].CompressedBytes
+	})
+	return trials, nil
+}
+
+// trialCompression compresses chunks with c and decompresses them back,
+// checking that they are restored.  RawBytes, Ratio and EstimatedBytes are
+// left to the caller.
+func trialCompression(c Compression, chunks [][]byte) CompressionTrial {
+	t := CompressionTrial{Label: c.Name(), Compression: c}
+	if d, ok := c.(*deflateLevel); ok {
+		t.Label = fmt.Sprintf("%s (level %d)", c.Name(), d.level)
+	}
+	compressed := make([][]byte, len(chunks))
+	start := time.Now()
+	for i, chunk := range chunks {
+		data, err := c.Compress(chunk)
+		if err != nil {
+			t.Err = err
+			return t
+		}
+		compressed[i] = data
+		t.CompressedBytes += int64(len(data))
+	}
+	t.CompressTime = time.Since(start)
+	start = time.Now()
+	for i, data := range compressed {
+		out, err := c.Decompress(data)
+		if err != nil {
+			return CompressionTrial{Label: t.Label, Compression: c, Err: err}
+		}
+		if !bytes.Equal(out, chunks[i]) {
+			return CompressionTrial{Label: t.Label, Compression: c, Err: CompressionError{c.Name(), "decompressed data does not match the original"}}
+		}
+	}
+	t.DecompressTime = time.Since(start)
+	return t
+}
+
+// A deflateLevel is a Deflate codec tried at a given level.
+type deflateLevel struct {
+	Compression
+	level int
+}
+
+// defaultCandidates returns the candidates of TrialCompressions when
+// TrialOptions.Candidates is nil.
+func defaultCandidates() ([]Compression, error) {
+	var list []Compression
+	for _, c := range ListCompressions() {
+		// Deflate is tried at several levels instead, under its
+		// standard value.
+		if c.ID() != 8 && c.ID() != 32946 {
+			list = append(list, c)
+		}
+	}
+	for _, level := range []int{1, 6, 9} {
+		c, err := NewDeflateCompression(8, level)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, &deflateLevel{c, level})
+	}
+	return list, nil
+}
@@ -0,0 +1,409 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package imagej provides tiff extensions for working with the TIFF files
+// written by ImageJ and Fiji, which describe the dimensions of a hyperstack in
+// the ImageDescription of the first IFD and keep labels, display ranges,
+// lookup tables and other metadata in two private tags.
+package imagej
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/google/tiff"
+)
+
+// Tags of the ImageJ metadata fields.  IJMetadataByteCounts gives the size of
+// the header of IJMetadata and of each block that follows it.
+const (
+	MetadataByteCountsTagID = 50838
+	MetadataTagID           = 50839
+)
+
+var imagejTags = tiff.NewTagSet("ImageJ", 32768, 65535)
+
+func init() {
+	imagejTags.Register(tiff.NewTag(MetadataByteCountsTagID, "IJMetadataByteCounts", nil))
+	imagejTags.Register(tiff.NewTag(MetadataTagID, "IJMetadata", nil))
+
+	imagejTags.Lock()
+
+	tiff.DefaultTagSpace.RegisterTagSet(imagejTags)
+}
+
+// maxPlanes bounds the images, channels, slices and frames of a description,
+// which PlaneData multiplies into offsets of planes past the end of the IFDs.
+const maxPlanes = 1 << 24
+
+/* ImageJ metadata
+
+The ImageDescription starts with "ImageJ=" and the version, followed by a
+key=value pair per line:
+	images=24
+	channels=2
+	slices=3
+	frames=4
+	hyperstack=true
+	mode=composite
+	unit=micron
+	spacing=0.5
+	finterval=0.1
+The planes are stored channel first, then slice, then frame.  ImageJ writes
+stacks larger than 4 GB with a single IFD, the other planes following the
+data of the first one.
+
+The IJMetadata field starts with a header, in the byte order of the file:
+	Bytes 0-3:  "IJIJ"
+	Then, for each type of block, its type and the number of blocks
+	(both 4 bytes).
+The blocks follow, in the order of the header, each of the size given by
+IJMetadataByteCounts.  Text is UTF-16 in the byte order of the file.
+*/
+
+// Types of the blocks of IJMetadata.
+const (
+	magic        = 0x494a494a // "IJIJ"
+	blockInfo    = 0x696e666f // "info": the Info of the image
+	blockLabels  = 0x6c61626c // "labl": a label per plane
+	blockRanges  = 0x72616e67 // "rang": display ranges, as doubles
+	blockLUTs    = 0x6c757473 // "luts": a lookup table per channel
+	blockPlot    = 0x706c6f74 // "plot": a serialized plot
+	blockROI     = 0x726f6920 // "roi ": the ROI, in ImageJ's binary format
+	blockOverlay = 0x6f766572 // "over": an ROI per block
+	blockProps   = 0x70726f70 // "prop": keys and values, alternating
+)
+
+// A Range is the display range of a channel.
+type Range struct {
+	Min, Max float64
+}
+
+// A LUT is the lookup table that gives the colors of a channel.
+type LUT struct {
+	R, G, B [256]uint8
+}
+
+// Metadata is the metadata ImageJ keeps in a TIFF file.
+type Metadata struct {
+	// Version is the version of ImageJ that wrote the file.
+	Version string
+	// Images is the number of planes.  Channels, Slices and Frames are
+	// the sizes of the dimensions of the hyperstack, at least 1 each; a
+	// plain stack is a stack of slices.
+	Images                   int
+	Channels, Slices, Frames int
+	Hyperstack               bool
+	// Mode is how the channels are shown: "composite", "color" or
+	// "grayscale", or empty for a single channel.
+	Mode string
+	// Unit is the unit of Spacing and of the resolution of the file, such
+	// as "micron".  Spacing is the distance between slices and
+	// FrameInterval the time between frames, in seconds; both are 0 if the
+	// file does not give them.
+	Unit          string
+	Spacing       float64
+	FrameInterval float64
+	Loop          bool
+	// Min and Max are the display range of a single channel image.
+	Min, Max float64
+	// Properties holds every key=value line of the ImageDescription,
+	// including those above.
+	Properties map[string]string
+
+	// The rest come from the IJMetadata field.
+	Info   string
+	Labels []string
+	Ranges []Range
+	LUTs   []LUT
+	// ImageProperties are the properties of the image set in ImageJ (see
+	// ImagePlus.setProp).
+	ImageProperties map[string]string
+	// ROI and Overlays are in ImageJ's binary ROI format, and Plot is a
+	// serialized plot; they are left undecoded.
+	ROI      []byte
+	Overlays [][]byte
+	Plot     []byte
+}
+
+// Parse returns the ImageJ metadata of t, read from the ImageDescription of
+// the first IFD and, if it has them, from the IJMetadata fields.
+func Parse(t tiff.TIFF) (*Metadata, error) {
+	ifds := t.IFDs()
+	if len(ifds) == 0 || !ifds[0].HasField(270) {
+		return nil, fmt.Errorf("imagej: file has no ImageDescription")
+	}
+	f := ifds[0].GetField(270)
+	m, err := ParseDescription(tiff.FieldText(f))
+	if err != nil {
+		return nil, err
+	}
+	if ifds[0].HasField(MetadataTagID) && ifds[0].HasField(MetadataByteCountsTagID) {
+		if err = m.readMetadata(ifds[0]); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// ParseDescription returns the Metadata given by desc, the ImageDescription of
+// an ImageJ file.  The fields read from IJMetadata are left empty.
+func ParseDescription(desc string) (*Metadata, error) {
+	desc = strings.TrimRight(desc, "\x00")
+	if !strings.HasPrefix(desc, "ImageJ=") {
+		return nil, fmt.Errorf("imagej: ImageDescription is not from ImageJ")
+	}
+	m := &Metadata{Properties: make(map[string]string)}
+	for _, line := range strings.Split(desc, "\n") {
+		kv := strings.SplitN(strings.TrimSpace(line), "=", 2)
+		if len(kv) == 2 {
+			m.Properties[kv[0]] = kv[1]
+		}
+	}
+	m.Version = m.Properties["ImageJ"]
+	m.Hyperstack = m.Properties["hyperstack"] == "true"
+	m.Loop = m.Properties["loop"] == "true"
+	m.Mode = m.Properties["mode"]
+	m.Unit = unescape(m.Properties["unit"])
+	for _, v := range []struct {
+		key string
+		dst *int
+	}{
+		{"images", &m.Images},
+		{"channels", &m.Channels},
+		{"slices", &m.Slices},
+		{"frames", &m.Frames},
+	} {
+		s, ok := m.Properties[v.key]
+		if !ok {
+			*v.dst = 1
+			continue
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 || n > maxPlanes {
+			return nil, fmt.Errorf("imagej: invalid %s %q", v.key, s)
+		}
+		*v.dst = n
+	}
+	for _, v := range []struct {
+		key string
+		dst *float64
+	}{
+		{"spacing", &m.Spacing},
+		{"finterval", &m.FrameInterval},
+		{"min", &m.Min},
+		{"max", &m.Max},
+	} {
+		if s, ok := m.Properties[v.key]; ok {
+			x, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				return nil, fmt.Errorf("imagej: invalid %s %q", v.key, s)
+			}
+			*v.dst = x
+		}
+	}
+	n := int64(m.Channels) * int64(m.Slices) * int64(m.Frames)
+	switch {
+	case n == int64(m.Images):
+	case n == 1:
+		// A plain stack gives only the number of images.
+		m.Slices = m.Images
+	case m.Properties["images"] == "":
+		m.Images = int(n)
+	default:
+		return nil, fmt.Errorf("imagej: %d channels, %d slices and %d frames do not make %d images", m.Channels, m.Slices, m.Frames, m.Images)
+	}
+	if m.Images > maxPlanes {
+		return nil, fmt.Errorf("imagej: %d images is too many", m.Images)
+	}
+	return m, nil
+}
+
+// unescape decodes the \uXXXX escapes ImageJ writes for units that are not
+// ASCII, such as "µm".
+func unescape(s string) string {
+	if !strings.Contains(s, `\u`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if strings.HasPrefix(s[i:], `\u`) && i+6 <= len(s) {
+			if r, err := strconv.ParseUint(s[i+2:i+6], 16, 16); err == nil {
+				b.WriteRune(rune(r))
+				i += 5
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// readMetadata reads the blocks of the IJMetadata field of ifd into m.
+func (m *Metadata) readMetadata(ifd tiff.IFD) error {
+	f := ifd.GetField(MetadataTagID)
+	bo := f.Value().Order()
+	data := f.Value().Bytes()[:f.Count()*f.Type().Size()]
+	var counts struct {
+		Counts []uint32 `tiff:"field,tag=50838"`
+	}
+	if err := tiff.UnmarshalIFD(ifd, &counts); err != nil {
+		return err
+	}
+	if len(counts.Counts) == 0 || len(data) < 4 || bo.Uint32(data) != magic {
+		return fmt.Errorf("imagej: IJMetadata has no header")
+	}
+	header := counts.Counts[0]
+	if header < 4 || header%8 != 4 || uint64(header) > uint64(len(data)) {
+		return fmt.Errorf("imagej: IJMetadata header is %d bytes long", header)
+	}
+	off := uint64(header)
+	next := 1
+	var props []string
+	for h := data[4:header]; len(h) > 0; h = h[8:] {
+		typ, n := bo.Uint32(h), bo.Uint32(h[4:])
+		for i := uint32(0); i < n; i++ {
+			if next >= len(counts.Counts) {
+				return fmt.Errorf("imagej: IJMetadataByteCounts has %d counts, but the header lists more blocks", len(counts.Counts))
+			}
+			size := uint64(counts.Counts[next])
+			next++
+			if off+size > uint64(len(data)) {
+				return fmt.Errorf("imagej: block %d of IJMetadata ends past the end of the field", next-1)
+			}
+			if typ == blockProps {
+				props = append(props, decodeUTF16(data[off:off+size], bo))
+			} else if err := m.readBlock(typ, data[off:off+size], bo); err != nil {
+				return err
+			}
+			off += size
+		}
+	}
+	// Keys and values are blocks of their own, alternating.
+	for i := 0; i+1 < len(props); i += 2 {
+		if m.ImageProperties == nil {
+			m.ImageProperties = make(map[string]string)
+		}
+		m.ImageProperties[props[i]] = props[i+1]
+	}
+	return nil
+}
+
+// readBlock reads a block of type typ other than "prop".  Blocks of unknown
+// types are skipped.
+func (m *Metadata) readBlock(typ uint32, p []byte, bo binary.ByteOrder) error {
+	switch typ {
+	case blockInfo:
+		m.Info = decodeUTF16(p, bo)
+	case blockLabels:
+		m.Labels = append(m.Labels, decodeUTF16(p, bo))
+	case blockRanges:
+		for ; len(p) >= 16; p = p[16:] {
+			m.Ranges = append(m.Ranges, Range{
+				math.Float64frombits(bo.Uint64(p)),
+				math.Float64frombits(bo.Uint64(p[8:])),
+			})
+		}
+	case blockLUTs:
+		if len(p) != 768 {
+			return fmt.Errorf("imagej: LUT is %d bytes long, not 768", len(p))
+		}
+		var lut LUT
+		copy(lut.R[:], p)
+		copy(lut.G[:], p[256:])
+		copy(lut.B[:], p[512:])
+		m.LUTs = append(m.LUTs, lut)
+	case blockPlot:
+		m.Plot = p
+	case blockROI:
+		m.ROI = p
+	case blockOverlay:
+		m.Overlays = append(m.Overlays, p)
+	}
+	return nil
+}
+
+func decodeUTF16(p []byte, bo binary.ByteOrder) string {
+	u := make([]uint16, len(p)/2)
+	for i := range u {
+		u[i] = bo.Uint16(p[2*i:])
+	}
+	return string(utf16.Decode(u))
+}
+
+// Color returns the color of the brightest entry of the LUT, the color a
+// channel is shown in.
+func (l *LUT) Color() (r, g, b uint8) {
+	return l.R[255], l.G[255], l.B[255]
+}
+
+// PlaneIndex returns the index among the planes of the file of channel c of
+// slice z at frame t, all counted from 0.  In files with an IFD per plane, it
+// is the index of the IFD in the IFD chain.
+func (m *Metadata) PlaneIndex(c, z, t int) (int, error) {
+	if c < 0 || c >= m.Channels || z < 0 || z >= m.Slices || t < 0 || t >= m.Frames {
+		return 0, fmt.Errorf("imagej: plane (c=%d, z=%d, t=%d) is outside of [%d, %d, %d)", c, z, t, m.Channels, m.Slices, m.Frames)
+	}
+	return (t*m.Slices+z)*m.Channels + c, nil
+}
+
+// Contiguous reports whether the planes of tf, which m describes, follow the
+// data of the first IFD rather than being in IFDs of their own, as they are in
+// the stacks larger than 4 GB ImageJ writes.  Use PlaneData to find them.
+func (m *Metadata) Contiguous(tf tiff.TIFF) bool {
+	return m.Images > 1 && len(tf.IFDs()) < m.Images
+}
+
+// PlaneData returns the offset and size of the image data of plane i of tf,
+// which m describes.  The IFD holding the plane (the first one, for a
+// Contiguous file) must store its data as a single run of strips.
+func (m *Metadata) PlaneData(tf tiff.TIFF, i int) (off, n uint64, err error) {
+	if i < 0 || i >= m.Images {
+		return 0, 0, fmt.Errorf("imagej: plane %d of %d planes", i, m.Images)
+	}
+	ifds := tf.IFDs()
+	if len(ifds) == 0 {
+		return 0, 0, fmt.Errorf("imagej: file has no IFDs")
+	}
+	idx := i
+	if m.Contiguous(tf) {
+		idx = 0
+	}
+	off, n, err = stripRun(ifds[idx])
+	if err != nil {
+		return 0, 0, fmt.Errorf("imagej: IFD %d: %v", idx, err)
+	}
+	if idx != i {
+		off += uint64(i) * n
+	}
+	return off, n, nil
+}
+
+// stripRun returns the offset and total size of the strips of ifd, which must
+// follow one another.
+func stripRun(ifd tiff.IFD) (off, n uint64, err error) {
+	var strips struct {
+		Offsets    []uint64 `tiff:"field,tag=273"`
+		ByteCounts []uint64 `tiff:"field,tag=279"`
+	}
+	if err = tiff.UnmarshalIFD(ifd, &strips); err != nil {
+		return 0, 0, err
+	}
+	if len(strips.Offsets) == 0 || len(strips.Offsets) != len(strips.ByteCounts) {
+		return 0, 0, fmt.Errorf("%d strip offsets and %d byte counts", len(strips.Offsets), len(strips.ByteCounts))
+	}
+	next := strips.Offsets[0]
+	for j, o := range strips.Offsets {
+		if o != next {
+			return 0, 0, fmt.Errorf("strip %d is not stored after strip %d", j, j-1)
+		}
+		next += strips.ByteCounts[j]
+		n += strips.ByteCounts[j]
+	}
+	return strips.Offsets[0], n, nil
+}
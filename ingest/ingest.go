@@ -0,0 +1,348 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package ingest runs the loop of a service that watches directories for new
+// TIFF files and hands each of them, parsed and optionally validated, to a
+// callback.  It waits for files to stop changing before reading them and
+// retries those that can not be parsed yet, as happens when a file is still
+// being copied.  File system notifications come from a Watcher, so that the
+// package does not depend on any one notification library.
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/tiff"
+)
+
+// An Op is a set of changes to a file.  The values are those of the fsnotify
+// package, so that its events convert directly.
+type Op uint32
+
+const (
+	Create Op = 1 << iota
+	Write
+	Remove
+	Rename
+	Chmod
+)
+
+// An Event is a change to the named file.
+type Event struct {
+	Name string
+	Op   Op
+}
+
+// A Watcher reports changes to the files of the directories added to it.  An
+// adapter for github.com/fsnotify/fsnotify, whose Watcher has Events and
+// Errors fields rather than methods, is a few lines long.
+type Watcher interface {
+	Add(dir string) error
+	Events() <-chan Event
+	Errors() <-chan error
+	Close() error
+}
+
+// A File is a file handed to Options.Handle.
+type File struct {
+	Path string
+	Size int64
+	TIFF tiff.TIFF
+	// Warnings are the violations found while parsing the file (see
+	// tiff.ParseWithOptions).
+	Warnings []tiff.Violation
+	// Findings are the results of tiff.Validate, if Options.Validate is
+	// set.
+	Findings []tiff.Finding
+}
+
+// Options controls Run.
+type Options struct {
+	// Handle is called for each file once it is parsed.  The file is open
+	// until Handle returns, and is closed afterwards.  An error is reported
+	// to OnError; the file is not retried.
+	Handle func(f *File) error
+	// OnError, if not nil, is called with the files that could not be
+	// handled, and with the errors of the Watcher (with an empty path).
+	OnError func(path string, err error)
+	// Match reports whether the named file is to be handled.  nil means
+	// files ending in ".tif" or ".tiff", in any case.
+	Match func(path string) bool
+	// Parse, if not nil, is used to parse each file (see
+	// tiff.ParseWithOptions).
+	Parse *tiff.ParseOptions
+	// Validate runs tiff.Validate on each file before it is handled.
+	Validate bool
+	// Existing handles the files already in the directories when Run
+	// starts, as well as new ones.
+	Existing bool
+
+	// Settle is how long a file must go without changing before it is
+	// read.  Zero means 2 seconds.
+	Settle time.Duration
+	// Retries is the number of times a file that can not be read or parsed
+	// is tried again, each time after a longer wait, before it is given
+	// up.  Zero means 3; use a negative number for none.
+	Retries int
+	// Workers is the number of files handled at once.  Zero means 1.
+	Workers int
+}
+
+// Run watches dirs through w until ctx is done or w stops sending events,
+// handling the files that are created or written in them as opts directs.
+// Files being handled when Run stops are finished first.  w is closed when Run
+// returns.  The error of ctx is returned, or nil if w stopped.
+func Run(ctx context.Context, w Watcher, dirs []string, opts Options) error {
+	defer w.Close()
+	if opts.Handle == nil {
+		return fmt.Errorf("ingest: no Handle function")
+	}
+	r := newRunner(opts)
+	for _, dir := range dirs {
+		if err := w.Add(dir); err != nil {
+			return fmt.Errorf("ingest: unable to watch %s: %v", dir, err)
+		}
+	}
+	if opts.Existing {
+		for _, dir := range dirs {
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				return fmt.Errorf("ingest: unable to list %s: %v", dir, err)
+			}
+			for _, e := range entries {
+				if e.Type().IsRegular() {
+					r.changed(filepath.Join(dir, e.Name()))
+				}
+			}
+		}
+	}
+	defer r.stop()
+	events, errs := w.Events(), w.Errors()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case ev, ok := <-events:
+			if !ok {
+				return nil
+			}
+			switch {
+			case ev.Op&(Remove|Rename) != 0:
+				r.removed(ev.Name)
+			case ev.Op&(Create|Write) != 0:
+				r.changed(ev.Name)
+			}
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			r.report("", err)
+		case path := <-r.due:
+			r.fire(path)
+		case res := <-r.done:
+			r.finish(res)
+		}
+	}
+}
+
+// A pending file is one that has changed and is waiting to be handled.
+type pending struct {
+	timer    *time.Timer
+	size     int64 // when it last changed
+	attempts int   // failed so far
+	busy     bool  // being handled
+	dirty    bool  // changed while being handled
+}
+
+// A result is the outcome of handling a file.
+type result struct {
+	path  string
+	err   error
+	retry bool // err is from reading or parsing the file
+}
+
+// A runner holds the state of Run, which only the goroutine of Run touches.
+type runner struct {
+	opts    Options
+	files   map[string]*pending
+	due     chan string
+	done    chan result
+	quit    chan struct{}
+	workers chan struct{}
+	wg      sync.WaitGroup
+}
+
+func newRunner(opts Options) *runner {
+	if opts.Match == nil {
+		opts.Match = func(path string) bool {
+			ext := strings.ToLower(filepath.Ext(path))
+			return ext == ".tif" || ext == ".tiff"
+		}
+	}
+	if opts.Settle <= 0 {
+		opts.Settle = 2 * time.Second
+	}
+	if opts.Retries == 0 {
+		opts.Retries = 3
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = 1
+	}
+	return &runner{
+		opts:    opts,
+		files:   make(map[string]*pending),
+		due:     make(chan string),
+		done:    make(chan result),
+		quit:    make(chan struct{}),
+		workers: make(chan struct{}, opts.Workers),
+	}
+}
+
+// changed notes that the named file changed, putting off handling it until it
+// settles.
+func (r *runner) changed(path string) {
+	if !r.opts.Match(path) {
+		return
+	}
+	p := r.files[path]
+	if p == nil {
+		p = &pending{}
+		r.files[path] = p
+	}
+	p.size = fileSize(path)
+	if p.busy {
+		p.dirty = true
+		return
+	}
+	r.schedule(path, p, r.opts.Settle)
+}
+
+// removed forgets the named file.  A file being handled is finished.
+func (r *runner) removed(path string) {
+	if p := r.files[path]; p != nil && !p.busy {
+		if p.timer != nil {
+			p.timer.Stop()
+		}
+		delete(r.files, path)
+	}
+}
+
+// schedule arranges for the named file to be due after d.
+func (r *runner) schedule(path string, p *pending, d time.Duration) {
+	if p.timer != nil {
+		p.timer.Stop()
+	}
+	p.timer = time.AfterFunc(d, func() {
+		select {
+		case r.due <- path:
+		case <-r.quit:
+		}
+	})
+}
+
+// fire handles the named file if it has settled.
+func (r *runner) fire(path string) {
+	p := r.files[path]
+	if p == nil || p.busy {
+		return
+	}
+	if size := fileSize(path); size != p.size {
+		// The file changed without an event, as happens on some
+		// network file systems.
+		p.size = size
+		r.schedule(path, p, r.opts.Settle)
+		return
+	}
+	p.busy = true
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		select {
+		case r.workers <- struct{}{}:
+		case <-r.quit:
+			return
+		}
+		res := r.handle(path)
+		<-r.workers
+		select {
+		case r.done <- res:
+		case <-r.quit:
+		}
+	}()
+}
+
+// finish records the outcome of handling a file, scheduling it again if it
+// changed meanwhile or may yet be readable.
+func (r *runner) finish(res result) {
+	p := r.files[res.path]
+	p.busy = false
+	switch {
+	case p.dirty:
+		p.dirty, p.attempts = false, 0
+		r.schedule(res.path, p, r.opts.Settle)
+	case res.retry && p.attempts < r.opts.Retries:
+		p.attempts++
+		r.schedule(res.path, p, time.Duration(p.attempts+1)*r.opts.Settle)
+	default:
+		delete(r.files, res.path)
+		if res.err != nil {
+			r.report(res.path, res.err)
+		}
+	}
+}
+
+// handle reads, parses and validates the named file and hands it to Handle.
+func (r *runner) handle(path string) result {
+	rf, err := tiff.OpenReadOnly(path)
+	if err != nil {
+		return result{path, err, true}
+	}
+	defer rf.Close()
+	f := &File{Path: path}
+	if f.Size, err = rf.Size(); err != nil {
+		return result{path, err, true}
+	}
+	if f.TIFF, f.Warnings, err = tiff.ParseWithOptions(rf, r.opts.Parse); err != nil {
+		return result{path, err, true}
+	}
+	if r.opts.Validate {
+		f.Findings = tiff.Validate(f.TIFF)
+	}
+	return result{path, r.opts.Handle(f), false}
+}
+
+// report hands err to OnError.
+func (r *runner) report(path string, err error) {
+	if r.opts.OnError != nil {
+		r.opts.OnError(path, err)
+	}
+}
+
+// stop cancels the files waiting to be handled and waits for those being
+// handled.
+func (r *runner) stop() {
+	close(r.quit)
+	for _, p := range r.files {
+		if p.timer != nil {
+			p.timer.Stop()
+		}
+	}
+	r.wg.Wait()
+}
+
+// fileSize returns the size of the named file, or -1 if it can not be found.
+func fileSize(path string) int64 {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return -1
+	}
+	return fi.Size()
+}
@@ -0,0 +1,136 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tiff
+
+import (
+	"math/big"
+	"reflect"
+	"sync"
+)
+
+// DefaultMaxInternLen is the default length of the longest string an Interner
+// will keep.
+const DefaultMaxInternLen = 256
+
+// An Interner keeps a single copy of each distinct decoded value it is given so
+// that metadata decoded from many similar files (values such as Make, Model,
+// Software, or the usual resolutions) share memory instead of each holding
+// their own copy.  An Interner is safe for concurrent use.  Values are kept for
+// as long as the Interner is, so it is best suited to repeated values; long
+// strings are not interned at all (see MaxLen).
+type Interner struct {
+	// MaxLen is the length of the longest string that is interned.  Zero
+	// means DefaultMaxInternLen.
+	MaxLen int
+
+	mu   sync.Mutex
+	strs map[string]string
+	rats map[string]*big.Rat
+}
+
+// NewInterner returns an empty Interner.  The zero value is also ready to use.
+func NewInterner() *Interner {
+	return &Interner{
+		strs: make(map[string]string, 1),
+		rats: make(map[string]*big.Rat, 1),
+	}
+}
+
+func (in *Interner) maxLen() int {
+	if in.MaxLen == 0 {
+		return DefaultMaxInternLen
+	}
+	return in.MaxLen
+}
+
+// String returns the interned copy of s.
+func (in *Interner) String(s string) string {
+	if len(s) > in.maxLen() {
+		return s
+	}
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	if is, ok := in.strs[s]; ok {
+		return is
+	}
+	if in.strs == nil {
+		in.strs = make(map[string]string, 1)
+	}
+	in.strs[s] = s
+	return s
+}
+
+// Rat returns the interned copy of r.  The returned value is shared and must
+// not be modified.
+func (in *Interner) Rat(r *big.Rat) *big.Rat {
+	if r == nil {
+		return nil
+	}
+	key := r.RatString()
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	if ir, ok := in.rats[key]; ok {
+		return ir
+	}
+	if in.rats == nil {
+		in.rats = make(map[string]*big.Rat, 1)
+	}
+	in.rats[key] = r
+	return r
+}
+
+// Len returns the number of distinct values held by in.
+func (in *Interner) Len() int {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	return len(in.strs) + len(in.rats)
+}
+
+// Intern replaces the strings and *big.Rat values found in the struct that out
+// points to (as filled in by UnmarshalIFD or UnmarshalTIFF) with their interned
+// copies.  Nested structs, pointers, slices, and arrays are followed.  Since
+// the *big.Rat values become shared, they must not be modified afterwards.
+func (in *Interner) Intern(out interface{}) {
+	in.intern(reflect.ValueOf(out), 0)
+}
+
+// maxInternDepth bounds the recursion of intern for self referencing values.
+const maxInternDepth = 16
+
+func (in *Interner) intern(v reflect.Value, depth int) {
+	if depth > maxInternDepth {
+		return
+	}
+	switch v.Kind() {
+	case reflect.String:
+		if v.CanSet() {
+			v.SetString(in.String(v.String()))
+		}
+	case reflect.Ptr:
+		if v.IsNil() {
+			return
+		}
+		if v.Type() == bigRatType {
+			if v.CanSet() {
+				v.Set(reflect.ValueOf(in.Rat(v.Interface().(*big.Rat))))
+			}
+			return
+		}
+		in.intern(v.Elem(), depth+1)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			in.intern(v.Field(i), depth+1)
+		}
+	case reflect.Slice, reflect.Array:
+		switch v.Type().Elem().Kind() {
+		case reflect.String, reflect.Ptr, reflect.Struct, reflect.Slice, reflect.Array:
+		default:
+			return // Nothing to intern in slices of numbers.
+		}
+		for i := 0; i < v.Len(); i++ {
+			in.intern(v.Index(i), depth+1)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tiff
+
+import "fmt"
+
+// IPTCTagID is the ID of the tag holding an IPTC-NAA record block (tag 33723).
+// Many writers (notably Photoshop) store the block as LONG values even though
+// it is really a sequence of bytes.  BYTE and UNDEFINED are also seen.
+const IPTCTagID = 33723
+
+// iptcTagMarker is the byte that starts each IPTC-NAA dataset.
+const iptcTagMarker = 0x1C
+
+func validateIPTC(p []byte) error {
+	if len(p) == 0 {
+		return ErrInvalidFieldValue{IPTCTagID, "empty iptc block"}
+	}
+	if p[0] != iptcTagMarker {
+		return ErrInvalidFieldValue{IPTCTagID, fmt.Sprintf("iptc block starts with %#02x instead of %#02x", p[0], iptcTagMarker)}
+	}
+	return nil
+}
+
+// IPTC returns the IPTC-NAA block embedded in ifd.  When the block was stored
+// as LONG values, the bytes are returned as they appear in the file (which may
+// include trailing padding).  If ifd has no IPTC block, nil is returned along
+// with a nil error.
+func IPTC(ifd IFD) ([]byte, error) {
+	if !ifd.HasField(IPTCTagID) {
+		return nil, nil
+	}
+	f := ifd.GetField(IPTCTagID)
+	switch f.Type().ID() {
+	case FTLong.ID(), FTUndefined.ID(), FTByte.ID():
+	default:
+		return nil, ErrInvalidFieldValue{IPTCTagID, fmt.Sprintf("unexpected field type %q", f.Type().Name())}
+	}
+	p := f.Value().Bytes()[:f.Count()*f.Type().Size()]
+	if err := validateIPTC(p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// SetIPTC embeds the IPTC-NAA block data in the IFD at index idx of t.IFDs(),
+// replacing any existing block.  For compatibility with existing readers, the
+// block is written as LONG values, padded with zeros to a multiple of 4 bytes.
+// Like SetXMP, the new data is appended to the end of the file behind rw.
+func SetIPTC(rw ReadWriteAtSeeker, t TIFF, idx int, data []byte) error {
+	if err := validateIPTC(data); err != nil {
+		return err
+	}
+	padded := make([]byte, (len(data)+3)/4*4)
+	copy(padded, data)
+	f := newField(IPTCTagID, FTLong.ID(), uint32(len(padded)/4), padded, t.R().ByteOrder(), nil, nil)
+	return rewriteIFD(rw, t, idx, []Field{f}, nil)
+}
+
+// RemoveIPTC removes the IPTC-NAA block from the IFD at index idx of
+// t.IFDs().
+func RemoveIPTC(rw ReadWriteAtSeeker, t TIFF, idx int) error {
+	return rewriteIFD(rw, t, idx, nil, []uint16{IPTCTagID})
+}
@@ -0,0 +1,149 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.23
+// +build go1.23
+
+package tiff
+
+import (
+	"fmt"
+	"iter"
+)
+
+// An IFDRef is an IFD found by Iterator.IFDs or Iterator.Images along with
+// where it was found.
+type IFDRef struct {
+	// Path names the IFD, such as "IFD 0" or "IFD 0/34665[0]" for the Exif
+	// IFD of the first page.
+	Path string
+	// Parent is the tag that pointed to the IFD, or 0 for the IFDs of the
+	// main IFD chain.
+	Parent uint16
+	IFD    IFD
+}
+
+// Entries returns an iterator over the entries of the IFD of r in the order
+// they are stored (see RawIFD).
+func (r IFDRef) Entries() iter.Seq[GenericEntry] {
+	return func(yield func(GenericEntry) bool) {
+		for _, f := range r.IFD.Fields() {
+			if !yield(EntryOf(f)) {
+				return
+			}
+		}
+	}
+}
+
+// An Iterator gives a TIFF iterator methods, so that its IFDs can be ranged
+// over:
+//
+//	for ref, err := range tiff.Iter(t).IFDs() {
+//		if err != nil {
+//			return err
+//		}
+//		for e := range ref.Entries() {
+//			...
+//		}
+//	}
+type Iterator struct {
+	t TIFF
+}
+
+// Iter returns an Iterator over the IFDs of t.
+func Iter(t TIFF) Iterator {
+	return Iterator{t}
+}
+
+// IFDs returns an iterator over the IFDs of the main IFD chain, each followed
+// by the sub-IFDs (see RegisterSubIFDTag) it references, depth first.  Each
+// sub-IFD is parsed when the iteration reaches it, so stopping early saves
+// reading the rest.  An error parsing a sub-IFD, or sub-IFDs nested more than
+// 8 deep, is yielded once, after which the iteration stops.
+func (it Iterator) IFDs() iter.Seq2[IFDRef, error] {
+	return func(yield func(IFDRef, error) bool) {
+		w := &ifdWalker{
+			t:     it.t,
+			parse: GetIFDParser(it.t.Version()),
+			yield: yield,
+			seen:  make(map[uint64]bool, len(it.t.IFDs())),
+		}
+		for i, ifd := range it.t.IFDs() {
+			if !w.walk(IFDRef{fmt.Sprintf("IFD %d", i), 0, ifd}, 0) {
+				return
+			}
+		}
+	}
+}
+
+// Images returns an iterator over the IFDs found by IFDs that hold image data
+// in strips or tiles, such as the pages of a file and reduced resolution
+// images stored as SubIFDs.
+func (it Iterator) Images() iter.Seq2[IFDRef, error] {
+	return func(yield func(IFDRef, error) bool) {
+		for ref, err := range it.IFDs() {
+			if err != nil {
+				yield(ref, err)
+				return
+			}
+			if !ref.IFD.HasField(273) && !ref.IFD.HasField(324) {
+				continue
+			}
+			if !yield(ref, nil) {
+				return
+			}
+		}
+	}
+}
+
+type ifdWalker struct {
+	t     TIFF
+	parse IFDParser
+	yield func(IFDRef, error) bool
+	seen  map[uint64]bool // offsets of the sub-IFDs visited
+}
+
+// walk yields ref and then its sub-IFDs.  It reports whether the iteration
+// should go on.
+func (w *ifdWalker) walk(ref IFDRef, depth int) bool {
+	if !w.yield(ref, nil) {
+		return false
+	}
+	for _, f := range ref.IFD.Fields() {
+		id := f.Tag().ID()
+		tsp, ok := GetSubIFDTag(id)
+		if !ok {
+			continue
+		}
+		if depth >= maxFingerprintDepth {
+			w.yield(ref, fmt.Errorf("tiff: %s: sub-ifds nested more than %d deep", ref.Path, maxFingerprintDepth))
+			return false
+		}
+		offsets, err := uintValues(f)
+		if err != nil {
+			w.yield(ref, err)
+			return false
+		}
+		br := IFDReader(w.t)
+		for i, off := range offsets {
+			if w.seen[off] {
+				continue
+			}
+			w.seen[off] = true
+			if err = CheckContext(br); err != nil {
+				w.yield(ref, err)
+				return false
+			}
+			sub, err := w.parse(br, off, tsp, nil)
+			if err != nil {
+				w.yield(ref, err)
+				return false
+			}
+			if !w.walk(IFDRef{fmt.Sprintf("%s/%d[%d]", ref.Path, id, i), id, sub}, depth+1) {
+				return false
+			}
+		}
+	}
+	return true
+}
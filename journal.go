@@ -0,0 +1,221 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tiff
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+/*
+Undo journal structure
+  The journal starts with a 16 byte header followed by zero or more records.
+	Bytes 0-7:   The magic string "TIFFUNDO".
+	Bytes 8-15:  The size of the file before any edits (big endian int64).
+  Each record holds bytes of the file as they were before being overwritten.
+	Bytes 0-7:   The file offset of the bytes (big endian int64).
+	Bytes 8-11:  The number of bytes, n (big endian uint32).
+	Bytes 12-:   The n original bytes.
+  A record is always synced to disk before the bytes it describes are changed,
+  so an incomplete trailing record can safely be ignored.
+*/
+
+// JournalSuffix is appended to the name of a file to form the name of the
+// undo journal used while the file is edited through a JournaledFile.
+const JournalSuffix = ".undo"
+
+const journalMagic = "TIFFUNDO"
+
+// JournaledFile is a file opened for in-place editing that writes an undo
+// journal before any of the file's existing bytes are changed.  Bytes written
+// past the original end of the file need no journal records since rolling back
+// simply truncates the file to its original size.  If an edit is interrupted
+// (i.e. the program crashes before Close or Commit is called), the journal is
+// left behind and the file is rolled back the next time it is opened with
+// OpenJournaled (or when Rollback is called).
+//
+// JournaledFile satisfies ReadWriteAtSeeker so it can be used with any of the
+// in-place editing functions of this package.  It intentionally does not
+// expose the other write methods of os.File, which would bypass the journal.
+type JournaledFile struct {
+	f     *os.File
+	name  string
+	size  int64    // size of the file when it was opened
+	j     *os.File // created on the first write
+	jsize int64
+}
+
+// OpenJournaled opens the named file for journaled in-place editing.  If a
+// journal from a previous interrupted edit exists, the file is rolled back
+// first.
+func OpenJournaled(name string) (*JournaledFile, error) {
+	if err := Rollback(name); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(name, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &JournaledFile{f: f, name: name, size: fi.Size()}, nil
+}
+
+func (jf *JournaledFile) Name() string {
+	return jf.name
+}
+
+func (jf *JournaledFile) Read(p []byte) (int, error) {
+	return jf.f.Read(p)
+}
+
+func (jf *JournaledFile) ReadAt(p []byte, off int64) (int, error) {
+	return jf.f.ReadAt(p, off)
+}
+
+func (jf *JournaledFile) Seek(offset int64, whence int) (int64, error) {
+	return jf.f.Seek(offset, whence)
+}
+
+// WriteAt records the bytes about to be overwritten in the journal, syncs the
+// journal, and then writes p to the file at off.
+func (jf *JournaledFile) WriteAt(p []byte, off int64) (int, error) {
+	if jf.j == nil {
+		if err := jf.startJournal(); err != nil {
+			return 0, err
+		}
+	}
+	if off < jf.size {
+		n := int64(len(p))
+		if off+n > jf.size {
+			n = jf.size - off
+		}
+		rec := make([]byte, 12+n)
+		binary.BigEndian.PutUint64(rec, uint64(off))
+		binary.BigEndian.PutUint32(rec[8:], uint32(n))
+		if _, err := jf.f.ReadAt(rec[12:], off); err != nil {
+			return 0, fmt.Errorf("tiff: journal: unable to read original bytes at offset %d: %v", off, err)
+		}
+		if _, err := jf.j.WriteAt(rec, jf.jsize); err != nil {
+			return 0, fmt.Errorf("tiff: journal: %v", err)
+		}
+		if err := jf.j.Sync(); err != nil {
+			return 0, fmt.Errorf("tiff: journal: %v", err)
+		}
+		jf.jsize += int64(len(rec))
+	}
+	return jf.f.WriteAt(p, off)
+}
+
+func (jf *JournaledFile) startJournal() error {
+	j, err := os.OpenFile(jf.name+JournalSuffix, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return fmt.Errorf("tiff: journal: %v", err)
+	}
+	var hdr [16]byte
+	copy(hdr[:], journalMagic)
+	binary.BigEndian.PutUint64(hdr[8:], uint64(jf.size))
+	if _, err = j.Write(hdr[:]); err == nil {
+		err = j.Sync()
+	}
+	if err != nil {
+		j.Close()
+		os.Remove(jf.name + JournalSuffix)
+		return fmt.Errorf("tiff: journal: %v", err)
+	}
+	jf.j = j
+	jf.jsize = int64(len(hdr))
+	return nil
+}
+
+// Commit syncs the file and removes the journal, making all edits so far
+// permanent.  Editing may continue after a call to Commit.
+func (jf *JournaledFile) Commit() error {
+	if err := jf.f.Sync(); err != nil {
+		return err
+	}
+	if fi, err := jf.f.Stat(); err == nil {
+		jf.size = fi.Size()
+	}
+	if jf.j == nil {
+		return nil
+	}
+	jf.j.Close()
+	jf.j = nil
+	return os.Remove(jf.name + JournalSuffix)
+}
+
+// Close commits any edits and closes the file.
+func (jf *JournaledFile) Close() error {
+	if err := jf.Commit(); err != nil {
+		jf.f.Close()
+		return err
+	}
+	return jf.f.Close()
+}
+
+// Rollback undoes an interrupted edit of the named file using the journal left
+// behind by a JournaledFile.  If there is no journal, Rollback does nothing.
+func Rollback(name string) error {
+	jname := name + JournalSuffix
+	data, err := ioutil.ReadFile(jname)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("tiff: journal: %v", err)
+	}
+	if len(data) < 16 || string(data[:8]) != journalMagic {
+		// The header is only missing if the edit was interrupted before
+		// anything was written to the file.
+		if len(data) < 16 {
+			return os.Remove(jname)
+		}
+		return fmt.Errorf("tiff: journal: %s is not an undo journal", jname)
+	}
+	size := int64(binary.BigEndian.Uint64(data[8:]))
+
+	type record struct {
+		off  int64
+		orig []byte
+	}
+	var recs []record
+	for buf := data[16:]; len(buf) >= 12; {
+		n := int(binary.BigEndian.Uint32(buf[8:]))
+		if len(buf) < 12+n {
+			break // Torn record; its write never happened.
+		}
+		recs = append(recs, record{int64(binary.BigEndian.Uint64(buf)), buf[12 : 12+n]})
+		buf = buf[12+n:]
+	}
+
+	f, err := os.OpenFile(name, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	// Apply the records in reverse so that the oldest copy of any byte that
+	// was overwritten more than once wins.
+	for i := len(recs) - 1; i >= 0; i-- {
+		if _, err = f.WriteAt(recs[i].orig, recs[i].off); err != nil {
+			f.Close()
+			return fmt.Errorf("tiff: journal: rollback failed: %v", err)
+		}
+	}
+	if err = f.Truncate(size); err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("tiff: journal: rollback failed: %v", err)
+	}
+	return os.Remove(jname)
+}
@@ -0,0 +1,337 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tiff
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+// A JSONDocument is the metadata of a TIFF file as exported by ToJSON: every
+// IFD of the main chain along with its sub-IFDs, and every field with its
+// values decoded.
+type JSONDocument struct {
+	// ByteOrder is "II" or "MM".
+	ByteOrder string    `json:"byteOrder"`
+	Version   uint16    `json:"version"`
+	IFDs      []JSONIFD `json:"ifds"`
+}
+
+// A JSONIFD is an IFD of a JSONDocument.
+type JSONIFD struct {
+	Fields  []JSONField   `json:"fields"`
+	SubIFDs []JSONSubIFDs `json:"subIFDs,omitempty"`
+}
+
+// JSONSubIFDs are the sub-IFDs referenced by the field for Tag.
+type JSONSubIFDs struct {
+	Tag  uint16    `json:"tag"`
+	IFDs []JSONIFD `json:"ifds"`
+}
+
+// A JSONField is a field of a JSONIFD.  Values are given as a string for
+// ASCII, as numbers for the integer and floating point types, and as "n/d"
+// strings for RATIONAL and SRATIONAL.  The values of any other type (and of
+// floating point fields holding NaN or infinities, which JSON can not hold)
+// are given as Bytes, in the byte order of the document.
+type JSONField struct {
+	Tag      uint16          `json:"tag"`
+	Name     string          `json:"name,omitempty"`
+	Type     uint16          `json:"type"`
+	TypeName string          `json:"typeName,omitempty"`
+	Count    uint64          `json:"count"`
+	Value    json.RawMessage `json:"value,omitempty"`
+	Bytes    []byte          `json:"bytes,omitempty"`
+	// Offsets is set for fields that hold the offsets of data or of
+	// sub-IFDs.  Their values only make sense in the file they came from,
+	// so Apply leaves them alone.
+	Offsets bool `json:"offsets,omitempty"`
+}
+
+// ToJSON returns the metadata of t as an indented JSONDocument.
+func ToJSON(t TIFF) ([]byte, error) {
+	doc, err := jsonDocument(t)
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+func jsonDocument(t TIFF) (*JSONDocument, error) {
+	doc := &JSONDocument{ByteOrder: t.Order(), Version: t.Version()}
+	for _, ifd := range t.IFDs() {
+		ji, err := jsonIFD(t, ifd, 0)
+		if err != nil {
+			return nil, err
+		}
+		doc.IFDs = append(doc.IFDs, ji)
+	}
+	return doc, nil
+}
+
+// FromJSON returns the JSONDocument held by data, as made by ToJSON.
+func FromJSON(data []byte) (*JSONDocument, error) {
+	doc := new(JSONDocument)
+	if err := json.Unmarshal(data, doc); err != nil {
+		return nil, fmt.Errorf("tiff: unable to read json document: %v", err)
+	}
+	if doc.ByteOrder != "II" && doc.ByteOrder != "MM" {
+		return nil, fmt.Errorf("tiff: json document has an invalid byte order %q", doc.ByteOrder)
+	}
+	return doc, nil
+}
+
+// maxJSONDepth bounds the nesting of the document ToJSON builds, which would
+// otherwise grow for as long as sub-IFDs point back at their parents.
+const maxJSONDepth = 8
+
+func jsonIFD(t TIFF, ifd IFD, depth int) (JSONIFD, error) {
+	var ji JSONIFD
+	for _, f := range ifd.Fields() {
+		jf, err := jsonField(f)
+		if err != nil {
+			return ji, err
+		}
+		id := f.Tag().ID()
+		_, isData := GetDataTags(id)
+		_, isSub := GetSubIFDTag(id)
+		jf.Offsets = isData || isSub
+		ji.Fields = append(ji.Fields, jf)
+		if !isSub || depth >= maxJSONDepth {
+			continue
+		}
+		subs, err := ParseSubIFDs(t, ifd, id)
+		if err != nil {
+			return ji, err
+		}
+		js := JSONSubIFDs{Tag: id}
+		for _, sub := range subs {
+			s, err := jsonIFD(t, sub, depth+1)
+			if err != nil {
+				return ji, err
+			}
+			js.IFDs = append(js.IFDs, s)
+		}
+		ji.SubIFDs = append(ji.SubIFDs, js)
+	}
+	return ji, nil
+}
+
+func jsonField(f Field) (JSONField, error) {
+	ft := f.Type()
+	jf := JSONField{
+		Tag:      f.Tag().ID(),
+		Name:     f.Tag().Name(),
+		Type:     ft.ID(),
+		TypeName: ft.Name(),
+		Count:    f.Count(),
+	}
+	buf, bo := f.Value().Bytes(), f.Value().Order()
+	if uint64(len(buf)) < ft.Size()*f.Count() {
+		return jf, ErrInvalidFieldValue{jf.Tag, fmt.Sprintf("%d bytes for %d values of type %s", len(buf), f.Count(), ft.Name())}
+	}
+	buf = buf[:ft.Size()*f.Count()]
+	var v interface{}
+	switch id := ft.ID(); {
+	case !KnownFieldType(ft):
+	case id == FTAscii.ID():
+		v = FieldText(f)
+	case id == FTRational.ID():
+		rs, _ := Rationals(f)
+		strs := make([]string, len(rs))
+		for i, r := range rs {
+			strs[i] = r.String()
+		}
+		v = strs
+	case id == FTSRational.ID():
+		rs, _ := SRationals(f)
+		strs := make([]string, len(rs))
+		for i, r := range rs {
+			strs[i] = r.String()
+		}
+		v = strs
+	case id == FTFloat.ID() || id == FTDouble.ID():
+		vals := make([]float64, f.Count())
+		for i := range vals {
+			if id == FTFloat.ID() {
+				vals[i] = float64(math.Float32frombits(bo.Uint32(buf[4*i:])))
+			} else {
+				vals[i] = math.Float64frombits(bo.Uint64(buf[8*i:]))
+			}
+			if math.IsNaN(vals[i]) || math.IsInf(vals[i], 0) {
+				vals = nil
+				break
+			}
+		}
+		if vals != nil {
+			v = vals
+		}
+	case jsonUnsigned[id]:
+		v, _ = uintValues(f)
+	case jsonSigned[id]:
+		vals := make([]int64, f.Count())
+		for i := range vals {
+			switch ft.Size() {
+			case 1:
+				vals[i] = int64(int8(buf[i]))
+			case 2:
+				vals[i] = int64(int16(bo.Uint16(buf[2*i:])))
+			case 4:
+				vals[i] = int64(int32(bo.Uint32(buf[4*i:])))
+			case 8:
+				vals[i] = int64(bo.Uint64(buf[8*i:]))
+			}
+		}
+		v = vals
+	}
+	if v == nil {
+		jf.Bytes = append([]byte(nil), buf...)
+		return jf, nil
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return jf, err
+	}
+	jf.Value = raw
+	return jf, nil
+}
+
+var (
+	jsonUnsigned = map[uint16]bool{
+		FTByte.ID(): true, FTShort.ID(): true, FTLong.ID(): true, FTIFD.ID(): true,
+		FTLong8.ID(): true, FTIFD8.ID(): true,
+	}
+	jsonSigned = map[uint16]bool{
+		FTSByte.ID(): true, FTSShort.ID(): true, FTSLong.ID(): true, FTSLong8.ID(): true,
+	}
+)
+
+// Apply queues changes on e that set the fields of d in the IFDs of the file
+// being edited, IFD by IFD, and in the single sub-IFDs that the Editor can
+// change.  Fields of the file that d does not have are left alone, as are
+// fields holding offsets.  The changes are made when e.Commit is called.
+func (d *JSONDocument) Apply(e *Editor) error {
+	if n := len(e.TIFF().IFDs()); len(d.IFDs) > n {
+		return fmt.Errorf("tiff: json document has %d IFDs, but the file has %d", len(d.IFDs), n)
+	}
+	for idx, ji := range d.IFDs {
+		for _, jf := range ji.Fields {
+			if jf.Offsets {
+				continue
+			}
+			f, err := d.field(e, jf)
+			if err != nil {
+				return err
+			}
+			if err = e.SetField(idx, f); err != nil {
+				return err
+			}
+		}
+		for _, js := range ji.SubIFDs {
+			if len(js.IFDs) != 1 {
+				continue
+			}
+			for _, jf := range js.IFDs[0].Fields {
+				if jf.Offsets {
+					continue
+				}
+				f, err := d.field(e, jf)
+				if err != nil {
+					return err
+				}
+				if err = e.SetSubField(idx, js.Tag, f); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// field returns jf as a Field in the byte order of the file edited by e.
+func (d *JSONDocument) field(e *Editor, jf JSONField) (Field, error) {
+	ftsp := e.ftsp
+	if ftsp == nil {
+		ftsp = DefaultFieldTypeSpace
+	}
+	ft := ftsp.GetFieldType(jf.Type)
+	if jf.Value == nil {
+		if ft.Size() > 1 && GetByteOrder(byteOrderMark(d.ByteOrder)) != e.ByteOrder() {
+			return nil, fmt.Errorf("tiff: bytes of tag %d are not in the byte order of the file", jf.Tag)
+		}
+		if jf.Count > math.MaxUint32 || uint64(len(jf.Bytes)) < ft.Size()*jf.Count {
+			return nil, ErrInvalidFieldValue{jf.Tag, fmt.Sprintf("%d bytes for %d values of type %s", len(jf.Bytes), jf.Count, ft.Name())}
+		}
+		return newField(jf.Tag, jf.Type, uint32(jf.Count), jf.Bytes[:ft.Size()*jf.Count], e.ByteOrder(), e.tsp, e.ftsp), nil
+	}
+	var v interface{}
+	var err error
+	switch id := ft.ID(); {
+	case id == FTAscii.ID():
+		var s string
+		err = json.Unmarshal(jf.Value, &s)
+		v = s
+	case id == FTRational.ID() || id == FTSRational.ID():
+		var strs []string
+		if err = json.Unmarshal(jf.Value, &strs); err != nil {
+			break
+		}
+		v, err = parseRationals(strs, id == FTSRational.ID())
+	case id == FTFloat.ID() || id == FTDouble.ID():
+		var vals []float64
+		err = json.Unmarshal(jf.Value, &vals)
+		v = vals
+	case jsonUnsigned[id]:
+		var vals []uint64
+		err = json.Unmarshal(jf.Value, &vals)
+		v = vals
+	case jsonSigned[id]:
+		var vals []int64
+		err = json.Unmarshal(jf.Value, &vals)
+		v = vals
+	default:
+		err = fmt.Errorf("values of type %s must be given as bytes", ft.Name())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("tiff: json value of tag %d: %v", jf.Tag, err)
+	}
+	b, err := NewEntry(jf.Tag, ft, v, e.ByteOrder(), false)
+	if err != nil {
+		return nil, err
+	}
+	return b.Field(e.tsp, e.ftsp)
+}
+
+func parseRationals(strs []string, signed bool) (interface{}, error) {
+	var rs []Rational
+	var srs []SRational
+	for _, s := range strs {
+		if signed {
+			var r SRational
+			if _, err := fmt.Sscanf(s, "%d/%d", &r.Num, &r.Den); err != nil {
+				return nil, fmt.Errorf("%q is not a fraction", s)
+			}
+			srs = append(srs, r)
+			continue
+		}
+		var r Rational
+		if _, err := fmt.Sscanf(s, "%d/%d", &r.Num, &r.Den); err != nil {
+			return nil, fmt.Errorf("%q is not a fraction", s)
+		}
+		rs = append(rs, r)
+	}
+	if signed {
+		return srs, nil
+	}
+	return rs, nil
+}
+
+// byteOrderMark returns the 16 bit value of the byte order mark order ("II"
+// or "MM") as GetByteOrder expects it.
+func byteOrderMark(order string) uint16 {
+	return binary.BigEndian.Uint16([]byte(order))
+}
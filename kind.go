@@ -0,0 +1,88 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tiff
+
+import "fmt"
+
+// An IFDKind classifies the image of an IFD by its NewSubfileType (tag 254)
+// or, in older files, its SubfileType (tag 255).
+type IFDKind int
+
+// Kinds of IFD.
+const (
+	// IFDFullResolution is a full resolution image, the default for IFDs
+	// with neither tag.
+	IFDFullResolution IFDKind = iota
+	// IFDReduced is a reduced resolution version of another image, such
+	// as a thumbnail or a level of a pyramid.
+	IFDReduced
+	// IFDMask is a transparency mask for another image.  Masks of reduced
+	// resolution images are masks too.
+	IFDMask
+	// IFDPage is a single page of a multi-page image.
+	IFDPage
+)
+
+func (k IFDKind) String() string {
+	switch k {
+	case IFDFullResolution:
+		return "full resolution"
+	case IFDReduced:
+		return "reduced resolution"
+	case IFDMask:
+		return "transparency mask"
+	case IFDPage:
+		return "page"
+	}
+	return fmt.Sprintf("IFDKind(%d)", int(k))
+}
+
+// Bits of NewSubfileType and values of SubfileType.
+const (
+	subfileReduced = 1
+	subfilePage    = 2
+	subfileMask    = 4
+
+	oldSubfileReduced = 2
+	oldSubfilePage    = 3
+)
+
+// KindOf returns the IFDKind of ifd.  IFDs parsed by this package or the
+// bigtiff package also have a Kind method that does the same.
+func KindOf(ifd IFD) IFDKind {
+	if f := ifd.GetField(254); f != nil {
+		vals, err := uintValues(f)
+		if err != nil || len(vals) == 0 {
+			return IFDFullResolution
+		}
+		switch v := vals[0]; {
+		case v&subfileMask != 0:
+			return IFDMask
+		case v&subfileReduced != 0:
+			return IFDReduced
+		case v&subfilePage != 0:
+			return IFDPage
+		}
+		return IFDFullResolution
+	}
+	if f := ifd.GetField(255); f != nil {
+		vals, err := uintValues(f)
+		if err != nil || len(vals) == 0 {
+			return IFDFullResolution
+		}
+		switch vals[0] {
+		case oldSubfileReduced:
+			return IFDReduced
+		case oldSubfilePage:
+			return IFDPage
+		}
+	}
+	return IFDFullResolution
+}
+
+// Kind returns the IFDKind of ifd (see KindOf).
+func (ifd *imageFileDirectory) Kind() IFDKind {
+	return KindOf(ifd)
+}
@@ -0,0 +1,154 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tiff
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Limits bounds the resources that parsing and decoding a file may use.  They
+// protect programs that read untrusted files from ones crafted to make them
+// allocate huge amounts of memory or do huge amounts of work.  A zero field
+// means that there is no limit.
+type Limits struct {
+	// MaxIFDs is the largest number of distinct IFDs (including sub-IFDs
+	// such as Exif IFDs) that may be parsed.
+	MaxIFDs int
+	// MaxEntries is the largest number of entries a single IFD may have.
+	MaxEntries uint64
+	// MaxValueBytes is the largest total size of the values of all of the
+	// fields parsed.
+	MaxValueBytes uint64
+	// MaxWidth, MaxHeight, and MaxPixels bound the size of the images that
+	// may be decoded.  They are enforced by the image package.
+	MaxWidth  int
+	MaxHeight int
+	MaxPixels int64
+}
+
+// DefaultLimits is a reasonable starting point for reading untrusted files.
+// It allows for all but the largest of pyramidal and multi-page files.
+var DefaultLimits = Limits{
+	MaxIFDs:       4096,
+	MaxEntries:    4096,
+	MaxValueBytes: 256 << 20,
+	MaxWidth:      1 << 17,
+	MaxHeight:     1 << 17,
+	MaxPixels:     1 << 30,
+}
+
+// ErrLimitExceeded is returned when parsing or decoding a file would go over
+// one of its Limits.
+type ErrLimitExceeded struct {
+	// Limit is the name of the field of Limits that was exceeded.
+	Limit string
+	Value uint64
+	Max   uint64
+}
+
+func (e ErrLimitExceeded) Error() string {
+	return fmt.Sprintf("tiff: %s limit exceeded: %d > %d", e.Limit, e.Value, e.Max)
+}
+
+// limitedBReader is a BReader that keeps track of the resources used by the
+// parsers that read from it.  IFDs and values are tracked by offset so that
+// parsing the same IFD more than once (as happens each time the sub-IFDs of a
+// TIFF are parsed) is only counted once.
+type limitedBReader struct {
+	BReader
+	limits Limits
+
+	mu         sync.Mutex
+	ifds       map[uint64]bool   // offsets of IFDs parsed
+	values     map[uint64]uint64 // offset -> size of values parsed
+	valueBytes uint64
+}
+
+// LimitBReader returns a BReader that reads from br and enforces l on the
+// parsers that use it (see ChargeIFD and ChargeValue).  The returned BReader
+// is used by the TIFF that is parsed with it, so the limits continue to apply
+// to sub-IFDs parsed later on.
+func LimitBReader(br BReader, l Limits) BReader {
+	return &limitedBReader{
+		BReader: br,
+		limits:  l,
+		ifds:    make(map[uint64]bool, 1),
+		values:  make(map[uint64]uint64, 1),
+	}
+}
+
+// LimitsOf returns the Limits enforced by br, if it was returned by
+// LimitBReader.
+func LimitsOf(br BReader) (Limits, bool) {
+	if lbr, ok := br.(*limitedBReader); ok {
+		return lbr.limits, true
+	}
+	return Limits{}, false
+}
+
+// ChargeIFD is called by IFD parsers once they have read the number of entries
+// of the IFD at off.  If br enforces Limits and parsing the IFD would exceed
+// them, an ErrLimitExceeded is returned and the IFD must not be parsed.
+func ChargeIFD(br BReader, off, entries uint64) error {
+	lbr, ok := br.(*limitedBReader)
+	if !ok {
+		return nil
+	}
+	lbr.mu.Lock()
+	defer lbr.mu.Unlock()
+	if lbr.ifds[off] {
+		return nil
+	}
+	if max := lbr.limits.MaxEntries; max > 0 && entries > max {
+		return ErrLimitExceeded{"MaxEntries", entries, max}
+	}
+	if max := lbr.limits.MaxIFDs; max > 0 && len(lbr.ifds) >= max {
+		return ErrLimitExceeded{"MaxIFDs", uint64(len(lbr.ifds)) + 1, uint64(max)}
+	}
+	lbr.ifds[off] = true
+	return nil
+}
+
+// ChargeValue is called by field parsers before they allocate room for a value
+// of size bytes stored at off.  If br enforces Limits and the value would take
+// the total size of the values parsed over them, an ErrLimitExceeded is
+// returned and the value must not be read.
+func ChargeValue(br BReader, off, size uint64) error {
+	lbr, ok := br.(*limitedBReader)
+	if !ok {
+		return nil
+	}
+	lbr.mu.Lock()
+	defer lbr.mu.Unlock()
+	prev := lbr.values[off]
+	if size <= prev {
+		return nil
+	}
+	total := lbr.valueBytes + size - prev
+	if max := lbr.limits.MaxValueBytes; max > 0 && (total > max || total < lbr.valueBytes) {
+		return ErrLimitExceeded{"MaxValueBytes", total, max}
+	}
+	lbr.values[off] = size
+	lbr.valueBytes = total
+	return nil
+}
+
+// ReadChargedValue returns the n bytes at off in br, as ReadValue does, after
+// charging them to the limits of br, as ChargeValue does.  Parsers of private
+// blocks that tags point to use it.  It returns nil for n 0, without reading.
+func ReadChargedValue(br BReader, off, n uint64) ([]byte, error) {
+	if n == 0 {
+		return nil, nil
+	}
+	if err := ChargeValue(br, off, n); err != nil {
+		return nil, err
+	}
+	buf, err := ReadValue(br, int64(off), int64(n))
+	if err != nil {
+		return nil, ReadError(err, fmt.Sprintf("a value of %d bytes", n), at(off))
+	}
+	return buf, nil
+}
@@ -0,0 +1,189 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package lsm provides tiff extensions for working with Zeiss LSM files, the
+// TIFF based files written by Zeiss laser scanning confocal microscopes.
+package lsm
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image/color"
+	"math"
+	"strings"
+
+	"github.com/google/tiff"
+)
+
+// InfoTagID is the tag of the CZ_LSMINFO field, which holds the offset of the
+// LSM information structure in the first IFD of an LSM file.
+const InfoTagID = 34412
+
+var lsmTags = tiff.NewTagSet("LSM", 32768, 65535)
+
+func init() {
+	lsmTags.Register(tiff.NewTag(InfoTagID, "CZ_LSMINFO", nil))
+
+	lsmTags.Lock()
+
+	tiff.DefaultTagSpace.RegisterTagSet(lsmTags)
+}
+
+// Magic numbers of the LSM information structure.
+const (
+	magicV1 = 0x00300494C
+	magicV2 = 0x00400494C
+)
+
+// infoSize is the size of the part of the LSM information structure that is
+// read.  Files have a larger structure, but these fields have been stable
+// since the first version.
+const infoSize = 136
+
+// maxCount bounds the counts of the time stamp and channel color blocks, which
+// give the number of bytes read and allocated for them.
+const maxCount = 1 << 20
+
+// Info is the part of the LSM information structure (CZ_LSMINFO) that
+// describes the dimensions of the recording.  Sizes are in meters and times
+// in seconds.
+type Info struct {
+	Magic uint32
+
+	Width, Height int
+	Slices        int
+	Channels      int
+	Frames        int
+
+	// DataType is the type of the samples of all channels: 1 for 8 bit,
+	// 2 for 12 bit, 5 for 32 bit floating point, or 0 if the channels do
+	// not share a type.
+	DataType int32
+	ScanType uint16
+
+	VoxelSizeX, VoxelSizeY, VoxelSizeZ float64
+	TimeInterval                       float64
+
+	// ChannelNames and ChannelColors describe each channel, when the file
+	// has a channel color block.
+	ChannelNames  []string
+	ChannelColors []color.RGBA
+
+	// TimeStamps holds the acquisition time of each frame, when the file has
+	// a time stamp block.
+	TimeStamps []float64
+}
+
+// ZSpacing returns the distance between two slices, in meters.
+func (i *Info) ZSpacing() float64 { return i.VoxelSizeZ }
+
+// Parse returns the LSM information of t, which is read from its first IFD.
+// LSM structures are always little endian, whatever the byte order of t.
+func Parse(t tiff.TIFF) (*Info, error) {
+	ifds := t.IFDs()
+	if len(ifds) == 0 || !ifds[0].HasField(InfoTagID) {
+		return nil, fmt.Errorf("lsm: file has no CZ_LSMINFO field")
+	}
+	f := ifds[0].GetField(InfoTagID)
+	buf := f.Value().Bytes()
+	if len(buf) < infoSize {
+		// Some writers store the offset of the structure in a LONG
+		// rather than the structure in a BYTE field.
+		if f.Count() != 1 || len(buf) < 4 {
+			return nil, fmt.Errorf("lsm: CZ_LSMINFO holds only %d bytes", len(buf))
+		}
+		var err error
+		if buf, err = tiff.ReadChargedValue(t.R(), uint64(f.Value().Order().Uint32(buf)), infoSize); err != nil {
+			return nil, err
+		}
+	}
+	le := binary.LittleEndian
+	info := &Info{
+		Magic:        le.Uint32(buf),
+		Width:        int(int32(le.Uint32(buf[8:]))),
+		Height:       int(int32(le.Uint32(buf[12:]))),
+		Slices:       int(int32(le.Uint32(buf[16:]))),
+		Channels:     int(int32(le.Uint32(buf[20:]))),
+		Frames:       int(int32(le.Uint32(buf[24:]))),
+		DataType:     int32(le.Uint32(buf[28:])),
+		VoxelSizeX:   math.Float64frombits(le.Uint64(buf[40:])),
+		VoxelSizeY:   math.Float64frombits(le.Uint64(buf[48:])),
+		VoxelSizeZ:   math.Float64frombits(le.Uint64(buf[56:])),
+		ScanType:     le.Uint16(buf[88:]),
+		TimeInterval: math.Float64frombits(le.Uint64(buf[112:])),
+	}
+	if info.Magic != magicV1 && info.Magic != magicV2 {
+		return nil, fmt.Errorf("lsm: CZ_LSMINFO has an unknown magic number %#x", info.Magic)
+	}
+	if off := le.Uint32(buf[108:]); off != 0 {
+		if err := info.readChannelColors(t.R(), uint64(off)); err != nil {
+			return nil, err
+		}
+	}
+	if off := le.Uint32(buf[132:]); off != 0 {
+		if err := info.readTimeStamps(t.R(), uint64(off)); err != nil {
+			return nil, err
+		}
+	}
+	return info, nil
+}
+
+// readChannelColors reads the channel color block at off.
+func (i *Info) readChannelColors(br tiff.BReader, off uint64) error {
+	le := binary.LittleEndian
+	hdr, err := tiff.ReadChargedValue(br, off, 24)
+	if err != nil {
+		return err
+	}
+	size := uint64(le.Uint32(hdr))
+	nColors := uint64(le.Uint32(hdr[4:]))
+	colorsOff := uint64(le.Uint32(hdr[12:]))
+	namesOff := uint64(le.Uint32(hdr[16:]))
+	if size > maxCount || nColors > maxCount || colorsOff+4*nColors > size || namesOff > size {
+		return fmt.Errorf("lsm: channel color block at %d is invalid", off)
+	}
+	block, err := tiff.ReadChargedValue(br, off, size)
+	if err != nil {
+		return err
+	}
+	for c := uint64(0); c < nColors; c++ {
+		p := block[colorsOff+4*c:]
+		i.ChannelColors = append(i.ChannelColors, color.RGBA{p[0], p[1], p[2], 0xFF})
+	}
+	if namesOff == 0 {
+		return nil
+	}
+	// Names are NUL terminated, each preceded by a length that is not
+	// always filled in, so they are split on NUL and stripped of any
+	// leading control characters.
+	for _, name := range strings.Split(string(block[namesOff:]), "\x00") {
+		name = strings.TrimLeftFunc(name, func(r rune) bool { return r < ' ' })
+		if name != "" {
+			i.ChannelNames = append(i.ChannelNames, name)
+		}
+	}
+	return nil
+}
+
+// readTimeStamps reads the time stamp block at off.
+func (i *Info) readTimeStamps(br tiff.BReader, off uint64) error {
+	le := binary.LittleEndian
+	hdr, err := tiff.ReadChargedValue(br, off, 8)
+	if err != nil {
+		return err
+	}
+	n := uint64(le.Uint32(hdr[4:]))
+	if n > maxCount {
+		return fmt.Errorf("lsm: time stamp block at %d holds %d time stamps", off, n)
+	}
+	buf, err := tiff.ReadChargedValue(br, off+8, 8*n)
+	if err != nil {
+		return err
+	}
+	i.TimeStamps = make([]float64, n)
+	for j := range i.TimeStamps {
+		i.TimeStamps[j] = math.Float64frombits(le.Uint64(buf[8*j:]))
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tiff
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// A Slicer is a reader that can return a section of its data without copying
+// it.  Field parsers use it (through ReadValue) to avoid copying large values
+// such as StripOffsets arrays with millions of entries.
+type Slicer interface {
+	// Slice returns the n bytes found at off.  The returned bytes must not
+	// be modified.
+	Slice(off, n int64) ([]byte, error)
+}
+
+// slicerOf returns the Slicer that br reads from, if there is one.
+func slicerOf(br BReader) Slicer {
+	for {
+		switch b := br.(type) {
+		case Slicer:
+			return b
+		case *ctxBReader:
+			if b.ctx.Err() != nil {
+				// Let the read report the error.
+				return nil
+			}
+			br = b.br
+		case *limitedBReader:
+			br = b.BReader
+		case *quirkBReader:
+			br = b.BReader
+		case *bReader:
+			s, _ := b.r.(Slicer)
+			return s
+		default:
+			return nil
+		}
+	}
+}
+
+// ReadValue returns the n bytes found at offset in br.  If br reads from a
+// Slicer (such as a MappedFile), the bytes are sliced from it rather than
+// copied and must not be modified.  Field parsers use it to read values that
+// do not fit in an entry.
+func ReadValue(br BReader, offset, n int64) ([]byte, error) {
+	if s := slicerOf(br); s != nil {
+		return s.Slice(offset, n)
+	}
+	buf := make([]byte, n)
+	if err := br.BReadSection(&buf, offset, n); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// A MappedFile is a file mapped into memory for reading.  It satisfies
+// ReadAtReadSeeker and Slicer, so a TIFF parsed from it refers to its values
+// in the mapping instead of holding copies of them.  Memory mapping is only
+// available on some platforms (see OpenMapped).
+//
+// Values and image data of a TIFF parsed from a MappedFile must not be used
+// once the file is closed.
+type MappedFile struct {
+	*bytes.Reader
+	data []byte
+}
+
+// Slice returns the n bytes found at off in the mapping.
+func (m *MappedFile) Slice(off, n int64) ([]byte, error) {
+	if off < 0 || n < 0 || off > int64(len(m.data)) || n > int64(len(m.data))-off {
+		return nil, fmt.Errorf("tiff: section [%d, %d) is outside of the %d byte mapping", off, off+n, len(m.data))
+	}
+	return m.data[off : off+n : off+n], nil
+}
+
+// ParseMapped maps the named file into memory and parses it.  The returned
+// MappedFile must be kept open for as long as t is in use and closed
+// afterwards.
+func ParseMapped(name string, tsp TagSpace, ftsp FieldTypeSpace) (t TIFF, m *MappedFile, err error) {
+	if m, err = OpenMapped(name); err != nil {
+		return
+	}
+	if t, err = Parse(m, tsp, ftsp); err != nil {
+		m.Close()
+		return nil, nil, err
+	}
+	return t, m, nil
+}
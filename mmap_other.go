@@ -0,0 +1,21 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package tiff
+
+import "errors"
+
+// OpenMapped maps the named file into memory for reading.  It is supported on
+// Unix systems; elsewhere it returns an error.
+func OpenMapped(name string) (*MappedFile, error) {
+	return nil, errors.New("tiff: memory mapped files are not supported on this platform")
+}
+
+// Close unmaps the file.
+func (m *MappedFile) Close() error {
+	return nil
+}
@@ -0,0 +1,52 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package tiff
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// OpenMapped maps the named file into memory for reading.  It is supported on
+// Unix systems; elsewhere it returns an error.
+func OpenMapped(name string) (*MappedFile, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := fi.Size()
+	if size <= 0 {
+		return nil, fmt.Errorf("tiff: unable to map %s: file is empty", name)
+	}
+	if int64(int(size)) != size {
+		return nil, fmt.Errorf("tiff: unable to map %s: file is too large", name)
+	}
+	data, err := syscall.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, fmt.Errorf("tiff: unable to map %s: %v", name, err)
+	}
+	return &MappedFile{Reader: bytes.NewReader(data), data: data}, nil
+}
+
+// Close unmaps the file.
+func (m *MappedFile) Close() error {
+	if m.data == nil {
+		return nil
+	}
+	err := syscall.Munmap(m.data)
+	m.data = nil
+	m.Reader = bytes.NewReader(nil)
+	return err
+}
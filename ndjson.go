@@ -0,0 +1,130 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tiff
+
+import (
+	"encoding/json"
+	"io"
+	"runtime"
+)
+
+// An NDJSONRecord is a line written by ExportNDJSON: the metadata of a single
+// file.
+type NDJSONRecord struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+	// Error is set if the file could not be read or parsed, in which case
+	// the document is left out.
+	Error    string   `json:"error,omitempty"`
+	Warnings []string `json:"warnings,omitempty"`
+	*JSONDocument
+}
+
+// ExportOptions controls ExportNDJSON.
+type ExportOptions struct {
+	// Workers is the number of files read at once.  Zero means
+	// runtime.GOMAXPROCS(0).
+	Workers int
+	// Parse, if not nil, is used to parse each file (see
+	// ParseWithOptions), so that limits can be set on untrusted files.
+	// Its Context stops the export once it is done.
+	Parse *ParseOptions
+}
+
+// ExportNDJSON writes the metadata of each file named in paths to w as
+// newline delimited JSON: one NDJSONRecord per line, in the order of paths,
+// the form ingestion pipelines for document stores and data warehouses take.
+// Files are read by up to opts.Workers goroutines, which only read ahead of
+// the records written by that many files.  A file that can not be read or
+// parsed gives a record with an Error rather than stopping the export; an
+// error writing to w does, and is returned.  A nil opts uses the defaults
+// described by ExportOptions.
+func ExportNDJSON(w io.Writer, paths []string, opts *ExportOptions) error {
+	var o ExportOptions
+	if opts != nil {
+		o = *opts
+	}
+	if o.Workers <= 0 {
+		o.Workers = runtime.GOMAXPROCS(0)
+	}
+	// Each file gets a channel for its line, queued in order.  Along with
+	// the one being waited on, the queue holds at most Workers of them,
+	// which bounds the work in progress.
+	pending := make(chan chan []byte, o.Workers-1)
+	stop := make(chan struct{})
+	go func() {
+		defer close(pending)
+		for _, path := range paths {
+			line := make(chan []byte, 1)
+			select {
+			case pending <- line:
+			case <-stop:
+				return
+			}
+			go func(path string) {
+				line <- ndjsonLine(path, o.Parse)
+			}(path)
+		}
+	}()
+	var err error
+	for line := range pending {
+		b := <-line
+		if err != nil {
+			continue
+		}
+		if err = checkExport(o.Parse); err == nil {
+			_, err = w.Write(b)
+		}
+		if err != nil {
+			close(stop)
+		}
+	}
+	return err
+}
+
+// checkExport returns the error of the context of opts, if it is done.
+func checkExport(opts *ParseOptions) error {
+	if opts == nil || opts.Context == nil {
+		return nil
+	}
+	return opts.Context.Err()
+}
+
+// ndjsonLine returns the NDJSONRecord of the file named path as a line of
+// JSON.
+func ndjsonLine(path string, opts *ParseOptions) []byte {
+	rec := ndjsonRecord(path, opts)
+	b, err := json.Marshal(rec)
+	if err != nil {
+		b, _ = json.Marshal(NDJSONRecord{Path: path, Size: rec.Size, Error: err.Error()})
+	}
+	return append(b, '\n')
+}
+
+func ndjsonRecord(path string, opts *ParseOptions) *NDJSONRecord {
+	rec := &NDJSONRecord{Path: path}
+	rf, err := OpenReadOnly(path)
+	if err != nil {
+		rec.Error = err.Error()
+		return rec
+	}
+	defer rf.Close()
+	if rec.Size, err = rf.Size(); err != nil {
+		rec.Error = err.Error()
+		return rec
+	}
+	t, warnings, err := ParseWithOptions(rf, opts)
+	if err != nil {
+		rec.Error = err.Error()
+		return rec
+	}
+	for _, v := range warnings {
+		rec.Warnings = append(rec.Warnings, v.Error())
+	}
+	if rec.JSONDocument, err = jsonDocument(t); err != nil {
+		rec.Error = err.Error()
+	}
+	return rec
+}
@@ -0,0 +1,119 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tiff
+
+import (
+	"fmt"
+	"io"
+	"math"
+)
+
+/* Hamamatsu NDPI
+
+NDPI files are classic TIFF files with 32 bit offsets, even those larger than
+4 GB.  Past 4 GB, offsets keep only their low 32 bits, with two exceptions:
+	- The offset to the next IFD is 8 bytes long: the usual 4, followed by
+	  the high 32 bits.
+	- Newer files give the high 32 bits of the offsets of the strips in an
+	  NDPI_OFFSET_HIGH_BYTES field (see NDPIOffsetHighBytesTagID).
+Any other offset is to data written shortly before the IFD holding it, which
+is enough to recover its high bits (see NDPIOffset).  The first IFD of every
+NDPI file has an NDPI_FORMAT_FLAG field.  Parse fixes the offsets of IFDs and
+of the values of fields; the offsets of strips are left as they are in the
+file, and DataOffsets fixes them.
+*/
+
+// Tags of the Hamamatsu NDPI private fields.
+const (
+	NDPIOffsetHighBytesTagID = 65324
+	NDPIFormatFlagTagID      = 65420
+	NDPISourceLensTagID      = 65421
+	NDPIXOffsetTagID         = 65422
+	NDPIYOffsetTagID         = 65423
+	NDPIFocalPlaneTagID      = 65424
+	NDPIMCUStartsTagID       = 65426
+	NDPIReferenceTagID       = 65427
+	NDPIScannerSerialTagID   = 65442
+	NDPIPropertyMapTagID     = 65449
+)
+
+// IsNDPI reports whether t is a Hamamatsu NDPI file.
+func IsNDPI(t TIFF) bool {
+	ifds := t.IFDs()
+	return len(ifds) > 0 && ifds[0].HasField(NDPIFormatFlagTagID)
+}
+
+// NDPIOffset returns the offset in an NDPI file of the data that off, an
+// offset truncated to 32 bits, refers to, given the offset ifdOffset of the
+// IFD holding off.  The data is taken to be in the 4 GB before the IFD.
+// Offsets of IFDs found in the first 4 GB are returned as they are.
+func NDPIOffset(ifdOffset, off uint64) uint64 {
+	fixed := ifdOffset&^math.MaxUint32 | off&math.MaxUint32
+	if fixed >= ifdOffset && fixed > math.MaxUint32 {
+		fixed -= 1 << 32
+	}
+	return fixed
+}
+
+// DataOffsets returns offsets, the offsets of the strips, tiles or other data
+// blocks of ifd as the file gives them, with their high bits recovered if ifd
+// is past 4 GB in an NDPI file (or a file read with QuirkWrappedOffsets).
+// The high bits come from the NDPI_OFFSET_HIGH_BYTES field where it has them,
+// and from NDPIOffset otherwise.  Offsets of other IFDs are returned as they
+// are.
+func DataOffsets(ifd IFD, offsets []uint64) ([]uint64, error) {
+	raw, ok := ifd.(*imageFileDirectory)
+	if !ok || raw.fix == nil {
+		return offsets, nil
+	}
+	var high []uint64
+	if ifd.HasField(NDPIOffsetHighBytesTagID) {
+		var err error
+		if high, err = uintValues(ifd.GetField(NDPIOffsetHighBytesTagID)); err != nil {
+			return nil, err
+		}
+	}
+	fixed := make([]uint64, len(offsets))
+	for i, off := range offsets {
+		if i < len(high) {
+			fixed[i] = high[i]<<32 | off&math.MaxUint32
+		} else {
+			fixed[i] = raw.fix(off)
+		}
+	}
+	return fixed, nil
+}
+
+// ndpiFix returns the fix (see parseField) for the offsets of the values of
+// the IFD at ifdOffset, or nil if they need none.
+func ndpiFix(ndpi bool, ifdOffset uint64) func(uint64) uint64 {
+	if !ndpi || ifdOffset <= math.MaxUint32 {
+		return nil
+	}
+	return func(off uint64) uint64 {
+		return NDPIOffset(ifdOffset, off)
+	}
+}
+
+// readNDPINextHigh reads the high 32 bits of the offset to the IFD following
+// ifd, stored after the low 32 bits.  A last IFD at the very end of the file
+// may leave them out.
+func readNDPINextHigh(br BReader, ifd *imageFileDirectory) error {
+	off := ifd.offset + 2 + 12*uint64(ifd.numEntries) + 4
+	err := br.BReadSection(&ifd.nextHigh, int64(off), 4)
+	if err != nil && (err != io.EOF || ifd.nextOffset != 0) {
+		return ReadError(err, "the high bits of the offset to the next ifd", at(off))
+	}
+	return nil
+}
+
+// largeFile reports whether the file behind br is larger than 4 GB.
+func largeFile(br BReader) (bool, error) {
+	size, err := br.Seek(0, io.SeekEnd)
+	if err != nil {
+		return false, fmt.Errorf("tiff: unable to locate the end of the file: %v", err)
+	}
+	return size > math.MaxUint32, nil
+}
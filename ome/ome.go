@@ -0,0 +1,353 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package ome provides tiff extensions for working with OME-TIFF files, which
+// describe their images in OME-XML held by the ImageDescription of the first
+// IFD and store each plane (a Z section of a channel at a time point) in an
+// IFD of their own.
+package ome
+
+import (
+	"encoding/xml"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/google/tiff"
+)
+
+// maxPlanes bounds SizeZ*SizeC*SizeT, which a plane is allocated for each of
+// before the TiffData elements are read, so that a few digits of XML can not
+// ask for gigabytes.
+const maxPlanes = 1 << 24
+
+// A Channel is a channel of an Image.
+type Channel struct {
+	ID, Name string
+	// SamplesPerPixel is the number of samples of the channel, 3 for the
+	// single channel of an RGB image.
+	SamplesPerPixel int
+	// Color is the display color of the channel as an RGBA value, red in
+	// the high byte, and HasColor reports whether the OME-XML gives one.
+	Color    uint32
+	HasColor bool
+}
+
+// A Plane locates a plane of an Image.
+type Plane struct {
+	Z, C, T int
+	// IFD is the index of the IFD holding the plane in the main IFD chain
+	// of its file.
+	IFD int
+	// UUID and FileName name the file holding the plane, for images whose
+	// planes are spread over several files.  Both are empty for planes
+	// held by the file the OME-XML came from.
+	UUID, FileName string
+}
+
+// An Image is an image described by OME-XML: a 5-dimensional array of planes
+// of SizeX by SizeY pixels.
+type Image struct {
+	ID, Name string
+	// DimensionOrder is the order the dimensions are stored in, fastest
+	// first, such as "XYZCT".
+	DimensionOrder                    string
+	SizeX, SizeY, SizeZ, SizeC, SizeT int
+	// PixelType is the type of the samples, such as "uint16".
+	PixelType string
+	// PhysicalSizeX, PhysicalSizeY and PhysicalSizeZ are the size of a
+	// pixel, or 0 if the file does not give them.
+	PhysicalSizeX, PhysicalSizeY, PhysicalSizeZ float64
+	Channels                                    []Channel
+
+	// planes maps the index of each plane (see index) to its location.
+	planes []*Plane
+}
+
+// Metadata is the OME-XML of an OME-TIFF file.
+type Metadata struct {
+	// UUID identifies the file the OME-XML came from, if it gives one.
+	UUID   string
+	Images []*Image
+}
+
+// The elements of OME-XML that are read.  Elements are matched by their local
+// names, so that every version of the schema is read the same way.
+type omeXML struct {
+	UUID   string     `xml:"UUID,attr"`
+	Images []imageXML `xml:"Image"`
+}
+
+type imageXML struct {
+	ID     string    `xml:"ID,attr"`
+	Name   string    `xml:"Name,attr"`
+	Pixels pixelsXML `xml:"Pixels"`
+}
+
+type pixelsXML struct {
+	DimensionOrder string        `xml:"DimensionOrder,attr"`
+	Type           string        `xml:"Type,attr"`
+	SizeX          int           `xml:"SizeX,attr"`
+	SizeY          int           `xml:"SizeY,attr"`
+	SizeZ          int           `xml:"SizeZ,attr"`
+	SizeC          int           `xml:"SizeC,attr"`
+	SizeT          int           `xml:"SizeT,attr"`
+	PhysicalSizeX  float64       `xml:"PhysicalSizeX,attr"`
+	PhysicalSizeY  float64       `xml:"PhysicalSizeY,attr"`
+	PhysicalSizeZ  float64       `xml:"PhysicalSizeZ,attr"`
+	Channels       []channelXML  `xml:"Channel"`
+	TiffData       []tiffDataXML `xml:"TiffData"`
+}
+
+type channelXML struct {
+	ID              string `xml:"ID,attr"`
+	Name            string `xml:"Name,attr"`
+	SamplesPerPixel int    `xml:"SamplesPerPixel,attr"`
+	Color           string `xml:"Color,attr"`
+}
+
+type tiffDataXML struct {
+	IFD        *int `xml:"IFD,attr"`
+	FirstZ     *int `xml:"FirstZ,attr"`
+	FirstC     *int `xml:"FirstC,attr"`
+	FirstT     *int `xml:"FirstT,attr"`
+	PlaneCount *int `xml:"PlaneCount,attr"`
+	UUID       *struct {
+		FileName string `xml:"FileName,attr"`
+		Value    string `xml:",chardata"`
+	} `xml:"UUID"`
+}
+
+// Parse returns the OME-XML held by the ImageDescription of the first IFD of
+// t.
+func Parse(t tiff.TIFF) (*Metadata, error) {
+	ifds := t.IFDs()
+	if len(ifds) == 0 || !ifds[0].HasField(270) {
+		return nil, fmt.Errorf("ome: file has no ImageDescription")
+	}
+	f := ifds[0].GetField(270)
+	desc := tiff.FieldText(f)
+	if !strings.Contains(desc, "<OME") {
+		return nil, fmt.Errorf("ome: ImageDescription holds no OME-XML")
+	}
+	return ParseXML([]byte(strings.TrimRight(desc, "\x00")))
+}
+
+// ParseXML returns the Metadata held by the OME-XML document data, as found
+// in an OME-TIFF file or in the companion file of a set of them.
+func ParseXML(data []byte) (*Metadata, error) {
+	var doc omeXML
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("ome: unable to read the OME-XML: %v", err)
+	}
+	m := &Metadata{UUID: doc.UUID}
+	for i, ix := range doc.Images {
+		img, err := newImage(ix, doc.UUID)
+		if err != nil {
+			return nil, fmt.Errorf("ome: image %d (%s): %v", i, ix.ID, err)
+		}
+		m.Images = append(m.Images, img)
+	}
+	return m, nil
+}
+
+// newImage returns the Image described by ix, whose planes in a file with the
+// UUID uuid are taken to be in the file the OME-XML came from.
+func newImage(ix imageXML, uuid string) (*Image, error) {
+	px := ix.Pixels
+	img := &Image{
+		ID:             ix.ID,
+		Name:           ix.Name,
+		DimensionOrder: px.DimensionOrder,
+		SizeX:          px.SizeX,
+		SizeY:          px.SizeY,
+		SizeZ:          px.SizeZ,
+		SizeC:          px.SizeC,
+		SizeT:          px.SizeT,
+		PixelType:      px.Type,
+		PhysicalSizeX:  px.PhysicalSizeX,
+		PhysicalSizeY:  px.PhysicalSizeY,
+		PhysicalSizeZ:  px.PhysicalSizeZ,
+	}
+	for _, c := range px.Channels {
+		spp := c.SamplesPerPixel
+		if spp == 0 {
+			spp = 1
+		}
+		ch := Channel{ID: c.ID, Name: c.Name, SamplesPerPixel: spp}
+		ch.Color, ch.HasColor = parseColor(c.Color)
+		img.Channels = append(img.Channels, ch)
+	}
+	if !validOrder(img.DimensionOrder) {
+		return nil, fmt.Errorf("invalid DimensionOrder %q", img.DimensionOrder)
+	}
+	if img.SizeX <= 0 || img.SizeY <= 0 || img.SizeZ <= 0 || img.SizeC <= 0 || img.SizeT <= 0 {
+		return nil, fmt.Errorf("invalid size %dx%dx%dx%dx%d", img.SizeX, img.SizeY, img.SizeZ, img.SizeC, img.SizeT)
+	}
+	n := img.NumPlanes()
+	if n > maxPlanes {
+		return nil, fmt.Errorf("%d planes is too many", n)
+	}
+	img.planes = make([]*Plane, n)
+	if len(px.TiffData) == 0 {
+		// Without TiffData, the planes are in the IFDs in order.
+		for i := range img.planes {
+			img.setPlane(i, &Plane{IFD: i})
+		}
+		return img, nil
+	}
+	for _, td := range px.TiffData {
+		ifd, first, count := 0, 0, 1
+		if td.IFD != nil {
+			ifd = *td.IFD
+		}
+		if td.FirstZ != nil || td.FirstC != nil || td.FirstT != nil {
+			z, c, t := deref(td.FirstZ), deref(td.FirstC), deref(td.FirstT)
+			var ok bool
+			if first, ok = img.index(z, c, t); !ok {
+				return nil, fmt.Errorf("TiffData starts at plane Z=%d C=%d T=%d, out of range", z, c, t)
+			}
+		} else if td.IFD == nil {
+			// A TiffData with neither IFD nor first plane covers
+			// every plane.
+			count = n
+		}
+		if td.PlaneCount != nil {
+			count = *td.PlaneCount
+		}
+		if ifd < 0 || count < 0 || count > n-first {
+			return nil, fmt.Errorf("TiffData maps %d planes from IFD %d, out of range", count, ifd)
+		}
+		var u, name string
+		if td.UUID != nil && strings.TrimSpace(td.UUID.Value) != uuid {
+			u, name = strings.TrimSpace(td.UUID.Value), td.UUID.FileName
+		}
+		for i := 0; i < count; i++ {
+			img.setPlane(first+i, &Plane{IFD: ifd + i, UUID: u, FileName: name})
+		}
+	}
+	return img, nil
+}
+
+func deref(p *int) int {
+	if p == nil {
+		return 0
+	}
+	return *p
+}
+
+// parseColor returns the RGBA value of the Color attribute s of a channel, and
+// whether s holds one.  The schema makes colors signed 32 bit integers, but
+// some writers store them unsigned, so both forms are accepted.
+func parseColor(s string) (uint32, bool) {
+	v, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	if err != nil || v < math.MinInt32 || v > math.MaxUint32 {
+		return 0, false
+	}
+	return uint32(v), true
+}
+
+// validOrder reports whether order is a DimensionOrder: "XY" followed by Z, C
+// and T in any order.
+func validOrder(order string) bool {
+	return len(order) == 5 && strings.HasPrefix(order, "XY") &&
+		strings.Count(order, "Z") == 1 && strings.Count(order, "C") == 1 && strings.Count(order, "T") == 1
+}
+
+// EffectiveSizeC returns the number of channels stored in planes of their own.
+// It is smaller than SizeC when channels have several samples, as the single
+// channel of an RGB image does, which count as one each in SizeC's place.
+func (img *Image) EffectiveSizeC() int {
+	samples := 0
+	for _, c := range img.Channels {
+		samples += c.SamplesPerPixel
+	}
+	if len(img.Channels) > 0 && samples == img.SizeC {
+		return len(img.Channels)
+	}
+	return img.SizeC
+}
+
+// NumPlanes returns the number of planes of img.
+func (img *Image) NumPlanes() int {
+	return img.SizeZ * img.EffectiveSizeC() * img.SizeT
+}
+
+// index returns the position of the plane (z, c, t) among the planes of img,
+// as ordered by DimensionOrder.
+func (img *Image) index(z, c, t int) (int, bool) {
+	pos := map[byte]int{'Z': z, 'C': c, 'T': t}
+	size := map[byte]int{'Z': img.SizeZ, 'C': img.EffectiveSizeC(), 'T': img.SizeT}
+	i, stride := 0, 1
+	for _, d := range []byte(img.DimensionOrder[2:]) {
+		if pos[d] < 0 || pos[d] >= size[d] {
+			return 0, false
+		}
+		i += pos[d] * stride
+		stride *= size[d]
+	}
+	return i, true
+}
+
+// setPlane records p as plane i of img, filling in its coordinates.
+func (img *Image) setPlane(i int, p *Plane) {
+	size := map[byte]int{'Z': img.SizeZ, 'C': img.EffectiveSizeC(), 'T': img.SizeT}
+	coords := map[byte]*int{'Z': &p.Z, 'C': &p.C, 'T': &p.T}
+	rest := i
+	for _, d := range []byte(img.DimensionOrder[2:]) {
+		*coords[d] = rest % size[d]
+		rest /= size[d]
+	}
+	img.planes[i] = p
+}
+
+// PlaneAt returns the location of the plane at Z section z of channel c at
+// time point t.  Channels are counted as EffectiveSizeC counts them.
+func (img *Image) PlaneAt(z, c, t int) (Plane, error) {
+	i, ok := img.index(z, c, t)
+	if !ok {
+		return Plane{}, fmt.Errorf("ome: plane Z=%d C=%d T=%d out of range [%d, %d, %d)", z, c, t, img.SizeZ, img.EffectiveSizeC(), img.SizeT)
+	}
+	if img.planes[i] == nil {
+		return Plane{}, fmt.Errorf("ome: plane Z=%d C=%d T=%d is not mapped to an IFD", z, c, t)
+	}
+	return *img.planes[i], nil
+}
+
+// Validate checks m against t, the file it came from: every plane of every
+// image must be mapped to an IFD, the IFDs of the planes held by t must exist
+// and have the size of their image, and no IFD may hold two planes.
+func (m *Metadata) Validate(t tiff.TIFF) error {
+	ifds := t.IFDs()
+	owner := make(map[int]string)
+	for _, img := range m.Images {
+		for i, p := range img.planes {
+			if p == nil {
+				return fmt.Errorf("ome: image %s: plane %d is not mapped to an IFD", img.ID, i)
+			}
+			if p.UUID != "" {
+				continue
+			}
+			if p.IFD >= len(ifds) {
+				return fmt.Errorf("ome: image %s: plane Z=%d C=%d T=%d is in IFD %d, but the file has %d IFDs", img.ID, p.Z, p.C, p.T, p.IFD, len(ifds))
+			}
+			if id, ok := owner[p.IFD]; ok {
+				return fmt.Errorf("ome: IFD %d holds planes of both image %s and image %s", p.IFD, id, img.ID)
+			}
+			owner[p.IFD] = img.ID
+			var size struct {
+				Width  uint32 `tiff:"field,tag=256"`
+				Height uint32 `tiff:"field,tag=257"`
+			}
+			if err := tiff.UnmarshalIFD(ifds[p.IFD], &size); err != nil {
+				return fmt.Errorf("ome: IFD %d: %v", p.IFD, err)
+			}
+			if int(size.Width) != img.SizeX || int(size.Height) != img.SizeY {
+				return fmt.Errorf("ome: image %s: IFD %d is %dx%d, but the image is %dx%d", img.ID, p.IFD, size.Width, size.Height, img.SizeX, img.SizeY)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,315 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tiff
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+)
+
+// ViolationKind identifies a way in which a file breaks the rules of the TIFF
+// specification that a reader can still work around.
+type ViolationKind int
+
+const (
+	// UnsortedTags means the entries of an IFD are not in ascending order
+	// of tag ID.
+	UnsortedTags ViolationKind = iota + 1
+	// DuplicateTag means an IFD has more than one entry for a tag.  The
+	// last entry is the one returned by IFD.GetField.
+	DuplicateTag
+	// OddValueOffset means a value is stored at an odd offset even though
+	// values are required to begin on a word boundary.
+	OddValueOffset
+	// ZeroCount means an entry has no values.
+	ZeroCount
+	// OverlappingData means two structures of the file share bytes (see
+	// ErrOverlap).
+	OverlappingData
+	// OffsetOverflow means a classic TIFF file is larger than 4 GB, so
+	// that offsets to its data likely wrapped (see ErrOffsetOverflow),
+	// even though its IFDs could be read.  NDPI files, and files read
+	// with QuirkWrappedOffsets, are not reported.
+	OffsetOverflow
+)
+
+var violationNames = map[ViolationKind]string{
+	UnsortedTags:    "unsorted tags",
+	DuplicateTag:    "duplicate tag",
+	OddValueOffset:  "odd value offset",
+	ZeroCount:       "zero count",
+	OverlappingData: "overlapping data",
+	OffsetOverflow:  "offset overflow",
+}
+
+func (k ViolationKind) String() string {
+	if name, ok := violationNames[k]; ok {
+		return name
+	}
+	return fmt.Sprintf("ViolationKind(%d)", int(k))
+}
+
+// A Violation describes a single breach of the specification found while
+// parsing.  In strict mode it is returned as the error from ParseWithOptions;
+// in lenient mode it is returned as a warning.
+type Violation struct {
+	Kind ViolationKind
+	// IFD names the IFD the violation was found in, e.g. "IFD 0" or
+	// "IFD 0/34665[0]" for the Exif IFD of IFD 0.
+	IFD    string
+	TagID  uint16
+	Offset uint64
+	Detail string
+}
+
+func (v Violation) Error() string {
+	if v.TagID == 0 {
+		return fmt.Sprintf("tiff: %s: %s: %s", v.IFD, v.Kind, v.Detail)
+	}
+	return fmt.Sprintf("tiff: %s: tag %d: %s: %s", v.IFD, v.TagID, v.Kind, v.Detail)
+}
+
+// ParseOptions controls how ParseWithOptions handles files that do not follow
+// the specification.
+type ParseOptions struct {
+	// TagSpace and FieldTypeSpace are passed on to the parser.  nil means
+	// DefaultTagSpace and DefaultFieldTypeSpace.
+	TagSpace       TagSpace
+	FieldTypeSpace FieldTypeSpace
+
+	// Strict causes the first violation found to be returned as an error.
+	// Otherwise, violations are returned as warnings and the parsed TIFF
+	// is returned as well.
+	Strict bool
+
+	// Allow lists kinds of violations that are accepted without being
+	// reported, even in strict mode.
+	Allow []ViolationKind
+
+	// CheckOverlaps also maps the layout of the file to look for
+	// OverlappingData violations.  This reads every IFD referenced by the
+	// file, including sub-IFDs.
+	CheckOverlaps bool
+
+	// Limits, if not nil, bounds the resources used by parsing the file
+	// and, through TIFF.R, anything later read from it (see Limits).
+	Limits *Limits
+
+	// Base is the offset of the TIFF within r, for a TIFF embedded in a
+	// larger container (see ParseEmbedded).  Every offset found in the file,
+	// and every offset reported for it, is relative to Base.
+	Base int64
+
+	// Context, if not nil, stops parsing the file, and anything later read
+	// from it through TIFF.R, once it is done (see ParseContext).
+	Context context.Context
+
+	// Quirks enables workarounds for files broken by known bugs of their
+	// writers, such as offsets that overflowed (see ErrOffsetOverflow).
+	Quirks Quirk
+
+	// Charset, if not empty, names the charset (see RegisterCharset) that
+	// the values of ASCII fields which are not valid UTF-8 are decoded
+	// with, in place of the text charset set by SetTextCharset.
+	Charset string
+
+	// DeferDataValues leaves the values of the offset and byte count tags
+	// of data blocks (see RegisterDataTags), such as StripOffsets and
+	// TileByteCounts, in the file until they are asked for.  ViewUints
+	// then reads single values of them as they are needed, which suits
+	// files with millions of tiles read over a network.
+	DeferDataValues bool
+}
+
+// fieldOptions are the ParseOptions that change how fields are parsed.  They
+// reach the field parsers through a fieldBReader.
+type fieldOptions struct {
+	ascii     FieldType // the type of ASCII fields, if not nil
+	deferData bool      // see ParseOptions.DeferDataValues
+}
+
+// fieldBReader is a BReader whose field parsers follow opts.
+type fieldBReader struct {
+	BReader
+	opts *fieldOptions
+}
+
+// fieldOptionsOf returns the fieldOptions of br, or nil if it has none.
+func fieldOptionsOf(br BReader) *fieldOptions {
+	for {
+		switch b := br.(type) {
+		case *fieldBReader:
+			return b.opts
+		case *quirkBReader:
+			br = b.BReader
+		case *ctxBReader:
+			br = b.br
+		case *limitedBReader:
+			br = b.BReader
+		default:
+			return nil
+		}
+	}
+}
+
+func (o *ParseOptions) allowed(k ViolationKind) bool {
+	for _, a := range o.Allow {
+		if a == k {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseWithOptions is like Parse, but it checks the parsed IFDs (and their
+// sub-IFDs) for the violations described by ViolationKind and handles them as
+// opts directs.  A nil opts is the same as the zero value: lenient, with all
+// violations reported as warnings.
+func ParseWithOptions(r ReadAtReadSeeker, opts *ParseOptions) (t TIFF, warnings []Violation, err error) {
+	if opts == nil {
+		opts = new(ParseOptions)
+	}
+	if opts.Base != 0 {
+		end, err := r.Seek(0, io.SeekEnd)
+		if err != nil {
+			return nil, nil, fmt.Errorf("tiff: unable to locate the end of the file: %v", err)
+		}
+		if opts.Base < 0 || opts.Base > end {
+			return nil, nil, fmt.Errorf("tiff: base offset %d out of range [0, %d]", opts.Base, end)
+		}
+		r = io.NewSectionReader(r, opts.Base, end-opts.Base)
+	}
+	var fo *fieldOptions
+	if opts.Charset != "" || opts.DeferDataValues {
+		fo = &fieldOptions{deferData: opts.DeferDataValues}
+		if opts.Charset != "" {
+			if fo.ascii, err = TextFieldType(opts.Charset); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	if t, err = parse(opts.Context, r, opts.TagSpace, opts.FieldTypeSpace, opts.Limits, opts.Quirks, fo); err != nil {
+		return nil, nil, err
+	}
+	vc := &violationChecker{t: t, opts: opts, seen: make(map[uint64]bool, len(t.IFDs()))}
+	if t.OffsetSize() == 4 && opts.Quirks&QuirkWrappedOffsets == 0 && !IsNDPI(t) {
+		size, err := r.Seek(0, io.SeekEnd)
+		if err != nil {
+			return nil, nil, fmt.Errorf("tiff: unable to locate the end of the file: %v", err)
+		}
+		if size > math.MaxUint32 {
+			if err = vc.report(Violation{OffsetOverflow, "file", 0, 0, fmt.Sprintf("the file is %d bytes, more than 32 bit offsets reach", size)}); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	for i, ifd := range t.IFDs() {
+		if err = vc.checkIFD(ifd, ifdOffset(t, i), fmt.Sprintf("IFD %d", i), 0); err != nil {
+			return nil, nil, err
+		}
+	}
+	if !opts.allowed(OverlappingData) {
+		var overlaps []Overlap
+		if opts.CheckOverlaps {
+			if overlaps, err = Overlaps(t); err != nil {
+				return nil, nil, err
+			}
+		} else {
+			// The IFDs of the main chain and their values are
+			// checked anyway, as parsing them did; cycles were
+			// rejected then.
+			cc := NewChainChecker(t.OffsetSize())
+			for i, ifd := range t.IFDs() {
+				cc.Add(ifd, ifdOffset(t, i))
+			}
+			overlaps = cc.Overlaps()
+		}
+		for _, o := range overlaps {
+			if opts.Strict {
+				return nil, nil, ErrOverlap{o}
+			}
+			vc.warnings = append(vc.warnings, Violation{
+				Kind:   OverlappingData,
+				IFD:    "layout",
+				Offset: o.B.Offset,
+				Detail: fmt.Sprintf("%v overlaps %v", o.A, o.B),
+			})
+		}
+	}
+	return t, vc.warnings, nil
+}
+
+type violationChecker struct {
+	t        TIFF
+	opts     *ParseOptions
+	seen     map[uint64]bool // offsets of IFDs already checked
+	warnings []Violation
+}
+
+// report records v, or returns it if parsing is strict.
+func (vc *violationChecker) report(v Violation) error {
+	if vc.opts.allowed(v.Kind) {
+		return nil
+	}
+	if vc.opts.Strict {
+		return v
+	}
+	vc.warnings = append(vc.warnings, v)
+	return nil
+}
+
+// checkIFD checks ifd, found at off and called name, and the sub-IFDs it
+// references, down to maxFingerprintDepth levels below the main IFD chain.
+func (vc *violationChecker) checkIFD(ifd IFD, off uint64, name string, depth int) error {
+	if vc.seen[off] {
+		return nil
+	}
+	vc.seen[off] = true
+	counts := make(map[uint16]int, len(ifd.Fields()))
+	var prev uint16
+	for i, f := range ifd.Fields() {
+		id := f.Tag().ID()
+		counts[id]++
+		if counts[id] == 2 {
+			if err := vc.report(Violation{DuplicateTag, name, id, off, fmt.Sprintf("entry %d repeats tag %d", i, id)}); err != nil {
+				return err
+			}
+		}
+		if i > 0 && id < prev {
+			if err := vc.report(Violation{UnsortedTags, name, id, off, fmt.Sprintf("entry %d (tag %d) follows tag %d", i, id, prev)}); err != nil {
+				return err
+			}
+		}
+		prev = id
+		if f.Count() == 0 {
+			if err := vc.report(Violation{ZeroCount, name, id, off, "entry has no values"}); err != nil {
+				return err
+			}
+		}
+		if valOff := f.Offset(); valOff%2 != 0 {
+			if err := vc.report(Violation{OddValueOffset, name, id, valOff, fmt.Sprintf("values begin at offset %d", valOff)}); err != nil {
+				return err
+			}
+		}
+		if _, ok := GetSubIFDTag(id); ok && counts[id] == 1 && depth < maxFingerprintDepth {
+			offsets, err := uintValues(ifd.GetField(id))
+			if err != nil {
+				return err
+			}
+			subs, err := ParseSubIFDs(vc.t, ifd, id)
+			if err != nil {
+				return err
+			}
+			for j, sub := range subs {
+				if err = vc.checkIFD(sub, offsets[j], fmt.Sprintf("%s/%d[%d]", name, id, j), depth+1); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tiff
+
+import "fmt"
+
+// An Overlap is a pair of referenced regions that share bytes.
+type Overlap struct {
+	A, B Region
+}
+
+// ErrOverlap is returned by a strict parse when two of the structures of a
+// file (the header, IFDs, out-of-line values, or data blocks) share bytes.
+// Well formed files never do this, so it indicates either corruption or a file
+// crafted to confuse readers.
+type ErrOverlap struct {
+	Overlap
+}
+
+func (e ErrOverlap) Error() string {
+	return fmt.Sprintf("tiff: %s [%d, %d) overlaps %s [%d, %d)", e.A.Desc, e.A.Offset, e.A.End(), e.B.Desc, e.B.Offset, e.B.End())
+}
+
+// findOverlaps returns every pair of regions that share bytes.  regions must be
+// sorted by offset.  Regions that are identical in offset and size are allowed
+// since sharing a block of data (e.g. a strip used by two pages) is legal.
+func findOverlaps(regions []Region) []Overlap {
+	var out []Overlap
+	var active []Region // earlier regions that end after the current one starts
+	for _, reg := range regions {
+		kept := active[:0]
+		for _, prev := range active {
+			if prev.End() <= reg.Offset {
+				continue
+			}
+			if prev.Offset != reg.Offset || prev.Size != reg.Size {
+				out = append(out, Overlap{prev, reg})
+			}
+			kept = append(kept, prev)
+		}
+		active = append(kept, reg)
+	}
+	return out
+}
+
+// Overlaps returns every pair of structures in t that share bytes.
+func Overlaps(t TIFF) ([]Overlap, error) {
+	regions, err := Regions(t)
+	if err != nil {
+		return nil, err
+	}
+	return findOverlaps(regions), nil
+}
+
+// ParseStrict is like Parse, but it fails on any violation of the
+// specification described by ViolationKind.  In particular, the layout of the
+// file is mapped and an ErrOverlap describing the first pair of structures
+// found to overlap is returned.  See ParseWithOptions for finer control.
+func ParseStrict(r ReadAtReadSeeker, tsp TagSpace, ftsp FieldTypeSpace) (TIFF, error) {
+	t, _, err := ParseWithOptions(r, &ParseOptions{
+		TagSpace:       tsp,
+		FieldTypeSpace: ftsp,
+		Strict:         true,
+		CheckOverlaps:  true,
+	})
+	return t, err
+}
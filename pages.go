@@ -0,0 +1,116 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tiff
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// WritePage writes the IFD at index idx of the main IFD chain of the TIFF
+// found in src to dst as a standalone single page TIFF.  Everything the IFD
+// references (strips, tiles, sub-IFDs such as the Exif IFD, etc.) is copied
+// along with it and all offsets are rewritten to match the new file.
+func WritePage(src ReadAtReadSeeker, dst io.Writer, idx int) error {
+	t, err := Parse(src, nil, nil)
+	if err != nil {
+		return err
+	}
+	ifds := t.IFDs()
+	if idx < 0 || idx >= len(ifds) {
+		return fmt.Errorf("tiff: ifd index %d out of range [0, %d)", idx, len(ifds))
+	}
+	w, err := planIFD(t, ifds[idx], 0, nil)
+	if err != nil {
+		return err
+	}
+	return writeTIFF(dst, t.R().ByteOrder(), t.OffsetSize() == 8, []*writeIFD{w})
+}
+
+// WritePages writes the IFDs at the indexes idxs of the main IFD chain of the
+// TIFF found in src to dst as a new TIFF holding those pages, in the order
+// given.  Everything the IFDs reference is copied along with them, as with
+// WritePage.  The new file has the same byte order and offset size as src.
+func WritePages(src ReadAtReadSeeker, dst io.Writer, idxs []int) error {
+	t, err := Parse(src, nil, nil)
+	if err != nil {
+		return err
+	}
+	ifds := t.IFDs()
+	if len(idxs) == 0 {
+		return fmt.Errorf("tiff: no pages to write")
+	}
+	ws := make([]*writeIFD, 0, len(idxs))
+	for _, idx := range idxs {
+		if idx < 0 || idx >= len(ifds) {
+			return fmt.Errorf("tiff: ifd index %d out of range [0, %d)", idx, len(ifds))
+		}
+		w, err := planIFD(t, ifds[idx], 0, nil)
+		if err != nil {
+			return err
+		}
+		ws = append(ws, w)
+	}
+	return writeTIFF(dst, t.R().ByteOrder(), t.OffsetSize() == 8, ws)
+}
+
+// SplitPages splits the TIFF found in src into one standalone TIFF for each IFD
+// in its main IFD chain (see WritePage).  The new files are held in memory;
+// use WritePage to write large pages elsewhere.
+func SplitPages(src ReadAtReadSeeker) ([]io.Reader, error) {
+	t, err := Parse(src, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	pages := make([]io.Reader, 0, len(t.IFDs()))
+	for _, ifd := range t.IFDs() {
+		w, err := planIFD(t, ifd, 0, nil)
+		if err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		if err = writeTIFF(&buf, t.R().ByteOrder(), t.OffsetSize() == 8, []*writeIFD{w}); err != nil {
+			return nil, err
+		}
+		pages = append(pages, bytes.NewReader(buf.Bytes()))
+	}
+	return pages, nil
+}
+
+// MergePages writes a multi-page TIFF to dst made of every page (IFD in the
+// main IFD chain) of each TIFF in srcs, in order.  All of the sources must have
+// the same byte order.  If any of them uses 64 bit offsets (BigTIFF), so does
+// the result.
+func MergePages(dst io.Writer, srcs ...ReadAtReadSeeker) error {
+	if len(srcs) == 0 {
+		return fmt.Errorf("tiff: no files to merge")
+	}
+	var (
+		ifds []*writeIFD
+		big  bool
+		t0   TIFF
+	)
+	for i, src := range srcs {
+		t, err := Parse(src, nil, nil)
+		if err != nil {
+			return fmt.Errorf("tiff: merge: file %d: %v", i, err)
+		}
+		if t0 == nil {
+			t0 = t
+		} else if t.R().ByteOrder() != t0.R().ByteOrder() {
+			return fmt.Errorf("tiff: merge: file %d is %v, but file 0 is %v", i, t.R().ByteOrder(), t0.R().ByteOrder())
+		}
+		if t.OffsetSize() == 8 {
+			big = true
+		}
+		w, err := planTIFF(t, nil)
+		if err != nil {
+			return fmt.Errorf("tiff: merge: file %d: %v", i, err)
+		}
+		ifds = append(ifds, w...)
+	}
+	return writeTIFF(dst, t0.R().ByteOrder(), big, ifds)
+}
@@ -0,0 +1,144 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tiff
+
+import (
+	"fmt"
+	"math"
+)
+
+// Values of the ResolutionUnit tag (296).
+const (
+	ResolutionUnitNone       = 1
+	ResolutionUnitInch       = 2
+	ResolutionUnitCentimeter = 3
+)
+
+// CentimetersPerInch converts between the two resolution units.
+const CentimetersPerInch = 2.54
+
+// resolutionFields are the fields of an IFD that give its print size.
+type resolutionFields struct {
+	ImageWidth     *uint32   `tiff:"field,tag=256"`
+	ImageLength    *uint32   `tiff:"field,tag=257"`
+	XResolution    *Rational `tiff:"field,tag=282"`
+	YResolution    *Rational `tiff:"field,tag=283"`
+	ResolutionUnit *uint16   `tiff:"field,tag=296"`
+}
+
+// Resolution returns the resolution of the image described by ifd in pixels
+// per inch.  An error is returned if ifd has no resolution or its unit is
+// ResolutionUnitNone, since the image then has no physical size.
+func Resolution(ifd IFD) (xdpi, ydpi float64, err error) {
+	var rf resolutionFields
+	if err = UnmarshalIFD(ifd, &rf); err != nil {
+		return
+	}
+	if rf.XResolution == nil || rf.YResolution == nil {
+		return 0, 0, fmt.Errorf("tiff: image has no resolution")
+	}
+	if !rf.XResolution.Valid() || !rf.YResolution.Valid() {
+		return 0, 0, fmt.Errorf("tiff: image resolution %v by %v has a zero denominator", rf.XResolution, rf.YResolution)
+	}
+	xdpi, ydpi = rf.XResolution.Float64(), rf.YResolution.Float64()
+	unit := uint16(ResolutionUnitInch)
+	if rf.ResolutionUnit != nil {
+		unit = *rf.ResolutionUnit
+	}
+	switch unit {
+	case ResolutionUnitInch:
+	case ResolutionUnitCentimeter:
+		xdpi, ydpi = xdpi*CentimetersPerInch, ydpi*CentimetersPerInch
+	case ResolutionUnitNone:
+		return 0, 0, fmt.Errorf("tiff: image resolution has no unit")
+	default:
+		return 0, 0, ErrInvalidFieldValue{296, fmt.Sprintf("unknown resolution unit %d", unit)}
+	}
+	if xdpi <= 0 || ydpi <= 0 {
+		return 0, 0, fmt.Errorf("tiff: invalid image resolution %gx%g", xdpi, ydpi)
+	}
+	return xdpi, ydpi, nil
+}
+
+// PrintSize returns the size, in inches, at which the image described by ifd
+// prints at its resolution.
+func PrintSize(ifd IFD) (width, height float64, err error) {
+	xdpi, ydpi, err := Resolution(ifd)
+	if err != nil {
+		return
+	}
+	var rf resolutionFields
+	if err = UnmarshalIFD(ifd, &rf); err != nil {
+		return
+	}
+	if rf.ImageWidth == nil || rf.ImageLength == nil {
+		return 0, 0, fmt.Errorf("tiff: missing image dimensions")
+	}
+	return float64(*rf.ImageWidth) / xdpi, float64(*rf.ImageLength) / ydpi, nil
+}
+
+// PixelsForPrintSize returns the size, in pixels, that an image must have to
+// print at width by height inches at dpi pixels per inch.
+func PixelsForPrintSize(width, height, dpi float64) (w, h int) {
+	return int(math.Round(width * dpi)), int(math.Round(height * dpi))
+}
+
+// rationalValue returns v encoded as a RATIONAL value in the byte order of
+// the file edited by e.
+func rationalValue(e *Editor, v float64) ([]byte, error) {
+	r, err := RationalOf(v)
+	if err != nil {
+		return nil, err
+	}
+	if r.Num == 0 {
+		return nil, fmt.Errorf("tiff: %g can not be stored as a rational", v)
+	}
+	return r.Bytes(e.ByteOrder()), nil
+}
+
+// SetResolution queues changes on e that set the resolution of the image
+// described by the IFD at index idx to xdpi by ydpi pixels per inch.  The
+// changes are made when e.Commit is called.
+func SetResolution(e *Editor, idx int, xdpi, ydpi float64) error {
+	xres, err := rationalValue(e, xdpi)
+	if err != nil {
+		return err
+	}
+	yres, err := rationalValue(e, ydpi)
+	if err != nil {
+		return err
+	}
+	unit := make([]byte, 2)
+	e.ByteOrder().PutUint16(unit, ResolutionUnitInch)
+	if err = e.Set(idx, 282, FTRational.ID(), 1, xres); err != nil {
+		return err
+	}
+	if err = e.Set(idx, 283, FTRational.ID(), 1, yres); err != nil {
+		return err
+	}
+	return e.Set(idx, 296, FTShort.ID(), 1, unit)
+}
+
+// SetPrintSize queues changes on e that set the resolution of the image
+// described by the IFD at index idx so that it prints at width by height
+// inches, without changing its pixels.  To print at a given resolution as
+// well, the image must first be resampled to the size returned by
+// PixelsForPrintSize (see the Resample function of the image package).
+func SetPrintSize(e *Editor, idx int, width, height float64) error {
+	if idx < 0 || idx >= len(e.TIFF().IFDs()) {
+		return fmt.Errorf("tiff: ifd index %d out of range [0, %d)", idx, len(e.TIFF().IFDs()))
+	}
+	var rf resolutionFields
+	if err := UnmarshalIFD(e.TIFF().IFDs()[idx], &rf); err != nil {
+		return err
+	}
+	if rf.ImageWidth == nil || rf.ImageLength == nil {
+		return fmt.Errorf("tiff: missing image dimensions")
+	}
+	if !(width > 0 && height > 0) {
+		return fmt.Errorf("tiff: invalid print size %gx%g", width, height)
+	}
+	return SetResolution(e, idx, float64(*rf.ImageWidth)/width, float64(*rf.ImageLength)/height)
+}
@@ -0,0 +1,137 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tiff
+
+import (
+	"fmt"
+	"math"
+)
+
+/* Offset overflows
+
+Classic TIFF offsets are unsigned 32 bit integers, which reach 4 GB.  Writers
+get this wrong in two ways:
+	- They store offsets and byte counts as signed integers (SSHORT or
+	  SLONG), so that those past 2 GB are negative.  Read as unsigned, the
+	  same bits are the right offsets.
+	- They write files larger than 4 GB, keeping only the low 32 bits of
+	  each offset.  Hamamatsu NDPI files do so on purpose (see NDPIOffset);
+	  others by accident.
+Both are reported as an ErrOffsetOverflow, unless the matching Quirk is
+enabled through ParseOptions.Quirks.
+*/
+
+// A Quirk enables a workaround for files broken by a known bug of their writer
+// (see ParseOptions.Quirks).  Quirks may be combined with |.  They only apply
+// to classic TIFF files.
+type Quirk uint
+
+const (
+	// QuirkSignedOffsets reads offsets and byte counts stored with a
+	// signed type (SSHORT or SLONG) as if they were unsigned.
+	QuirkSignedOffsets Quirk = 1 << iota
+	// QuirkWrappedOffsets reads files larger than 4 GB whose writers kept
+	// only the low 32 bits of offsets.  The high bits are recovered as for
+	// NDPI files: values are taken to be in the 4 GB before the IFD that
+	// holds them (see NDPIOffset), and each IFD of the main chain to come
+	// after the one before it.  The offsets of strips and tiles are left as
+	// they are in the file (see DataOffsets).
+	QuirkWrappedOffsets
+)
+
+// ErrOffsetOverflow is returned for classic TIFF files whose offsets
+// overflowed, which the Quirks of ParseOptions may work around.
+type ErrOffsetOverflow struct {
+	ErrorContext
+	Problem string
+	// Err is the error that reading the file at the overflowed offsets ran
+	// into, if any.
+	Err error
+}
+
+func (e ErrOffsetOverflow) Error() string {
+	msg := fmt.Sprintf("tiff: offsets overflowed (%s): %s", e.ErrorContext, e.Problem)
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e ErrOffsetOverflow) Unwrap() error {
+	return e.Err
+}
+
+// quirkBReader is a BReader whose parsers apply quirks.
+type quirkBReader struct {
+	BReader
+	quirks Quirk
+}
+
+// QuirksOf returns the quirks applied by the parsers that read from br (see
+// ParseOptions.Quirks).
+func QuirksOf(br BReader) Quirk {
+	for {
+		switch b := br.(type) {
+		case *quirkBReader:
+			return b.quirks
+		case *ctxBReader:
+			br = b.br
+		case *limitedBReader:
+			br = b.BReader
+		default:
+			return 0
+		}
+	}
+}
+
+// isOffsetTag reports whether the values of tagID are offsets or byte counts:
+// those of a data tag or of its byte count tag (see RegisterDataTags), or
+// those of a sub-IFD tag.
+func isOffsetTag(tagID uint16) bool {
+	if _, ok := GetDataTags(tagID); ok {
+		return true
+	}
+	if _, ok := GetSubIFDTag(tagID); ok {
+		return true
+	}
+	for _, id := range ListDataTags() {
+		if countID, _ := GetDataTags(id); countID == tagID {
+			return true
+		}
+	}
+	return false
+}
+
+// unsignedType returns the unsigned field type of the same size as the signed
+// integer field type typeID.
+func unsignedType(typeID uint16) (uint16, bool) {
+	switch typeID {
+	case FTSShort.ID():
+		return FTShort.ID(), true
+	case FTSLong.ID():
+		return FTLong.ID(), true
+	}
+	return 0, false
+}
+
+// signedOffsets returns the error for the field f, which holds offsets or
+// byte counts with a signed type.
+func signedOffsets(f Field) error {
+	return ErrOffsetOverflow{
+		ErrorContext{f.Offset(), f.Tag().ID(), -1},
+		fmt.Sprintf("offsets or byte counts are stored as %s, which its writer likely overflowed past 2 GB (see QuirkSignedOffsets)", f.Type().Name()),
+		nil,
+	}
+}
+
+// unwrapNext returns the offset of the IFD following the IFD at cur, given the
+// low 32 bits of its offset, taking it to come after cur.
+func unwrapNext(cur, next uint64) uint64 {
+	fixed := cur&^math.MaxUint32 | next&math.MaxUint32
+	if fixed <= cur {
+		fixed += 1 << 32
+	}
+	return fixed
+}
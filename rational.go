@@ -0,0 +1,202 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tiff
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/big"
+)
+
+// A Rational is the value of a RATIONAL (type 5) field: two LONGs holding a
+// numerator and a denominator.  The denominator is kept as it is stored, so
+// a Rational may be invalid (see Valid).
+type Rational struct {
+	Num, Den uint32
+}
+
+// An SRational is the value of an SRATIONAL (type 10) field: two SLONGs
+// holding a numerator and a denominator.
+type SRational struct {
+	Num, Den int32
+}
+
+// DecodeRational returns the RATIONAL held by the first 8 bytes of in.
+func DecodeRational(in []byte, bo binary.ByteOrder) Rational {
+	return Rational{bo.Uint32(in), bo.Uint32(in[4:])}
+}
+
+// DecodeSRational returns the SRATIONAL held by the first 8 bytes of in.
+func DecodeSRational(in []byte, bo binary.ByteOrder) SRational {
+	return SRational{int32(bo.Uint32(in)), int32(bo.Uint32(in[4:]))}
+}
+
+// Valid reports whether r has a denominator other than zero.
+func (r Rational) Valid() bool { return r.Den != 0 }
+
+// Float64 returns the value of r.  A zero denominator gives +Inf, or NaN if
+// the numerator is also zero.
+func (r Rational) Float64() float64 { return float64(r.Num) / float64(r.Den) }
+
+// Rat returns r as a big.Rat, or nil if r is not valid.
+func (r Rational) Rat() *big.Rat {
+	if !r.Valid() {
+		return nil
+	}
+	return new(big.Rat).SetFrac64(int64(r.Num), int64(r.Den))
+}
+
+// Reduce returns r with its numerator and denominator divided by their
+// greatest common divisor.
+func (r Rational) Reduce() Rational {
+	if g := gcd(uint64(r.Num), uint64(r.Den)); g > 1 {
+		r.Num, r.Den = uint32(uint64(r.Num)/g), uint32(uint64(r.Den)/g)
+	}
+	return r
+}
+
+// Bytes returns r encoded in bo, as it is stored in a field.
+func (r Rational) Bytes(bo binary.ByteOrder) []byte {
+	b := make([]byte, 8)
+	bo.PutUint32(b, r.Num)
+	bo.PutUint32(b[4:], r.Den)
+	return b
+}
+
+// String returns r in "n/d" notation, as stored.
+func (r Rational) String() string { return fmt.Sprintf("%d/%d", r.Num, r.Den) }
+
+// Valid reports whether r has a denominator other than zero.
+func (r SRational) Valid() bool { return r.Den != 0 }
+
+// Float64 returns the value of r.  A zero denominator gives an infinity, or
+// NaN if the numerator is also zero.
+func (r SRational) Float64() float64 { return float64(r.Num) / float64(r.Den) }
+
+// Rat returns r as a big.Rat, or nil if r is not valid.
+func (r SRational) Rat() *big.Rat {
+	if !r.Valid() {
+		return nil
+	}
+	return big.NewRat(int64(r.Num), int64(r.Den))
+}
+
+// Reduce returns r with its numerator and denominator divided by their
+// greatest common divisor.  The sign is not moved to the numerator, since
+// -2147483648 can not be negated.
+func (r SRational) Reduce() SRational {
+	if g := int64(gcd(abs64(int64(r.Num)), abs64(int64(r.Den)))); g > 1 {
+		r.Num, r.Den = int32(int64(r.Num)/g), int32(int64(r.Den)/g)
+	}
+	return r
+}
+
+// Bytes returns r encoded in bo, as it is stored in a field.
+func (r SRational) Bytes(bo binary.ByteOrder) []byte {
+	b := make([]byte, 8)
+	bo.PutUint32(b, uint32(r.Num))
+	bo.PutUint32(b[4:], uint32(r.Den))
+	return b
+}
+
+// String returns r in "n/d" notation, as stored.
+func (r SRational) String() string { return fmt.Sprintf("%d/%d", r.Num, r.Den) }
+
+// RationalOf returns the Rational closest to v whose numerator and
+// denominator fit in a LONG.  Whole numbers are exact.  An error is returned
+// for values that are negative, not a number or too large.
+func RationalOf(v float64) (Rational, error) {
+	if !(v >= 0 && v <= math.MaxUint32) {
+		return Rational{}, fmt.Errorf("tiff: %g can not be stored as a rational", v)
+	}
+	num, den := approximate(v, math.MaxUint32)
+	return Rational{uint32(num), uint32(den)}, nil
+}
+
+// SRationalOf returns the SRational closest to v whose numerator and
+// denominator fit in an SLONG.  An error is returned for values that are not
+// a number or too large.
+func SRationalOf(v float64) (SRational, error) {
+	if !(v >= -math.MaxInt32 && v <= math.MaxInt32) {
+		return SRational{}, fmt.Errorf("tiff: %g can not be stored as a signed rational", v)
+	}
+	num, den := approximate(math.Abs(v), math.MaxInt32)
+	if v < 0 {
+		return SRational{-int32(num), int32(den)}, nil
+	}
+	return SRational{int32(num), int32(den)}, nil
+}
+
+// approximate returns the last convergent of the continued fraction of v (which
+// must not be negative) whose terms are both at most max.
+func approximate(v float64, max uint64) (num, den uint64) {
+	// h and k hold the last two numerators and denominators.
+	h0, h1 := uint64(0), uint64(1)
+	k0, k1 := uint64(1), uint64(0)
+	x := v
+	for i := 0; i < 64; i++ {
+		a := math.Floor(x)
+		if a > float64(max) {
+			break
+		}
+		ai := uint64(a)
+		h2, k2 := ai*h1+h0, ai*k1+k0
+		if h2 > max || k2 > max {
+			break
+		}
+		h0, h1, k0, k1 = h1, h2, k1, k2
+		if x == a || float64(h1)/float64(k1) == v {
+			break
+		}
+		x = 1 / (x - a)
+	}
+	if k1 == 0 {
+		return 0, 1
+	}
+	return h1, k1
+}
+
+// Rationals returns the values of f, which must be of type RATIONAL.
+func Rationals(f Field) ([]Rational, error) {
+	if f.Type().ID() != FTRational.ID() {
+		return nil, fmt.Errorf("tiff: field %d is of type %s, not Rational", f.Tag().ID(), f.Type().Name())
+	}
+	buf, bo := f.Value().Bytes(), f.Value().Order()
+	rs := make([]Rational, 0, len(buf)/8)
+	for i := uint64(0); i < f.Count() && len(buf) >= 8; i++ {
+		rs = append(rs, DecodeRational(buf, bo))
+		buf = buf[8:]
+	}
+	return rs, nil
+}
+
+// SRationals returns the values of f, which must be of type SRATIONAL.
+func SRationals(f Field) ([]SRational, error) {
+	if f.Type().ID() != FTSRational.ID() {
+		return nil, fmt.Errorf("tiff: field %d is of type %s, not SRational", f.Tag().ID(), f.Type().Name())
+	}
+	buf, bo := f.Value().Bytes(), f.Value().Order()
+	rs := make([]SRational, 0, len(buf)/8)
+	for i := uint64(0); i < f.Count() && len(buf) >= 8; i++ {
+		rs = append(rs, DecodeSRational(buf, bo))
+		buf = buf[8:]
+	}
+	return rs, nil
+}
+
+func gcd(a, b uint64) uint64 {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+func abs64(n int64) uint64 {
+	if n < 0 {
+		return uint64(-n)
+	}
+	return uint64(n)
+}
@@ -0,0 +1,142 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tiff
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// atBReader is a BReader over an io.ReaderAt.  ReadAt and BReadSection go
+// straight to the io.ReaderAt, which the io package requires to allow parallel
+// calls, so they never touch shared state.  Only Read, BRead and Seek use the
+// current position, which is guarded by mu.
+type atBReader struct {
+	order binary.ByteOrder
+	r     io.ReaderAt
+	size  int64
+
+	mu  sync.Mutex
+	pos int64
+}
+
+// NewBReaderAt returns a BReader that reads the first size bytes of r using
+// byte order o.  Unlike the BReader returned by NewBReader, it is safe for
+// concurrent use by multiple goroutines: ReadAt and BReadSection may be called
+// in parallel (for example to fetch different tiles of the same file), and
+// calls to Read, BRead and Seek are serialized.  An *os.File, a
+// *bytes.Reader, or an io.SectionReader all make suitable values of r.
+func NewBReaderAt(r io.ReaderAt, size int64, o binary.ByteOrder) BReader {
+	return &atBReader{order: o, r: r, size: size}
+}
+
+func (b *atBReader) Read(p []byte) (n int, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.pos >= b.size {
+		return 0, io.EOF
+	}
+	if rem := b.size - b.pos; int64(len(p)) > rem {
+		p = p[:rem]
+	}
+	n, err = b.r.ReadAt(p, b.pos)
+	b.pos += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+func (b *atBReader) ReadAt(p []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, errors.New("tiff: negative offset")
+	}
+	if off >= b.size {
+		return 0, io.EOF
+	}
+	if rem := b.size - off; int64(len(p)) > rem {
+		n, err = b.r.ReadAt(p[:rem], off)
+		if err == nil {
+			err = io.EOF
+		}
+		return n, err
+	}
+	return b.r.ReadAt(p, off)
+}
+
+func (b *atBReader) BRead(data interface{}) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	sr := io.NewSectionReader(b.r, b.pos, b.size-b.pos)
+	err := binary.Read(sr, b.order, data)
+	n, _ := sr.Seek(0, io.SeekCurrent)
+	b.pos += n
+	return err
+}
+
+func (b *atBReader) BReadSection(data interface{}, offset int64, n int64) error {
+	if offset < 0 {
+		return fmt.Errorf("tiff: invalid offset %d", offset)
+	}
+	if n < 1 {
+		return fmt.Errorf("tiff: invalid section size %d", n)
+	}
+	sr := io.NewSectionReader(b, offset, n)
+	return binary.Read(sr, b.order, data)
+}
+
+func (b *atBReader) Seek(offset int64, whence int) (int64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += b.pos
+	case io.SeekEnd:
+		offset += b.size
+	default:
+		return 0, errors.New("tiff: invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("tiff: negative position")
+	}
+	b.pos = offset
+	return offset, nil
+}
+
+func (b *atBReader) ByteOrder() binary.ByteOrder {
+	return b.order
+}
+
+// ParseReaderAt is like Parse, but it reads the first size bytes of r through
+// a BReader returned by NewBReaderAt.  The TIFF.R of the returned TIFF can be
+// shared by goroutines decoding different strips or tiles at the same time.
+func ParseReaderAt(r io.ReaderAt, size int64, tsp TagSpace, ftsp FieldTypeSpace) (TIFF, error) {
+	var ordr [2]byte
+	if _, err := r.ReadAt(ordr[:], 0); err != nil {
+		return nil, ReadError(err, "the byte order", at(0))
+	}
+	bo := GetByteOrder(binary.BigEndian.Uint16(ordr[:]))
+	if bo == nil {
+		bo = binary.BigEndian // parse reports the bad byte order.
+	}
+	return Parse(NewBReaderAt(r, size, bo), tsp, ftsp)
+}
+
+// ParseEmbedded parses a TIFF stream of size bytes embedded at offset base of
+// a larger container, such as the Exif data of a JPEG APP1 segment or a
+// MakerNote.  Every offset found in the stream is taken to be relative to
+// base, as the containers require, and so are the offsets reported by the
+// returned TIFF and its errors.  Like ParseReaderAt, the TIFF.R of the
+// returned TIFF can be shared by goroutines.
+func ParseEmbedded(r io.ReaderAt, base, size int64, tsp TagSpace, ftsp FieldTypeSpace) (TIFF, error) {
+	if base < 0 || size < 0 {
+		return nil, fmt.Errorf("tiff: invalid embedded stream at offset %d of %d bytes", base, size)
+	}
+	return ParseReaderAt(io.NewSectionReader(r, base, size), size, tsp, ftsp)
+}
@@ -0,0 +1,71 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tiff
+
+import "os"
+
+// ReadOnlyFile is a file that can only be read.  It satisfies ReadAtReadSeeker
+// so it can be given to Parse and to anything else in this package that only
+// reads a file.  It does not satisfy ReadWriteAtSeeker (as an os.File opened
+// for writing or a JournaledFile does), so handing it to any function of this
+// package that modifies a file (SetXMP, Edit, and the like) is rejected at
+// compile time.  The underlying file is also opened with os.O_RDONLY, so the
+// operating system refuses writes as well.  This is intended for handling
+// files that must not change, such as forensic evidence.
+type ReadOnlyFile struct {
+	f *os.File
+}
+
+// OpenReadOnly opens the named file for reading only.
+func OpenReadOnly(name string) (*ReadOnlyFile, error) {
+	f, err := os.OpenFile(name, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &ReadOnlyFile{f: f}, nil
+}
+
+func (rf *ReadOnlyFile) Name() string {
+	return rf.f.Name()
+}
+
+func (rf *ReadOnlyFile) Read(p []byte) (int, error) {
+	return rf.f.Read(p)
+}
+
+func (rf *ReadOnlyFile) ReadAt(p []byte, off int64) (int, error) {
+	return rf.f.ReadAt(p, off)
+}
+
+func (rf *ReadOnlyFile) Seek(offset int64, whence int) (int64, error) {
+	return rf.f.Seek(offset, whence)
+}
+
+// Size returns the size of the file.
+func (rf *ReadOnlyFile) Size() (int64, error) {
+	fi, err := rf.f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return fi.Size(), nil
+}
+
+func (rf *ReadOnlyFile) Close() error {
+	return rf.f.Close()
+}
+
+// ParseFile opens the named file read-only and parses it.  The returned
+// ReadOnlyFile must be kept open for as long as t is in use (values and image
+// data are read through it) and closed afterwards.
+func ParseFile(name string, tsp TagSpace, ftsp FieldTypeSpace) (t TIFF, rf *ReadOnlyFile, err error) {
+	if rf, err = OpenReadOnly(name); err != nil {
+		return
+	}
+	if t, err = Parse(rf, tsp, ftsp); err != nil {
+		rf.Close()
+		return nil, nil, err
+	}
+	return t, rf, nil
+}
@@ -0,0 +1,277 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tiff
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// maxSalvageEntries is the largest number of entries a scanned IFD may have
+// to be considered plausible.
+const maxSalvageEntries = 1024
+
+// salvageChunk is the number of bytes scanned at a time.
+const salvageChunk = 1 << 20
+
+// A SalvageResult holds what Salvage was able to recover from a file.
+type SalvageResult struct {
+	// TIFF holds the recovered IFDs: those reached by following the IFD
+	// chain from the header, followed by those found by scanning, in file
+	// order.  Since its IFDs do not necessarily form a chain, TIFF must
+	// not be used for in-place editing; write a repaired copy with
+	// MergePages or WritePage instead.
+	TIFF TIFF
+	// Offsets holds the file offset of each IFD in TIFF.IFDs().
+	Offsets []uint64
+	// Chained is the number of IFDs at the start of TIFF.IFDs() that were
+	// found by following the IFD chain.
+	Chained int
+	// ChainErr is the error that ended the IFD chain early, if any.
+	ChainErr error
+}
+
+// Salvage recovers as much as it can from a classic TIFF whose structure is
+// damaged.  It first follows the IFD chain from the header as far as it can.
+// Then it scans every word aligned offset of the file for plausible IFDs:
+// those with a reasonable number of entries in ascending tag order, known field
+// types, and values, data blocks, and next IFD offsets that lie within the
+// file.  IFDs referenced from other IFDs (such as Exif IFDs) and anything
+// found inside the data blocks of recovered IFDs are not reported as pages.
+//
+// If the byte order in the header is damaged, both byte orders are tried and
+// the one that yields more IFDs is used.  An error is only returned if nothing
+// at all could be recovered.
+func Salvage(r ReadAtReadSeeker, tsp TagSpace, ftsp FieldTypeSpace) (*SalvageResult, error) {
+	if tsp == nil {
+		tsp = DefaultTagSpace
+	}
+	if ftsp == nil {
+		ftsp = DefaultFieldTypeSpace
+	}
+	size, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, fmt.Errorf("tiff: salvage: unable to locate the end of the file: %v", err)
+	}
+	var hdr [8]byte
+	n, _ := r.ReadAt(hdr[:], 0)
+
+	orders := []binary.ByteOrder{binary.LittleEndian, binary.BigEndian}
+	if bo := GetByteOrder(binary.BigEndian.Uint16(hdr[:])); bo != nil {
+		orders = []binary.ByteOrder{bo}
+	}
+	var best *SalvageResult
+	for _, bo := range orders {
+		res, err := salvage(r, uint64(size), hdr[:n], bo, tsp, ftsp)
+		if err != nil {
+			return nil, err
+		}
+		if best == nil || len(res.Offsets) > len(best.Offsets) {
+			best = res
+		}
+	}
+	if len(best.Offsets) == 0 {
+		return nil, fmt.Errorf("tiff: salvage: no IFDs found")
+	}
+	return best, nil
+}
+
+type salvager struct {
+	r    ReadAtReadSeeker
+	br   BReader
+	size uint64
+	bo   binary.ByteOrder
+	tsp  TagSpace
+	ftsp FieldTypeSpace
+}
+
+func salvage(r ReadAtReadSeeker, size uint64, hdr []byte, bo binary.ByteOrder, tsp TagSpace, ftsp FieldTypeSpace) (*SalvageResult, error) {
+	s := &salvager{r: r, br: NewBReader(r, bo), size: size, bo: bo, tsp: tsp, ftsp: ftsp}
+	t := &tiff{ordr: [2]byte{'I', 'I'}, vers: Version, r: s.br}
+	if bo == binary.BigEndian {
+		t.ordr = [2]byte{'M', 'M'}
+	}
+	res := &SalvageResult{TIFF: t}
+	have := make(map[uint64]bool, 1)
+	var blocks []Region
+
+	accept := func(ifd IFD, off uint64) {
+		t.ifds = append(t.ifds, ifd)
+		res.Offsets = append(res.Offsets, off)
+		have[off] = true
+		blocks = append(blocks, s.dataBlocks(ifd)...)
+	}
+
+	// Follow the chain for as long as it holds together.
+	if len(hdr) == 8 {
+		t.firstOff = bo.Uint32(hdr[4:])
+	}
+	for off := uint64(t.firstOff); off != 0; {
+		if off < 8 || off%2 != 0 || have[off] || !s.plausible(off) {
+			res.ChainErr = fmt.Errorf("tiff: salvage: implausible IFD offset %d", off)
+			break
+		}
+		ifd, err := ParseIFD(s.br, off, tsp, ftsp)
+		if err != nil {
+			res.ChainErr = err
+			break
+		}
+		accept(ifd, off)
+		off = ifd.NextOffset()
+	}
+	res.Chained = len(t.ifds)
+
+	// Scan for the rest.
+	cands, err := s.scan()
+	if err != nil {
+		return nil, err
+	}
+	type found struct {
+		ifd IFD
+		off uint64
+	}
+	var fs []found
+	subs := make(map[uint64]bool, 1)
+	for _, off := range cands {
+		if have[off] {
+			continue
+		}
+		ifd, err := ParseIFD(s.br, off, tsp, ftsp)
+		if err != nil {
+			continue
+		}
+		fs = append(fs, found{ifd, off})
+	}
+	for _, ifd := range t.ifds {
+		s.markSubIFDs(ifd, subs)
+	}
+	for _, f := range fs {
+		s.markSubIFDs(f.ifd, subs)
+	}
+nextCandidate:
+	for _, f := range fs {
+		if subs[f.off] {
+			continue
+		}
+		for _, b := range blocks {
+			if f.off >= b.Offset && f.off < b.End() {
+				continue nextCandidate
+			}
+		}
+		accept(f.ifd, f.off)
+	}
+	return res, nil
+}
+
+// dataBlocks returns the data blocks referenced by ifd.
+func (s *salvager) dataBlocks(ifd IFD) []Region {
+	var out []Region
+	for _, f := range ifd.Fields() {
+		countID, ok := GetDataTags(f.Tag().ID())
+		if !ok || !ifd.HasField(countID) {
+			continue
+		}
+		offsets, err1 := uintValues(f)
+		counts, err2 := uintValues(ifd.GetField(countID))
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		for i := 0; i < len(offsets) && i < len(counts); i++ {
+			out = append(out, Region{Offset: offsets[i], Size: counts[i], Kind: RegionData})
+		}
+	}
+	return out
+}
+
+// markSubIFDs records the offsets of the IFDs that ifd references.
+func (s *salvager) markSubIFDs(ifd IFD, subs map[uint64]bool) {
+	for _, f := range ifd.Fields() {
+		if _, ok := GetSubIFDTag(f.Tag().ID()); !ok {
+			continue
+		}
+		if offsets, err := uintValues(f); err == nil {
+			for _, off := range offsets {
+				subs[off] = true
+			}
+		}
+	}
+}
+
+// plausible reports whether the bytes at off look like an IFD.
+func (s *salvager) plausible(off uint64) bool {
+	var num [2]byte
+	if _, err := s.r.ReadAt(num[:], int64(off)); err != nil {
+		return false
+	}
+	n := uint64(s.bo.Uint16(num[:]))
+	if n == 0 || n > maxSalvageEntries || off+ifdSize(4, n) > s.size {
+		return false
+	}
+	buf := make([]byte, ifdSize(4, n))
+	if _, err := s.r.ReadAt(buf, int64(off)); err != nil {
+		return false
+	}
+	return s.plausibleIFD(buf, off)
+}
+
+// plausibleIFD checks an IFD held in buf (starting with its entry count) that
+// was found at off.
+func (s *salvager) plausibleIFD(buf []byte, off uint64) bool {
+	n := uint64(s.bo.Uint16(buf))
+	if n == 0 || n > maxSalvageEntries || uint64(len(buf)) < ifdSize(4, n) {
+		return false
+	}
+	var prev uint16
+	for i := uint64(0); i < n; i++ {
+		e := buf[2+12*i:]
+		tagID := s.bo.Uint16(e)
+		typeID := s.bo.Uint16(e[2:])
+		count := uint64(s.bo.Uint32(e[4:]))
+		if i > 0 && tagID <= prev {
+			return false
+		}
+		prev = tagID
+		if typeID < 1 || typeID > 13 || count == 0 {
+			return false
+		}
+		if size := s.ftsp.GetFieldType(typeID).Size() * count; size > 4 {
+			valOff := uint64(s.bo.Uint32(e[8:]))
+			if valOff < 8 || valOff+size > s.size {
+				return false
+			}
+		}
+	}
+	next := uint64(s.bo.Uint32(buf[2+12*n:]))
+	return next == 0 || (next%2 == 0 && next >= 8 && next < s.size && next != off)
+}
+
+// scan returns the offsets of every plausible IFD in the file.
+func (s *salvager) scan() ([]uint64, error) {
+	var out []uint64
+	overlap := ifdSize(4, maxSalvageEntries)
+	buf := make([]byte, salvageChunk+overlap)
+	for base := uint64(8); base < s.size; base += salvageChunk {
+		n, err := s.r.ReadAt(buf, int64(base))
+		if err != nil && err != io.EOF {
+			return nil, fmt.Errorf("tiff: salvage: read failed at offset %d: %v", base, err)
+		}
+		chunk := buf[:n]
+		for i := uint64(0); i < salvageChunk && i+2 <= uint64(len(chunk)); i += 2 {
+			if s.plausibleIFD(chunk[i:], base+i) {
+				out = append(out, base+i)
+			}
+		}
+	}
+	sort.Sort(uint64Slice(out))
+	return out, nil
+}
+
+type uint64Slice []uint64
+
+func (p uint64Slice) Len() int           { return len(p) }
+func (p uint64Slice) Less(i, j int) bool { return p[i] < p[j] }
+func (p uint64Slice) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
@@ -0,0 +1,282 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tiff
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+/*
+Sidecar files
+
+Raw workflows keep edits to the metadata of an image in an XMP "sidecar" file
+next to it rather than in the image itself.  Two naming schemes are in use:
+	IMG_0001.xmp      the extension is replaced (Adobe Lightroom, Bridge)
+	IMG_0001.tif.xmp  the extension is appended (darktable, digiKam)
+Both are looked for when reading.  When a file has both an embedded packet and
+a sidecar, the properties of the sidecar take precedence (see MergeXMP).
+*/
+
+// SidecarPath returns the name of the XMP sidecar that WriteSidecar writes for
+// the image named name: name with its extension replaced by ".xmp".
+func SidecarPath(name string) string {
+	return strings.TrimSuffix(name, filepath.Ext(name)) + ".xmp"
+}
+
+// FindSidecar returns the name of the XMP sidecar of the image named name, if
+// it has one.
+func FindSidecar(name string) (string, bool) {
+	base := strings.TrimSuffix(name, filepath.Ext(name))
+	for _, cand := range []string{base + ".xmp", base + ".XMP", name + ".xmp", name + ".XMP"} {
+		if fi, err := os.Stat(cand); err == nil && fi.Mode().IsRegular() {
+			return cand, true
+		}
+	}
+	return "", false
+}
+
+// ReadSidecar returns the contents of the XMP sidecar of the image named name.
+// If there is no sidecar, nil is returned without an error.
+func ReadSidecar(name string) ([]byte, error) {
+	path, ok := FindSidecar(name)
+	if !ok {
+		return nil, nil
+	}
+	packet, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("tiff: unable to read xmp sidecar: %v", err)
+	}
+	return packet, nil
+}
+
+// WriteSidecar writes packet as the XMP sidecar of the image named name.  An
+// existing sidecar is replaced, whichever naming scheme it uses; otherwise the
+// sidecar is named by SidecarPath.  The packet is written to a temporary file
+// that is then renamed, so readers never see a partly written sidecar.
+func WriteSidecar(name string, packet []byte) error {
+	path, ok := FindSidecar(name)
+	if !ok {
+		path = SidecarPath(name)
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".sidecar")
+	if err != nil {
+		return fmt.Errorf("tiff: unable to create xmp sidecar: %v", err)
+	}
+	_, err = tmp.Write(packet)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("tiff: unable to write xmp sidecar: %v", err)
+	}
+	return nil
+}
+
+// XMPWithSidecar returns the XMP that applies to the first IFD of t, which was
+// parsed from the file named name: the packet embedded in the IFD merged with
+// the sidecar of the file, if it has one.
+func XMPWithSidecar(t TIFF, name string) ([]byte, error) {
+	var embedded []byte
+	if len(t.IFDs()) > 0 {
+		embedded = XMP(t.IFDs()[0])
+	}
+	sidecar, err := ReadSidecar(name)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case sidecar == nil:
+		return embedded, nil
+	case embedded == nil:
+		return sidecar, nil
+	}
+	return MergeXMP(embedded, sidecar)
+}
+
+const rdfNS = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+
+// An xmpProperty is a top level property of an XMP packet.
+type xmpProperty struct {
+	name xml.Name
+	// raw holds the property element as it appears in the packet.  For
+	// properties given as attributes, it is built from the value.
+	raw string
+}
+
+// xmpDoc holds the properties of an XMP packet along with the namespace
+// prefixes declared by the property elements and their ancestors.
+type xmpDoc struct {
+	props    []xmpProperty
+	prefixes map[string]string // prefix -> namespace
+}
+
+var xmlnsRE = regexp.MustCompile(`xmlns:([A-Za-z_][\w.\-]*)\s*=\s*(?:"([^"]*)"|'([^']*)')`)
+
+// readXMPDoc reads the properties of every rdf:Description of packet.
+func readXMPDoc(packet []byte) (*xmpDoc, error) {
+	doc := &xmpDoc{prefixes: make(map[string]string, 1)}
+	packet = bytes.TrimRight(packet, "\x00")
+	d := xml.NewDecoder(bytes.NewReader(packet))
+	var (
+		inDesc bool
+		depth  int // depth of elements within the current Description
+		start  int // start of the current property element
+		cur    xml.Name
+	)
+	for {
+		before := int(d.InputOffset())
+		tok, err := d.Token()
+		if err == io.EOF {
+			return doc, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("tiff: unable to read xmp packet: %v", err)
+		}
+		after := int(d.InputOffset())
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			if !inDesc {
+				// Declarations made by the properties themselves
+				// are kept in their raw text.
+				for _, m := range xmlnsRE.FindAllSubmatch(packet[before:after], -1) {
+					ns := string(m[2]) + string(m[3])
+					if old, ok := doc.prefixes[string(m[1])]; ok && old != ns {
+						return nil, fmt.Errorf("tiff: xmp packet binds prefix %q to both %q and %q", m[1], old, ns)
+					}
+					doc.prefixes[string(m[1])] = ns
+				}
+			}
+			switch {
+			case !inDesc && tok.Name == xml.Name{Space: rdfNS, Local: "Description"}:
+				inDesc, depth = true, 0
+				for _, a := range tok.Attr {
+					if a.Name.Space == "xmlns" || a.Name.Space == rdfNS || a.Name.Space == "" || a.Name.Space == "http://www.w3.org/XML/1998/namespace" {
+						continue
+					}
+					doc.props = append(doc.props, xmpProperty{a.Name, simpleProperty(doc.prefix(a.Name.Space), a.Name, a.Value)})
+				}
+			case inDesc:
+				if depth == 0 {
+					start, cur = before, tok.Name
+				}
+				depth++
+			}
+		case xml.EndElement:
+			if !inDesc {
+				continue
+			}
+			if depth == 0 {
+				inDesc = false
+				continue
+			}
+			depth--
+			if depth == 0 {
+				doc.props = append(doc.props, xmpProperty{cur, string(packet[start:after])})
+			}
+		}
+	}
+}
+
+// prefix returns a prefix bound to ns, or "ns" if there is none.
+func (doc *xmpDoc) prefix(ns string) string {
+	prefix := ""
+	for p, s := range doc.prefixes {
+		if s == ns && (prefix == "" || p < prefix) {
+			prefix = p
+		}
+	}
+	if prefix == "" {
+		return "ns"
+	}
+	return prefix
+}
+
+// simpleProperty returns an element holding a simple property.  The element
+// declares its own namespace so that it can be placed anywhere.
+func simpleProperty(prefix string, name xml.Name, value string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(value))
+	return fmt.Sprintf("<%[1]s:%[2]s xmlns:%[1]s=%[3]q>%[4]s</%[1]s:%[2]s>", prefix, name.Local, name.Space, buf.String())
+}
+
+// MergeXMP returns an XMP packet holding the properties of both base and
+// overlay.  Properties found in both are taken from overlay.  The result is a
+// new packet with a single rdf:Description; the values of properties are
+// copied as they are.  An error is returned if either packet cannot be read
+// or if they bind a namespace prefix to different namespaces.
+func MergeXMP(base, overlay []byte) ([]byte, error) {
+	bd, err := readXMPDoc(base)
+	if err != nil {
+		return nil, err
+	}
+	od, err := readXMPDoc(overlay)
+	if err != nil {
+		return nil, err
+	}
+	prefixes := bd.prefixes
+	for p, ns := range od.prefixes {
+		if old, ok := prefixes[p]; ok && old != ns {
+			return nil, fmt.Errorf("tiff: xmp packets bind prefix %q to both %q and %q", p, old, ns)
+		}
+		prefixes[p] = ns
+	}
+	over := make(map[xml.Name]string, len(od.props))
+	for _, p := range od.props {
+		over[p.name] = p.raw
+	}
+	var props []string
+	done := make(map[xml.Name]bool, len(bd.props)+len(od.props))
+	for _, ps := range [][]xmpProperty{bd.props, od.props} {
+		for _, p := range ps {
+			if done[p.name] {
+				continue
+			}
+			done[p.name] = true
+			if raw, ok := over[p.name]; ok {
+				props = append(props, raw)
+			} else {
+				props = append(props, p.raw)
+			}
+		}
+	}
+
+	if ns, ok := prefixes["rdf"]; ok && ns != rdfNS {
+		return nil, fmt.Errorf("tiff: xmp packet binds prefix \"rdf\" to %q", ns)
+	}
+	names := make([]string, 0, len(prefixes))
+	for p, ns := range prefixes {
+		if p != "rdf" && !(p == "x" && ns == "adobe:ns:meta/") {
+			names = append(names, p)
+		}
+	}
+	sort.Strings(names)
+	var buf bytes.Buffer
+	buf.WriteString("<?xpacket begin=\"\ufeff\" id=\"W5M0MpCehiHzreSzNTczkc9d\"?>\n")
+	buf.WriteString("<x:xmpmeta xmlns:x=\"adobe:ns:meta/\">\n")
+	fmt.Fprintf(&buf, " <rdf:RDF xmlns:rdf=%q>\n", rdfNS)
+	buf.WriteString("  <rdf:Description rdf:about=\"\"")
+	for _, p := range names {
+		fmt.Fprintf(&buf, "\n    xmlns:%s=%q", p, prefixes[p])
+	}
+	buf.WriteString(">\n")
+	for _, p := range props {
+		buf.WriteString("   " + p + "\n")
+	}
+	buf.WriteString("  </rdf:Description>\n </rdf:RDF>\n</x:xmpmeta>\n<?xpacket end=\"w\"?>")
+	return buf.Bytes(), nil
+}
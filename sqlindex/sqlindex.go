@@ -0,0 +1,294 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package sqlindex indexes the tags of a corpus of TIFF files in a SQL
+// database, so that the corpus can be searched with queries such as
+//
+//	SELECT DISTINCT f.path
+//	FROM files f
+//	JOIN ifds i ON i.file_id = f.id
+//	JOIN tags t ON t.ifd_id = i.id
+//	JOIN tag_values v ON v.tag_id = t.id
+//	WHERE t.tag = 259 AND v.int_value = 6
+//
+// which finds the files holding old-style JPEG images.  The package only uses
+// database/sql; the caller picks the database and registers its driver.  The
+// statements are written for SQLite and work with any database that takes ?
+// placeholders and supports LastInsertId.
+package sqlindex
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"reflect"
+
+	"github.com/google/tiff"
+)
+
+// schema creates the tables of an index, unless they already exist (see New).
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS files (
+		id INTEGER PRIMARY KEY,
+		path TEXT NOT NULL UNIQUE,
+		size INTEGER,
+		byte_order TEXT,
+		version INTEGER,
+		error TEXT
+	)`,
+	`CREATE TABLE IF NOT EXISTS ifds (
+		id INTEGER PRIMARY KEY,
+		file_id INTEGER NOT NULL REFERENCES files(id),
+		parent_id INTEGER REFERENCES ifds(id),
+		path TEXT NOT NULL,
+		ifd_offset INTEGER
+	)`,
+	`CREATE TABLE IF NOT EXISTS tags (
+		id INTEGER PRIMARY KEY,
+		ifd_id INTEGER NOT NULL REFERENCES ifds(id),
+		tag INTEGER NOT NULL,
+		name TEXT,
+		type INTEGER NOT NULL,
+		count INTEGER NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS tag_values (
+		tag_id INTEGER NOT NULL REFERENCES tags(id),
+		idx INTEGER NOT NULL,
+		int_value INTEGER,
+		real_value REAL,
+		text_value TEXT
+	)`,
+	`CREATE INDEX IF NOT EXISTS tags_tag ON tags(tag)`,
+	`CREATE INDEX IF NOT EXISTS tag_values_tag_id ON tag_values(tag_id)`,
+}
+
+// MaxValues is the number of values of a field that are indexed.  Fields
+// holding more, such as the offsets of strips, only have their first MaxValues
+// values in tag_values, though tags gives their full count.
+const MaxValues = 64
+
+// maxDepth bounds how deep the indexer follows sub-IFDs.  Sub-IFDs that point
+// back at their parents would otherwise add rows until the database is full.
+const maxDepth = 8
+
+// An Indexer adds TIFF files to an index held in a SQL database.
+type Indexer struct {
+	db *sql.DB
+}
+
+// New returns an Indexer adding to the index in db, creating its tables if
+// they do not exist:
+//
+//	files       a file, with the error that kept it from being parsed, if any
+//	ifds        an IFD of a file, with its path (such as "IFD 0/34665[0]")
+//	            and the IFD holding it, for sub-IFDs
+//	tags        a field of an IFD, with its tag, type and count
+//	tag_values  the values of a field, by index: integers in int_value,
+//	            floating point numbers and rationals in real_value (rationals
+//	            also as "n/d" in text_value), and ASCII strings in text_value
+func New(db *sql.DB) (*Indexer, error) {
+	for _, stmt := range schema {
+		if _, err := db.Exec(stmt); err != nil {
+			return nil, fmt.Errorf("sqlindex: unable to create the schema: %v", err)
+		}
+	}
+	return &Indexer{db: db}, nil
+}
+
+// Add indexes the named file, replacing what an earlier Add recorded for it.
+// A file that can not be opened or parsed is recorded with its error in
+// files.error, and Add returns nil; errors from the database are returned.
+// Each file is added in a transaction of its own.
+func (ix *Indexer) Add(path string) error {
+	tx, err := ix.db.Begin()
+	if err != nil {
+		return fmt.Errorf("sqlindex: %v", err)
+	}
+	if err = addFile(tx, path); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("sqlindex: %s: %v", path, err)
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("sqlindex: %s: %v", path, err)
+	}
+	return nil
+}
+
+// AddAll indexes each file named in paths (see Add), stopping at the first
+// error from the database.
+func (ix *Indexer) AddAll(paths []string) error {
+	for _, path := range paths {
+		if err := ix.Add(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addFile indexes the named file through tx.
+func addFile(tx *sql.Tx, path string) error {
+	if err := removeFile(tx, path); err != nil {
+		return err
+	}
+	var size int64
+	t, rf, perr := tiff.ParseFile(path, nil, nil)
+	if perr == nil {
+		defer rf.Close()
+		if size, perr = rf.Size(); perr == nil {
+			res, err := tx.Exec(`INSERT INTO files (path, size, byte_order, version) VALUES (?, ?, ?, ?)`, path, size, t.Order(), t.Version())
+			if err != nil {
+				return err
+			}
+			fileID, err := res.LastInsertId()
+			if err != nil {
+				return err
+			}
+			for i, ifd := range t.IFDs() {
+				if err = addIFD(tx, t, fileID, nil, fmt.Sprintf("IFD %d", i), ifd, 0); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+	_, err := tx.Exec(`INSERT INTO files (path, size, error) VALUES (?, ?, ?)`, path, size, perr.Error())
+	return err
+}
+
+// removeFile removes what the index holds for the named file.
+func removeFile(tx *sql.Tx, path string) error {
+	for _, stmt := range []string{
+		`DELETE FROM tag_values WHERE tag_id IN (SELECT t.id FROM tags t JOIN ifds i ON t.ifd_id = i.id JOIN files f ON i.file_id = f.id WHERE f.path = ?)`,
+		`DELETE FROM tags WHERE ifd_id IN (SELECT i.id FROM ifds i JOIN files f ON i.file_id = f.id WHERE f.path = ?)`,
+		`DELETE FROM ifds WHERE file_id IN (SELECT id FROM files WHERE path = ?)`,
+		`DELETE FROM files WHERE path = ?`,
+	} {
+		if _, err := tx.Exec(stmt, path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addIFD indexes ifd, found at path, along with its sub-IFDs.  parentID is the
+// IFD holding it, or nil.
+func addIFD(tx *sql.Tx, t tiff.TIFF, fileID int64, parentID interface{}, path string, ifd tiff.IFD, depth int) error {
+	res, err := tx.Exec(`INSERT INTO ifds (file_id, parent_id, path, ifd_offset) VALUES (?, ?, ?, ?)`, fileID, parentID, path, int64(tiff.RawIFDOf(ifd).Offset()))
+	if err != nil {
+		return err
+	}
+	ifdID, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	for _, f := range ifd.Fields() {
+		if err = addField(tx, ifdID, f); err != nil {
+			return err
+		}
+	}
+	if depth >= maxDepth {
+		return nil
+	}
+	for _, f := range ifd.Fields() {
+		id := f.Tag().ID()
+		if _, ok := tiff.GetSubIFDTag(id); !ok {
+			continue
+		}
+		subs, err := tiff.ParseSubIFDs(t, ifd, id)
+		if err != nil {
+			// A broken sub-IFD is left out rather than failing the
+			// whole file; its tag is indexed all the same.
+			continue
+		}
+		for i, sub := range subs {
+			if err = addIFD(tx, t, fileID, ifdID, fmt.Sprintf("%s/%d[%d]", path, id, i), sub, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// addField indexes f, a field of the IFD ifdID.
+func addField(tx *sql.Tx, ifdID int64, f tiff.Field) error {
+	ft := f.Type()
+	res, err := tx.Exec(`INSERT INTO tags (ifd_id, tag, name, type, count) VALUES (?, ?, ?, ?, ?)`, ifdID, f.Tag().ID(), f.Tag().Name(), ft.ID(), int64(f.Count()))
+	if err != nil {
+		return err
+	}
+	tagID, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	for i, v := range fieldValues(f) {
+		if _, err = tx.Exec(`INSERT INTO tag_values (tag_id, idx, int_value, real_value, text_value) VALUES (?, ?, ?, ?, ?)`, tagID, i, v.i, v.r, v.s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// A value is a row of tag_values.  Missing columns are nil.
+type value struct {
+	i, r, s interface{}
+}
+
+// fieldValues returns the first MaxValues values of f.  Values of types that
+// are neither numbers nor text are left out.
+func fieldValues(f tiff.Field) []value {
+	ft := f.Type()
+	buf, bo := f.Value().Bytes(), f.Value().Order()
+	if !tiff.KnownFieldType(ft) || uint64(len(buf)) < ft.Size()*f.Count() {
+		return nil
+	}
+	n := f.Count()
+	if n > MaxValues {
+		n = MaxValues
+	}
+	var vals []value
+	switch id := ft.ID(); {
+	case id == tiff.FTAscii.ID():
+		return []value{{s: tiff.FieldText(f)}}
+	case id == tiff.FTRational.ID():
+		rs, _ := tiff.Rationals(f)
+		for _, r := range rs[:n] {
+			vals = append(vals, rationalValue(r.Valid(), r.Float64(), r.String()))
+		}
+	case id == tiff.FTSRational.ID():
+		rs, _ := tiff.SRationals(f)
+		for _, r := range rs[:n] {
+			vals = append(vals, rationalValue(r.Valid(), r.Float64(), r.String()))
+		}
+	case id == tiff.FTUndefined.ID():
+	default:
+		for i := uint64(0); i < n; i++ {
+			v := ft.Valuer()(buf[i*ft.Size():], bo)
+			switch v.Kind() {
+			case reflect.Uint8, reflect.Uint16, reflect.Uint32:
+				vals = append(vals, value{i: int64(v.Uint())})
+			case reflect.Uint64:
+				// Databases only hold signed 64 bit integers.
+				if u := v.Uint(); u <= math.MaxInt64 {
+					vals = append(vals, value{i: int64(u)})
+				} else {
+					vals = append(vals, value{r: float64(u)})
+				}
+			case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+				vals = append(vals, value{i: v.Int()})
+			case reflect.Float32, reflect.Float64:
+				vals = append(vals, value{r: v.Float()})
+			}
+		}
+	}
+	return vals
+}
+
+// rationalValue returns the value of a rational, leaving out real_value for
+// those with a zero denominator.
+func rationalValue(valid bool, f float64, s string) value {
+	if !valid {
+		return value{s: s}
+	}
+	return value{r: f, s: s}
+}
@@ -0,0 +1,260 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package stk provides tiff extensions for working with MetaMorph STK files,
+// which hold a stack of planes in the image data of a single IFD and describe
+// them in the private UIC tags.
+package stk
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/google/tiff"
+)
+
+// Tags of the UIC fields.
+const (
+	UIC1TagID = 33628
+	UIC2TagID = 33629
+	UIC3TagID = 33630
+	UIC4TagID = 33631
+)
+
+var stkTags = tiff.NewTagSet("STK", 32768, 65535)
+
+func init() {
+	stkTags.Register(tiff.NewTag(UIC1TagID, "UIC1Tag", nil))
+	stkTags.Register(tiff.NewTag(UIC2TagID, "UIC2Tag", nil))
+	stkTags.Register(tiff.NewTag(UIC3TagID, "UIC3Tag", nil))
+	stkTags.Register(tiff.NewTag(UIC4TagID, "UIC4Tag", nil))
+
+	stkTags.Lock()
+
+	tiff.DefaultTagSpace.RegisterTagSet(stkTags)
+}
+
+// maxPlanes bounds the count of UIC2Tag, the number of planes, since the
+// sizes of the UIC2Tag, UIC3Tag and UIC4Tag arrays are read from it.
+const maxPlanes = 1 << 20
+
+// IDs of the entries of the UIC4 field that are read.
+const (
+	uic4StagePosition    = 28
+	uic4CameraChipOffset = 29
+	uic4StageLabel       = 37
+	uic4AbsoluteZ        = 40
+	uic4AbsoluteZValid   = 41
+)
+
+// A Position is a point on the stage, in the units of the stage.
+type Position struct {
+	X, Y float64
+}
+
+// A Plane describes one plane of a stack.
+type Plane struct {
+	// ZDistance is the distance of the plane from the first plane.
+	ZDistance float64
+	// Created and Modified are the times the plane was acquired and last
+	// changed, in UTC.
+	Created, Modified time.Time
+	// Wavelength is the wavelength the plane was acquired at, if the file
+	// has a UIC3 field.
+	Wavelength float64
+	// Stage is the position of the stage, if the file gives one.
+	Stage *Position
+	// CameraChipOffset is the offset of the camera chip, if the file gives
+	// one.
+	CameraChipOffset *Position
+	// StageLabel is the name of the stage position, if the file gives one.
+	StageLabel string
+	// AbsoluteZ is the absolute position of the plane, if the file gives
+	// one and marks it as valid.
+	AbsoluteZ *float64
+}
+
+// A Stack is the description of the planes of an STK file.  The planes are
+// stored one after the other in the strips of the first IFD, each of them
+// with the size described by that IFD.
+type Stack struct {
+	Planes []Plane
+}
+
+// PlaneData returns the offset and size of the image data of plane i of s,
+// given the first IFD of the file.  The IFD describes the data of the first
+// plane, which must be stored as a single run of strips; the other planes
+// follow it.
+func (s *Stack) PlaneData(ifd tiff.IFD, i int) (off, n uint64, err error) {
+	if i < 0 || i >= len(s.Planes) {
+		return 0, 0, fmt.Errorf("stk: plane %d of %d planes", i, len(s.Planes))
+	}
+	var strips struct {
+		Offsets    []uint64 `tiff:"field,tag=273"`
+		ByteCounts []uint64 `tiff:"field,tag=279"`
+	}
+	if err = tiff.UnmarshalIFD(ifd, &strips); err != nil {
+		return 0, 0, err
+	}
+	if len(strips.Offsets) == 0 || len(strips.Offsets) != len(strips.ByteCounts) {
+		return 0, 0, fmt.Errorf("stk: IFD has %d strip offsets and %d byte counts", len(strips.Offsets), len(strips.ByteCounts))
+	}
+	next := strips.Offsets[0]
+	for j, o := range strips.Offsets {
+		if o != next {
+			return 0, 0, fmt.Errorf("stk: strip %d is not stored after strip %d", j, j-1)
+		}
+		next += strips.ByteCounts[j]
+		n += strips.ByteCounts[j]
+	}
+	return strips.Offsets[0] + uint64(i)*n, n, nil
+}
+
+// Parse returns the stack described by the UIC fields of the first IFD of t.
+// Only the UIC2 field, which gives the number of planes, is required.
+func Parse(t tiff.TIFF) (*Stack, error) {
+	ifds := t.IFDs()
+	if len(ifds) == 0 || !ifds[0].HasField(UIC2TagID) {
+		return nil, fmt.Errorf("stk: file has no UIC2Tag field")
+	}
+	ifd := ifds[0]
+	br := t.R()
+	uic2 := ifd.GetField(UIC2TagID)
+	n := uic2.Count()
+	if n == 0 || n > maxPlanes {
+		return nil, fmt.Errorf("stk: UIC2Tag gives %d planes", n)
+	}
+	bo := uic2.Value().Order()
+	buf, err := tiff.ReadChargedValue(br, valueOffset(uic2), 24*n)
+	if err != nil {
+		return nil, err
+	}
+	s := &Stack{Planes: make([]Plane, n)}
+	for i := range s.Planes {
+		p := buf[24*i:]
+		s.Planes[i] = Plane{
+			ZDistance: rational(p, bo),
+			Created:   julianTime(bo.Uint32(p[8:]), bo.Uint32(p[12:])),
+			Modified:  julianTime(bo.Uint32(p[16:]), bo.Uint32(p[20:])),
+		}
+	}
+	if ifd.HasField(UIC3TagID) {
+		uic3 := ifd.GetField(UIC3TagID)
+		if buf, err = tiff.ReadChargedValue(br, valueOffset(uic3), 8*n); err != nil {
+			return nil, err
+		}
+		for i := range s.Planes {
+			s.Planes[i].Wavelength = rational(buf[8*i:], bo)
+		}
+	}
+	if ifd.HasField(UIC4TagID) {
+		if err := s.readUIC4(br, valueOffset(ifd.GetField(UIC4TagID)), bo); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// readUIC4 reads the entries of the UIC4 field at off: each is a SHORT id
+// followed by a value per plane, up to an id of 0.  Reading stops at the first
+// entry whose values are of an unknown size.
+func (s *Stack) readUIC4(br tiff.BReader, off uint64, bo binary.ByteOrder) error {
+	n := uint64(len(s.Planes))
+	var absZ []float64
+	for {
+		id, err := tiff.ReadChargedValue(br, off, 2)
+		if err != nil {
+			return err
+		}
+		off += 2
+		switch bo.Uint16(id) {
+		case uic4StagePosition, uic4CameraChipOffset:
+			buf, err := tiff.ReadChargedValue(br, off, 16*n)
+			if err != nil {
+				return err
+			}
+			off += 16 * n
+			for i := range s.Planes {
+				pos := &Position{rational(buf[16*i:], bo), rational(buf[16*i+8:], bo)}
+				if bo.Uint16(id) == uic4StagePosition {
+					s.Planes[i].Stage = pos
+				} else {
+					s.Planes[i].CameraChipOffset = pos
+				}
+			}
+		case uic4StageLabel:
+			for i := range s.Planes {
+				l, err := tiff.ReadChargedValue(br, off, 4)
+				if err != nil {
+					return err
+				}
+				size := uint64(bo.Uint32(l))
+				if size > 1<<16 {
+					return fmt.Errorf("stk: stage label at %d is %d bytes long", off, size)
+				}
+				label, err := tiff.ReadChargedValue(br, off+4, size)
+				if err != nil {
+					return err
+				}
+				s.Planes[i].StageLabel = tiff.DecodeText(label)
+				off += 4 + size
+			}
+		case uic4AbsoluteZ:
+			buf, err := tiff.ReadChargedValue(br, off, 8*n)
+			if err != nil {
+				return err
+			}
+			off += 8 * n
+			absZ = make([]float64, n)
+			for i := range absZ {
+				absZ[i] = rational(buf[8*i:], bo)
+			}
+		case uic4AbsoluteZValid:
+			buf, err := tiff.ReadChargedValue(br, off, 4*n)
+			if err != nil {
+				return err
+			}
+			off += 4 * n
+			for i := range s.Planes {
+				if absZ != nil && bo.Uint32(buf[4*i:]) != 0 {
+					z := absZ[i]
+					s.Planes[i].AbsoluteZ = &z
+				}
+			}
+		default:
+			return nil
+		}
+	}
+}
+
+// valueOffset returns the offset held by the entry of f.  The UIC fields give
+// the number of planes as their count, so their offset is not the offset of a
+// value of that count.
+func valueOffset(f tiff.Field) uint64 {
+	return tiff.EntryOf(f).ValueOffset64(f.Value().Order())
+}
+
+// rational returns the value of the RATIONAL at the start of p, or 0 if its
+// denominator is 0.
+func rational(p []byte, bo binary.ByteOrder) float64 {
+	r := tiff.DecodeRational(p, bo)
+	if !r.Valid() {
+		return 0
+	}
+	return r.Float64()
+}
+
+// julianEpoch is the Julian day number of the Unix epoch.
+const julianEpoch = 2440588
+
+// julianTime returns the time given by a Julian day number and the number of
+// milliseconds since midnight, or the zero time if day is 0.
+func julianTime(day, ms uint32) time.Time {
+	if day == 0 {
+		return time.Time{}
+	}
+	sec := (int64(day) - julianEpoch) * 86400
+	return time.Unix(sec, 0).Add(time.Duration(ms) * time.Millisecond).UTC()
+}
@@ -0,0 +1,74 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tiff
+
+import "io"
+
+// MetadataCategory selects a kind of metadata to be removed by StripMetadata.
+// Categories may be combined with |.
+type MetadataCategory uint
+
+const (
+	// StripGPS removes the GPS IFD (tag 34853).
+	StripGPS MetadataCategory = 1 << iota
+	// StripExif removes the Exif IFD (tag 34665) and everything it
+	// references, including the maker note and the Interoperability IFD.
+	StripExif
+	// StripXMP removes the XMP packet (tag 700).
+	StripXMP
+	// StripIPTC removes the IPTC-NAA record (tag 33723) and the Photoshop
+	// image resources (tag 34377), which usually carry a copy of it.
+	StripIPTC
+	// StripMakerNotes removes the maker note (tag 37500) from the Exif IFD
+	// while keeping the rest of the Exif IFD.
+	StripMakerNotes
+
+	// StripAll removes every category of metadata listed above.
+	StripAll = StripGPS | StripExif | StripXMP | StripIPTC | StripMakerNotes
+)
+
+const (
+	photoshopTagID = 34377
+	makerNoteTagID = 37500
+)
+
+// StripOptions controls the behavior of StripMetadata.
+type StripOptions struct {
+	// Categories selects the metadata to remove.  Zero means StripAll.
+	Categories MetadataCategory
+}
+
+// StripMetadata writes a copy of the TIFF found in src to dst with the
+// metadata selected by opts removed.  A nil opts removes all of the supported
+// categories of metadata.  Image data (strips, tiles, etc.) is copied byte for
+// byte; only the IFDs are rebuilt.  The copy has the same byte order and
+// offset size as src.
+func StripMetadata(src ReadAtReadSeeker, dst io.Writer, opts *StripOptions) error {
+	t, err := Parse(src, nil, nil)
+	if err != nil {
+		return err
+	}
+	cats := StripAll
+	if opts != nil && opts.Categories != 0 {
+		cats = opts.Categories
+	}
+	keep := func(parentTagID uint16, f Field) bool {
+		switch id := f.Tag().ID(); {
+		case cats&StripGPS != 0 && id == gpsIFDTagID:
+		case cats&StripExif != 0 && id == exifIFDTagID:
+		case cats&StripXMP != 0 && id == XMPTagID:
+		case cats&StripIPTC != 0 && (id == IPTCTagID || id == photoshopTagID):
+		case cats&StripMakerNotes != 0 && id == makerNoteTagID && parentTagID == exifIFDTagID:
+		default:
+			return true
+		}
+		return false
+	}
+	ifds, err := planTIFF(t, keep)
+	if err != nil {
+		return err
+	}
+	return writeTIFF(dst, t.R().ByteOrder(), t.OffsetSize() == 8, ifds)
+}
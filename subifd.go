@@ -0,0 +1,160 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tiff
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Tags whose values are offsets to other IFDs.  The Exif, GPS, and
+// Interoperability tags are defined more fully in the exif package, but they
+// are known here so that anything rewriting a file keeps them intact.
+const (
+	SubIFDsTagID             = 330
+	GlobalParametersIFDTagID = 400
+	exifIFDTagID             = 34665
+	gpsIFDTagID              = 34853
+	interoperabilityIFDTagID = 40965
+)
+
+var subIFDTags = struct {
+	mu   sync.RWMutex
+	list map[uint16]TagSpace
+}{
+	list: make(map[uint16]TagSpace, 1),
+}
+
+// RegisterSubIFDTag registers tagID as a tag whose values are offsets to IFDs.
+// Those IFDs are parsed using tsp (or DefaultTagSpace if tsp is nil).
+// Registering a tag again replaces the TagSpace used for it.
+func RegisterSubIFDTag(tagID uint16, tsp TagSpace) {
+	subIFDTags.mu.Lock()
+	subIFDTags.list[tagID] = tsp
+	subIFDTags.mu.Unlock()
+}
+
+// GetSubIFDTag reports whether tagID is registered as a tag that points to
+// IFDs and which TagSpace is used for those IFDs.
+func GetSubIFDTag(tagID uint16) (tsp TagSpace, ok bool) {
+	subIFDTags.mu.RLock()
+	defer subIFDTags.mu.RUnlock()
+	tsp, ok = subIFDTags.list[tagID]
+	if ok && tsp == nil {
+		tsp = DefaultTagSpace
+	}
+	return
+}
+
+// ListSubIFDTags returns the IDs of all tags registered with
+// RegisterSubIFDTag.
+func ListSubIFDTags() []uint16 {
+	subIFDTags.mu.RLock()
+	defer subIFDTags.mu.RUnlock()
+	ids := make([]uint16, 0, len(subIFDTags.list))
+	for id := range subIFDTags.list {
+		ids = append(ids, id)
+	}
+	sort.Sort(uint16Slice(ids))
+	return ids
+}
+
+var dataTags = struct {
+	mu   sync.RWMutex
+	list map[uint16]uint16
+}{
+	list: make(map[uint16]uint16, 1),
+}
+
+// RegisterDataTags registers offsetTagID as a tag whose values are offsets to
+// blocks of data (such as strips or tiles) and byteCountTagID as the tag that
+// holds the size of each of those blocks.
+func RegisterDataTags(offsetTagID, byteCountTagID uint16) {
+	dataTags.mu.Lock()
+	dataTags.list[offsetTagID] = byteCountTagID
+	dataTags.mu.Unlock()
+}
+
+// GetDataTags reports whether offsetTagID is registered as a tag whose values
+// are offsets to blocks of data and returns the tag holding their sizes.
+func GetDataTags(offsetTagID uint16) (byteCountTagID uint16, ok bool) {
+	dataTags.mu.RLock()
+	defer dataTags.mu.RUnlock()
+	byteCountTagID, ok = dataTags.list[offsetTagID]
+	return
+}
+
+// isDataTag reports whether id is registered as an offset or byte count tag
+// of data blocks.
+func isDataTag(id uint16) bool {
+	dataTags.mu.RLock()
+	defer dataTags.mu.RUnlock()
+	if _, ok := dataTags.list[id]; ok {
+		return true
+	}
+	for _, countID := range dataTags.list {
+		if countID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// ListDataTags returns the IDs of all offset tags registered with
+// RegisterDataTags.
+func ListDataTags() []uint16 {
+	dataTags.mu.RLock()
+	defer dataTags.mu.RUnlock()
+	ids := make([]uint16, 0, len(dataTags.list))
+	for id := range dataTags.list {
+		ids = append(ids, id)
+	}
+	sort.Sort(uint16Slice(ids))
+	return ids
+}
+
+// ParseSubIFDs parses the IFDs pointed to by the field for tagID in ifd, which
+// must be a field of t.  The tag space registered for tagID (see
+// RegisterSubIFDTag) is used.  If ifd has no such field, nil is returned.
+func ParseSubIFDs(t TIFF, ifd IFD, tagID uint16) ([]IFD, error) {
+	if !ifd.HasField(tagID) {
+		return nil, nil
+	}
+	tsp, ok := GetSubIFDTag(tagID)
+	if !ok {
+		return nil, fmt.Errorf("tiff: tag %d is not registered as a sub-ifd tag", tagID)
+	}
+	offsets, err := uintValues(ifd.GetField(tagID))
+	if err != nil {
+		return nil, err
+	}
+	parse := GetIFDParser(t.Version())
+	ifds := make([]IFD, 0, len(offsets))
+	for _, off := range offsets {
+		if err := CheckContext(IFDReader(t)); err != nil {
+			return nil, err
+		}
+		sub, err := parse(IFDReader(t), off, tsp, nil)
+		if err != nil {
+			return nil, err
+		}
+		ifds = append(ifds, sub)
+	}
+	return ifds, nil
+}
+
+func init() {
+	RegisterSubIFDTag(SubIFDsTagID, nil)
+	RegisterSubIFDTag(GlobalParametersIFDTagID, nil)
+	RegisterSubIFDTag(exifIFDTagID, nil)
+	RegisterSubIFDTag(gpsIFDTagID, nil)
+	RegisterSubIFDTag(interoperabilityIFDTagID, nil)
+
+	RegisterDataTags(273, 279) // StripOffsets, StripByteCounts
+	RegisterDataTags(288, 289) // FreeOffsets, FreeByteCounts
+	RegisterDataTags(324, 325) // TileOffsets, TileByteCounts
+	RegisterDataTags(513, 514) // JPEGInterchangeFormat, JPEGInterchangeFormatLength
+}
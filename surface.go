@@ -0,0 +1,311 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tiff
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// A Region is a range of bytes in a file along with a description of what
+// refers to it.
+type Region struct {
+	Offset uint64
+	Size   uint64
+	Desc   string
+	Kind   RegionKind
+}
+
+// A RegionKind tells what a Region holds.
+type RegionKind int
+
+const (
+	RegionHeader RegionKind = iota
+	RegionIFD
+	// RegionValue holds the values of a field that do not fit in its entry.
+	RegionValue
+	// RegionData holds a strip, tile or other block of data referenced by
+	// an offsets field (see GetDataTags).
+	RegionData
+	// RegionGap holds bytes between referenced regions.
+	RegionGap
+	// RegionTrailing holds bytes after the last referenced region.
+	RegionTrailing
+)
+
+func (k RegionKind) String() string {
+	switch k {
+	case RegionHeader:
+		return "header"
+	case RegionIFD:
+		return "ifd"
+	case RegionValue:
+		return "value"
+	case RegionData:
+		return "data"
+	case RegionGap:
+		return "gap"
+	case RegionTrailing:
+		return "trailing"
+	}
+	return fmt.Sprintf("RegionKind(%d)", int(k))
+}
+
+// End returns the offset of the first byte after r.
+func (r Region) End() uint64 {
+	return r.Offset + r.Size
+}
+
+// Overlaps reports whether r and o share any bytes.
+func (r Region) Overlaps(o Region) bool {
+	return r.Size > 0 && o.Size > 0 && r.Offset < o.End() && o.Offset < r.End()
+}
+
+func (r Region) String() string {
+	return fmt.Sprintf("[%d, %d) %s", r.Offset, r.End(), r.Desc)
+}
+
+// A Gap is a range of bytes not referenced by any structure of a file.
+type Gap struct {
+	Region
+	// Zero reports whether every byte in the gap is zero.  Gaps holding
+	// anything else are the most likely places for hidden data.
+	Zero bool
+}
+
+// A SurfaceReport describes the parts of a file that fall outside of, or
+// between, the structures the file declares.  These are the usual places for
+// data to be hidden in (or appended to) a TIFF.
+type SurfaceReport struct {
+	// Size is the size of the file.
+	Size uint64
+	// Regions holds every region referenced by the file: the header, the
+	// IFDs, out-of-line values, and data blocks, sorted by offset.
+	Regions []Region
+	// Unreferenced holds the gaps between referenced regions.  Single
+	// bytes that only serve to word align the next region are omitted.
+	Unreferenced []Gap
+	// Trailing holds the bytes after the last referenced byte, if any.
+	Trailing *Gap
+	// Overlaps holds referenced regions that share bytes.  Regions that
+	// are referenced more than once with the same offset and size (e.g. a
+	// strip shared by two pages) are not considered to overlap.
+	Overlaps []Overlap
+	// OutOfBounds holds referenced regions that extend past the end of the
+	// file.
+	OutOfBounds []Region
+}
+
+// Clean reports whether r found nothing unusual.
+func (r *SurfaceReport) Clean() bool {
+	return len(r.Unreferenced) == 0 && r.Trailing == nil && len(r.Overlaps) == 0 && len(r.OutOfBounds) == 0
+}
+
+// Findings returns a description of each unusual thing found in r.
+func (r *SurfaceReport) Findings() []string {
+	var out []string
+	for _, g := range r.Unreferenced {
+		out = append(out, fmt.Sprintf("unreferenced bytes %s", g.describe()))
+	}
+	if r.Trailing != nil {
+		out = append(out, fmt.Sprintf("data after the last referenced byte %s", r.Trailing.describe()))
+	}
+	for _, o := range r.Overlaps {
+		out = append(out, fmt.Sprintf("overlapping regions %v and %v", o.A, o.B))
+	}
+	for _, reg := range r.OutOfBounds {
+		out = append(out, fmt.Sprintf("region %v extends past the end of the file (%d bytes)", reg, r.Size))
+	}
+	return out
+}
+
+func (g Gap) describe() string {
+	if g.Zero {
+		return fmt.Sprintf("[%d, %d) (%d bytes, all zero)", g.Offset, g.End(), g.Size)
+	}
+	return fmt.Sprintf("[%d, %d) (%d bytes)", g.Offset, g.End(), g.Size)
+}
+
+// regionMapper collects the regions referenced by a TIFF.
+type regionMapper struct {
+	t       TIFF
+	regions []Region
+	seen    map[uint64]bool // offsets of IFDs already mapped
+}
+
+func (m *regionMapper) add(kind RegionKind, off, size uint64, format string, args ...interface{}) {
+	m.regions = append(m.regions, Region{off, size, fmt.Sprintf(format, args...), kind})
+}
+
+// ifdSize returns the number of bytes used by an IFD with n entries.
+func ifdSize(offsetSize, n uint64) uint64 {
+	if offsetSize == 8 {
+		return 8 + 20*n + 8
+	}
+	return 2 + 12*n + 4
+}
+
+func (m *regionMapper) mapIFD(ifd IFD, off uint64, name string) error {
+	if m.seen[off] {
+		return nil
+	}
+	m.seen[off] = true
+	osz := uint64(m.t.OffsetSize())
+	m.add(RegionIFD, off, ifdSize(osz, uint64(len(ifd.Fields()))), "%s", name)
+	for _, f := range ifd.Fields() {
+		id := f.Tag().ID()
+		if size := f.Type().Size() * f.Count(); size > osz {
+			m.add(RegionValue, f.Offset(), size, "%s tag %d values", name, id)
+		}
+		if countID, ok := GetDataTags(id); ok && ifd.HasField(countID) {
+			offsets, err := uintValues(f)
+			if err == nil {
+				offsets, err = DataOffsets(ifd, offsets)
+			}
+			if err != nil {
+				return err
+			}
+			counts, err := uintValues(ifd.GetField(countID))
+			if err != nil {
+				return err
+			}
+			for i := 0; i < len(offsets) && i < len(counts); i++ {
+				if counts[i] > 0 {
+					m.add(RegionData, offsets[i], counts[i], "%s tag %d block %d", name, id, i)
+				}
+			}
+		}
+		if _, ok := GetSubIFDTag(id); ok {
+			offsets, err := uintValues(f)
+			if err != nil {
+				return err
+			}
+			subs, err := ParseSubIFDs(m.t, ifd, id)
+			if err != nil {
+				return err
+			}
+			for i, sub := range subs {
+				if err = m.mapIFD(sub, offsets[i], fmt.Sprintf("%s/%d[%d]", name, id, i)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Regions returns every region referenced by t sorted by offset (and then by
+// size).
+func Regions(t TIFF) ([]Region, error) {
+	m := &regionMapper{t: t, seen: make(map[uint64]bool, len(t.IFDs()))}
+	hdr := uint64(8)
+	if t.OffsetSize() == 8 {
+		hdr = 16
+	}
+	m.add(RegionHeader, 0, hdr, "header")
+	m.mapDICOM(hdr)
+	for i, ifd := range t.IFDs() {
+		if err := m.mapIFD(ifd, ifdOffset(t, i), fmt.Sprintf("IFD %d", i)); err != nil {
+			return nil, err
+		}
+	}
+	sort.Stable(regionsByOffset(m.regions))
+	return m.regions, nil
+}
+
+type regionsByOffset []Region
+
+func (p regionsByOffset) Len() int { return len(p) }
+func (p regionsByOffset) Less(i, j int) bool {
+	if p[i].Offset != p[j].Offset {
+		return p[i].Offset < p[j].Offset
+	}
+	return p[i].Size < p[j].Size
+}
+func (p regionsByOffset) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
+
+// isZero reports whether the size bytes at off in r are all zero.
+func isZero(r io.ReaderAt, off, size uint64) (bool, error) {
+	buf := make([]byte, 32*1024)
+	zero := make([]byte, len(buf))
+	for size > 0 {
+		n := uint64(len(buf))
+		if size < n {
+			n = size
+		}
+		if _, err := r.ReadAt(buf[:n], int64(off)); err != nil {
+			return false, err
+		}
+		if !bytes.Equal(buf[:n], zero[:n]) {
+			return false, nil
+		}
+		off += n
+		size -= n
+	}
+	return true, nil
+}
+
+// Surface parses the TIFF found in src and reports the bytes of the file that
+// are not referenced by it, referenced regions that overlap, and anything
+// stored after the last referenced byte.
+func Surface(src ReadAtReadSeeker) (*SurfaceReport, error) {
+	t, err := Parse(src, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return surfaceOf(t, src)
+}
+
+// surfaceOf builds the SurfaceReport for t, which was parsed from src.
+func surfaceOf(t TIFF, src ReadAtReadSeeker) (*SurfaceReport, error) {
+	end, err := src.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, fmt.Errorf("tiff: unable to locate the end of the file: %v", err)
+	}
+	regions, err := Regions(t)
+	if err != nil {
+		return nil, err
+	}
+	rep := &SurfaceReport{Size: uint64(end), Regions: regions, Overlaps: findOverlaps(regions)}
+
+	var covered uint64 // end of the referenced bytes seen so far
+	for _, reg := range regions {
+		if reg.End() > rep.Size {
+			rep.OutOfBounds = append(rep.OutOfBounds, reg)
+		}
+		if reg.Offset > covered && covered < rep.Size {
+			// Ignore a single byte that word aligns reg.
+			if !(reg.Offset-covered == 1 && covered%2 == 1) {
+				gap := Region{Offset: covered, Size: minUint64(reg.Offset, rep.Size) - covered, Desc: "unreferenced", Kind: RegionGap}
+				zero, err := isZero(src, gap.Offset, gap.Size)
+				if err != nil {
+					return nil, err
+				}
+				rep.Unreferenced = append(rep.Unreferenced, Gap{gap, zero})
+			}
+		}
+		if reg.End() > covered {
+			covered = reg.End()
+		}
+	}
+	if covered < rep.Size && !(rep.Size-covered == 1 && covered%2 == 1) {
+		gap := Region{Offset: covered, Size: rep.Size - covered, Desc: "trailing", Kind: RegionTrailing}
+		zero, err := isZero(src, gap.Offset, gap.Size)
+		if err != nil {
+			return nil, err
+		}
+		rep.Trailing = &Gap{gap, zero}
+	}
+	return rep, nil
+}
+
+func minUint64(a, b uint64) uint64 {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -16,9 +16,13 @@ type Tag interface {
 }
 
 func NewTag(id uint16, name string, fi FieldInterpreter) Tag {
-	return &tag{id: id, name: name, fi: fi}
+	return &tag{id: id, name: tagNames.String(name), fi: fi}
 }
 
+// tagNames interns the names of tags, many of which are registered in several
+// TagSets (such as those of the Exif and DNG TagSpaces) under the same name.
+var tagNames = NewInterner()
+
 type tag struct {
 	id   uint16
 	name string
@@ -46,6 +46,11 @@ func init() {
 	PrivateTags.Register(NewTag(34909, "HylaFAX FaxSubAddress", nil))
 	PrivateTags.Register(NewTag(34910, "HylaFAX FaxRecvTime", nil))
 	PrivateTags.Register(NewTag(37724, "ImageSourceData", nil))
+	PrivateTags.Register(NewTag(40091, "XPTitle", nil))
+	PrivateTags.Register(NewTag(40092, "XPComment", nil))
+	PrivateTags.Register(NewTag(40093, "XPAuthor", nil))
+	PrivateTags.Register(NewTag(40094, "XPKeywords", nil))
+	PrivateTags.Register(NewTag(40095, "XPSubject", nil))
 	PrivateTags.Register(NewTag(42112, "GDAL_METADATA", nil))
 	PrivateTags.Register(NewTag(42113, "GDAL_NODATA", nil))
 	PrivateTags.Register(NewTag(50215, "Oce Scanjob Description", nil))
@@ -57,5 +62,17 @@ func init() {
 	// Alias Sketchbook Pro
 	PrivateTags.Register(NewTag(50784, "Alias Layer Metadata", nil))
 
+	// Hamamatsu NDPI
+	PrivateTags.Register(NewTag(NDPIOffsetHighBytesTagID, "NDPI_OFFSET_HIGH_BYTES", nil))
+	PrivateTags.Register(NewTag(NDPIFormatFlagTagID, "NDPI_FORMAT_FLAG", nil))
+	PrivateTags.Register(NewTag(NDPISourceLensTagID, "NDPI_SOURCELENS", nil))
+	PrivateTags.Register(NewTag(NDPIXOffsetTagID, "NDPI_XOFFSET", nil))
+	PrivateTags.Register(NewTag(NDPIYOffsetTagID, "NDPI_YOFFSET", nil))
+	PrivateTags.Register(NewTag(NDPIFocalPlaneTagID, "NDPI_FOCAL_PLANE", nil))
+	PrivateTags.Register(NewTag(NDPIMCUStartsTagID, "NDPI_MCU_STARTS", nil))
+	PrivateTags.Register(NewTag(NDPIReferenceTagID, "NDPI_REFERENCE", nil))
+	PrivateTags.Register(NewTag(NDPIScannerSerialTagID, "NDPI_SCANNER_SERIAL", nil))
+	PrivateTags.Register(NewTag(NDPIPropertyMapTagID, "NDPI_PROPERTY_MAP", nil))
+
 	DefaultTagSpace.RegisterTagSet(PrivateTags)
 }
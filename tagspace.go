@@ -25,8 +25,9 @@ type TagSpace interface {
 
 func NewTagSpace(name string) TagSpace {
 	return &tagSpace{
-		name: name,
-		ts:   make(map[string]TagSet, 1),
+		name:  name,
+		ts:    make(map[string]TagSet, 1),
+		names: make(map[string]uint16, 1),
 	}
 }
 
@@ -40,6 +41,10 @@ type tagSpace struct {
 	name string
 	ts   map[string]TagSet
 	tags [65536]*nsTagPair // Cache for fast lookup
+	// names is the symbol table of the names of the tags in the cache.  A
+	// name whose tag has since been replaced by one of another name is
+	// left in place and skipped by LookupTag.
+	names map[string]uint16
 }
 
 func (tsp *tagSpace) Name() string {
@@ -61,7 +66,69 @@ func (tsp *tagSpace) GetTag(id uint16) Tag {
 			return t
 		}
 	}
-	return NewTag(id, fmt.Sprintf("UNKNOWN_TAG_%d", id), nil)
+	return unknownTag(id)
+}
+
+// unknownTags holds the tags returned for IDs that no TagSet has, made once
+// for each ID so that decoding files full of them does not allocate.
+var unknownTags struct {
+	mu   sync.Mutex
+	tags [65536]Tag
+}
+
+func unknownTag(id uint16) Tag {
+	unknownTags.mu.Lock()
+	defer unknownTags.mu.Unlock()
+	t := unknownTags.tags[id]
+	if t == nil {
+		t = NewTag(id, fmt.Sprintf("UNKNOWN_TAG_%d", id), nil)
+		unknownTags.tags[id] = t
+	}
+	return t
+}
+
+// lookupName returns the tag of tsp named name.  It does not allocate.
+func (tsp *tagSpace) lookupName(name string) (Tag, bool) {
+	tsp.mu.RLock()
+	defer tsp.mu.RUnlock()
+	id, ok := tsp.names[name]
+	if !ok {
+		return nil, false
+	}
+	nstp := tsp.tags[id]
+	if nstp == nil || nstp.tag.Name() != name {
+		return nil, false
+	}
+	return nstp.tag, true
+}
+
+// LookupTag returns the tag of tsp (DefaultTagSpace if nil) named name, as
+// given by Tag.Name.  Names are matched exactly; if several tags share a name,
+// any of them may be returned.  For the TagSpaces made by NewTagSpace, finding
+// a tag takes constant time and does not allocate, which matters to queries
+// run against millions of entries.  Other TagSpaces, and tags added to a
+// TagSet after it was registered with the TagSpace, are searched tag by tag.
+func LookupTag(tsp TagSpace, name string) (Tag, bool) {
+	if tsp == nil {
+		tsp = DefaultTagSpace
+	}
+	if s, ok := tsp.(*tagSpace); ok {
+		if t, ok := s.lookupName(name); ok {
+			return t, true
+		}
+	}
+	for _, setName := range tsp.ListTagSets() {
+		ts, ok := tsp.GetTagSet(setName)
+		if !ok {
+			continue
+		}
+		for _, id := range ts.ListTags() {
+			if t := tsp.GetTag(id); t.Name() == name {
+				return t, true
+			}
+		}
+	}
+	return nil, false
 }
 
 func (tsp *tagSpace) GetTagSet(name string) (TagSet, bool) {
@@ -122,6 +189,7 @@ func (tsp *tagSpace) RegisterTagSet(ts TagSet) {
 		// user can always get the TagSet and then access the
 		// conflicting tag that way.
 		tsp.tags[tID] = &nsTagPair{ts.Name(), t}
+		tsp.names[t.Name()] = tID
 	}
 	tsp.mu.Unlock()
 }
@@ -5,9 +5,11 @@
 package tiff
 
 import (
+	"context"
 	"encoding/binary"
 	"fmt"
 	"io"
+	"math"
 	"sync"
 )
 
@@ -38,6 +40,15 @@ func GetByteOrder(bo uint16) binary.ByteOrder {
 	return nil
 }
 
+// ByteOrderOf returns the byte order of the file described by h.  The same
+// order is used by h.R() for a TIFF.
+func ByteOrderOf(h Header) binary.ByteOrder {
+	if len(h.Order()) != 2 {
+		return nil
+	}
+	return GetByteOrder(byteOrderMark(h.Order()))
+}
+
 type ErrInvalidByteOrder struct {
 	Order [2]byte
 }
@@ -70,6 +81,13 @@ type TIFF interface {
 }
 
 func Parse(r ReadAtReadSeeker, tsp TagSpace, ftsp FieldTypeSpace) (TIFF, error) {
+	return parse(nil, r, tsp, ftsp, nil, 0, nil)
+}
+
+// parse is Parse, stopping once ctx is done if it is not nil, enforcing l if it
+// is not nil, applying quirks q, and parsing fields as fo directs if it is not
+// nil.
+func parse(ctx context.Context, r ReadAtReadSeeker, tsp TagSpace, ftsp FieldTypeSpace, l *Limits, q Quirk, fo *fieldOptions) (TIFF, error) {
 	if tsp == nil {
 		tsp = DefaultTagSpace
 	}
@@ -77,25 +95,48 @@ func Parse(r ReadAtReadSeeker, tsp TagSpace, ftsp FieldTypeSpace) (TIFF, error)
 		ftsp = DefaultFieldTypeSpace
 	}
 
+	if ctx != nil {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+	}
 	var magicBytes [4]byte
 
 	if _, err := io.ReadFull(r, magicBytes[:]); err != nil {
-		return nil, fmt.Errorf("tiff: unable to read byte order and version: %v", err)
+		return nil, ReadError(err, "the byte order and version", at(0))
 	}
 
 	orderBytes := [2]byte{magicBytes[0], magicBytes[1]}
 	byteOrder := GetByteOrder(binary.BigEndian.Uint16(orderBytes[:]))
 	if byteOrder == nil {
-		return nil, ErrInvalidByteOrder{orderBytes}
+		return nil, ErrBadMagic{at(0), magicBytes, ErrInvalidByteOrder{orderBytes}}
 	}
 
 	vers := byteOrder.Uint16(magicBytes[2:])
 
 	tp := GetVersionParser(vers)
 	if tp == nil {
-		return nil, ErrUnsuppTIFFVersion{vers}
+		return nil, ErrBadMagic{at(2), magicBytes, ErrUnsuppTIFFVersion{vers}}
+	}
+	// A BReader with the right byte order (such as one returned by
+	// NewBReaderAt) is used as it is.
+	br, ok := r.(BReader)
+	if !ok || br.ByteOrder() != byteOrder {
+		br = NewBReader(r, byteOrder)
+	}
+	if fo != nil {
+		br = &fieldBReader{br, fo}
+	}
+	if q != 0 {
+		br = &quirkBReader{br, q}
 	}
-	return tp(orderBytes, vers, NewBReader(r, byteOrder), tsp, ftsp)
+	if ctx != nil {
+		br = ContextBReader(ctx, br)
+	}
+	if l != nil {
+		br = LimitBReader(br, *l)
+	}
+	return tp(orderBytes, vers, br, tsp, ftsp)
 }
 
 // Type tiff represents a standard tiff structure with 32 bit offsets.
@@ -142,24 +183,85 @@ func ParseTIFF(ordr [2]byte, vers uint16, br BReader, tsp TagSpace, ftsp FieldTy
 	var firstOffset uint32
 	// Get the offset to the first IFD
 	if err = br.BRead(&firstOffset); err != nil {
-		return nil, fmt.Errorf("tiff: unable to read offset to first ifd: %v", err)
+		return nil, ReadError(err, "the offset to the first ifd", at(4))
 	}
 	// Check the offset to the first IFD (ensure it is past the end of the header)
 	if firstOffset < 8 {
-		return nil, fmt.Errorf("tiff: invalid offset to first IFD, %d < 8", firstOffset)
+		return nil, ErrOffsetOutOfBounds{at(uint64(firstOffset)), "the first ifd", fmt.Errorf("%d < 8", firstOffset)}
 	}
 
 	t := &tiff{ordr: ordr, vers: vers, firstOff: firstOffset, r: br}
-	// Locate and decode IFDs
-	for nextOffset := uint64(firstOffset); nextOffset != 0; {
-		var ifd IFD
-		if ifd, err = ParseIFD(br, nextOffset, tsp, ftsp); err != nil {
-			return
+	// Hamamatsu NDPI files larger than 4 GB need their offsets fixed (see
+	// NDPIOffset); the first IFD tells whether the file is one.  Smaller
+	// ones are read as usual, since their offsets are right and editors
+	// that do not know of NDPI do not keep the high bits zero.  Other
+	// files larger than 4 GB get the same fix if QuirkWrappedOffsets is
+	// enabled.
+	ndpi, wrapped := false, false
+	if QuirksOf(br)&QuirkWrappedOffsets != 0 {
+		if wrapped, err = largeFile(br); err != nil {
+			return nil, err
+		}
+	}
+	if err = t.parseChain(br, tsp, ftsp, &ndpi, wrapped); err != nil {
+		return nil, overflowed(br, ndpi || wrapped, err)
+	}
+	return t, nil
+}
+
+// parseChain parses the main IFD chain of t.  ndpi is set once the first IFD
+// shows that the file is an NDPI file larger than 4 GB.  wrapped enables
+// QuirkWrappedOffsets.
+func (t *tiff) parseChain(br BReader, tsp TagSpace, ftsp FieldTypeSpace, ndpi *bool, wrapped bool) (err error) {
+	cc := NewChainChecker(4)
+	for nextOffset := uint64(t.firstOff); nextOffset != 0; {
+		if err = CheckContext(br); err != nil {
+			return err
+		}
+		if err = cc.Visit(nextOffset); err != nil {
+			return err
+		}
+		var ifd *imageFileDirectory
+		if ifd, err = parseIFD(br, nextOffset, tsp, ftsp, ndpiFix(*ndpi || wrapped, nextOffset)); err != nil {
+			return WithIFDIndex(err, len(t.ifds))
+		}
+		if len(t.ifds) == 0 && ifd.HasField(NDPIFormatFlagTagID) {
+			if *ndpi, err = largeFile(br); err != nil {
+				return err
+			}
+		}
+		switch {
+		case *ndpi:
+			if err = readNDPINextHigh(br, ifd); err != nil {
+				return WithIFDIndex(err, len(t.ifds))
+			}
+		case wrapped && ifd.nextOffset != 0:
+			ifd.nextHigh = uint32(unwrapNext(nextOffset, uint64(ifd.nextOffset)) >> 32)
+		}
+		if err = cc.Add(ifd, nextOffset); err != nil {
+			return err
 		}
 		t.ifds = append(t.ifds, ifd)
 		nextOffset = ifd.NextOffset()
 	}
-	return t, nil
+	return nil
+}
+
+// overflowed returns err, which parsing the file behind br ran into, as an
+// ErrOffsetOverflow if the file is larger than 4 GB and its offsets were not
+// fixed, since they then likely wrapped.
+func overflowed(br BReader, fixed bool, err error) error {
+	if fixed || CheckContext(br) != nil {
+		return err
+	}
+	if _, ok := err.(ErrOffsetOverflow); ok {
+		return err
+	}
+	size, serr := br.Seek(0, io.SeekEnd)
+	if serr != nil || size <= math.MaxUint32 {
+		return err
+	}
+	return ErrOffsetOverflow{at(0), fmt.Sprintf("the file is %d bytes, more than 32 bit offsets reach, so its writer likely wrapped them (see QuirkWrappedOffsets)", size), err}
 }
 
 var versionParsers = struct {
@@ -181,6 +283,35 @@ func GetVersionParser(v uint16) TIFFParser {
 	return versionParsers.parsers[v]
 }
 
+var ifdParsers = struct {
+	mu      sync.RWMutex
+	parsers map[uint16]IFDParser
+}{
+	parsers: make(map[uint16]IFDParser, 1),
+}
+
+// RegisterIFDParser registers the IFDParser used for IFDs of files with
+// version v.  This allows IFDs that are only referenced from other IFDs (such
+// as SubIFDs or the Exif IFD) to be parsed without knowing the version
+// specific details of the file.
+func RegisterIFDParser(v uint16, p IFDParser) {
+	ifdParsers.mu.Lock()
+	defer ifdParsers.mu.Unlock()
+	ifdParsers.parsers[v] = p
+}
+
+// GetIFDParser returns the IFDParser registered for version v.  ParseIFD is
+// returned if no parser has been registered.
+func GetIFDParser(v uint16) IFDParser {
+	ifdParsers.mu.RLock()
+	defer ifdParsers.mu.RUnlock()
+	if p := ifdParsers.parsers[v]; p != nil {
+		return p
+	}
+	return ParseIFD
+}
+
 func init() {
 	RegisterVersion(Version, ParseTIFF)
+	RegisterIFDParser(Version, ParseIFD)
 }
@@ -0,0 +1,176 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tiffep
+
+import (
+	"fmt"
+
+	"github.com/google/tiff"
+)
+
+/* Camera raw files
+
+Raw formats keep several images in one TIFF/EP structure, each in its own IFD:
+	CR2:  IFD 0 holds a JPEG preview, IFD 1 a thumbnail (as a JPEG stream),
+	      IFD 2 a small uncompressed RGB image and IFD 3 the raw data, cut
+	      into slices (see CR2SliceTagID).
+	NEF:  IFD 0 holds a thumbnail, and its SubIFDs a JPEG preview and the
+	      raw data.
+	ARW:  IFD 0 holds a JPEG preview as a JPEG stream, and its SubIFDs the
+	      raw data; IFD 1 holds a thumbnail.
+Images walks the IFD chain and every sub-IFD tag registered with
+tiff.RegisterSubIFDTag, so it finds all of these.  Previews hidden in maker
+notes are not looked for.
+*/
+
+// Values of the PhotometricInterpretation tag that mark raw sensor data.
+const (
+	PhotometricCFA       = 32803
+	PhotometricLinearRaw = 34892
+)
+
+// Values of the Compression tag used by raw data.
+const (
+	CompressionNikonNEF = 34713
+	CompressionSonyARW  = 32767
+)
+
+// maxDepth bounds how deep Images looks for images in sub-IFDs.  Cameras nest
+// their previews one or two levels deep; a longer chain of distinct sub-IFDs
+// is not worth reading.
+const maxDepth = 8
+
+// An Image is an image embedded in a raw file.
+type Image struct {
+	// Path names the IFD of the image, as in tiff.IFDRef.
+	Path string
+	IFD  tiff.IFD
+	// Raw is set for raw sensor data, as opposed to previews and
+	// thumbnails made by the camera.
+	Raw           bool
+	Width, Height uint32 // zero for JPEG streams, which give their own
+	Compression   uint16
+	// Offset and Length locate the image in the file when it is a single
+	// JPEG stream given by the JPEGInterchangeFormat and
+	// JPEGInterchangeFormatLength tags.  Images stored in strips or tiles
+	// leave them zero.
+	Offset, Length uint64
+}
+
+type imageFields struct {
+	NewSubfileType *uint32  `tiff:"field,tag=254"`
+	ImageWidth     *uint32  `tiff:"field,tag=256"`
+	ImageLength    *uint32  `tiff:"field,tag=257"`
+	Compression    *uint16  `tiff:"field,tag=259"`
+	Photometric    *uint16  `tiff:"field,tag=262"`
+	JPEGOffset     *uint32  `tiff:"field,tag=513"`
+	JPEGLength     *uint32  `tiff:"field,tag=514"`
+	CR2Slice       []uint16 `tiff:"field,tag=50752"`
+}
+
+// Images returns the images embedded in t, in the order their IFDs are
+// found: each IFD of the main chain followed by its sub-IFDs, depth first.
+// An IFD with both strips or tiles and a JPEG stream gives two images.
+func Images(t tiff.TIFF) ([]Image, error) {
+	w := &walker{t: t, seen: make(map[uint64]bool)}
+	for i, ifd := range t.IFDs() {
+		if err := w.walk(fmt.Sprintf("IFD %d", i), ifd, 0); err != nil {
+			return w.images, err
+		}
+	}
+	return w.images, nil
+}
+
+// RawImage returns the largest raw image of t, or nil if t has none.
+func RawImage(t tiff.TIFF) (*Image, error) {
+	imgs, err := Images(t)
+	if err != nil {
+		return nil, err
+	}
+	var best *Image
+	for i := range imgs {
+		img := &imgs[i]
+		if img.Raw && (best == nil || uint64(img.Width)*uint64(img.Height) > uint64(best.Width)*uint64(best.Height)) {
+			best = img
+		}
+	}
+	return best, nil
+}
+
+type walker struct {
+	t      tiff.TIFF
+	seen   map[uint64]bool // offsets of the sub-IFDs visited
+	images []Image
+}
+
+func (w *walker) walk(path string, ifd tiff.IFD, depth int) error {
+	if err := w.add(path, ifd); err != nil {
+		return err
+	}
+	if depth >= maxDepth {
+		return nil
+	}
+	for _, f := range ifd.Fields() {
+		id := f.Tag().ID()
+		if _, ok := tiff.GetSubIFDTag(id); !ok {
+			continue
+		}
+		subs, err := tiff.ParseSubIFDs(w.t, ifd, id)
+		if err != nil {
+			return fmt.Errorf("tiffep: %s: %v", path, err)
+		}
+		for i, sub := range subs {
+			if off := tiff.RawIFDOf(sub).Offset(); off != 0 {
+				if w.seen[off] {
+					continue
+				}
+				w.seen[off] = true
+			}
+			if err := w.walk(fmt.Sprintf("%s/%d[%d]", path, id, i), sub, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// add adds the images held by ifd.
+func (w *walker) add(path string, ifd tiff.IFD) error {
+	strips, jpeg := ifd.HasField(273) || ifd.HasField(324), ifd.HasField(513)
+	if !strips && !jpeg {
+		return nil
+	}
+	var f imageFields
+	if err := tiff.UnmarshalIFD(ifd, &f); err != nil {
+		return fmt.Errorf("tiffep: %s: %v", path, err)
+	}
+	if strips {
+		img := Image{Path: path, IFD: ifd, Compression: 1}
+		if f.ImageWidth != nil && f.ImageLength != nil {
+			img.Width, img.Height = *f.ImageWidth, *f.ImageLength
+		}
+		if f.Compression != nil {
+			img.Compression = *f.Compression
+		}
+		img.Raw = f.CR2Slice != nil || img.Compression == CompressionNikonNEF || img.Compression == CompressionSonyARW
+		if f.Photometric != nil && (*f.Photometric == PhotometricCFA || *f.Photometric == PhotometricLinearRaw) {
+			img.Raw = true
+		}
+		if f.NewSubfileType != nil && *f.NewSubfileType&1 != 0 {
+			img.Raw = false
+		}
+		w.images = append(w.images, img)
+	}
+	if jpeg && f.JPEGOffset != nil && f.JPEGLength != nil && *f.JPEGLength > 0 {
+		w.images = append(w.images, Image{
+			Path:        path,
+			IFD:         ifd,
+			Compression: 6,
+			Offset:      uint64(*f.JPEGOffset),
+			Length:      uint64(*f.JPEGLength),
+		})
+	}
+	return nil
+}
@@ -2,23 +2,99 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
+// Package tiffep provides the tags of TIFF/EP (ISO 12234-2), the format camera
+// raw files such as Canon CR2, Nikon NEF and Sony ARW are built on, and finds
+// the images (raw sensor data, previews and thumbnails) these files embed.
 package tiffep
 
 import "github.com/google/tiff"
 
-var tiffEPTags = tiff.NewTagSet("TIFF/EP", 32768, 65535)
+// Tags of TIFF/EP fields that locate or describe the raw data.
+const (
+	CFARepeatPatternDimTagID = 33421
+	CFAPatternTagID          = 33422
+	TIFFEPStandardIDTagID    = 37398
+	SensingMethodTagID       = 37399
+
+	// CR2SliceTagID is the Canon tag giving how the raw data of a CR2 file
+	// is cut into vertical slices.
+	CR2SliceTagID = 50752
+)
+
+var (
+	tiffEPTags = tiff.NewTagSet("TIFF/EP", 32768, 65535)
+	rawTags    = tiff.NewTagSet("CameraRaw", 32768, 65535)
+	// tiffEPOnlyTags holds the TIFF/EP tags whose IDs other sets of
+	// tiff.DefaultTagSpace give other names: 34377 is Photoshop there and
+	// 37396 is the EXIF SubjectArea.
+	tiffEPOnlyTags = tiff.NewTagSet("TIFF/EP only", 32768, 65535)
+
+	// TIFFEPTagSpace holds the tags of the IFDs of TIFF/EP files: the
+	// baseline and extended TIFF tags, the TIFF/EP tags, and the private
+	// tags of raw formats built on TIFF/EP.  The TIFF/EP and raw tags are
+	// also registered with tiff.DefaultTagSpace, since raw files keep them
+	// in the main IFDs, apart from the two whose IDs it already names.
+	TIFFEPTagSpace = tiff.NewTagSpace("TIFF/EP")
+)
 
 func init() {
 	tiffEPTags.Register(tiff.NewTag(33421, "CFARepeatPatternDim", nil))
 	tiffEPTags.Register(tiff.NewTag(33422, "CFAPattern", nil))
+	tiffEPTags.Register(tiff.NewTag(33423, "BatteryLevel", nil))
+	tiffEPTags.Register(tiff.NewTag(33434, "ExposureTime", nil))
+	tiffEPTags.Register(tiff.NewTag(33437, "FNumber", nil))
+	tiffEPTags.Register(tiff.NewTag(34850, "ExposureProgram", nil))
+	tiffEPTags.Register(tiff.NewTag(34852, "SpectralSensitivity", nil))
+	tiffEPTags.Register(tiff.NewTag(34855, "ISOSpeedRatings", nil))
+	tiffEPTags.Register(tiff.NewTag(34856, "OECF", nil))
+	tiffEPTags.Register(tiff.NewTag(34857, "Interlace", nil))
+	tiffEPTags.Register(tiff.NewTag(34858, "TimeZoneOffset", nil))
 	tiffEPTags.Register(tiff.NewTag(34859, "SelfTimeMode", nil))
+	tiffEPTags.Register(tiff.NewTag(36867, "DateTimeOriginal", nil))
+	tiffEPTags.Register(tiff.NewTag(37122, "CompressedBitsPerPixel", nil))
+	tiffEPTags.Register(tiff.NewTag(37377, "ShutterSpeedValue", nil))
+	tiffEPTags.Register(tiff.NewTag(37378, "ApertureValue", nil))
+	tiffEPTags.Register(tiff.NewTag(37379, "BrightnessValue", nil))
+	tiffEPTags.Register(tiff.NewTag(37380, "ExposureBiasValue", nil))
+	tiffEPTags.Register(tiff.NewTag(37381, "MaxApertureValue", nil))
+	tiffEPTags.Register(tiff.NewTag(37382, "SubjectDistance", nil))
+	tiffEPTags.Register(tiff.NewTag(37383, "MeteringMode", nil))
+	tiffEPTags.Register(tiff.NewTag(37384, "LightSource", nil))
+	tiffEPTags.Register(tiff.NewTag(37385, "Flash", nil))
+	tiffEPTags.Register(tiff.NewTag(37386, "FocalLength", nil))
+	tiffEPTags.Register(tiff.NewTag(37387, "FlashEnergy", nil))
+	tiffEPTags.Register(tiff.NewTag(37388, "SpatialFrequencyResponse", nil))
+	tiffEPTags.Register(tiff.NewTag(37389, "Noise", nil))
 	tiffEPTags.Register(tiff.NewTag(37390, "FocalPlaneXResolution", nil))
 	tiffEPTags.Register(tiff.NewTag(37391, "FocalPlaneYResolution", nil))
 	tiffEPTags.Register(tiff.NewTag(37392, "FocalPlaneResolutionUnit", nil))
+	tiffEPTags.Register(tiff.NewTag(37393, "ImageNumber", nil))
+	tiffEPTags.Register(tiff.NewTag(37394, "SecurityClassification", nil))
+	tiffEPTags.Register(tiff.NewTag(37395, "ImageHistory", nil))
+	tiffEPTags.Register(tiff.NewTag(37397, "ExposureIndex", nil))
 	tiffEPTags.Register(tiff.NewTag(37398, "TIFF/EPStandardID", nil))
 	tiffEPTags.Register(tiff.NewTag(37399, "SensingMethod", nil))
 
 	tiffEPTags.Lock()
 
+	tiffEPOnlyTags.Register(tiff.NewTag(34377, "ImageResources", nil))
+	tiffEPOnlyTags.Register(tiff.NewTag(37396, "SubjectLocation", nil))
+
+	tiffEPOnlyTags.Lock()
+
+	rawTags.Register(tiff.NewTag(50648, "CR2Unknown1", nil))
+	rawTags.Register(tiff.NewTag(50656, "CR2Unknown2", nil))
+	rawTags.Register(tiff.NewTag(CR2SliceTagID, "CR2Slice", nil))
+
+	rawTags.Lock()
+
 	tiff.DefaultTagSpace.RegisterTagSet(tiffEPTags)
+	tiff.DefaultTagSpace.RegisterTagSet(rawTags)
+
+	TIFFEPTagSpace.RegisterTagSet(tiff.BaselineTags)
+	TIFFEPTagSpace.RegisterTagSet(tiff.ExtendedTags)
+	TIFFEPTagSpace.RegisterTagSet(tiffEPTags)
+	TIFFEPTagSpace.RegisterTagSet(tiffEPOnlyTags)
+	TIFFEPTagSpace.RegisterTagSet(rawTags)
+	tiff.RegisterTagSpace(TIFFEPTagSpace)
 }
@@ -0,0 +1,192 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tiff
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// uintViewPage is the number of bytes a UintView over a file reads at once.
+const uintViewPage = 4096
+
+// A UintView is a read-only view of an array of unsigned integers, such as the
+// offsets or byte counts of the strips or tiles of an image, that decodes
+// values as they are asked for instead of all at once.  Looking up a few tiles
+// of an image with millions of them then costs no more than those few values.
+//
+// A view of a field whose value was read by the parser decodes from the bytes
+// of that value.  A view of a field whose value was deferred (see
+// ParseOptions.DeferDataValues) reads the bytes it needs from the file, a page
+// at a time, keeping the last page read; this suits files read over a
+// network, where reading the whole array up front is what takes time.  A
+// UintView is safe for concurrent use.
+type UintView struct {
+	n    int
+	size int // of a value, in bytes
+	bo   binary.ByteOrder
+	buf  []byte // the values, for views held in memory
+
+	// For views over a file.
+	br       BReader
+	off      int64 // of the first value
+	mu       sync.Mutex
+	page     []byte
+	pageOff  int64 // of page, relative to off
+	pageRead bool
+}
+
+// ViewUints returns a view of the values of f, which must have an unsigned
+// integer type (such as SHORT, LONG, or LONG8).  The values of a field that
+// were deferred, and have not been asked for since, are read from the file as
+// the view is used rather than all at once.
+func ViewUints(f Field) (*UintView, error) {
+	if dv, ok := f.Value().(*deferredValue); ok && !dv.isRead() {
+		ft := f.Type()
+		if !KnownFieldType(ft) || !isUintType(ft) {
+			return nil, ErrInvalidType{ErrorContext{f.Offset(), f.Tag().ID(), -1}, ft.ID(), fmt.Sprintf("field type %q is not an unsigned integer type", ft.Name())}
+		}
+		if uint64(dv.n) < ft.Size()*f.Count() {
+			return nil, fmt.Errorf("tiff: field %d has %d bytes for %d values", f.Tag().ID(), dv.n, f.Count())
+		}
+		return &UintView{n: int(f.Count()), size: int(ft.Size()), bo: dv.order, br: dv.br, off: dv.off}, nil
+	}
+	if err := checkUints(f); err != nil {
+		return nil, err
+	}
+	return &UintView{
+		n:    int(f.Count()),
+		size: int(f.Type().Size()),
+		bo:   f.Value().Order(),
+		buf:  f.Value().Bytes(),
+	}, nil
+}
+
+// A deferredValue is a FieldValue read from the file when its bytes are first
+// asked for.
+type deferredValue struct {
+	order binary.ByteOrder
+	br    BReader
+	off   int64
+	n     int64
+
+	mu    sync.Mutex
+	value []byte
+	read  bool
+}
+
+// DeferredValue returns a FieldValue for the n bytes at off in br that reads
+// them when they are first asked for, and true, if the file of br is parsed
+// with ParseOptions.DeferDataValues and tagID is an offset or byte count tag of
+// data blocks (see RegisterDataTags).  Otherwise it returns nil and false, and
+// the value must be read at once.  Field parsers call it for values that do
+// not fit in their entry.
+func DeferredValue(br BReader, tagID uint16, off, n int64) (FieldValue, bool) {
+	if fo := fieldOptionsOf(br); fo == nil || !fo.deferData || !isDataTag(tagID) {
+		return nil, false
+	}
+	return &deferredValue{order: br.ByteOrder(), br: br, off: off, n: n}, true
+}
+
+func (dv *deferredValue) Order() binary.ByteOrder {
+	return dv.order
+}
+
+// Bytes reads the value if it has not been read yet.  A value that can not be
+// read is empty, which the users of the value report as too short for its
+// count.
+func (dv *deferredValue) Bytes() []byte {
+	dv.mu.Lock()
+	defer dv.mu.Unlock()
+	if !dv.read {
+		dv.value, _ = ReadValue(dv.br, dv.off, dv.n)
+		dv.read = true
+	}
+	return dv.value
+}
+
+func (dv *deferredValue) isRead() bool {
+	dv.mu.Lock()
+	defer dv.mu.Unlock()
+	return dv.read
+}
+
+func (dv *deferredValue) MarshalJSON() ([]byte, error) {
+	tmp := struct {
+		Bytes []byte
+	}{
+		Bytes: dv.Bytes(),
+	}
+	return json.Marshal(tmp)
+}
+
+// Len returns the number of values of v.
+func (v *UintView) Len() int {
+	return v.n
+}
+
+// At returns the value of index i.  Only views over a file return errors, when
+// the value can not be read.
+func (v *UintView) At(i int) (uint64, error) {
+	if i < 0 || i >= v.n {
+		return 0, fmt.Errorf("tiff: index %d out of range [0, %d)", i, v.n)
+	}
+	if v.buf != nil {
+		return v.decode(v.buf[i*v.size:]), nil
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	pos := int64(i) * int64(v.size)
+	if !v.pageRead || pos < v.pageOff || pos+int64(v.size) > v.pageOff+int64(len(v.page)) {
+		start := pos - pos%uintViewPage
+		n := int64(v.n)*int64(v.size) - start
+		if n > uintViewPage {
+			n = uintViewPage
+		}
+		page, err := ReadValue(v.br, v.off+start, n)
+		if err != nil {
+			return 0, ReadError(err, "an array of values", at(uint64(v.off+pos)))
+		}
+		v.page, v.pageOff, v.pageRead = page, start, true
+	}
+	return v.decode(v.page[pos-v.pageOff:]), nil
+}
+
+// Slice decodes the values of the indexes [i, j) into dst, which is grown as
+// needed, and returns it.  A view over a file reads the values at once, which
+// is cheaper than calling At for each of them.
+func (v *UintView) Slice(dst []uint64, i, j int) ([]uint64, error) {
+	if i < 0 || j < i || j > v.n {
+		return dst, fmt.Errorf("tiff: slice [%d:%d] out of range [0, %d]", i, j, v.n)
+	}
+	b := v.buf
+	if b != nil {
+		b = b[i*v.size : j*v.size]
+	} else if j > i {
+		var err error
+		if b, err = ReadValue(v.br, v.off+int64(i)*int64(v.size), int64(j-i)*int64(v.size)); err != nil {
+			return dst, ReadError(err, "an array of values", at(uint64(v.off)+uint64(i*v.size)))
+		}
+	}
+	for ; len(b) > 0; b = b[v.size:] {
+		dst = append(dst, v.decode(b))
+	}
+	return dst, nil
+}
+
+// decode returns the value at the start of b.
+func (v *UintView) decode(b []byte) uint64 {
+	switch v.size {
+	case 1:
+		return uint64(b[0])
+	case 2:
+		return uint64(v.bo.Uint16(b))
+	case 4:
+		return uint64(v.bo.Uint32(b))
+	}
+	return v.bo.Uint64(b)
+}
@@ -440,6 +440,8 @@ func ParseTiffSubIFDStructTag(text string) *subIFDStructTag {
 
 var bigRatType = reflect.TypeOf((*big.Rat)(nil))
 var timeType = reflect.TypeOf(time.Time{})
+var rationalType = reflect.TypeOf(Rational{})
+var sRationalType = reflect.TypeOf(SRational{})
 
 type ErrUnsuppConversion struct {
 	From FieldType
@@ -472,12 +474,38 @@ func unmarshalVal(data []byte, bo binary.ByteOrder, ft FieldType, v reflect.Valu
 	}
 
 	typ := v.Type()
+	switch typ {
+	case rationalType:
+		if ft.ID() != FTRational.ID() {
+			return ErrUnsuppConversion{ft, typ}
+		}
+		v.Set(reflect.ValueOf(DecodeRational(data, bo)))
+		return nil
+	case sRationalType:
+		if ft.ID() != FTSRational.ID() {
+			return ErrUnsuppConversion{ft, typ}
+		}
+		v.Set(reflect.ValueOf(DecodeSRational(data, bo)))
+		return nil
+	}
 	switch typ.Kind() {
 	case reflect.Ptr:
 		switch typ {
 		case bigRatType:
-			// If the types were the same, it should have been caught above.
-			return ErrUnsuppConversion{ft, typ}
+			// Rationals with a zero denominator become 0.
+			var r *big.Rat
+			switch ft.ID() {
+			case FTRational.ID():
+				r = DecodeRational(data, bo).Rat()
+			case FTSRational.ID():
+				r = DecodeSRational(data, bo).Rat()
+			default:
+				return ErrUnsuppConversion{ft, typ}
+			}
+			if r == nil {
+				r = new(big.Rat)
+			}
+			v.Set(reflect.ValueOf(r))
 		default:
 			newV := reflect.New(typ.Elem())
 			if err := unmarshalVal(data, bo, ft, newV.Elem()); err != nil {
@@ -489,7 +517,11 @@ func unmarshalVal(data []byte, bo binary.ByteOrder, ft FieldType, v reflect.Valu
 		var s string
 		switch ft.ReflectType().Kind() {
 		case reflect.Uint8:
-			s = string(data)
+			if ft.ID() == FTAscii.ID() {
+				s = DecodeText(data)
+			} else {
+				s = string(data)
+			}
 		default:
 			return ErrUnsuppConversion{ft, typ}
 		}
@@ -642,6 +674,12 @@ func UnmarshalIFD(ifd IFD, out interface{}) error {
 				ifdFT := ifdField.Type()
 				fvBytes := ifdField.Value().Bytes()
 				fvBo := ifdField.Value().Order()
+				if !KnownFieldType(ifdFT) {
+					return ErrInvalidType{ErrorContext{ifdField.Offset(), *fTag.Tag, -1}, ifdFT.ID(), "unknown field type"}
+				}
+				if uint64(len(fvBytes)) < ifdFT.Size()*ifdField.Count() {
+					return ErrInvalidFieldValue{*fTag.Tag, fmt.Sprintf("%d bytes for %d values of type %s", len(fvBytes), ifdField.Count(), ifdFT.Name())}
+				}
 
 				switch vftk {
 				case reflect.Array:
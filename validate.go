@@ -0,0 +1,403 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tiff
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Severity ranks how serious a Finding is.
+type Severity int
+
+const (
+	// SevInfo findings are noteworthy but not problems, e.g. features
+	// beyond Baseline TIFF.
+	SevInfo Severity = iota
+	// SevWarning findings break the specification in ways readers
+	// commonly tolerate.
+	SevWarning
+	// SevError findings break the specification in ways that are likely
+	// to keep readers from using the file.
+	SevError
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SevInfo:
+		return "info"
+	case SevWarning:
+		return "warning"
+	case SevError:
+		return "error"
+	}
+	return fmt.Sprintf("Severity(%d)", int(s))
+}
+
+// A Finding is a single result of Validate.
+type Finding struct {
+	Severity Severity
+	// Code is a short, stable identifier for the kind of finding (e.g.
+	// "missing-tag") suitable for filtering by machines.
+	Code string
+	// IFD names the IFD the finding is about (e.g. "IFD 0"), or is empty
+	// for findings about the file as a whole.
+	IFD    string
+	TagID  uint16
+	Offset uint64
+	// Message describes the finding for people.
+	Message string
+}
+
+func (f Finding) String() string {
+	loc := f.IFD
+	if f.TagID != 0 {
+		loc = fmt.Sprintf("%s tag %d", loc, f.TagID)
+	}
+	if loc == "" {
+		loc = "file"
+	}
+	return fmt.Sprintf("%s: %s: %s [%s] (offset %d)", f.Severity, loc, f.Message, f.Code, f.Offset)
+}
+
+// Finding codes used by Validate.
+const (
+	CodeMissingTag     = "missing-tag"
+	CodeDefaultedTag   = "defaulted-tag"
+	CodeWrongType      = "wrong-type"
+	CodeWrongCount     = "wrong-count"
+	CodeBadValue       = "bad-value"
+	CodeNotBaseline    = "not-baseline"
+	CodeOutOfBounds    = "out-of-bounds"
+	CodeOverlap        = "overlap"
+	CodeUnreferenced   = "unreferenced-data"
+	CodeTrailingData   = "trailing-data"
+	CodeSpecViolation  = "spec-violation"
+	CodeUnterminated   = "unterminated-ascii"
+	CodeStripMismatch  = "strip-count-mismatch"
+	CodeLayoutUnknown  = "layout-unknown"
+	CodeSubIFDProblem  = "sub-ifd"
+	CodeNoIFDs         = "no-ifds"
+	CodeUnknownVersion = "unknown-version"
+)
+
+// countRule is the number of values a baseline tag must have.  Positive
+// values are exact counts.
+type countRule int
+
+const (
+	countAny countRule = 0
+	countSPP countRule = -1 // SamplesPerPixel values
+)
+
+type baselineTag struct {
+	name  string
+	types []uint16
+	count countRule
+}
+
+var (
+	tShort     = []uint16{3}
+	tLong      = []uint16{4}
+	tShortLong = []uint16{3, 4}
+	tASCII     = []uint16{2}
+	tRational  = []uint16{5}
+	tLong8     = []uint16{16}
+)
+
+// bigTIFFTypes lists the further types that baseline tags holding offsets and
+// byte counts may have in BigTIFF files.
+var bigTIFFTypes = map[uint16][]uint16{
+	273: tLong8, // StripOffsets
+	279: tLong8, // StripByteCounts
+	288: tLong8, // FreeOffsets
+	289: tLong8, // FreeByteCounts
+}
+
+// baselineTags lists the types and counts of the Baseline TIFF 6.0 tags.
+var baselineTags = map[uint16]baselineTag{
+	254:   {"NewSubfileType", tLong, 1},
+	255:   {"SubfileType", tShort, 1},
+	256:   {"ImageWidth", tShortLong, 1},
+	257:   {"ImageLength", tShortLong, 1},
+	258:   {"BitsPerSample", tShort, countSPP},
+	259:   {"Compression", tShort, 1},
+	262:   {"PhotometricInterpretation", tShort, 1},
+	263:   {"Threshholding", tShort, 1},
+	264:   {"CellWidth", tShort, 1},
+	265:   {"CellLength", tShort, 1},
+	266:   {"FillOrder", tShort, 1},
+	270:   {"ImageDescription", tASCII, countAny},
+	271:   {"Make", tASCII, countAny},
+	272:   {"Model", tASCII, countAny},
+	273:   {"StripOffsets", tShortLong, countAny},
+	274:   {"Orientation", tShort, 1},
+	277:   {"SamplesPerPixel", tShort, 1},
+	278:   {"RowsPerStrip", tShortLong, 1},
+	279:   {"StripByteCounts", tShortLong, countAny},
+	280:   {"MinSampleValue", tShort, countSPP},
+	281:   {"MaxSampleValue", tShort, countSPP},
+	282:   {"XResolution", tRational, 1},
+	283:   {"YResolution", tRational, 1},
+	284:   {"PlanarConfiguration", tShort, 1},
+	288:   {"FreeOffsets", tLong, countAny},
+	289:   {"FreeByteCounts", tLong, countAny},
+	290:   {"GrayResponseUnit", tShort, 1},
+	291:   {"GrayResponseCurve", tShort, countAny},
+	296:   {"ResolutionUnit", tShort, 1},
+	305:   {"Software", tASCII, countAny},
+	306:   {"DateTime", tASCII, 20},
+	315:   {"Artist", tASCII, countAny},
+	316:   {"HostComputer", tASCII, countAny},
+	320:   {"ColorMap", tShort, countAny},
+	338:   {"ExtraSamples", tShort, countAny},
+	33432: {"Copyright", tASCII, countAny},
+}
+
+// validator accumulates findings.
+type validator struct {
+	t        TIFF
+	findings []Finding
+}
+
+func (v *validator) add(sev Severity, code, ifd string, tagID uint16, off uint64, format string, args ...interface{}) {
+	v.findings = append(v.findings, Finding{sev, code, ifd, tagID, off, fmt.Sprintf(format, args...)})
+}
+
+// Validate checks t against the requirements of Baseline TIFF 6.0 and returns
+// what it finds, most severe first.  The checks cover:
+//
+//	the tags required for each class of image (bilevel, grayscale, palette
+//	color, and RGB), taking tiled images into account;
+//	the types and counts of the baseline tags, and field types that are
+//	unknown or that the file can not hold;
+//	the consistency of strip offsets, byte counts, and RowsPerStrip;
+//	structures and values that lie outside of the file or overlap each
+//	other, unreferenced and trailing data (see Surface);
+//	values that do not start on a word boundary, unsorted and duplicate
+//	tags, and entries with no values (see ParseWithOptions).
+//
+// Sub-IFDs are checked for structural problems but not for baseline tags.
+func Validate(t TIFF) []Finding {
+	v := &validator{t: t}
+	if len(t.IFDs()) == 0 {
+		v.add(SevError, CodeNoIFDs, "", 0, 0, "the file has no IFDs")
+		return v.findings
+	}
+	if t.Version() != Version {
+		v.add(SevInfo, CodeUnknownVersion, "", 0, 0, "version %d is not Baseline TIFF", t.Version())
+	}
+	for i, ifd := range t.IFDs() {
+		v.checkBaseline(ifd, fmt.Sprintf("IFD %d", i), ifdOffset(t, i))
+	}
+	v.checkStructure()
+	v.checkLayout()
+	sort.Stable(findingsBySeverity(v.findings))
+	return v.findings
+}
+
+type findingsBySeverity []Finding
+
+func (p findingsBySeverity) Len() int           { return len(p) }
+func (p findingsBySeverity) Less(i, j int) bool { return p[i].Severity > p[j].Severity }
+func (p findingsBySeverity) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+
+// firstUint returns the first value of the field for tagID in ifd.
+func firstUint(ifd IFD, tagID uint16) (uint64, bool) {
+	if !ifd.HasField(tagID) {
+		return 0, false
+	}
+	vals, err := uintValues(ifd.GetField(tagID))
+	if err != nil || len(vals) == 0 {
+		return 0, false
+	}
+	return vals[0], true
+}
+
+func (v *validator) checkBaseline(ifd IFD, name string, off uint64) {
+	spp, ok := firstUint(ifd, 277)
+	if !ok {
+		spp = 1
+	}
+
+	// Type and count of each baseline tag.
+	for _, f := range ifd.Fields() {
+		id := f.Tag().ID()
+		if problem := checkFieldType(f.Type(), v.t.OffsetSize() == 8); problem != "" {
+			// Readers are expected to skip fields of unknown types.
+			sev := SevWarning
+			if KnownFieldType(f.Type()) {
+				sev = SevError
+			}
+			v.add(sev, CodeWrongType, name, id, off, "%s has type %d: %s", tagName(id), f.Type().ID(), problem)
+			continue
+		}
+		bt, ok := baselineTags[id]
+		if !ok {
+			continue
+		}
+		types := bt.types
+		if v.t.OffsetSize() == 8 {
+			types = append(types[:len(types):len(types)], bigTIFFTypes[id]...)
+		}
+		typeOK := false
+		for _, typ := range types {
+			typeOK = typeOK || f.Type().ID() == typ
+		}
+		if !typeOK {
+			v.add(SevError, CodeWrongType, name, id, off, "%s has type %s (%d)", bt.name, f.Type().Name(), f.Type().ID())
+			continue
+		}
+		want := uint64(bt.count)
+		if bt.count == countSPP {
+			want = spp
+		}
+		if bt.count != countAny && f.Count() != want {
+			sev := SevError
+			if bt.count == countSPP {
+				sev = SevWarning // TIFF 6.0 allows a single value for all samples in practice.
+			}
+			v.add(sev, CodeWrongCount, name, id, off, "%s has %d values, expected %d", bt.name, f.Count(), want)
+		}
+		if f.Type().ID() == FTAscii.ID() && f.Count() > 0 {
+			b := f.Value().Bytes()
+			if n := f.Count(); uint64(len(b)) >= n && b[n-1] != 0 {
+				v.add(SevWarning, CodeUnterminated, name, id, off, "%s is not NUL terminated", bt.name)
+			}
+		}
+	}
+
+	// Required tags by image class.
+	required := []uint16{256, 257, 262}
+	defaulted := []uint16{259, 296}
+	tiled := ifd.HasField(324) || ifd.HasField(322)
+	if tiled {
+		v.add(SevInfo, CodeNotBaseline, name, 0, off, "tiled images are an extension to Baseline TIFF")
+		required = append(required, 322, 323, 324, 325)
+	} else {
+		required = append(required, 273, 279)
+		defaulted = append(defaulted, 278)
+	}
+	required = append(required, 282, 283)
+	photo, hasPhoto := firstUint(ifd, 262)
+	bps, _ := firstUint(ifd, 258)
+	switch {
+	case !hasPhoto:
+		// Reported as missing below.
+	case photo == 0 || photo == 1:
+		if bps > 1 {
+			required = append(required, 258) // Grayscale
+		}
+	case photo == 2:
+		required = append(required, 258, 277)
+		if spp < 3 {
+			v.add(SevError, CodeBadValue, name, 277, off, "RGB images need at least 3 samples per pixel, not %d", spp)
+		}
+	case photo == 3:
+		required = append(required, 258, 320)
+		if ifd.HasField(320) && bps > 0 && bps < 64 {
+			if want := 3 * (uint64(1) << bps); ifd.GetField(320).Count() != want {
+				v.add(SevError, CodeWrongCount, name, 320, off, "ColorMap has %d values, expected %d for %d bits per sample", ifd.GetField(320).Count(), want, bps)
+			}
+		}
+	default:
+		v.add(SevInfo, CodeNotBaseline, name, 262, off, "PhotometricInterpretation %d is not part of Baseline TIFF", photo)
+	}
+	for _, id := range required {
+		if !ifd.HasField(id) {
+			v.add(SevError, CodeMissingTag, name, id, off, "required tag %d (%s) is missing", id, tagName(id))
+		}
+	}
+	for _, id := range defaulted {
+		if !ifd.HasField(id) {
+			v.add(SevInfo, CodeDefaultedTag, name, id, off, "tag %d (%s) is missing, so its default is used", id, tagName(id))
+		}
+	}
+
+	if !tiled {
+		v.checkStrips(ifd, name, off)
+	}
+}
+
+func tagName(id uint16) string {
+	if bt, ok := baselineTags[id]; ok {
+		return bt.name
+	}
+	return DefaultTagSpace.GetTag(id).Name()
+}
+
+func (v *validator) checkStrips(ifd IFD, name string, off uint64) {
+	if !ifd.HasField(273) || !ifd.HasField(279) {
+		return
+	}
+	offsets, err1 := uintValues(ifd.GetField(273))
+	counts, err2 := uintValues(ifd.GetField(279))
+	if err1 != nil || err2 != nil {
+		return // Reported as a wrong type.
+	}
+	if len(offsets) != len(counts) {
+		v.add(SevError, CodeStripMismatch, name, 279, off, "%d strip offsets but %d strip byte counts", len(offsets), len(counts))
+	}
+	length, ok := firstUint(ifd, 257)
+	if !ok {
+		return
+	}
+	rps, ok := firstUint(ifd, 278)
+	if !ok || rps == 0 || rps > length {
+		rps = length
+	}
+	if rps == 0 {
+		return
+	}
+	strips := (length + rps - 1) / rps
+	if planar, _ := firstUint(ifd, 284); planar == 2 {
+		spp, ok := firstUint(ifd, 277)
+		if !ok {
+			spp = 1
+		}
+		strips *= spp
+	}
+	if uint64(len(offsets)) != strips {
+		v.add(SevWarning, CodeStripMismatch, name, 273, off, "%d strips expected for ImageLength %d and RowsPerStrip %d, found %d", strips, length, rps, len(offsets))
+	}
+}
+
+// checkStructure reports spec violations found by a lenient parse.
+func (v *validator) checkStructure() {
+	vc := &violationChecker{t: v.t, opts: new(ParseOptions), seen: make(map[uint64]bool, len(v.t.IFDs()))}
+	for i, ifd := range v.t.IFDs() {
+		if err := vc.checkIFD(ifd, ifdOffset(v.t, i), fmt.Sprintf("IFD %d", i), 0); err != nil {
+			v.add(SevError, CodeSubIFDProblem, fmt.Sprintf("IFD %d", i), 0, ifdOffset(v.t, i), "%v", err)
+		}
+	}
+	for _, w := range vc.warnings {
+		v.add(SevWarning, CodeSpecViolation, w.IFD, w.TagID, w.Offset, "%s: %s", w.Kind, w.Detail)
+	}
+}
+
+// checkLayout reports problems with where things are in the file.
+func (v *validator) checkLayout() {
+	rep, err := surfaceOf(v.t, v.t.R())
+	if err != nil {
+		v.add(SevInfo, CodeLayoutUnknown, "", 0, 0, "the layout of the file could not be checked: %v", err)
+		return
+	}
+	for _, reg := range rep.OutOfBounds {
+		v.add(SevError, CodeOutOfBounds, "", 0, reg.Offset, "%v extends past the end of the file (%d bytes)", reg, rep.Size)
+	}
+	for _, o := range rep.Overlaps {
+		v.add(SevError, CodeOverlap, "", 0, o.B.Offset, "%v overlaps %v", o.A, o.B)
+	}
+	for _, g := range rep.Unreferenced {
+		sev := SevInfo
+		if !g.Zero {
+			sev = SevWarning
+		}
+		v.add(sev, CodeUnreferenced, "", 0, g.Offset, "unreferenced bytes %s", g.describe())
+	}
+	if g := rep.Trailing; g != nil {
+		v.add(SevWarning, CodeTrailingData, "", 0, g.Offset, "data after the last referenced byte %s", g.describe())
+	}
+}
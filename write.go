@@ -0,0 +1,527 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tiff
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+)
+
+// A FieldFilter decides whether a field is kept when a TIFF is rewritten.
+// parentTagID is the ID of the tag that pointed to the IFD holding f (for
+// example 34665 for fields of the Exif IFD) or 0 for the IFDs of the main IFD
+// chain.
+type FieldFilter func(parentTagID uint16, f Field) bool
+
+// A dataBlock is a chunk of bytes (a strip, a tile, etc.) in a source file.
+type dataBlock struct {
+	src    io.ReaderAt
+	offset uint64
+	size   uint64
+	// swap is the size of the samples whose bytes are reversed when the
+	// block is copied to a file of the other byte order, or 0.
+	swap uint64
+}
+
+// A writeIFD is an IFD prepared for writing.  The values of fields listed in
+// blocks and subs are offsets that are replaced when the IFD is written.
+type writeIFD struct {
+	order  binary.ByteOrder
+	fields []Field                // sorted by tag ID (see keepFieldOrder)
+	blocks map[uint16][]dataBlock // offset tag ID -> referenced data
+	subs   map[uint16][]*writeIFD // sub-ifd tag ID -> referenced IFDs
+
+	// Set during layout.
+	offset  uint64
+	valOffs map[uint16]uint64
+}
+
+// planIFD prepares ifd (an IFD of t) for writing along with all of the sub-IFDs
+// and data blocks it references.  Fields for which keep returns false are
+// dropped along with anything they reference.  A nil keep keeps everything.
+// Sub-IFDs that are referenced twice, as those of damaged files pointing back
+// at their parents are, or that are nested more than maxFingerprintDepth deep
+// are an error.
+func planIFD(t TIFF, ifd IFD, parentTagID uint16, keep FieldFilter) (*writeIFD, error) {
+	p := &planner{t: t, keep: keep, seen: make(map[uint64]bool, 1)}
+	return p.plan(ifd, parentTagID, 0)
+}
+
+// A planner is the state of planIFD and planTIFF.
+type planner struct {
+	t    TIFF
+	keep FieldFilter
+	seen map[uint64]bool // offsets of the IFDs planned
+}
+
+// plan is planIFD for an IFD depth levels below the main IFD chain.
+func (p *planner) plan(ifd IFD, parentTagID uint16, depth int) (*writeIFD, error) {
+	if off := RawIFDOf(ifd).Offset(); off != 0 {
+		if p.seen[off] {
+			return nil, fmt.Errorf("tiff: the IFD at offset %d is referenced more than once", off)
+		}
+		p.seen[off] = true
+	}
+	t, keep := p.t, p.keep
+	w := &writeIFD{
+		order:  t.R().ByteOrder(),
+		blocks: make(map[uint16][]dataBlock, 1),
+		subs:   make(map[uint16][]*writeIFD, 1),
+	}
+	for _, f := range ifd.Fields() {
+		if keep != nil && !keep(parentTagID, f) {
+			continue
+		}
+		w.fields = append(w.fields, f)
+	}
+	sort.Sort(fieldsByTag(w.fields))
+
+	for _, f := range w.fields {
+		id := f.Tag().ID()
+		if countID, ok := GetDataTags(id); ok && ifd.HasField(countID) {
+			offsets, err := uintValues(f)
+			if err == nil {
+				offsets, err = DataOffsets(ifd, offsets)
+			}
+			if err != nil {
+				return nil, err
+			}
+			counts, err := uintValues(ifd.GetField(countID))
+			if err != nil {
+				return nil, err
+			}
+			if len(counts) != len(offsets) {
+				return nil, fmt.Errorf("tiff: tag %d has %d offsets, but tag %d has %d byte counts", id, len(offsets), countID, len(counts))
+			}
+			blocks := make([]dataBlock, len(offsets))
+			for i := range offsets {
+				blocks[i] = dataBlock{src: t.R(), offset: offsets[i], size: counts[i]}
+			}
+			w.blocks[id] = blocks
+			continue
+		}
+		if _, ok := GetSubIFDTag(id); ok {
+			if depth >= maxFingerprintDepth {
+				return nil, fmt.Errorf("tiff: sub-ifds nested more than %d deep", maxFingerprintDepth)
+			}
+			subIFDs, err := ParseSubIFDs(t, ifd, id)
+			if err != nil {
+				return nil, err
+			}
+			for _, sub := range subIFDs {
+				ws, err := p.plan(sub, id, depth+1)
+				if err != nil {
+					return nil, err
+				}
+				w.subs[id] = append(w.subs[id], ws)
+			}
+		}
+	}
+	return w, nil
+}
+
+// planTIFF prepares every IFD in the main IFD chain of t for writing.
+func planTIFF(t TIFF, keep FieldFilter) ([]*writeIFD, error) {
+	p := &planner{t: t, keep: keep, seen: make(map[uint64]bool, len(t.IFDs()))}
+	ifds := make([]*writeIFD, 0, len(t.IFDs()))
+	for _, ifd := range t.IFDs() {
+		w, err := p.plan(ifd, 0, 0)
+		if err != nil {
+			return nil, err
+		}
+		ifds = append(ifds, w)
+	}
+	return ifds, nil
+}
+
+type fieldsByTag []Field
+
+func (p fieldsByTag) Len() int           { return len(p) }
+func (p fieldsByTag) Less(i, j int) bool { return p[i].Tag().ID() < p[j].Tag().ID() }
+func (p fieldsByTag) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+
+// A tiffWriter lays out and writes a set of IFDs with 4 byte (TIFF) or 8 byte
+// (BigTIFF) offsets.  Everything other than the data blocks (the header, the
+// IFDs, and their values) is placed at the start of the file, followed by all
+// of the data blocks.
+type tiffWriter struct {
+	order binary.ByteOrder
+	big   bool
+
+	pos       uint64
+	blockOffs map[dataBlock]uint64
+	blocks    []dataBlock // in the order they are written
+	w         io.Writer
+	written   uint64
+}
+
+func (tw *tiffWriter) offsetSize() uint64 {
+	if tw.big {
+		return 8
+	}
+	return 4
+}
+
+func (tw *tiffWriter) entrySize() uint64 {
+	if tw.big {
+		return 20
+	}
+	return 12
+}
+
+func (tw *tiffWriter) countSize() uint64 {
+	if tw.big {
+		return 8
+	}
+	return 2
+}
+
+// offsetType returns the field type used for the rewritten offsets of a field
+// that originally had type ft.
+func (tw *tiffWriter) offsetType(ft FieldType) (id uint16, size uint64) {
+	isIFD := ft.ID() == FTIFD.ID() || ft.ID() == FTIFD8.ID()
+	switch {
+	case tw.big && isIFD:
+		return FTIFD8.ID(), 8
+	case tw.big:
+		return FTLong8.ID(), 8
+	case isIFD:
+		return FTIFD.ID(), 4
+	}
+	return FTLong.ID(), 4
+}
+
+// valueSize returns the number of bytes needed for the value of f in w.
+func (tw *tiffWriter) valueSize(w *writeIFD, f Field) uint64 {
+	id := f.Tag().ID()
+	if _, ok := w.blocks[id]; ok {
+		_, size := tw.offsetType(f.Type())
+		return size * uint64(len(w.blocks[id]))
+	}
+	if _, ok := w.subs[id]; ok {
+		_, size := tw.offsetType(f.Type())
+		return size * uint64(len(w.subs[id]))
+	}
+	return f.Type().Size() * f.Count()
+}
+
+func even(n uint64) uint64 {
+	return n + n%2
+}
+
+// layout assigns offsets to w, its values, and its sub-IFDs.
+func (tw *tiffWriter) layout(w *writeIFD) {
+	w.offset = even(tw.pos)
+	tw.pos = w.offset + tw.countSize() + uint64(len(w.fields))*tw.entrySize() + tw.offsetSize()
+	w.valOffs = make(map[uint16]uint64, len(w.fields))
+	for _, f := range w.fields {
+		if size := tw.valueSize(w, f); size > tw.offsetSize() {
+			tw.pos = even(tw.pos)
+			w.valOffs[f.Tag().ID()] = tw.pos
+			tw.pos += size
+		}
+	}
+	for _, f := range w.fields {
+		for _, sub := range w.subs[f.Tag().ID()] {
+			tw.layout(sub)
+		}
+	}
+}
+
+// layoutBlocks assigns offsets to the data blocks of w and its sub-IFDs.
+// Blocks that are referenced more than once are only written once.
+func (tw *tiffWriter) layoutBlocks(w *writeIFD) {
+	for _, f := range w.fields {
+		id := f.Tag().ID()
+		for _, b := range w.blocks[id] {
+			if _, ok := tw.blockOffs[b]; ok || b.size == 0 {
+				continue
+			}
+			tw.pos = even(tw.pos)
+			tw.blockOffs[b] = tw.pos
+			tw.blocks = append(tw.blocks, b)
+			tw.pos += b.size
+		}
+		for _, sub := range w.subs[id] {
+			tw.layoutBlocks(sub)
+		}
+	}
+}
+
+func (tw *tiffWriter) write(p []byte) error {
+	n, err := tw.w.Write(p)
+	tw.written += uint64(n)
+	return err
+}
+
+// padTo writes zeros until off is reached.
+func (tw *tiffWriter) padTo(off uint64) error {
+	if off < tw.written {
+		return fmt.Errorf("tiff: write: internal error: position %d is already past %d", tw.written, off)
+	}
+	if off > tw.written {
+		return tw.write(make([]byte, off-tw.written))
+	}
+	return nil
+}
+
+func (tw *tiffWriter) putOffset(buf []byte, off uint64) {
+	if tw.big {
+		tw.order.PutUint64(buf, off)
+	} else {
+		tw.order.PutUint32(buf, uint32(off))
+	}
+}
+
+// fieldValue returns the bytes of the value of f as it is to be written.
+func (tw *tiffWriter) fieldValue(w *writeIFD, f Field) (typeID uint16, count uint64, value []byte) {
+	id := f.Tag().ID()
+	var offs []uint64
+	if blocks, ok := w.blocks[id]; ok {
+		for _, b := range blocks {
+			off := tw.blockOffs[b]
+			if b.size == 0 {
+				off = b.offset
+			}
+			offs = append(offs, off)
+		}
+	} else if subs, ok := w.subs[id]; ok {
+		for _, sub := range subs {
+			offs = append(offs, sub.offset)
+		}
+	} else {
+		if f.Value().Order() != tw.order {
+			f = orderField(f, tw.order)
+		}
+		return f.Type().ID(), f.Count(), f.Value().Bytes()[:f.Type().Size()*f.Count()]
+	}
+	typeID, size := tw.offsetType(f.Type())
+	value = make([]byte, size*uint64(len(offs)))
+	for i, off := range offs {
+		if size == 8 {
+			tw.order.PutUint64(value[uint64(i)*size:], off)
+		} else {
+			tw.order.PutUint32(value[uint64(i)*size:], uint32(off))
+		}
+	}
+	return typeID, uint64(len(offs)), value
+}
+
+// writeIFD writes w, its values and its sub-IFDs.  next is the offset of the
+// IFD that follows w in its chain (or 0).
+func (tw *tiffWriter) writeIFD(w *writeIFD, next uint64) error {
+	if err := tw.padTo(w.offset); err != nil {
+		return err
+	}
+	buf := make([]byte, tw.countSize()+uint64(len(w.fields))*tw.entrySize()+tw.offsetSize())
+	if tw.big {
+		tw.order.PutUint64(buf, uint64(len(w.fields)))
+	} else {
+		tw.order.PutUint16(buf, uint16(len(w.fields)))
+	}
+	values := make([][]byte, len(w.fields))
+	e := buf[tw.countSize():]
+	for i, f := range w.fields {
+		typeID, count, value := tw.fieldValue(w, f)
+		tw.order.PutUint16(e[0:], f.Tag().ID())
+		tw.order.PutUint16(e[2:], typeID)
+		if tw.big {
+			tw.order.PutUint64(e[4:], count)
+			e = e[12:]
+		} else {
+			tw.order.PutUint32(e[4:], uint32(count))
+			e = e[8:]
+		}
+		if off, ok := w.valOffs[f.Tag().ID()]; ok {
+			tw.putOffset(e, off)
+			values[i] = value
+		} else {
+			copy(e[:tw.offsetSize()], value)
+		}
+		e = e[tw.offsetSize():]
+	}
+	tw.putOffset(e, next)
+	if err := tw.write(buf); err != nil {
+		return err
+	}
+	for i, f := range w.fields {
+		if values[i] == nil {
+			continue
+		}
+		if err := tw.padTo(w.valOffs[f.Tag().ID()]); err != nil {
+			return err
+		}
+		if err := tw.write(values[i]); err != nil {
+			return err
+		}
+	}
+	for _, f := range w.fields {
+		for _, sub := range w.subs[f.Tag().ID()] {
+			if err := tw.writeIFD(sub, 0); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// newTIFFWriter returns a tiffWriter that lays out ifds starting at offset
+// base and writes them to dst, which is positioned at base.
+func newTIFFWriter(dst io.Writer, order binary.ByteOrder, big bool, base uint64, ifds []*writeIFD) (*tiffWriter, error) {
+	if len(ifds) == 0 {
+		return nil, fmt.Errorf("tiff: write: no IFDs to write")
+	}
+	tw := &tiffWriter{order: order, big: big, blockOffs: make(map[dataBlock]uint64, 1), w: dst}
+	for _, w := range ifds {
+		if err := tw.checkTypes(w); err != nil {
+			return nil, err
+		}
+	}
+	tw.pos, tw.written = base, base
+	for _, w := range ifds {
+		tw.layout(w)
+	}
+	for _, w := range ifds {
+		tw.layoutBlocks(w)
+	}
+	if !big && tw.pos > math.MaxUint32 {
+		return nil, fmt.Errorf("tiff: write: %d bytes do not fit in a file with 32 bit offsets", tw.pos)
+	}
+	return tw, nil
+}
+
+// checkTypes checks that the values of the fields of w and its sub-IFDs can be
+// written as they are.  Offsets are not checked since they are rewritten with
+// a type that suits the file.
+func (tw *tiffWriter) checkTypes(w *writeIFD) error {
+	for _, f := range w.fields {
+		id := f.Tag().ID()
+		for _, sub := range w.subs[id] {
+			if err := tw.checkTypes(sub); err != nil {
+				return err
+			}
+		}
+		if _, ok := w.blocks[id]; ok || w.subs[id] != nil {
+			continue
+		}
+		ft := f.Type()
+		if problem := checkFieldType(ft, tw.big); problem != "" {
+			return ErrInvalidType{ErrorContext{f.Offset(), id, -1}, ft.ID(), problem}
+		}
+		if n := uint64(len(f.Value().Bytes())); n < ft.Size()*f.Count() {
+			return fmt.Errorf("tiff: write: tag %d has %d bytes for %d values of type %s", id, n, f.Count(), ft.Name())
+		}
+	}
+	return nil
+}
+
+// writeBody writes ifds as a chain of IFDs followed by all of their data
+// blocks.  ifds must be the IFDs given to newTIFFWriter.
+func (tw *tiffWriter) writeBody(ifds []*writeIFD) error {
+	for i, w := range ifds {
+		var next uint64
+		if i+1 < len(ifds) {
+			next = ifds[i+1].offset
+		}
+		if err := tw.writeIFD(w, next); err != nil {
+			return err
+		}
+	}
+	for _, b := range tw.blocks {
+		if err := tw.padTo(tw.blockOffs[b]); err != nil {
+			return err
+		}
+		sr := io.NewSectionReader(b.src, int64(b.offset), int64(b.size))
+		var n int64
+		var err error
+		if b.swap > 1 {
+			n, err = copySwapped(tw.w, sr, b.swap)
+		} else {
+			n, err = io.Copy(tw.w, sr)
+		}
+		tw.written += uint64(n)
+		if err != nil {
+			return fmt.Errorf("tiff: write: unable to copy %d bytes of data from offset %d: %v", b.size, b.offset, err)
+		}
+		if uint64(n) != b.size {
+			return fmt.Errorf("tiff: write: data at offset %d is truncated (%d of %d bytes)", b.offset, n, b.size)
+		}
+	}
+	return nil
+}
+
+// writeTIFF writes ifds as the main IFD chain of a new file to dst in byte
+// order order.  Values of fields in the other byte order are converted, while
+// data blocks are copied as they are unless marked for swapping (see
+// ConvertByteOrder).
+func writeTIFF(dst io.Writer, order binary.ByteOrder, big bool, ifds []*writeIFD) error {
+	hdrSize := uint64(8)
+	if big {
+		hdrSize = 16
+	}
+	tw, err := newTIFFWriter(dst, order, big, hdrSize, ifds)
+	if err != nil {
+		return err
+	}
+
+	if _, err = dst.Write(tiffHeader(order, big, ifds[0].offset)); err != nil {
+		return err
+	}
+	return tw.writeBody(ifds)
+}
+
+// copySwapped copies src to dst, reversing the bytes of every size byte sample.
+// A trailing partial sample is copied as it is.
+func copySwapped(dst io.Writer, src io.Reader, size uint64) (int64, error) {
+	buf := make([]byte, 32*1024-32*1024%size)
+	var written int64
+	for {
+		n, err := io.ReadFull(src, buf)
+		for i := uint64(0); i+size <= uint64(n); i += size {
+			for j, k := i, i+size-1; j < k; j, k = j+1, k-1 {
+				buf[j], buf[k] = buf[k], buf[j]
+			}
+		}
+		if n > 0 {
+			m, werr := dst.Write(buf[:n])
+			written += int64(m)
+			if werr != nil {
+				return written, werr
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return written, nil
+		}
+		if err != nil {
+			return written, err
+		}
+	}
+}
+
+// tiffHeader returns the header of a file with the given byte order and offset
+// size whose first IFD is at offset first.
+func tiffHeader(order binary.ByteOrder, big bool, first uint64) []byte {
+	hdr := make([]byte, 8)
+	if big {
+		hdr = make([]byte, 16)
+	}
+	if order == binary.BigEndian {
+		copy(hdr, "MM")
+	} else {
+		copy(hdr, "II")
+	}
+	if big {
+		order.PutUint16(hdr[2:], 0x2B)
+		order.PutUint16(hdr[4:], 8)
+		order.PutUint64(hdr[8:], first)
+	} else {
+		order.PutUint16(hdr[2:], Version)
+		order.PutUint32(hdr[4:], uint32(first))
+	}
+	return hdr
+}
@@ -0,0 +1,65 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tiff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+)
+
+// cyclicSubIFDFile returns a 38 byte classic TIFF whose IFD 0 has a SubIFDs
+// entry pointing back at IFD 0 itself.
+func cyclicSubIFDFile() []byte {
+	var b bytes.Buffer
+	le := binary.LittleEndian
+	b.WriteString("II*\x00")
+	binary.Write(&b, le, uint32(8))
+	binary.Write(&b, le, uint16(2))
+	for _, e := range []struct {
+		tag, typ   uint16
+		count, val uint32
+	}{
+		{256, 3, 1, 1}, // ImageWidth
+		{330, 4, 1, 8}, // SubIFDs, at IFD 0
+	} {
+		binary.Write(&b, le, e.tag)
+		binary.Write(&b, le, e.typ)
+		binary.Write(&b, le, e.count)
+		binary.Write(&b, le, e.val)
+	}
+	binary.Write(&b, le, uint32(0))
+	return b.Bytes()
+}
+
+func TestWriteCyclicSubIFDs(t *testing.T) {
+	f := cyclicSubIFDFile()
+	for _, tc := range []struct {
+		name  string
+		write func(src ReadAtReadSeeker) error
+	}{
+		{"StripMetadata", func(src ReadAtReadSeeker) error { return StripMetadata(src, io.Discard, nil) }},
+		{"Compact", func(src ReadAtReadSeeker) error { return Compact(src, io.Discard) }},
+		{"ConvertToBigTIFF", func(src ReadAtReadSeeker) error { return ConvertToBigTIFF(src, io.Discard) }},
+	} {
+		if err := tc.write(bytes.NewReader(f)); err == nil {
+			t.Errorf("%s of a file with cyclic sub-IFDs succeeded, want an error", tc.name)
+		}
+	}
+}
+
+func TestKeepFieldOrderCyclicSubIFDs(t *testing.T) {
+	tf, err := Parse(bytes.NewReader(cyclicSubIFDFile()), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A plan that follows the cycle, as planIFD used to build.
+	w := &writeIFD{subs: make(map[uint16][]*writeIFD, 1)}
+	w.subs[330] = []*writeIFD{w}
+	if err = keepFieldOrder(tf, tf.IFDs()[0], w); err == nil {
+		t.Error("keepFieldOrder of a file with cyclic sub-IFDs succeeded, want an error")
+	}
+}
@@ -0,0 +1,44 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tiff
+
+import "bytes"
+
+// XMPTagID is the ID of the tag holding an XMP packet (tag 700).  The packet
+// is an XML document stored as BYTE (or UNDEFINED) values.
+const XMPTagID = 700
+
+// XMP returns the raw XMP packet stored in ifd.  If ifd has no XMP packet, nil
+// is returned.
+func XMP(ifd IFD) []byte {
+	if !ifd.HasField(XMPTagID) {
+		return nil
+	}
+	f := ifd.GetField(XMPTagID)
+	return f.Value().Bytes()[:f.Count()*f.Type().Size()]
+}
+
+// XMPString returns the XMP packet stored in ifd as a string.  Any trailing NUL
+// bytes (padding) are removed.  If ifd has no XMP packet, "" is returned.
+func XMPString(ifd IFD) string {
+	return string(bytes.TrimRight(XMP(ifd), "\x00"))
+}
+
+// SetXMP sets the XMP packet of the IFD at index idx of t.IFDs() to packet,
+// replacing any existing packet.  The file t was parsed from must be the one
+// accessed through rw.  The packet and a new copy of the IFD are appended to
+// the end of the file, leaving the rest of the file (including image data)
+// untouched.  Once SetXMP returns, t no longer reflects the contents of the
+// file and should be parsed again.
+func SetXMP(rw ReadWriteAtSeeker, t TIFF, idx int, packet []byte) error {
+	f := newField(XMPTagID, FTByte.ID(), uint32(len(packet)), packet, t.R().ByteOrder(), nil, nil)
+	return rewriteIFD(rw, t, idx, []Field{f}, nil)
+}
+
+// RemoveXMP removes the XMP packet from the IFD at index idx of t.IFDs().  As
+// with SetXMP, t should be parsed again afterwards.
+func RemoveXMP(rw ReadWriteAtSeeker, t TIFF, idx int) error {
+	return rewriteIFD(rw, t, idx, nil, []uint16{XMPTagID})
+}
@@ -0,0 +1,93 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tiff
+
+import (
+	"encoding/binary"
+	"fmt"
+	"unicode/utf16"
+)
+
+// The IDs of the tags Windows Explorer uses for the fields of the Details tab
+// of a file's properties.  Their values are UTF-16LE text, terminated by a NUL
+// character, stored as BYTE values.  XPKeywords holds keywords separated by
+// semicolons.
+const (
+	XPTitleTagID    = 40091
+	XPCommentTagID  = 40092
+	XPAuthorTagID   = 40093
+	XPKeywordsTagID = 40094
+	XPSubjectTagID  = 40095
+)
+
+func isXPTag(tagID uint16) bool {
+	return tagID >= XPTitleTagID && tagID <= XPSubjectTagID
+}
+
+// DecodeXP returns the text held by the value of an XP tag.  The value is
+// always little endian, whatever the byte order of the file.  Everything from
+// the first NUL character on is ignored.
+func DecodeXP(b []byte) string {
+	u := make([]uint16, 0, len(b)/2)
+	for ; len(b) >= 2; b = b[2:] {
+		c := binary.LittleEndian.Uint16(b)
+		if c == 0 {
+			break
+		}
+		u = append(u, c)
+	}
+	return string(utf16.Decode(u))
+}
+
+// EncodeXP returns s encoded as the value of an XP tag, including the
+// terminating NUL character.
+func EncodeXP(s string) []byte {
+	u := utf16.Encode([]rune(s))
+	b := make([]byte, 2*len(u)+2)
+	for i, c := range u {
+		binary.LittleEndian.PutUint16(b[2*i:], c)
+	}
+	return b
+}
+
+// XP returns the text of the XP tag tagID (such as XPTitleTagID) of ifd.  If
+// ifd has no such field, "" is returned along with a nil error.
+func XP(ifd IFD, tagID uint16) (string, error) {
+	if !isXPTag(tagID) {
+		return "", fmt.Errorf("tiff: tag %d is not an XP tag", tagID)
+	}
+	if !ifd.HasField(tagID) {
+		return "", nil
+	}
+	f := ifd.GetField(tagID)
+	switch f.Type().ID() {
+	case FTByte.ID(), FTUndefined.ID():
+	default:
+		return "", ErrInvalidFieldValue{tagID, fmt.Sprintf("unexpected field type %q", f.Type().Name())}
+	}
+	return DecodeXP(f.Value().Bytes()[:f.Count()]), nil
+}
+
+// SetXP sets the XP tag tagID of the IFD at index idx of t.IFDs() to s,
+// replacing any existing value.  The value and a new copy of the IFD are
+// appended to the end of the file behind rw (see SetXMP).  To change XP tags
+// along with other entries, pass the value returned by EncodeXP to
+// Editor.Set instead.
+func SetXP(rw ReadWriteAtSeeker, t TIFF, idx int, tagID uint16, s string) error {
+	if !isXPTag(tagID) {
+		return fmt.Errorf("tiff: tag %d is not an XP tag", tagID)
+	}
+	b := EncodeXP(s)
+	f := newField(tagID, FTByte.ID(), uint32(len(b)), b, t.R().ByteOrder(), nil, nil)
+	return rewriteIFD(rw, t, idx, []Field{f}, nil)
+}
+
+// RemoveXP removes the XP tag tagID from the IFD at index idx of t.IFDs().
+func RemoveXP(rw ReadWriteAtSeeker, t TIFF, idx int, tagID uint16) error {
+	if !isXPTag(tagID) {
+		return fmt.Errorf("tiff: tag %d is not an XP tag", tagID)
+	}
+	return rewriteIFD(rw, t, idx, nil, []uint16{tagID})
+}